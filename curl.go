@@ -17,6 +17,8 @@ import (
 	"time"
 )
 
+var errTokenExpired = errors.New("The token has expired")
+
 type Token struct {
 	Expire string `json:"expire"`
 	Token  string `json:"token"`
@@ -32,6 +34,9 @@ func main() {
 	}
 	u := getURL(flag.Arg(0))
 	token, err := getToken()
+	if err == errTokenExpired {
+		token, err = refresh(u, token)
+	}
 	if err != nil {
 		token, err = login(u)
 		if err != nil {
@@ -96,6 +101,29 @@ func login(u *url.URL) (*Token, error) {
 	if err != nil {
 		return nil, err
 	}
+	return saveToken(resp)
+}
+
+// refresh renews an expired token, which works until the max refresh duration of the server
+func refresh(u *url.URL, expired *Token) (*Token, error) {
+	refreshURL := fmt.Sprintf("%s://%s:%s/refresh_token", u.Scheme, u.Hostname(), u.Port())
+	req, err := http.NewRequest("GET", refreshURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Authorization", "Bearer "+expired.Token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("Refreshing the token failed with status %v", resp.StatusCode)
+	}
+	return saveToken(resp)
+}
+
+func saveToken(resp *http.Response) (*Token, error) {
 	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
@@ -125,7 +153,7 @@ func getToken() (*Token, error) {
 	}
 	expire, _ := time.Parse(time.RFC3339, token.Expire)
 	if expire.Before(time.Now()) {
-		return nil, errors.New("The token has expired")
+		return &token, errTokenExpired
 	}
 	return &token, nil
 }
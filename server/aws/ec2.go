@@ -1,14 +1,15 @@
 package aws
 
 import (
+	"context"
 	"errors"
-	"log"
 	"net/http"
 
 	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 )
 
 const (
@@ -20,11 +21,11 @@ const (
 func listEC2InstancesHandler(c *gin.Context) {
 	username := common.GetUserName(c)
 
-	log.Println(username + " lists EC2 Instances")
+	common.Logger(c).WithField("user", username).Info("Listing EC2 instances")
 
-	instances, err := listEC2InstancesByUsername(username)
+	instances, err := listEC2InstancesByUsername(c, username)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
 	} else {
 		c.JSON(http.StatusOK, instances)
 	}
@@ -34,12 +35,12 @@ func deleteEC2InstanceSnapshotHandler(c *gin.Context) {
 	username := common.GetUserName(c)
 	snapshotid := c.Param("snapshotid")
 	account := c.Param("account")
-	err := deleteSnapshot(snapshotid, account)
+	err := deleteSnapshot(c, snapshotid, account)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, common.ApiResponse{Message: genericAwsAPIError})
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, genericAwsAPIError))
 		return
 	}
-	log.Println(username + " deleted snapshot " + snapshotid)
+	common.Logger(c).WithFields(logrus.Fields{"user": username, "snapshot": snapshotid}).Info("Deleted snapshot")
 	c.JSON(http.StatusOK, common.ApiResponse{Message: "Der Snapshot wurde erfolgreich gelöscht"})
 }
 
@@ -47,69 +48,71 @@ func createEC2InstanceSnapshotHandler(c *gin.Context) {
 	username := common.GetUserName(c)
 	var data common.CreateSnapshotCommand
 	if c.BindJSON(&data) == nil {
-		snapshot, err := createSnapshot(data.VolumeId, data.InstanceId, data.Description, data.Account)
+		snapshot, err := createSnapshot(c, data.VolumeId, data.InstanceId, data.Description, data.Account)
 		if err != nil {
-			log.Println(err)
-			c.JSON(http.StatusBadRequest, common.ApiResponse{Message: genericAwsAPIError})
+			common.Logger(c).WithError(err).Error("Error creating snapshot")
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, genericAwsAPIError))
 			return
 		}
-		log.Println(username + " snapshots volume " + data.VolumeId + " in instance " + data.InstanceId)
+		common.Logger(c).WithFields(logrus.Fields{"user": username, "volume": data.VolumeId, "instance": data.InstanceId}).Info("Creating a snapshot of a volume")
 		c.JSON(http.StatusOK, common.SnapshotApiResponse{Message: "Der Snapshot wurde erfolgreich erstellt: " + data.Description, Snapshot: *snapshot})
 		return
 	}
-	c.JSON(http.StatusBadRequest, common.ApiResponse{Message: wrongAPIUsageError})
+	c.JSON(http.StatusBadRequest, common.ErrorResponse(c, wrongAPIUsageError))
 }
 
 func setEC2InstanceStateHandler(c *gin.Context) {
 	username := common.GetUserName(c)
 	instanceid := c.Param("instanceid")
 	state := c.Param("state")
-	log.Print(username + " requested instance " + instanceid + " to " + state)
-	instance, err := getInstance(instanceid, username)
+	common.Logger(c).WithFields(logrus.Fields{"user": username, "instance": instanceid, "state": state}).Info("Changing the state of an EC2 instance")
+	instance, err := getInstance(c, instanceid, username)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
 		return
 	}
 	account := instance.Account
 
+	// Waiting for the state of the instance takes a while, the client polls the job
+	var jobID string
 	switch state {
 	case "start":
-		res, err := startEC2Instance(instanceid, username, account)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
-			return
-		}
-		c.JSON(http.StatusOK, res)
+		jobID, err = common.StartJob(c, "ec2-start", func(ctx context.Context) (interface{}, error) {
+			return startEC2Instance(ctx, instanceid, username, account)
+		})
 	case "stop":
-		res, err := stopEC2Instance(instanceid, username, account)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
-			return
-		}
-		c.JSON(http.StatusOK, res)
+		jobID, err = common.StartJob(c, "ec2-stop", func(ctx context.Context) (interface{}, error) {
+			return stopEC2Instance(ctx, instanceid, username, account)
+		})
 	default:
-		c.JSON(http.StatusBadRequest, common.ApiResponse{Message: wrongAPIUsageError})
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, wrongAPIUsageError))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
+		return
 	}
+	c.JSON(http.StatusAccepted, common.JobApiResponse{Message: "Der Auftrag wurde gestartet.", JobID: jobID})
 }
 
-func deleteSnapshot(snapshotid string, account string) error {
-	svc, err := GetEC2ClientForAccount(account)
+func deleteSnapshot(ctx context.Context, snapshotid string, account string) error {
+	svc, err := GetEC2ClientForAccount(ctx, account)
 	if err != nil {
 		return err
 	}
 
 	_, err = svc.DeleteSnapshot(&ec2.DeleteSnapshotInput{SnapshotId: aws.String(snapshotid)})
 	if err != nil {
-		log.Println("Error creating snapshot (CreateSnapshot API call): " + err.Error())
+		common.Logger(ctx).WithError(err).Error("Error creating snapshot (CreateSnapshot API call)")
 		return err
 	}
 	return nil
 }
 
-func createSnapshot(volumeid string, instanceid string, description string, account string) (*common.Snapshot, error) {
-	tags, err := getTags(volumeid, account)
+func createSnapshot(ctx context.Context, volumeid string, instanceid string, description string, account string) (*common.Snapshot, error) {
+	tags, err := getTags(ctx, volumeid, account)
 	if err != nil {
-		log.Println("Error getting tags: " + err.Error())
+		common.Logger(ctx).WithError(err).Error("Error getting tags")
 		return nil, err
 	}
 	tags = addInstanceidTag(tags, instanceid)
@@ -124,24 +127,24 @@ func createSnapshot(volumeid string, instanceid string, description string, acco
 		},
 	}
 
-	svc, err := GetEC2ClientForAccount(account)
+	svc, err := GetEC2ClientForAccount(ctx, account)
 	if err != nil {
-		log.Println("Error getting EC2 client: " + err.Error())
+		common.Logger(ctx).WithError(err).Error("Error getting EC2 client")
 		return nil, err
 	}
 
 	snapshot, err := svc.CreateSnapshot(input)
 	if err != nil {
-		log.Println("Error creating snapshot (CreateSnapshot API call): " + err.Error())
+		common.Logger(ctx).WithError(err).Error("Error creating snapshot (CreateSnapshot API call)")
 		return nil, err
 	}
-	deviceName, _ := getDeviceName(*snapshot.VolumeId, account)
+	deviceName, _ := getDeviceName(ctx, *snapshot.VolumeId, account)
 	csnapshot := getSnapshotStruct(snapshot, *deviceName)
 	return &csnapshot, nil
 }
 
-func getInstance(instanceid string, username string) (*common.Instance, error) {
-	instances, err := listEC2InstancesByUsername(username)
+func getInstance(ctx context.Context, instanceid string, username string) (*common.Instance, error) {
+	instances, err := listEC2InstancesByUsername(ctx, username)
 	if err != nil {
 		return nil, err
 	}
@@ -150,26 +153,26 @@ func getInstance(instanceid string, username string) (*common.Instance, error) {
 			return &instance, nil
 		}
 	}
-	log.Println("Could not find an instance with id: " + instanceid)
+	common.Logger(ctx).WithField("instance", instanceid).Warn("Could not find the instance")
 	return nil, errors.New(ec2ListError)
 }
 
-func startEC2Instance(instanceid string, username string, account string) (*common.Instance, error) {
+func startEC2Instance(ctx context.Context, instanceid string, username string, account string) (*common.Instance, error) {
 	input := &ec2.StartInstancesInput{
 		InstanceIds: []*string{
 			aws.String(instanceid),
 		},
 	}
 
-	svc, err := GetEC2ClientForAccount(account)
+	svc, err := GetEC2ClientForAccount(ctx, account)
 	if err != nil {
-		log.Println("Error getting EC2 client: " + err.Error())
+		common.Logger(ctx).WithError(err).Error("Error getting EC2 client")
 		return nil, errors.New(ec2StartError)
 	}
 
 	_, err = svc.StartInstances(input)
 	if err != nil {
-		log.Println("Error starting EC2 instance (StartInstances API call): " + err.Error())
+		common.Logger(ctx).WithError(err).Error("Error starting EC2 instance (StartInstances API call)")
 		return nil, errors.New(ec2StartError)
 	}
 
@@ -185,32 +188,32 @@ func startEC2Instance(instanceid string, username string, account string) (*comm
 	}
 	err = svc.WaitUntilInstanceRunning(filters)
 	if err != nil {
-		log.Println("Error waiting for EC2 instance to start: " + err.Error())
+		common.Logger(ctx).WithError(err).Error("Error waiting for EC2 instance to start")
 		return nil, errors.New(ec2StartError)
 	}
-	result, err := getInstance(instanceid, username)
+	result, err := getInstance(ctx, instanceid, username)
 	if err != nil {
 		return nil, err
 	}
 	return result, nil
 }
 
-func stopEC2Instance(instanceid string, username string, account string) (*common.Instance, error) {
+func stopEC2Instance(ctx context.Context, instanceid string, username string, account string) (*common.Instance, error) {
 	input := &ec2.StopInstancesInput{
 		InstanceIds: []*string{
 			aws.String(instanceid),
 		},
 	}
 
-	svc, err := GetEC2ClientForAccount(account)
+	svc, err := GetEC2ClientForAccount(ctx, account)
 	if err != nil {
-		log.Println("Error getting EC2 client: " + err.Error())
+		common.Logger(ctx).WithError(err).Error("Error getting EC2 client")
 		return nil, errors.New(ec2StopError)
 	}
 
 	_, err = svc.StopInstances(input)
 	if err != nil {
-		log.Println("Error stopping EC2 instance (StopInstances API call): " + err.Error())
+		common.Logger(ctx).WithError(err).Error("Error stopping EC2 instance (StopInstances API call)")
 		return nil, errors.New(ec2StopError)
 	}
 
@@ -226,26 +229,26 @@ func stopEC2Instance(instanceid string, username string, account string) (*commo
 	}
 	err = svc.WaitUntilInstanceStopped(filters)
 	if err != nil {
-		log.Println("Error waiting for EC2 instance to stop: " + err.Error())
+		common.Logger(ctx).WithError(err).Error("Error waiting for EC2 instance to stop")
 		return nil, errors.New(ec2StopError)
 	}
 
-	result, err := getInstance(instanceid, username)
+	result, err := getInstance(ctx, instanceid, username)
 	if err != nil {
 		return nil, err
 	}
 	return result, nil
 }
 
-func listEC2InstancesByUsername(username string) (*common.InstanceListResponse, error) {
+func listEC2InstancesByUsername(ctx context.Context, username string) (*common.InstanceListResponse, error) {
 	result := common.InstanceListResponse{
 		Instances: []common.Instance{},
 	}
-	nonprodInstances, err := listEC2InstancesByUsernameForAccount(username, accountNonProd)
+	nonprodInstances, err := listEC2InstancesByUsernameForAccount(ctx, username, accountNonProd)
 	if err != nil {
 		return nil, err
 	}
-	prodInstances, err := listEC2InstancesByUsernameForAccount(username, accountProd)
+	prodInstances, err := listEC2InstancesByUsernameForAccount(ctx, username, accountProd)
 	if err != nil {
 		return nil, err
 	}
@@ -256,7 +259,7 @@ func listEC2InstancesByUsername(username string) (*common.InstanceListResponse,
 	return &result, nil
 }
 
-func listEC2InstancesByUsernameForAccount(username string, account string) ([]common.Instance, error) {
+func listEC2InstancesByUsernameForAccount(ctx context.Context, username string, account string) ([]common.Instance, error) {
 	instances := []common.Instance{}
 	filters := &ec2.DescribeInstancesInput{
 		Filters: []*ec2.Filter{
@@ -269,29 +272,29 @@ func listEC2InstancesByUsernameForAccount(username string, account string) ([]co
 		},
 	}
 
-	svc, err := GetEC2ClientForAccount(account)
+	svc, err := GetEC2ClientForAccount(ctx, account)
 	if err != nil {
 		return nil, errors.New(ec2ListError)
 	}
 
 	result, err := svc.DescribeInstances(filters)
 	if err != nil {
-		log.Print("Unable to list instances (DescribeInstances API call): " + err.Error())
+		common.Logger(ctx).WithError(err).Error("Unable to list instances (DescribeInstances API call)")
 		return nil, errors.New(ec2ListError)
 	}
 	for _, reservation := range result.Reservations {
 		for _, instance := range reservation.Instances {
-			snapshots, _ := listSnapshots(instance, account)
+			snapshots, _ := listSnapshots(ctx, instance, account)
 			volumes := listVolumes(instance)
-			instances = append(instances, getInstanceStruct(instance, account, snapshots, volumes))
+			instances = append(instances, getInstanceStruct(ctx, instance, account, snapshots, volumes))
 		}
 	}
 
 	return instances, nil
 }
 
-func listSnapshots(instance *ec2.Instance, account string) ([]common.Snapshot, error) {
-	svc, err := GetEC2ClientForAccount(account)
+func listSnapshots(ctx context.Context, instance *ec2.Instance, account string) ([]common.Snapshot, error) {
+	svc, err := GetEC2ClientForAccount(ctx, account)
 	if err != nil {
 		return nil, errors.New(ec2ListError)
 	}
@@ -313,7 +316,7 @@ func listSnapshots(instance *ec2.Instance, account string) ([]common.Snapshot, e
 	}
 	snapshots := []common.Snapshot{}
 	for _, snapshot := range snapshotsOutput.Snapshots {
-		deviceName, _ := getDeviceName(*snapshot.VolumeId, account)
+		deviceName, _ := getDeviceName(ctx, *snapshot.VolumeId, account)
 		snapshots = append(snapshots, getSnapshotStruct(snapshot, *deviceName))
 	}
 	return snapshots, nil
@@ -334,22 +337,22 @@ func getVolumeStruct(volume *ec2.InstanceBlockDeviceMapping) common.Volume {
 	}
 }
 
-func getDeviceName(volumeId string, account string) (*string, error) {
+func getDeviceName(ctx context.Context, volumeId string, account string) (*string, error) {
 	input := &ec2.DescribeVolumesInput{
 		VolumeIds: []*string{
 			aws.String(volumeId),
 		},
 	}
 
-	svc, err := GetEC2ClientForAccount(account)
+	svc, err := GetEC2ClientForAccount(ctx, account)
 	if err != nil {
-		log.Println("Error getting EC2 client: " + err.Error())
+		common.Logger(ctx).WithError(err).Error("Error getting EC2 client")
 		return nil, errors.New(ec2StartError)
 	}
 
 	describeVolumesOutput, err := svc.DescribeVolumes(input)
 	if err != nil {
-		log.Println("Error getting EC2 volumes (DescribeVolumes API call): " + err.Error())
+		common.Logger(ctx).WithError(err).Error("Error getting EC2 volumes (DescribeVolumes API call)")
 		return nil, errors.New(ec2StartError)
 	}
 	return describeVolumesOutput.Volumes[0].Attachments[0].Device, nil
@@ -375,7 +378,7 @@ func addInstanceidTag(tags []*ec2.Tag, instanceid string) []*ec2.Tag {
 	return tags
 }
 
-func getTags(resourceid string, account string) ([]*ec2.Tag, error) {
+func getTags(ctx context.Context, resourceid string, account string) ([]*ec2.Tag, error) {
 	input := &ec2.DescribeTagsInput{
 		Filters: []*ec2.Filter{
 			{
@@ -387,15 +390,15 @@ func getTags(resourceid string, account string) ([]*ec2.Tag, error) {
 		},
 	}
 
-	svc, err := GetEC2ClientForAccount(account)
+	svc, err := GetEC2ClientForAccount(ctx, account)
 	if err != nil {
-		log.Println("Error getting EC2 client: " + err.Error())
+		common.Logger(ctx).WithError(err).Error("Error getting EC2 client")
 		return nil, err
 	}
 
 	describetagsoutput, err := svc.DescribeTags(input)
 	if err != nil {
-		log.Println("Error getting EC2 tags (DescribeTags API call): " + err.Error())
+		common.Logger(ctx).WithError(err).Error("Error getting EC2 tags (DescribeTags API call)")
 		return nil, err
 	}
 	tags := []*ec2.Tag{}
@@ -405,22 +408,22 @@ func getTags(resourceid string, account string) ([]*ec2.Tag, error) {
 	return tags, nil
 }
 
-func getImageName(imageId string, account string) (*string, error) {
+func getImageName(ctx context.Context, imageId string, account string) (*string, error) {
 	input := &ec2.DescribeImagesInput{
 		ImageIds: []*string{
 			aws.String(imageId),
 		},
 	}
 
-	svc, err := GetEC2ClientForAccount(account)
+	svc, err := GetEC2ClientForAccount(ctx, account)
 	if err != nil {
-		log.Println("Error getting EC2 client: " + err.Error())
+		common.Logger(ctx).WithError(err).Error("Error getting EC2 client")
 		return nil, err
 	}
 
 	describeImagesOutput, err := svc.DescribeImages(input)
 	if err != nil {
-		log.Println("Error getting EC2 image name (DescribeImages API call): " + err.Error())
+		common.Logger(ctx).WithError(err).Error("Error getting EC2 image name (DescribeImages API call)")
 		return nil, err
 	}
 	if len(describeImagesOutput.Images) == 0 {
@@ -431,7 +434,7 @@ func getImageName(imageId string, account string) (*string, error) {
 	return describeImagesOutput.Images[0].Name, nil
 }
 
-func getInstanceStruct(instance *ec2.Instance, account string, snapshots []common.Snapshot, volumes []common.Volume) common.Instance {
+func getInstanceStruct(ctx context.Context, instance *ec2.Instance, account string, snapshots []common.Snapshot, volumes []common.Volume) common.Instance {
 	var name string
 	for _, tag := range instance.Tags {
 		if *tag.Key == "Name" {
@@ -439,7 +442,7 @@ func getInstanceStruct(instance *ec2.Instance, account string, snapshots []commo
 			break
 		}
 	}
-	imageName, _ := getImageName(*instance.ImageId, account)
+	imageName, _ := getImageName(ctx, *instance.ImageId, account)
 
 	return common.Instance{
 		Name:             name,
@@ -1,8 +1,8 @@
 package aws
 
 import (
+	"context"
 	"errors"
-	"log"
 	"regexp"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -29,7 +29,7 @@ type StatementEntry struct {
 	Resource string
 }
 
-func validateNewS3User(username string, bucketname string, newuser string, stage string) error {
+func validateNewS3User(ctx context.Context, username string, bucketname string, newuser string, stage string) error {
 	if len(username) == 0 {
 		return errors.New("Benutzername muss angegeben werden")
 	}
@@ -49,25 +49,25 @@ func validateNewS3User(username string, bucketname string, newuser string, stage
 		return errors.New("Benutzername kann nur alphanumerische Zeichen und Bindestriche enthalten")
 	}
 
-	svc, err := GetIAMClient(stage)
+	svc, err := GetIAMClient(ctx, stage)
 	if err != nil {
 		return err
 	}
 	result, err := svc.ListUsers(nil)
 	if err != nil {
-		log.Print("Error while trying to create a new user (ListUsers call): " + err.Error())
+		common.Logger(ctx).WithError(err).Error("Error while trying to create a new user (ListUsers call)")
 		return errors.New(genericUserCreationError)
 	}
 	// Loop over existing users
 	for _, u := range result.Users {
 		if *u.UserName == newuser {
-			log.Printf("Error, user %v already exists", newuser)
+			common.Logger(ctx).WithField("new_user", newuser).Warn("S3 user already exists")
 			return errors.New("Fehler: IAM-Benutzer " + newuser + " existiert bereits")
 		}
 	}
 
 	// Make sure the user is allowed to create new IAM users for this bucket
-	myBuckets, _ := listS3BucketByUsername(username)
+	myBuckets, _ := listS3BucketByUsername(ctx, username)
 	for _, mybucket := range myBuckets.Buckets {
 		if bucketname == mybucket.Name {
 			// Everything OK
@@ -77,10 +77,10 @@ func validateNewS3User(username string, bucketname string, newuser string, stage
 	return errors.New("Es gibt diesen Bucket " + bucketname + " nicht. Oder du darfst für den Bucket keine Benutzer erstellen")
 }
 
-func createNewS3User(bucketname string, s3username string, stage string, isReadonly bool) (*common.S3CredentialsResponse, error) {
+func createNewS3User(ctx context.Context, bucketname string, s3username string, stage string, isReadonly bool) (*common.S3CredentialsResponse, error) {
 	generatedName := bucketname + "-" + s3username
 
-	svc, err := GetIAMClient(stage)
+	svc, err := GetIAMClient(ctx, stage)
 	if err != nil {
 		return nil, err
 	}
@@ -101,7 +101,7 @@ func createNewS3User(bucketname string, s3username string, stage string, isReado
 		})
 
 		if err != nil {
-			log.Println("CreateUser error in createNewS3User: " + err.Error())
+			common.Logger(ctx).WithError(err).Error("CreateUser error in createNewS3User")
 			return nil, errors.New(genericUserCreationError)
 		}
 
@@ -112,7 +112,7 @@ func createNewS3User(bucketname string, s3username string, stage string, isReado
 		cred.AccessKeyID = *result.AccessKey.AccessKeyId
 		cred.SecretKey = *result.AccessKey.SecretAccessKey
 	} else {
-		log.Println("Failed to create used: ", err.Error())
+		common.Logger(ctx).WithError(err).Error("Failed to create used")
 		return nil, errors.New(genericUserCreationError)
 	}
 
@@ -123,17 +123,17 @@ func createNewS3User(bucketname string, s3username string, stage string, isReado
 		policy += bucketWritePolicy
 	}
 
-	err = attachIAMPolicyToUser(policy, generatedName, stage)
+	err = attachIAMPolicyToUser(ctx, policy, generatedName, stage)
 	if err != nil {
-		log.Print("Error while calling attachIAMPolicyToUser: " + err.Error())
+		common.Logger(ctx).WithError(err).Error("Error while calling attachIAMPolicyToUser")
 		return &cred, errors.New(genericUserCreationError)
 	}
 
 	return &cred, nil
 }
 
-func attachIAMPolicyToUser(policyName string, username string, stage string) error {
-	svc, err := GetIAMClient(stage)
+func attachIAMPolicyToUser(ctx context.Context, policyName string, username string, stage string) error {
+	svc, err := GetIAMClient(ctx, stage)
 	if err != nil {
 		return err
 	}
@@ -142,7 +142,7 @@ func attachIAMPolicyToUser(policyName string, username string, stage string) err
 	result, err := svc.GetUser(nil)
 	var accountNumber string
 	if err != nil {
-		return errors.New("GetUser error in attachIAMPolicyToUser() while trying to determine account ID: " + err.Error())
+		return errors.New("GetUser error in attachIAMPolicyToUser(ctx) while trying to determine account ID: " + err.Error())
 	}
 	re := regexp.MustCompile("[0-9]+")
 	accountNumber = re.FindString(*result.User.Arn)
@@ -1,16 +1,13 @@
 package aws
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
-	"log"
 	"net/http"
-	"os"
 	"regexp"
 	"strings"
 
-	"strconv"
-
 	"fmt"
 
 	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
@@ -18,6 +15,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/iam"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 )
 
 const (
@@ -25,13 +23,16 @@ const (
 	s3ListError   = "Die Buckets können nicht aufgelistet werden. Bitte erstelle ein Ticket"
 )
 
-func validateNewS3Bucket(projectname string, bucketname string, billing string, stage string) error {
+func validateNewS3Bucket(ctx context.Context, projectname string, bucketname string, billing string, stage string) error {
 	if len(stage) == 0 {
 		return errors.New("Umgebung muss definiert werden")
 	}
 	if len(billing) == 0 {
 		return errors.New("Verrechnungsnummer muss definiert sein")
 	}
+	if err := common.ValidateBilling(ctx, billing); err != nil {
+		return err
+	}
 	if len(bucketname) == 0 {
 		return errors.New("Bucketname muss definiert sein")
 	}
@@ -48,20 +49,20 @@ func validateNewS3Bucket(projectname string, bucketname string, billing string,
 		return errors.New("Bucketname kann nur alphanumerische Zeichen und Bindestriche enthalten")
 	}
 
-	svc, err := GetS3Client(stage)
+	svc, err := GetS3Client(ctx, stage)
 	if err != nil {
 		return err
 	}
 
 	result, err := svc.ListBuckets(nil)
 	if err != nil {
-		log.Print("Error while trying to validate new bucket (ListBucket call): " + err.Error())
+		common.Logger(ctx).WithError(err).Error("Error while trying to validate new bucket (ListBucket call)")
 		return errors.New(s3CreateError)
 	}
 
 	for _, b := range result.Buckets {
 		if *b.Name == bucketname {
-			log.Print("Error, bucket " + bucketname + "already exists")
+			common.Logger(ctx).WithField("bucket", bucketname).Warn("Bucket already exists")
 			return errors.New("Fehler: Bucket " + bucketname + " existiert bereits")
 		}
 	}
@@ -73,11 +74,11 @@ func validateNewS3Bucket(projectname string, bucketname string, billing string,
 func listS3BucketsHandler(c *gin.Context) {
 	username := common.GetUserName(c)
 
-	log.Print(username + " lists S3 buckets")
+	common.Logger(c).WithField("user", username).Info("Listing S3 buckets")
 
-	myBuckets, err := listS3BucketByUsername(username)
+	myBuckets, err := listS3BucketByUsername(c, username)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
 	} else {
 		c.JSON(http.StatusOK, myBuckets)
 	}
@@ -88,21 +89,21 @@ func newS3BucketHandler(c *gin.Context) {
 
 	var data common.NewS3BucketCommand
 	if c.BindJSON(&data) == nil {
-		newbucketname, err := generateS3Bucketname(data.BucketName, data.Stage)
+		newbucketname, err := generateS3Bucketname(c, data.BucketName, data.Stage)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
 			return
 		}
 
-		if err := validateNewS3Bucket(data.Project, newbucketname, data.Billing, data.Stage); err != nil {
-			c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
+		if err := validateNewS3Bucket(c, data.Project, newbucketname, data.Billing, data.Stage); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
 			return
 		}
 
-		log.Print("Creating new bucket " + newbucketname + " for " + username)
+		common.Logger(c).WithFields(logrus.Fields{"bucket": newbucketname, "user": username}).Info("Creating new bucket")
 
-		if err := createNewS3Bucket(username, data.Project, newbucketname, data.Billing, data.Stage); err != nil {
-			c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
+		if err := createNewS3Bucket(c, username, data.Project, newbucketname, data.Billing, data.Stage); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
 		} else {
 			c.JSON(http.StatusOK, common.ApiResponse{
 				Message: "Es wurde ein neuer S3 Bucket erstellt: " + newbucketname +
@@ -110,7 +111,7 @@ func newS3BucketHandler(c *gin.Context) {
 			})
 		}
 	} else {
-		c.JSON(http.StatusBadRequest, common.ApiResponse{Message: wrongAPIUsageError})
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, wrongAPIUsageError))
 	}
 }
 
@@ -127,28 +128,28 @@ func newS3UserHandler(c *gin.Context) {
 		} else {
 			stage = stageProd
 		}
-		if err := validateNewS3User(username, bucketName, data.UserName, stage); err != nil {
-			c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
+		if err := validateNewS3User(c, username, bucketName, data.UserName, stage); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
 			return
 		}
 
-		log.Print(username + " creates a new user (" + data.UserName + ") for " + bucketName + " , readonly: " + strconv.FormatBool(data.IsReadonly))
+		common.Logger(c).WithFields(logrus.Fields{"user": username, "new_user": data.UserName, "bucket": bucketName, "readonly": data.IsReadonly}).Info("Creating a new S3 user")
 
-		credentials, err := createNewS3User(bucketName, data.UserName, stage, data.IsReadonly)
+		credentials, err := createNewS3User(c, bucketName, data.UserName, stage, data.IsReadonly)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
 		} else {
 			c.JSON(http.StatusOK, common.ApiResponse{
 				Message: fmt.Sprintf("Der Benutzer (%v) wurde erstellt. Access Key ID: %v - Secret Access Key: %v",
 					credentials.Username, credentials.AccessKeyID, credentials.SecretKey)})
 		}
 	} else {
-		c.JSON(http.StatusBadRequest, common.ApiResponse{Message: wrongAPIUsageError})
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, wrongAPIUsageError))
 	}
 }
 
-func createNewS3Bucket(username string, projectname string, bucketname string, billing string, stage string) error {
-	svc, err := GetS3Client(stage)
+func createNewS3Bucket(ctx context.Context, username string, projectname string, bucketname string, billing string, stage string) error {
+	svc, err := GetS3Client(ctx, stage)
 	if err != nil {
 		return err
 	}
@@ -157,18 +158,18 @@ func createNewS3Bucket(username string, projectname string, bucketname string, b
 		Bucket: aws.String(bucketname),
 	})
 	if err != nil {
-		log.Print("Error on CreateBucket call (username=" + username + ", bucketname=" + bucketname + "): " + err.Error())
+		common.Logger(ctx).WithError(err).WithFields(logrus.Fields{"bucket": bucketname, "user": username}).Error("Error on CreateBucket call")
 		return errors.New(s3CreateError)
 	}
 
 	// Wait until bucket is created before finishing
-	log.Print("Waiting for bucket " + bucketname + " to be created...")
+	common.Logger(ctx).WithField("bucket", bucketname).Info("Waiting for bucket to be created")
 	err = svc.WaitUntilBucketExists(&s3.HeadBucketInput{
 		Bucket: aws.String(bucketname),
 	})
 
 	if err != nil {
-		log.Print("Error when creating S3 bucket in WaitUntilBucketExists: " + err.Error())
+		common.Logger(ctx).WithError(err).Error("Error when creating S3 bucket in WaitUntilBucketExists")
 		return errors.New(s3CreateError)
 	}
 
@@ -183,14 +184,14 @@ func createNewS3Bucket(username string, projectname string, bucketname string, b
 			},
 		}})
 	if err != nil {
-		log.Print("Tagging bucket " + bucketname + " failed: " + err.Error())
+		common.Logger(ctx).WithError(err).WithField("bucket", bucketname).Error("Tagging bucket failed")
 		return errors.New(s3CreateError)
 	}
 
-	log.Print("Creating IAM policies for bucket " + bucketname + "...")
+	common.Logger(ctx).WithField("bucket", bucketname).Info("Creating IAM policies for bucket")
 
 	// Create a IAM service client.
-	iamSvc, err := GetIAMClient(stage)
+	iamSvc, err := GetIAMClient(ctx, stage)
 	if err != nil {
 		return err
 	}
@@ -246,7 +247,7 @@ func createNewS3Bucket(username string, projectname string, bucketname string, b
 	// Read policy
 	b, err := json.Marshal(&readPolicy)
 	if err != nil {
-		log.Print("Error marshaling readPolicy: " + err.Error())
+		common.Logger(ctx).WithError(err).Error("Error marshaling readPolicy")
 		return errors.New(s3CreateError)
 	}
 
@@ -255,14 +256,14 @@ func createNewS3Bucket(username string, projectname string, bucketname string, b
 		PolicyName:     aws.String(bucketname + bucketReadPolicy),
 	})
 	if err != nil {
-		log.Print("Error CreatePolicy for BucketReadPolicy failed: " + err.Error())
+		common.Logger(ctx).WithError(err).Error("Error CreatePolicy for BucketReadPolicy failed")
 		return errors.New(s3CreateError)
 	}
 
 	// Write policy
 	c, err := json.Marshal(&writePolicy)
 	if err != nil {
-		log.Print("Error marshaling writePolicy: " + err.Error())
+		common.Logger(ctx).WithError(err).Error("Error marshaling writePolicy")
 		return errors.New(s3CreateError)
 	}
 
@@ -271,20 +272,20 @@ func createNewS3Bucket(username string, projectname string, bucketname string, b
 		PolicyName:     aws.String(bucketname + bucketWritePolicy),
 	})
 	if err != nil {
-		log.Print("Error CreatePolicy for BucketWritePolicy failed: " + err.Error())
+		common.Logger(ctx).WithError(err).Error("Error CreatePolicy for BucketWritePolicy failed")
 		return errors.New(s3CreateError)
 	}
 
-	log.Print("Bucket " + bucketname + " and IAM policies successfully created")
+	common.Logger(ctx).WithField("bucket", bucketname).Info("Bucket and IAM policies successfully created")
 
 	return nil
 }
 
-func generateS3Bucketname(bucketname string, stage string) (string, error) {
+func generateS3Bucketname(ctx context.Context, bucketname string, stage string) (string, error) {
 	// Generate bucketname: <prefix>-<bucketname>-<stage_suffix>
-	bucketPrefix := os.Getenv("AWS_S3_BUCKET_PREFIX")
+	bucketPrefix := config.S3BucketPrefix
 
-	account, err := getAccountForStage(stage)
+	account, err := getAccountForStage(ctx, stage)
 	if err != nil {
 		return "", err
 	}
@@ -292,15 +293,15 @@ func generateS3Bucketname(bucketname string, stage string) (string, error) {
 	return strings.ToLower(bucketPrefix + "-" + bucketname + "-" + account), nil
 }
 
-func listS3BucketByUsername(username string) (*common.BucketListResponse, error) {
+func listS3BucketByUsername(ctx context.Context, username string) (*common.BucketListResponse, error) {
 	result := common.BucketListResponse{
 		Buckets: []common.Bucket{},
 	}
-	nonProdBuckets, err := listS3BucketByUsernameForAccount(username, accountNonProd)
+	nonProdBuckets, err := listS3BucketByUsernameForAccount(ctx, username, accountNonProd)
 	if err != nil {
 		return nil, err
 	}
-	prodBuckets, err := listS3BucketByUsernameForAccount(username, accountProd)
+	prodBuckets, err := listS3BucketByUsernameForAccount(ctx, username, accountProd)
 	if err != nil {
 		return nil, err
 	}
@@ -311,7 +312,7 @@ func listS3BucketByUsername(username string) (*common.BucketListResponse, error)
 	return &result, nil
 }
 
-func listS3BucketByUsernameForAccount(username string, account string) ([]common.Bucket, error) {
+func listS3BucketByUsernameForAccount(ctx context.Context, username string, account string) ([]common.Bucket, error) {
 	var stage string
 	if account == accountProd {
 		stage = stageProd
@@ -319,14 +320,14 @@ func listS3BucketByUsernameForAccount(username string, account string) ([]common
 		stage = stageDev
 	}
 
-	svc, err := GetS3Client(stage)
+	svc, err := GetS3Client(ctx, stage)
 	if err != nil {
 		return nil, err
 	}
 
 	result, err := svc.ListBuckets(nil)
 	if err != nil {
-		log.Print("Unable to list buckets (ListBuckets API call): " + err.Error())
+		common.Logger(ctx).WithError(err).Error("Unable to list buckets (ListBuckets API call)")
 		return nil, errors.New(s3ListError)
 	}
 
@@ -338,7 +339,7 @@ func listS3BucketByUsernameForAccount(username string, account string) ([]common
 		}
 		result, err := svc.GetBucketTagging(taggingParams)
 		if err != nil {
-			log.Print("Unable to get tags for bucket " + *b.Name + ", username " + username + ": " + err.Error())
+			common.Logger(ctx).WithError(err).WithFields(logrus.Fields{"bucket": *b.Name, "user": username}).Error("Unable to get tags for bucket")
 			// Something went wrong with this bucket (probably no tags). Don't fail, just skip this bucket
 			continue
 		}
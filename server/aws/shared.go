@@ -1,14 +1,14 @@
 package aws
 
 import (
-	"os"
-
-	"log"
+	"context"
 
 	"errors"
 
+	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/iam"
@@ -39,7 +39,13 @@ const (
 	bucketWritePolicy = "-BucketWritePolicy"
 )
 
-func RegisterRoutes(r *gin.RouterGroup) {
+// config is the AWS section of the configuration, set by RegisterRoutes
+var config common.AwsConfig
+
+// RegisterRoutes registers the routes for AWS
+func RegisterRoutes(r *gin.RouterGroup, cfg common.AwsConfig) {
+	config = cfg
+
 	r.GET("/aws/s3", listS3BucketsHandler)
 	r.POST("/aws/s3", newS3BucketHandler)
 	r.POST("/aws/s3/:bucketname/user", newS3UserHandler)
@@ -50,20 +56,20 @@ func RegisterRoutes(r *gin.RouterGroup) {
 	r.POST("/aws/ec2/:instanceid/:state", setEC2InstanceStateHandler)
 }
 
-func GetEC2Client(stage string) (*ec2.EC2, error) {
-	account, err := getAccountForStage(stage)
+func GetEC2Client(ctx context.Context, stage string) (*ec2.EC2, error) {
+	account, err := getAccountForStage(ctx, stage)
 	if err != nil {
 		return nil, err
 	}
 
-	sess, err := getAwsSession(account)
+	sess, err := getAwsSession(ctx, account)
 	if err != nil {
 		return nil, err
 	}
 	return ec2.New(sess), nil
 }
 
-func GetEC2ClientForAccount(account string) (*ec2.EC2, error) {
+func GetEC2ClientForAccount(ctx context.Context, account string) (*ec2.EC2, error) {
 	var stage string
 	if account == accountProd {
 		stage = stageProd
@@ -71,76 +77,71 @@ func GetEC2ClientForAccount(account string) (*ec2.EC2, error) {
 		stage = stageDev
 	}
 
-	svc, err := GetEC2Client(stage)
+	svc, err := GetEC2Client(ctx, stage)
 	if err != nil {
-		log.Println("Error getting EC2 client: " + err.Error())
+		common.Logger(ctx).WithError(err).Error("Error getting EC2 client")
 		return nil, err
 	}
 	return svc, nil
 }
 
-func GetS3Client(stage string) (*s3.S3, error) {
-	account, err := getAccountForStage(stage)
+func GetS3Client(ctx context.Context, stage string) (*s3.S3, error) {
+	account, err := getAccountForStage(ctx, stage)
 	if err != nil {
 		return nil, err
 	}
 
-	sess, err := getAwsSession(account)
+	sess, err := getAwsSession(ctx, account)
 	if err != nil {
 		return nil, err
 	}
 	return s3.New(sess), nil
 }
 
-func GetIAMClient(stage string) (*iam.IAM, error) {
-	account, err := getAccountForStage(stage)
+func GetIAMClient(ctx context.Context, stage string) (*iam.IAM, error) {
+	account, err := getAccountForStage(ctx, stage)
 	if err != nil {
 		return nil, err
 	}
 
-	sess, err := getAwsSession(account)
+	sess, err := getAwsSession(ctx, account)
 	if err != nil {
 		return nil, err
 	}
 	return iam.New(sess), nil
 }
 
-func getAwsSession(account string) (*session.Session, error) {
-	// Validate necessary env variables
-	region := os.Getenv("AWS_REGION")
-	if len(region) == 0 {
-		log.Fatal("Env variable 'AWS_REGION' must be specified")
-	}
-	bucketPrefix := os.Getenv("AWS_S3_BUCKET_PREFIX")
-	if len(bucketPrefix) == 0 {
-		log.Fatal("Env variable 'AWS_S3_BUCKET_PREFIX' must be specified")
-	}
-
+func getAwsSession(ctx context.Context, account string) (*session.Session, error) {
 	// Create AWS session based on account
 	var accessKeyID string
 	var accessSecret string
 
 	switch account {
 	case accountProd:
-		accessKeyID = os.Getenv("AWS_PROD_ACCESS_KEY_ID")
-		accessSecret = os.Getenv("AWS_PROD_SECRET_ACCESS_KEY")
+		accessKeyID = config.Prod.AccessKeyID
+		accessSecret = config.Prod.SecretAccessKey
 	case accountNonProd:
-		accessKeyID = os.Getenv("AWS_NONPROD_ACCESS_KEY_ID")
-		accessSecret = os.Getenv("AWS_NONPROD_SECRET_ACCESS_KEY")
+		accessKeyID = config.NonProd.AccessKeyID
+		accessSecret = config.NonProd.SecretAccessKey
 	default:
-		log.Println("Invalid account: " + account)
+		common.Logger(ctx).WithField("account", account).Error("Invalid account")
 	}
 
 	sess, err := session.NewSession(&aws.Config{
 		Credentials: credentials.NewStaticCredentials(accessKeyID, accessSecret, ""),
-		Region:      aws.String(region)},
+		Region:      aws.String(config.Region)},
 	)
 
 	if err != nil {
-		log.Println("Error creating aws session: ", err.Error())
+		common.Logger(ctx).WithError(err).Error("Error creating aws session")
 		return nil, errors.New(genericAwsAPIError)
 	}
 
+	// Pass the request id on to AWS
+	sess.Handlers.Build.PushBack(func(r *request.Request) {
+		common.SetRequestIDHeader(ctx, r.HTTPRequest)
+	})
+
 	return sess, nil
 }
 
@@ -148,14 +149,14 @@ func getAwsSession(account string) (*session.Session, error) {
 // the technical AWS account
 // dev, test, int = NONPROD
 // prod = PROD
-func getAccountForStage(stage string) (string, error) {
+func getAccountForStage(ctx context.Context, stage string) (string, error) {
 	switch stage {
 	case stageDev, stageTest, stageInt:
 		return accountNonProd, nil
 	case stageProd:
 		return accountProd, nil
 	default:
-		log.Println("Could not map to account, invalid stage: " + stage)
+		common.Logger(ctx).WithField("stage", stage).Warn("Could not map to account, invalid stage")
 		return "", errors.New(wrongAPIUsageError)
 	}
 }
@@ -15,6 +15,11 @@ type NewVolumeCommand struct {
 	Technology string `json:"technology"`
 }
 
+type DeleteVolumeCommand struct {
+	ProjectName
+	PvcName string `json:"pvcName"`
+}
+
 type FixVolumeCommand struct {
 	ProjectName
 }
@@ -27,14 +32,24 @@ type GrowVolumeCommand struct {
 
 type NewProjectCommand struct {
 	ProjectName
-	Billing string `json:"billing"`
-	MegaId  string `json:"megaId"`
+	Billing  string `json:"billing"`
+	MegaId   string `json:"megaId"`
+	Template string `json:"template"`
+}
+
+type ProjectTemplateInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
 }
 
 type NewTestProjectCommand struct {
 	ProjectName
 }
 
+type ExtendTestProjectCommand struct {
+	ProjectName
+}
+
 type EditBillingDataCommand struct {
 	ProjectName
 	Billing string `json:"billing"`
@@ -54,14 +69,92 @@ type EditSematextPlanCommand struct {
 
 type EditQuotasCommand struct {
 	ProjectName
-	CPU    string `json:"cpu"`
-	Memory string `json:"memory"`
+	CPU       string            `json:"cpu"`
+	Memory    string            `json:"memory"`
+	Resources map[string]string `json:"resources"`
+}
+
+type DecideQuotaRequestCommand struct {
+	Reason string `json:"reason"`
+}
+
+type QuotaRequest struct {
+	ID            string            `json:"id"`
+	Cluster       string            `json:"cluster"`
+	Project       string            `json:"project"`
+	Requester     string            `json:"requester"`
+	RequesterMail string            `json:"requesterMail"`
+	Resources     map[string]string `json:"resources"`
+	Status        string            `json:"status"`
+	Reason        string            `json:"reason,omitempty"`
+	DecidedBy     string            `json:"decidedBy,omitempty"`
+	Created       time.Time         `json:"created"`
+	Decided       *time.Time        `json:"decided,omitempty"`
+}
+
+type ProjectQuotas struct {
+	Project     string              `json:"project"`
+	Quotas      []ProjectQuota      `json:"quotas"`
+	LimitRanges []ProjectLimitRange `json:"limitRanges"`
+}
+
+type ProjectQuota struct {
+	Name   string            `json:"name"`
+	Scopes []string          `json:"scopes,omitempty"`
+	Hard   map[string]string `json:"hard"`
+	Used   map[string]string `json:"used"`
+}
+
+type ProjectLimitRange struct {
+	Name   string         `json:"name"`
+	Limits []ProjectLimit `json:"limits"`
+}
+
+type ProjectLimit struct {
+	Type                 string            `json:"type"`
+	Min                  map[string]string `json:"min,omitempty"`
+	Max                  map[string]string `json:"max,omitempty"`
+	Default              map[string]string `json:"default,omitempty"`
+	DefaultRequest       map[string]string `json:"defaultRequest,omitempty"`
+	MaxLimitRequestRatio map[string]string `json:"maxLimitRequestRatio,omitempty"`
 }
 
 type NewServiceAccountCommand struct {
 	ProjectName
-	ServiceAccount  string `json:"serviceAccount"`
-	OrganizationKey string `json:"organizationKey"`
+	ServiceAccount  string               `json:"serviceAccount"`
+	OrganizationKey string               `json:"organizationKey"`
+	Roles           []ServiceAccountRole `json:"roles"`
+	Sink            *CredentialSink      `json:"sink"`
+}
+
+// RotateServiceAccountTokenCommand chooses the credential sink of the new token. Without it, the token is stored
+// in the sink of the service account. Service accounts without a known sink need the sink or WithoutSink.
+type RotateServiceAccountTokenCommand struct {
+	OrganizationKey string          `json:"organizationKey"`
+	Sink            *CredentialSink `json:"sink"`
+	WithoutSink     bool            `json:"withoutSink"`
+}
+
+// CredentialSink is where the token of a service account is stored. The target depends on the type:
+// jenkins: the organization key, webhook: the name of the configured webhook,
+// gitlab: the id or path of the GitLab project, secret: the project which gets the secret.
+// The name is the key of the GitLab variable or the name of the secret.
+type CredentialSink struct {
+	Type   string `json:"type"`
+	Target string `json:"target"`
+	Name   string `json:"name,omitempty"`
+}
+
+// ServiceAccountRole is a role of a service account in its own project, or in the given project
+type ServiceAccountRole struct {
+	Role    string `json:"role"`
+	Project string `json:"project"`
+}
+
+type ProjectServiceAccount struct {
+	Name    string          `json:"name"`
+	Created string          `json:"created"`
+	Sink    *CredentialSink `json:"sink,omitempty"`
 }
 
 type CreateSnapshotCommand struct {
@@ -104,7 +197,8 @@ type FeatureToggleResponse struct {
 }
 
 type ApiResponse struct {
-	Message string `json:"message"`
+	Message   string `json:"message"`
+	RequestID string `json:"requestId,omitempty"`
 }
 
 type SnapshotApiResponse struct {
@@ -131,6 +225,31 @@ type NewVolumeResponse struct {
 	Server string
 	Path   string
 	JobId  int
+	Steps  []VolumeStep
+}
+
+// VolumeStep is a step of the creation of a volume and its status: executed, compensated or compensation failed
+type VolumeStep struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+type VolumeListResponse struct {
+	Volumes []ProjectVolume `json:"volumes"`
+}
+
+type ProjectVolume struct {
+	PvcName    string       `json:"pvcName"`
+	PvName     string       `json:"pvName"`
+	Technology string       `json:"technology"`
+	Size       string       `json:"size"`
+	Mode       string       `json:"mode"`
+	Usage      *VolumeUsage `json:"usage"`
+}
+
+type VolumeUsage struct {
+	TotalKiloBytes int `json:"totalKiloBytes"`
+	UsedKiloBytes  int `json:"usedKiloBytes"`
 }
 
 type InstanceListResponse struct {
@@ -172,6 +291,13 @@ type S3CredentialsResponse struct {
 
 type AdminList struct {
 	Admins []string `json:"admins"`
+	Groups []string `json:"groups"`
+}
+
+// ProjectAdminCommand adds or removes either a user or a group as admin of a project
+type ProjectAdminCommand struct {
+	User  string `json:"user"`
+	Group string `json:"group"`
 }
 
 type SematextAppList struct {
@@ -213,6 +339,27 @@ type DDCBillingRow struct {
 	Total               float64 `json:"total"`
 }
 
+// OpenshiftBilling is the chargeback of the projects of a cluster, grouped by their billing number.
+// Unbilled are the projects without billing number.
+type OpenshiftBilling struct {
+	Rows     []OpenshiftBillingRow `json:"rows"`
+	CSV      string                `json:"csv"`
+	Unbilled []string              `json:"unbilled"`
+}
+
+// OpenshiftBillingRow are the resources of the projects with the same billing number, cpu in cores, memory and storage in GiB
+type OpenshiftBillingRow struct {
+	Billing      string   `json:"billing"`
+	Projects     []string `json:"projects"`
+	CPU          float64  `json:"cpu"`
+	Memory       float64  `json:"memory"`
+	Storage      float64  `json:"storage"`
+	TotalCPU     float64  `json:"totalCpu"`
+	TotalMemory  float64  `json:"totalMemory"`
+	TotalStorage float64  `json:"totalStorage"`
+	Total        float64  `json:"total"`
+}
+
 type NewS3BucketCommand struct {
 	ProjectName
 	BucketName string `json:"bucketname"`
@@ -224,3 +371,29 @@ type NewS3UserCommand struct {
 	UserName   string `json:"username"`
 	IsReadonly bool   `json:"isReadonly"`
 }
+
+type OseCluster struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Gluster bool   `json:"gluster"`
+	Nfs     bool   `json:"nfs"`
+}
+
+// Job is a long-running operation, its status is polled with GET /api/jobs/:id
+type Job struct {
+	ID       string      `json:"id"`
+	Type     string      `json:"type"`
+	User     string      `json:"user"`
+	Status   string      `json:"status"`
+	Progress float64     `json:"progress"`
+	Result   interface{} `json:"result,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	Created  time.Time   `json:"created"`
+	Started  *time.Time  `json:"started,omitempty"`
+	Finished *time.Time  `json:"finished,omitempty"`
+}
+
+type JobApiResponse struct {
+	Message string `json:"message"`
+	JobID   string `json:"jobId"`
+}
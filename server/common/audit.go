@@ -0,0 +1,317 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	auditQueryError  = "Das Audit-Log konnte nicht gelesen werden"
+	redactedValue    = "***"
+	defaultAuditSize = 100
+)
+
+var secretKeyPattern = regexp.MustCompile(`(?i)(password|secret|token|accesskey|credential)`)
+
+// AuditEntry is the record of a single mutating call to the api
+type AuditEntry struct {
+	Timestamp time.Time       `json:"timestamp"`
+	User      string          `json:"user"`
+	Action    string          `json:"action"`
+	Target    string          `json:"target"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	Status    int             `json:"status"`
+	Result    string          `json:"result"`
+	RequestID string          `json:"requestId,omitempty"`
+}
+
+// AuditFilter restricts the entries returned by AuditStore.Query.
+// Empty fields match everything.
+type AuditFilter struct {
+	User   string
+	Action string
+	Target string
+	From   time.Time
+	To     time.Time
+	Limit  int
+}
+
+// AuditStore persists audit entries
+type AuditStore interface {
+	Add(entry AuditEntry) error
+	Query(filter AuditFilter) ([]AuditEntry, error)
+}
+
+// FileAuditStore writes audit entries as json lines into a file
+type FileAuditStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileAuditStore returns an AuditStore which appends to the file at path
+func NewFileAuditStore(path string) *FileAuditStore {
+	return &FileAuditStore{path: path}
+}
+
+// Add appends the entry to the audit file
+func (s *FileAuditStore) Add(entry AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// Query returns the matching entries, newest first
+func (s *FileAuditStore) Query(filter AuditFilter) ([]AuditEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := []AuditEntry{}
+
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			Log.WithError(err).Warn("Skipping invalid line in audit log")
+			continue
+		}
+		if filter.matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.After(entries[j].Timestamp)
+	})
+
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		entries = entries[:filter.Limit]
+	}
+
+	return entries, nil
+}
+
+func (f AuditFilter) matches(e AuditEntry) bool {
+	if len(f.User) > 0 && !strings.EqualFold(f.User, e.User) {
+		return false
+	}
+	if len(f.Action) > 0 && !strings.Contains(e.Action, f.Action) {
+		return false
+	}
+	if len(f.Target) > 0 && f.Target != e.Target {
+		return false
+	}
+	if !f.From.IsZero() && e.Timestamp.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && e.Timestamp.After(f.To) {
+		return false
+	}
+	return true
+}
+
+type auditResponseWriter struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w auditResponseWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// AuditMiddleware records every mutating request in the store.
+// It must run after the authentication middleware.
+func AuditMiddleware(store AuditStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+
+		var body []byte
+		if c.Request.Body != nil {
+			body, _ = ioutil.ReadAll(c.Request.Body)
+			c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+
+		w := auditResponseWriter{ResponseWriter: c.Writer, body: &bytes.Buffer{}}
+		c.Writer = w
+
+		c.Next()
+
+		entry := AuditEntry{
+			Timestamp: time.Now(),
+			User:      GetUserName(c),
+			Action:    c.Request.Method + " " + c.Request.URL.Path,
+			Target:    getAuditTarget(c, body),
+			Payload:   redactPayload(body),
+			Status:    c.Writer.Status(),
+			Result:    getAuditResult(c.Writer.Status(), w.body.Bytes()),
+			RequestID: GetRequestID(c),
+		}
+
+		if err := store.Add(entry); err != nil {
+			Logger(c).WithError(err).WithField("entry", entry).Error("Error writing audit entry")
+		}
+	}
+}
+
+// AuditQueryHandler returns the audit entries matching the query parameters
+// user, action, target, from, to (RFC3339) and limit. It must be protected with RequireRole(RolePlatformAdmin).
+func AuditQueryHandler(store AuditStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, err := getAuditFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse(c, err.Error()))
+			return
+		}
+
+		entries, err := store.Query(filter)
+		if err != nil {
+			Logger(c).WithError(err).Error("Error querying audit log")
+			c.JSON(http.StatusInternalServerError, ErrorResponse(c, auditQueryError))
+			return
+		}
+
+		c.JSON(http.StatusOK, entries)
+	}
+}
+
+func getAuditFilter(c *gin.Context) (AuditFilter, error) {
+	filter := AuditFilter{
+		User:   c.Query("user"),
+		Action: c.Query("action"),
+		Target: c.Query("target"),
+		Limit:  defaultAuditSize,
+	}
+
+	if from := c.Query("from"); len(from) > 0 {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return filter, errors.New("Ungültiges Datum für 'from', Format: 2006-01-02T15:04:05Z")
+		}
+		filter.From = t
+	}
+	if to := c.Query("to"); len(to) > 0 {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return filter, errors.New("Ungültiges Datum für 'to', Format: 2006-01-02T15:04:05Z")
+		}
+		filter.To = t
+	}
+	if limit := c.Query("limit"); len(limit) > 0 {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l <= 0 {
+			return filter, errors.New("Ungültige Limite")
+		}
+		filter.Limit = l
+	}
+
+	return filter, nil
+}
+
+// getAuditTarget returns the project of the payload or the url parameters
+func getAuditTarget(c *gin.Context, body []byte) string {
+	var payload ProjectName
+	if err := json.Unmarshal(body, &payload); err == nil && len(payload.Project) > 0 {
+		return payload.Project
+	}
+
+	var params []string
+	for _, p := range c.Params {
+		params = append(params, p.Value)
+	}
+	return strings.Join(params, "/")
+}
+
+func getAuditResult(status int, response []byte) string {
+	if status < http.StatusBadRequest {
+		return "success"
+	}
+
+	// Success messages can contain credentials, so only error messages are stored
+	var msg ApiResponse
+	if err := json.Unmarshal(response, &msg); err == nil && len(msg.Message) > 0 {
+		return "failure: " + msg.Message
+	}
+	return "failure"
+}
+
+// redactPayload masks all values of keys which could contain secrets
+func redactPayload(body []byte) json.RawMessage {
+	if len(body) == 0 {
+		return nil
+	}
+
+	var payload interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil
+	}
+
+	redacted, err := json.Marshal(redactValue(payload))
+	if err != nil {
+		return nil
+	}
+	return redacted
+}
+
+func redactValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, val := range t {
+			if secretKeyPattern.MatchString(k) {
+				t[k] = redactedValue
+			} else {
+				t[k] = redactValue(val)
+			}
+		}
+		return t
+	case []interface{}:
+		for i, val := range t {
+			t[i] = redactValue(val)
+		}
+		return t
+	default:
+		return v
+	}
+}
@@ -0,0 +1,63 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRedactPayload(t *testing.T) {
+	body := []byte(`{"project":"p","password":"pw","nested":{"SecretKey":"s"},"list":[{"token":"t"}]}`)
+
+	redacted := redactPayload(body)
+
+	equals(t, `{"list":[{"token":"***"}],"nested":{"SecretKey":"***"},"password":"***","project":"p"}`, string(redacted))
+}
+
+func TestRedactPayload_NoJson(t *testing.T) {
+	equals(t, 0, len(redactPayload([]byte("user=u&password=pw"))))
+}
+
+func TestGetAuditResult(t *testing.T) {
+	equals(t, "success", getAuditResult(200, []byte(`{"message":"Secret Access Key: abc"}`)))
+	equals(t, "failure: Das Projekt existiert nicht", getAuditResult(400, []byte(`{"message":"Das Projekt existiert nicht"}`)))
+	equals(t, "failure", getAuditResult(500, []byte("")))
+}
+
+func TestFileAuditStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+
+	store := NewFileAuditStore(filepath.Join(dir, "audit.log"))
+	now := time.Now()
+
+	ok(t, store.Add(AuditEntry{Timestamp: now.Add(-2 * time.Hour), User: "u1", Action: "POST /api/ose/quotas", Target: "p1"}))
+	ok(t, store.Add(AuditEntry{Timestamp: now.Add(-1 * time.Hour), User: "u2", Action: "POST /api/ose/billing", Target: "p1"}))
+	ok(t, store.Add(AuditEntry{Timestamp: now, User: "u1", Action: "POST /api/ose/quotas", Target: "p2"}))
+
+	all, err := store.Query(AuditFilter{})
+	ok(t, err)
+	equals(t, 3, len(all))
+	equals(t, "p2", all[0].Target)
+
+	quotas, err := store.Query(AuditFilter{Action: "quotas", Target: "p1"})
+	ok(t, err)
+	equals(t, 1, len(quotas))
+	equals(t, "u1", quotas[0].User)
+
+	recent, err := store.Query(AuditFilter{From: now.Add(-90 * time.Minute), Limit: 1})
+	ok(t, err)
+	equals(t, 1, len(recent))
+	equals(t, "p2", recent[0].Target)
+}
+
+func TestFileAuditStore_Empty(t *testing.T) {
+	store := NewFileAuditStore(filepath.Join(os.TempDir(), "does-not-exist", "audit.log"))
+
+	entries, err := store.Query(AuditFilter{})
+	ok(t, err)
+	equals(t, 0, len(entries))
+}
@@ -0,0 +1,184 @@
+package common
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const billingLookupError = "Die Kontierungsnummer kann im Moment nicht geprüft werden. Bitte versuche es später nochmals"
+
+// BillingValidator checks a billing number (Kontierungsnummer, e.g. a PSP element) against a source of valid numbers
+type BillingValidator interface {
+	Validate(ctx context.Context, billing string) error
+}
+
+// billingValidators are the configured validators, set by InitBillingValidators. A billing number has to pass all of them.
+var billingValidators []BillingValidator
+
+// InitBillingValidators creates the validators of the configured sources. Without a source every billing number is accepted.
+func InitBillingValidators(config BillingConfig) error {
+	var validators []BillingValidator
+	if len(config.Pattern) > 0 {
+		pattern, err := regexp.Compile("^(?:" + config.Pattern + ")$")
+		if err != nil {
+			return fmt.Errorf("Invalid billing pattern: %v", err.Error())
+		}
+		validators = append(validators, patternBillingValidator{pattern: pattern})
+	}
+	if len(config.File) > 0 {
+		v := &fileBillingValidator{path: config.File}
+		if err := v.load(); err != nil {
+			return err
+		}
+		validators = append(validators, v)
+	}
+	if len(config.URL) > 0 {
+		client, err := NewHTTPClient("billing lookup", config.HTTPClientConfig)
+		if err != nil {
+			return err
+		}
+		validators = append(validators, httpBillingValidator{url: strings.TrimSuffix(config.URL, "/"), client: client})
+	}
+
+	billingValidators = validators
+	return nil
+}
+
+// ValidateBilling checks the billing number against the configured sources
+func ValidateBilling(ctx context.Context, billing string) error {
+	for _, v := range billingValidators {
+		if err := v.Validate(ctx, billing); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func invalidBillingError(billing string) error {
+	return fmt.Errorf("Die Kontierungsnummer %v ist ungültig", billing)
+}
+
+// patternBillingValidator accepts the billing numbers which match the whole pattern
+type patternBillingValidator struct {
+	pattern *regexp.Regexp
+}
+
+func (v patternBillingValidator) Validate(ctx context.Context, billing string) error {
+	if !v.pattern.MatchString(billing) {
+		return invalidBillingError(billing)
+	}
+	return nil
+}
+
+// fileBillingValidator accepts the billing numbers of a file, which is either a json list of strings or a csv file
+// with the numbers in the first column. The file is read again when it has changed.
+type fileBillingValidator struct {
+	path     string
+	mu       sync.Mutex
+	modified time.Time
+	valid    map[string]bool
+}
+
+func (v *fileBillingValidator) Validate(ctx context.Context, billing string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if info, err := os.Stat(v.path); err == nil && !info.ModTime().Equal(v.modified) {
+		// A broken update of the file keeps the numbers read before
+		if err := v.load(); err != nil {
+			Logger(ctx).WithError(err).Error("Error reading the billing file, keeping the old billing numbers")
+		}
+	}
+
+	if !v.valid[strings.TrimSpace(billing)] {
+		return invalidBillingError(billing)
+	}
+	return nil
+}
+
+func (v *fileBillingValidator) load() error {
+	info, err := os.Stat(v.path)
+	if err != nil {
+		return fmt.Errorf("Error reading the billing file %v: %v", v.path, err.Error())
+	}
+	content, err := ioutil.ReadFile(v.path)
+	if err != nil {
+		return fmt.Errorf("Error reading the billing file %v: %v", v.path, err.Error())
+	}
+
+	var numbers []string
+	if strings.EqualFold(filepath.Ext(v.path), ".json") {
+		if err := json.Unmarshal(content, &numbers); err != nil {
+			return fmt.Errorf("Error parsing the billing file %v: %v", v.path, err.Error())
+		}
+	} else {
+		r := csv.NewReader(strings.NewReader(string(content)))
+		r.FieldsPerRecord = -1
+		r.Comment = '#'
+		rows, err := r.ReadAll()
+		if err != nil {
+			return fmt.Errorf("Error parsing the billing file %v: %v", v.path, err.Error())
+		}
+		for _, row := range rows {
+			numbers = append(numbers, row[0])
+		}
+	}
+
+	valid := map[string]bool{}
+	for _, n := range numbers {
+		if n = strings.TrimSpace(n); len(n) > 0 {
+			valid[n] = true
+		}
+	}
+	v.valid = valid
+	v.modified = info.ModTime()
+	Log.WithFields(logrus.Fields{"file": v.path, "count": len(valid)}).Info("Loaded the billing numbers")
+	return nil
+}
+
+// httpBillingValidator asks a lookup service with GET <url>/<billing number>.
+// It answers 200 for valid and 404 for unknown numbers.
+type httpBillingValidator struct {
+	url    string
+	client *http.Client
+}
+
+func (v httpBillingValidator) Validate(ctx context.Context, billing string) error {
+	req, err := http.NewRequest("GET", v.url+"/"+url.PathEscape(billing), nil)
+	if err != nil {
+		Logger(ctx).WithError(err).Error("Error creating the billing lookup")
+		return errors.New(billingLookupError)
+	}
+	SetRequestIDHeader(ctx, req)
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		Logger(ctx).WithError(err).Error("Error calling the billing lookup")
+		return errors.New(billingLookupError)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return invalidBillingError(billing)
+	default:
+		Logger(ctx).WithField("status", resp.StatusCode).Error("Unexpected answer of the billing lookup")
+		return errors.New(billingLookupError)
+	}
+}
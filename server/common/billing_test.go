@@ -0,0 +1,73 @@
+package common
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestValidateBilling_Pattern(t *testing.T) {
+	ok(t, InitBillingValidators(BillingConfig{Pattern: `R\.\d{6}\.\d{2}`}))
+	defer InitBillingValidators(BillingConfig{})
+
+	ok(t, ValidateBilling(context.Background(), "R.123456.01"))
+	// The whole number has to match
+	err := ValidateBilling(context.Background(), "R.123456.01x")
+	equals(t, "Die Kontierungsnummer R.123456.01x ist ungültig", err.Error())
+
+	assert(t, InitBillingValidators(BillingConfig{Pattern: `R\.(`}) != nil, "Invalid pattern should be an error")
+}
+
+func TestValidateBilling_File(t *testing.T) {
+	dir, err := ioutil.TempDir("", "billing")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+
+	csvFile := filepath.Join(dir, "psp.csv")
+	ok(t, ioutil.WriteFile(csvFile, []byte("# psp,description\nR.123456.01,Team A\n R.654321.02 ,Team B\n"), 0600))
+	ok(t, InitBillingValidators(BillingConfig{File: csvFile}))
+	defer InitBillingValidators(BillingConfig{})
+
+	ok(t, ValidateBilling(context.Background(), "R.123456.01"))
+	ok(t, ValidateBilling(context.Background(), "R.654321.02"))
+	assert(t, ValidateBilling(context.Background(), "Team A") != nil, "Only the first column should be valid")
+
+	// A changed file is read again
+	ok(t, ioutil.WriteFile(csvFile, []byte("R.999999.01\n"), 0600))
+	later := time.Now().Add(time.Minute)
+	ok(t, os.Chtimes(csvFile, later, later))
+	ok(t, ValidateBilling(context.Background(), "R.999999.01"))
+	assert(t, ValidateBilling(context.Background(), "R.123456.01") != nil, "Removed number should be invalid")
+
+	jsonFile := filepath.Join(dir, "psp.json")
+	ok(t, ioutil.WriteFile(jsonFile, []byte(`["R.123456.01"]`), 0600))
+	ok(t, InitBillingValidators(BillingConfig{File: jsonFile}))
+	ok(t, ValidateBilling(context.Background(), "R.123456.01"))
+	assert(t, ValidateBilling(context.Background(), "R.123456.02") != nil, "Unknown number should be invalid")
+}
+
+func TestValidateBilling_Lookup(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/psp/R.123456.01":
+		case "/psp/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	ok(t, InitBillingValidators(BillingConfig{URL: server.URL + "/psp/"}))
+	defer InitBillingValidators(BillingConfig{})
+
+	ok(t, ValidateBilling(context.Background(), "R.123456.01"))
+	err := ValidateBilling(context.Background(), "R.123456.02")
+	equals(t, "Die Kontierungsnummer R.123456.02 ist ungültig", err.Error())
+	err = ValidateBilling(context.Background(), "broken")
+	equals(t, billingLookupError, err.Error())
+}
@@ -0,0 +1,46 @@
+package common
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strconv"
+)
+
+// SAPChargebackRow is a line of the internal charging, as imported by SAP
+type SAPChargebackRow struct {
+	Sender              string
+	Art                 string
+	Total               float64
+	ReceptionAssignment string
+	OrderReception      string
+	PspElement          string
+	Text                string
+	SysID               string
+}
+
+// CreateSAPCSV returns the rows as csv for the import into SAP
+func CreateSAPCSV(rows []SAPChargebackRow) string {
+	b := &bytes.Buffer{}
+	wr := csv.NewWriter(b)
+	wr.Comma = ';'
+
+	// Title row
+	title := []string{"SendStelle", "SendAuftrag", "Sender-PSP-Element",
+		"SendKdAuft", "SndPos", "SendNetzplan", "SendervorgangSVrg",
+		"Kostenart", "Betrag", "Waehrung",
+		"EmpfStelle", "EmpfAuftrag", "Empfaenger-PSP-Element",
+		"EmpfKdAuft", "EmpPos", "EmpfNetzplan", "Evrg",
+		"Menge gesamt", "ME", "PersNr", "Text", "Sys ID"}
+	wr.Write(title)
+
+	for _, r := range rows {
+		totalString := strconv.FormatFloat(r.Total, 'f', 2, 64)
+		row := []string{"", r.Sender, "", "", "", "", "", r.Art, totalString, "CHF",
+			r.ReceptionAssignment, r.OrderReception, r.PspElement,
+			"", "", "", "", "1", "ST", "", r.Text, r.SysID}
+		wr.Write(row)
+	}
+
+	wr.Flush()
+	return b.String()
+}
@@ -1,20 +1,650 @@
 package common
 
 import (
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
 )
 
-func ConfigHandler(c *gin.Context) {
-	glusterApi := os.Getenv("GLUSTER_API_URL")
-	nfsApi := os.Getenv("NFS_API_URL")
-	ddcApi := os.Getenv("DDC_API")
+const defaultConfigFile = "config.yml"
+
+// cfg is the loaded configuration, used by the helpers in this package
+var cfg = defaultConfig()
+
+// Config is the configuration of the backend. It is loaded once on startup from a yaml file.
+// Every value can be overridden by the env variable in its env tag,
+// the env tag of a struct is the prefix of its fields.
+type Config struct {
+	SessionKey          string          `yaml:"sessionKey" env:"SESSION_KEY"`
+	SecApiPassword      string          `yaml:"secApiPassword" env:"SEC_API_PASSWORD"`
+	PlatformAdmins      []string        `yaml:"platformAdmins" env:"PLATFORM_ADMINS"`
+	PlatformAdminGroups []string        `yaml:"platformAdminGroups" env:"PLATFORM_ADMIN_GROUPS"`
+	BillingAdminGroups  []string        `yaml:"billingAdminGroups" env:"BILLING_ADMIN_GROUPS"`
+	AuditLogFile        string          `yaml:"auditLogFile" env:"AUDIT_LOG_FILE"`
+	LogLevel            string          `yaml:"logLevel" env:"LOG_LEVEL"`
+	TokenMaxRefresh     time.Duration   `yaml:"tokenMaxRefresh" env:"TOKEN_MAX_REFRESH"`
+	RevocationFile      string          `yaml:"revocationFile" env:"REVOCATION_FILE"`
+	JobFile             string          `yaml:"jobFile" env:"JOB_FILE"`
+	JobWorkers          int             `yaml:"jobWorkers" env:"JOB_WORKERS"`
+	AuthBackends        []string        `yaml:"authBackends" env:"AUTH_BACKENDS"`
+	Ldap                LdapConfig      `yaml:"ldap" env:"LDAP_"`
+	Oidc                OidcConfig      `yaml:"oidc" env:"OIDC_"`
+	Mail                MailConfig      `yaml:"mail" env:"MAIL_"`
+	Billing             BillingConfig   `yaml:"billing" env:"BILLING_"`
+	Openshift           OpenshiftConfig `yaml:"openshift"`
+	Aws                 AwsConfig       `yaml:"aws" env:"AWS_"`
+	Sematext            SematextConfig  `yaml:"sematext"`
+	DDC                 DDCConfig       `yaml:"ddc" env:"DDC_"`
+}
+
+// LdapConfig is the directory used for the login
+type LdapConfig struct {
+	Host           string `yaml:"host" env:"URL"`
+	Port           int    `yaml:"port" env:"PORT"`
+	TLS            string `yaml:"tls" env:"TLS"`
+	CAFile         string `yaml:"caFile" env:"CA_FILE"`
+	BindDN         string `yaml:"bindDn" env:"BIND_DN"`
+	BindPassword   string `yaml:"bindPassword" env:"BIND_CRED"`
+	SearchBase     string `yaml:"searchBase" env:"SEARCH_BASE"`
+	Filter         string `yaml:"filter" env:"FILTER"`
+	MailAttribute  string `yaml:"mailAttribute" env:"MAIL_ATTRIBUTE"`
+	GroupAttribute string `yaml:"groupAttribute" env:"GROUP_ATTRIBUTE"`
+	PoolSize       int    `yaml:"poolSize" env:"POOL_SIZE"`
+}
+
+// OidcConfig is the OpenID Connect identity provider used for the login
+type OidcConfig struct {
+	IssuerURL    string   `yaml:"issuerUrl" env:"ISSUER_URL"`
+	ClientID     string   `yaml:"clientId" env:"CLIENT_ID"`
+	ClientSecret string   `yaml:"clientSecret" env:"CLIENT_SECRET"`
+	RedirectURL  string   `yaml:"redirectUrl" env:"REDIRECT_URL"`
+	FrontendURL  string   `yaml:"frontendUrl" env:"FRONTEND_URL"`
+	Audience     string   `yaml:"audience" env:"AUDIENCE"`
+	Scopes       []string `yaml:"scopes" env:"SCOPES"`
+	UserClaim    string   `yaml:"userClaim" env:"USER_CLAIM"`
+	MailClaim    string   `yaml:"mailClaim" env:"MAIL_CLAIM"`
+	GroupsClaim  string   `yaml:"groupsClaim" env:"GROUPS_CLAIM"`
+}
+
+// Authentication backends
+const (
+	AuthBackendLdap = "ldap"
+	AuthBackendOidc = "oidc"
+)
+
+// TLS modes of the ldap connection
+const (
+	LdapTLSNone     = "none"
+	LdapTLSStartTLS = "starttls"
+	LdapTLSLdaps    = "ldaps"
+)
+
+// Address returns host:port of the directory. The port defaults to the one of the TLS mode.
+func (l LdapConfig) Address() string {
+	port := l.Port
+	if port == 0 {
+		port = 389
+		if l.TLS == LdapTLSLdaps {
+			port = 636
+		}
+	}
+	return fmt.Sprintf("%v:%v", l.Host, port)
+}
+
+// MailConfig is the smtp server for notifications. Mails are only sent if it is set.
+type MailConfig struct {
+	Server string `yaml:"server" env:"SERVER"`
+	Sender string `yaml:"sender" env:"SENDER"`
+}
+
+// BillingConfig are the sources of valid billing numbers, which are checked by all modules.
+// The pattern has to match the whole number. The file is a json list or a csv file with the numbers in the first column.
+// The lookup service answers GET <url>/<number> with 200 or 404. Without a source every number is accepted.
+type BillingConfig struct {
+	Pattern          string `yaml:"pattern" env:"PATTERN"`
+	File             string `yaml:"file" env:"FILE"`
+	URL              string `yaml:"url" env:"URL"`
+	HTTPClientConfig `yaml:",inline"`
+}
+
+// OpenshiftConfig configures the OpenShift module and its storage backends.
+// Without clusters apiUrl, token, caFile, gluster and nfs configure the only cluster.
+type OpenshiftConfig struct {
+	Enabled            *bool  `yaml:"enabled" env:"OPENSHIFT_ENABLED"`
+	APIURL             string `yaml:"apiUrl" env:"OPENSHIFT_API"`
+	Token              string `yaml:"token" env:"OPENSHIFT_TOKEN"`
+	HTTPClientConfig   `yaml:",inline" env:"OPENSHIFT_"`
+	MaxQuotaCPU        int                                `yaml:"maxQuotaCpu" env:"MAX_QUOTA_CPU"`
+	MaxQuotaMemory     int                                `yaml:"maxQuotaMemory" env:"MAX_QUOTA_MEMORY"`
+	MaxQuotas          map[string]int                     `yaml:"maxQuotas"`
+	QuotaRequestFile   string                             `yaml:"quotaRequestFile" env:"QUOTA_REQUEST_FILE"`
+	ProjectTemplates   map[string]ProjectTemplate         `yaml:"projectTemplates"`
+	MaxVolumeGB        int                                `yaml:"maxVolumeGb" env:"MAX_VOLUME_GB"`
+	JenkinsURL         string                             `yaml:"jenkinsUrl" env:"JENKINS_URL"`
+	WZUBackend         WZUBackendConfig                   `yaml:"wzuBackend" env:"WZUBACKEND_"`
+	GitLab             GitLabConfig                       `yaml:"gitlab" env:"GITLAB_"`
+	CredentialWebhooks map[string]CredentialWebhookConfig `yaml:"credentialWebhooks"`
+	Gluster            GlusterConfig                      `yaml:"gluster" env:"GLUSTER_"`
+	Nfs                NfsConfig                          `yaml:"nfs" env:"NFS_"`
+	Clusters           []OpenshiftClusterConfig           `yaml:"clusters"`
+	Chargeback         ChargebackConfig                   `yaml:"chargeback" env:"CHARGEBACK_"`
+}
+
+// OpenshiftClusterConfig is a cluster of the OpenShift module with its storage backends.
+// The timeout of the OpenShift config is used if the cluster has none.
+type OpenshiftClusterConfig struct {
+	ID               string `yaml:"id"`
+	Name             string `yaml:"name"`
+	APIURL           string `yaml:"apiUrl"`
+	Token            string `yaml:"token"`
+	HTTPClientConfig `yaml:",inline"`
+	Gluster          GlusterConfig `yaml:"gluster"`
+	Nfs              NfsConfig     `yaml:"nfs"`
+}
+
+// ProjectTemplate are the resources created in a new project. The template 'default' is used
+// for projects without template.
+type ProjectTemplate struct {
+	Description     string                         `yaml:"description"`
+	Labels          map[string]string              `yaml:"labels"`
+	ResourceQuotas  []ProjectTemplateQuota         `yaml:"resourceQuotas"`
+	LimitRanges     []ProjectTemplateLimitRange    `yaml:"limitRanges"`
+	NetworkPolicies []ProjectTemplateNetworkPolicy `yaml:"networkPolicies"`
+	ServiceAccounts []string                       `yaml:"serviceAccounts"`
+	RoleBindings    []ProjectTemplateRoleBinding   `yaml:"roleBindings"`
+}
+
+// ProjectTemplateQuota is a ResourceQuota, an existing quota of the same name is updated
+type ProjectTemplateQuota struct {
+	Name   string            `yaml:"name"`
+	Scopes []string          `yaml:"scopes"`
+	Hard   map[string]string `yaml:"hard"`
+}
+
+// ProjectTemplateLimitRange is a LimitRange
+type ProjectTemplateLimitRange struct {
+	Name   string                 `yaml:"name"`
+	Limits []ProjectTemplateLimit `yaml:"limits"`
+}
+
+// ProjectTemplateLimit are the limits of a type of object, e.g. Container or Pod
+type ProjectTemplateLimit struct {
+	Type           string            `yaml:"type"`
+	Max            map[string]string `yaml:"max"`
+	Min            map[string]string `yaml:"min"`
+	Default        map[string]string `yaml:"default"`
+	DefaultRequest map[string]string `yaml:"defaultRequest"`
+}
+
+// ProjectTemplateNetworkPolicy is a NetworkPolicy, the spec is passed on as it is
+type ProjectTemplateNetworkPolicy struct {
+	Name string                 `yaml:"name"`
+	Spec map[string]interface{} `yaml:"spec"`
+}
+
+// ProjectTemplateRoleBinding grants a cluster role to users, groups and service accounts of the project
+type ProjectTemplateRoleBinding struct {
+	Name            string   `yaml:"name"`
+	Role            string   `yaml:"role"`
+	Users           []string `yaml:"users"`
+	Groups          []string `yaml:"groups"`
+	ServiceAccounts []string `yaml:"serviceAccounts"`
+}
+
+// WZUBackendConfig is the backend which stores service account tokens in Jenkins (optional)
+type WZUBackendConfig struct {
+	URL              string `yaml:"url" env:"URL"`
+	Secret           string `yaml:"secret" env:"SECRET"`
+	HTTPClientConfig `yaml:",inline"`
+}
+
+// Sources of the OpenShift chargeback
+const (
+	ChargebackSourceQuota = "quota"
+	ChargebackSourceUsage = "usage"
+)
+
+// ChargebackConfig are the prices of the OpenShift chargeback in CHF per month: per core, per GiB memory and per GiB of persistent volumes.
+// The source 'quota' bills the quotas of the projects, 'usage' the requests of their pods.
+type ChargebackConfig struct {
+	Source  string  `yaml:"source" env:"SOURCE"`
+	Sender  string  `yaml:"sender" env:"SENDER"`
+	Art     string  `yaml:"art" env:"ART"`
+	CPU     float64 `yaml:"cpu" env:"CPU"`
+	Memory  float64 `yaml:"memory" env:"MEMORY"`
+	Storage float64 `yaml:"storage" env:"STORAGE"`
+}
+
+// GitLabConfig is the GitLab whose CI variables can receive the tokens of service accounts (optional)
+type GitLabConfig struct {
+	URL   string `yaml:"url" env:"URL"`
+	Token string `yaml:"token" env:"TOKEN"`
+	// UnprotectedVariables makes the tokens available to the pipelines of all branches, not only the protected ones
+	UnprotectedVariables bool `yaml:"unprotectedVariables" env:"UNPROTECTED_VARIABLES"`
+	HTTPClientConfig     `yaml:",inline"`
+}
+
+// CredentialWebhookConfig is a url which receives the tokens of service accounts as json.
+// The secret is sent as bearer token.
+type CredentialWebhookConfig struct {
+	Description      string `yaml:"description"`
+	URL              string `yaml:"url"`
+	Secret           string `yaml:"secret"`
+	HTTPClientConfig `yaml:",inline"`
+}
+
+// GlusterConfig is the gluster api for persistent volumes (optional)
+type GlusterConfig struct {
+	APIURL           string   `yaml:"apiUrl" env:"API_URL"`
+	Secret           string   `yaml:"secret" env:"SECRET"`
+	IPs              []string `yaml:"ips" env:"IPS"`
+	HTTPClientConfig `yaml:",inline"`
+}
+
+// NfsConfig is the nfs api for persistent volumes (optional), it is reached through the proxy
+type NfsConfig struct {
+	APIURL           string `yaml:"apiUrl" env:"API_URL"`
+	Secret           string `yaml:"secret" env:"API_SECRET"`
+	HTTPClientConfig `yaml:",inline"`
+}
+
+// AwsConfig configures the AWS module
+type AwsConfig struct {
+	Enabled        *bool            `yaml:"enabled" env:"ENABLED"`
+	Region         string           `yaml:"region" env:"REGION"`
+	S3BucketPrefix string           `yaml:"s3BucketPrefix" env:"S3_BUCKET_PREFIX"`
+	Prod           AwsAccountConfig `yaml:"prod" env:"PROD_"`
+	NonProd        AwsAccountConfig `yaml:"nonProd" env:"NONPROD_"`
+}
+
+// AwsAccountConfig are the credentials of an AWS account
+type AwsAccountConfig struct {
+	AccessKeyID     string `yaml:"accessKeyId" env:"ACCESS_KEY_ID"`
+	SecretAccessKey string `yaml:"secretAccessKey" env:"SECRET_ACCESS_KEY"`
+}
 
+// SematextConfig configures the Sematext module
+type SematextConfig struct {
+	Enabled          *bool  `yaml:"enabled" env:"LOGSENE_ENABLED"`
+	APIToken         string `yaml:"apiToken" env:"SEMATEXT_API_TOKEN"`
+	BaseURL          string `yaml:"baseUrl" env:"SEMATEXT_BASE_URL"`
+	DiscountCode     string `yaml:"discountCode" env:"LOGSENE_DISCOUNTCODE"`
+	HTTPClientConfig `yaml:",inline" env:"SEMATEXT_"`
+}
+
+// DDCConfig configures the DDC billing module
+type DDCConfig struct {
+	Enabled          *bool  `yaml:"enabled" env:"ENABLED"`
+	APIURL           string `yaml:"apiUrl" env:"API"`
+	HTTPClientConfig `yaml:",inline"`
+}
+
+func defaultConfig() Config {
+	return Config{
+		AuditLogFile:    "audit.log",
+		LogLevel:        "info",
+		TokenMaxRefresh: 12 * time.Hour,
+		JobWorkers:      4,
+		AuthBackends:    []string{AuthBackendLdap},
+		Oidc: OidcConfig{
+			Scopes:      []string{"openid", "profile", "email"},
+			UserClaim:   "preferred_username",
+			MailClaim:   "email",
+			GroupsClaim: "groups",
+		},
+		Ldap: LdapConfig{
+			TLS:            LdapTLSStartTLS,
+			MailAttribute:  "mail",
+			GroupAttribute: "memberOf",
+			PoolSize:       5,
+		},
+		Openshift: OpenshiftConfig{
+			HTTPClientConfig: HTTPClientConfig{Timeout: DefaultHTTPTimeout},
+			Chargeback: ChargebackConfig{
+				Source: ChargebackSourceQuota,
+				Sender: "70029508",
+				Art:    "816750",
+			},
+		},
+	}
+}
+
+// LoadConfig reads the config file, applies the env variables and validates the result.
+// The file is taken from the env variable 'SSP_CONFIG', it is optional if that is not set.
+func LoadConfig() (*Config, error) {
+	c := defaultConfig()
+
+	path, explicit := os.LookupEnv("SSP_CONFIG")
+	if !explicit {
+		path = defaultConfigFile
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err == nil {
+		if err := yaml.UnmarshalStrict(content, &c); err != nil {
+			return nil, fmt.Errorf("Error parsing config file %v: %v", path, err.Error())
+		}
+		Log.WithField("path", path).Info("Loaded config file")
+	} else if explicit || !os.IsNotExist(err) {
+		return nil, fmt.Errorf("Error reading config file %v: %v", path, err.Error())
+	}
+
+	if err := applyEnv(reflect.ValueOf(&c).Elem(), ""); err != nil {
+		return nil, err
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	SetLogLevel(c.LogLevel)
+
+	cfg = c
+	return &c, nil
+}
+
+// Validate checks that all the settings of the enabled modules are present
+func (c Config) Validate() error {
+	var missing []string
+	require := func(present bool, name string) {
+		if !present {
+			missing = append(missing, name)
+		}
+	}
+
+	require(len(c.SessionKey) > 0, "sessionKey (SESSION_KEY)")
+	_, err := logrus.ParseLevel(c.LogLevel)
+	require(err == nil, "logLevel (LOG_LEVEL) with one of debug, info, warning, error")
+	require(c.TokenMaxRefresh >= tokenTimeout, "tokenMaxRefresh (TOKEN_MAX_REFRESH) of at least 1h")
+	require(c.JobWorkers > 0, "jobWorkers (JOB_WORKERS) of at least 1")
+	require(len(c.AuthBackends) > 0, "authBackends (AUTH_BACKENDS)")
+	for _, b := range c.AuthBackends {
+		require(b == AuthBackendLdap || b == AuthBackendOidc, "authBackends (AUTH_BACKENDS) with ldap and/or oidc")
+	}
+
+	if c.AuthBackendEnabled(AuthBackendLdap) {
+		require(len(c.Ldap.Host) > 0, "ldap.host (LDAP_URL)")
+		require(len(c.Ldap.SearchBase) > 0, "ldap.searchBase (LDAP_SEARCH_BASE)")
+		require(len(c.Ldap.Filter) > 0, "ldap.filter (LDAP_FILTER)")
+		require(c.Ldap.TLS == LdapTLSNone || c.Ldap.TLS == LdapTLSStartTLS || c.Ldap.TLS == LdapTLSLdaps,
+			"ldap.tls (LDAP_TLS) with one of none, starttls, ldaps")
+		if c.Ldap.TLS == LdapTLSNone {
+			Log.Warn("The ldap connection is not encrypted (LDAP_TLS none), the passwords of the users are sent in plaintext")
+		}
+	}
+
+	if c.AuthBackendEnabled(AuthBackendOidc) {
+		require(len(c.Oidc.IssuerURL) > 0, "oidc.issuerUrl (OIDC_ISSUER_URL)")
+		require(len(c.Oidc.ClientID) > 0, "oidc.clientId (OIDC_CLIENT_ID)")
+		require(len(c.Oidc.ClientSecret) > 0, "oidc.clientSecret (OIDC_CLIENT_SECRET)")
+		require(len(c.Oidc.RedirectURL) > 0, "oidc.redirectUrl (OIDC_REDIRECT_URL)")
+	}
+
+	if c.Openshift.IsEnabled() {
+		o := c.Openshift
+		if len(o.Clusters) == 0 {
+			require(len(o.APIURL) > 0, "openshift.apiUrl (OPENSHIFT_API)")
+			require(len(o.Token) > 0, "openshift.token (OPENSHIFT_TOKEN)")
+			if len(o.Gluster.APIURL) > 0 {
+				require(len(o.Gluster.Secret) > 0, "openshift.gluster.secret (GLUSTER_SECRET)")
+				require(len(o.Gluster.IPs) > 0, "openshift.gluster.ips (GLUSTER_IPS)")
+			}
+			if len(o.Nfs.APIURL) > 0 {
+				require(len(o.Nfs.Secret) > 0, "openshift.nfs.secret (NFS_API_SECRET)")
+				require(len(o.Nfs.Proxy) > 0, "openshift.nfs.proxy (NFS_PROXY)")
+			}
+		}
+		ids := map[string]bool{}
+		for i, cl := range o.Clusters {
+			p := fmt.Sprintf("openshift.clusters[%v].", i)
+			require(len(cl.ID) > 0 && !ids[cl.ID], p+"id (unique)")
+			ids[cl.ID] = true
+			require(len(cl.APIURL) > 0, p+"apiUrl")
+			require(len(cl.Token) > 0, p+"token")
+			if len(cl.Gluster.APIURL) > 0 {
+				require(len(cl.Gluster.Secret) > 0, p+"gluster.secret")
+				require(len(cl.Gluster.IPs) > 0, p+"gluster.ips")
+			}
+			if len(cl.Nfs.APIURL) > 0 {
+				require(len(cl.Nfs.Secret) > 0, p+"nfs.secret")
+				require(len(cl.Nfs.Proxy) > 0, p+"nfs.proxy")
+			}
+		}
+		require(o.Timeout > 0, "openshift.timeout (OPENSHIFT_TIMEOUT)")
+		require(o.MaxQuotaCPU > 0, "openshift.maxQuotaCpu (MAX_QUOTA_CPU)")
+		require(o.MaxQuotaMemory > 0, "openshift.maxQuotaMemory (MAX_QUOTA_MEMORY)")
+		if len(o.WZUBackend.URL) > 0 {
+			require(len(o.WZUBackend.Secret) > 0, "openshift.wzuBackend.secret (WZUBACKEND_SECRET)")
+			require(len(o.JenkinsURL) > 0, "openshift.jenkinsUrl (JENKINS_URL)")
+		}
+		if len(o.GitLab.URL) > 0 {
+			require(len(o.GitLab.Token) > 0, "openshift.gitlab.token (GITLAB_TOKEN)")
+		}
+		for name, h := range o.CredentialWebhooks {
+			require(len(h.URL) > 0, fmt.Sprintf("openshift.credentialWebhooks.%v.url", name))
+		}
+		require(o.Chargeback.Source == ChargebackSourceQuota || o.Chargeback.Source == ChargebackSourceUsage,
+			"openshift.chargeback.source (CHARGEBACK_SOURCE) with quota or usage")
+		require(o.Chargeback.CPU >= 0 && o.Chargeback.Memory >= 0 && o.Chargeback.Storage >= 0,
+			"openshift.chargeback.cpu, memory and storage (CHARGEBACK_CPU, CHARGEBACK_MEMORY, CHARGEBACK_STORAGE) of at least 0")
+		if o.VolumesEnabled() {
+			require(o.MaxVolumeGB > 0, "openshift.maxVolumeGb (MAX_VOLUME_GB)")
+		}
+		for name, t := range o.ProjectTemplates {
+			p := fmt.Sprintf("openshift.projectTemplates.%v.", name)
+			for _, q := range t.ResourceQuotas {
+				require(len(q.Name) > 0, p+"resourceQuotas.name")
+			}
+			for _, l := range t.LimitRanges {
+				require(len(l.Name) > 0, p+"limitRanges.name")
+			}
+			for _, n := range t.NetworkPolicies {
+				require(len(n.Name) > 0, p+"networkPolicies.name")
+			}
+			for _, r := range t.RoleBindings {
+				require(len(r.Name) > 0 && len(r.Role) > 0, p+"roleBindings.name and role")
+			}
+		}
+	}
+
+	if c.Aws.IsEnabled() {
+		a := c.Aws
+		require(len(a.Region) > 0, "aws.region (AWS_REGION)")
+		require(len(a.S3BucketPrefix) > 0, "aws.s3BucketPrefix (AWS_S3_BUCKET_PREFIX)")
+		require(len(a.Prod.AccessKeyID) > 0, "aws.prod.accessKeyId (AWS_PROD_ACCESS_KEY_ID)")
+		require(len(a.Prod.SecretAccessKey) > 0, "aws.prod.secretAccessKey (AWS_PROD_SECRET_ACCESS_KEY)")
+		require(len(a.NonProd.AccessKeyID) > 0, "aws.nonProd.accessKeyId (AWS_NONPROD_ACCESS_KEY_ID)")
+		require(len(a.NonProd.SecretAccessKey) > 0, "aws.nonProd.secretAccessKey (AWS_NONPROD_SECRET_ACCESS_KEY)")
+	}
+
+	if c.Sematext.IsEnabled() {
+		require(len(c.Sematext.APIToken) > 0, "sematext.apiToken (SEMATEXT_API_TOKEN)")
+		require(len(c.Sematext.BaseURL) > 0, "sematext.baseUrl (SEMATEXT_BASE_URL)")
+	}
+
+	if c.DDC.IsEnabled() {
+		require(len(c.DDC.APIURL) > 0, "ddc.apiUrl (DDC_API)")
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("Invalid config, the following values must be specified: %v", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// AuthBackendEnabled returns if users can log in with the backend
+func (c Config) AuthBackendEnabled(backend string) bool {
+	for _, b := range c.AuthBackends {
+		if b == backend {
+			return true
+		}
+	}
+	return false
+}
+
+// IsEnabled returns if the module is enabled explicitly or if a cluster is configured
+func (o OpenshiftConfig) IsEnabled() bool {
+	if o.Enabled != nil {
+		return *o.Enabled
+	}
+	return len(o.GetClusters()) > 0
+}
+
+// GetClusters returns the configured clusters, or the single cluster of apiUrl and token
+func (o OpenshiftConfig) GetClusters() []OpenshiftClusterConfig {
+	if len(o.Clusters) > 0 || len(o.APIURL) == 0 {
+		return o.Clusters
+	}
+	return []OpenshiftClusterConfig{{
+		ID:               "default",
+		Name:             "OpenShift",
+		APIURL:           o.APIURL,
+		Token:            o.Token,
+		HTTPClientConfig: o.HTTPClientConfig,
+		Gluster:          o.Gluster,
+		Nfs:              o.Nfs,
+	}}
+}
+
+// VolumesEnabled returns if any cluster has a storage backend
+func (o OpenshiftConfig) VolumesEnabled() bool {
+	return hasCluster(o, OpenshiftClusterConfig.VolumesEnabled)
+}
+
+// VolumesEnabled returns if any storage backend is configured
+func (c OpenshiftClusterConfig) VolumesEnabled() bool {
+	return len(c.Gluster.APIURL) > 0 || len(c.Nfs.APIURL) > 0
+}
+
+// IsEnabled returns if the module is enabled explicitly or if its region is configured
+func (a AwsConfig) IsEnabled() bool {
+	return isEnabled(a.Enabled, a.Region)
+}
+
+// IsEnabled returns if the module is enabled explicitly or if its token is configured
+func (s SematextConfig) IsEnabled() bool {
+	return isEnabled(s.Enabled, s.APIToken)
+}
+
+// IsEnabled returns if the module is enabled explicitly or if its api is configured
+func (d DDCConfig) IsEnabled() bool {
+	return isEnabled(d.Enabled, d.APIURL)
+}
+
+func isEnabled(enabled *bool, setting string) bool {
+	if enabled != nil {
+		return *enabled
+	}
+	return len(setting) > 0
+}
+
+// applyEnv overrides the fields of v with the values of their env variables
+func applyEnv(v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		tag, hasTag := t.Field(i).Tag.Lookup("env")
+
+		if field.Kind() == reflect.Struct {
+			if err := applyEnv(field, prefix+tag); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !hasTag {
+			continue
+		}
+		name := prefix + tag
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+
+		if err := setField(field, value); err != nil {
+			return fmt.Errorf("Invalid value for env variable '%v': %v", name, err.Error())
+		}
+	}
+	return nil
+}
+
+func setField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int64:
+		if field.Type() != reflect.TypeOf(time.Duration(0)) {
+			return errors.New("unsupported type " + field.Type().String())
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+	case reflect.Int:
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(i))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Ptr:
+		if field.Type().Elem().Kind() != reflect.Bool {
+			return errors.New("unsupported type " + field.Type().String())
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(&b))
+	case reflect.Slice:
+		var values []string
+		for _, s := range strings.Split(value, ",") {
+			if s = strings.TrimSpace(s); len(s) > 0 {
+				values = append(values, s)
+			}
+		}
+		field.Set(reflect.ValueOf(values))
+	default:
+		return errors.New("unsupported type " + field.Type().String())
+	}
+	return nil
+}
+
+func ConfigHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, FeatureToggleResponse{
-		DDC:     ddcApi != "",
-		Gluster: glusterApi != "",
-		Nfs:     nfsApi != "",
+		DDC:     cfg.DDC.IsEnabled(),
+		Gluster: cfg.Openshift.IsEnabled() && hasCluster(cfg.Openshift, func(c OpenshiftClusterConfig) bool { return len(c.Gluster.APIURL) > 0 }),
+		Nfs:     cfg.Openshift.IsEnabled() && hasCluster(cfg.Openshift, func(c OpenshiftClusterConfig) bool { return len(c.Nfs.APIURL) > 0 }),
 	})
 }
+
+// hasCluster returns if any cluster matches
+func hasCluster(o OpenshiftConfig, matches func(c OpenshiftClusterConfig) bool) bool {
+	for _, c := range o.GetClusters() {
+		if matches(c) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testConfig = `
+sessionKey: secret
+ldap:
+  host: ldap.example.com
+  searchBase: dc=example,dc=com
+  filter: (uid=%s)
+openshift:
+  apiUrl: https://master.example.com
+  token: token
+  maxQuotaCpu: 30
+  maxQuotaMemory: 50
+`
+
+func writeTestConfig(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "config")
+	ok(t, err)
+	path := filepath.Join(dir, "config.yml")
+	ok(t, ioutil.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+// setEnv sets the env variable and returns a function restoring the old value
+func setEnv(key string, value string) func() {
+	old, existed := os.LookupEnv(key)
+	os.Setenv(key, value)
+	return func() {
+		if existed {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	defer setEnv("SSP_CONFIG", writeTestConfig(t, testConfig))()
+
+	c, err := LoadConfig()
+	ok(t, err)
+	equals(t, "https://master.example.com", c.Openshift.APIURL)
+	equals(t, 30, c.Openshift.MaxQuotaCPU)
+	equals(t, 30*time.Second, c.Openshift.Timeout)
+	equals(t, "audit.log", c.AuditLogFile)
+	equals(t, LdapTLSStartTLS, c.Ldap.TLS)
+	assert(t, c.Openshift.IsEnabled(), "OpenShift should be enabled by its api url")
+	assert(t, !c.Aws.IsEnabled(), "AWS should be disabled without a region")
+}
+
+func TestLoadConfigEnvOverrides(t *testing.T) {
+	defer setEnv("SSP_CONFIG", writeTestConfig(t, testConfig))()
+	defer setEnv("MAX_QUOTA_CPU", "10")()
+	defer setEnv("GLUSTER_IPS", "10.0.0.1, 10.0.0.2")()
+	defer setEnv("AWS_ENABLED", "false")()
+	defer setEnv("AWS_PROD_ACCESS_KEY_ID", "key")()
+	defer setEnv("NFS_PROXY", "http://proxy:3128")()
+	defer setEnv("DDC_INSECURE_SKIP_VERIFY", "true")()
+	defer setEnv("CHARGEBACK_CPU", "12.5")()
+
+	c, err := LoadConfig()
+	ok(t, err)
+	equals(t, 10, c.Openshift.MaxQuotaCPU)
+	equals(t, "http://proxy:3128", c.Openshift.Nfs.Proxy)
+	equals(t, 12.5, c.Openshift.Chargeback.CPU)
+	assert(t, c.DDC.InsecureSkipVerify, "Skipping the verification should be set by env")
+	equals(t, []string{"10.0.0.1", "10.0.0.2"}, c.Openshift.Gluster.IPs)
+	equals(t, "key", c.Aws.Prod.AccessKeyID)
+	assert(t, !c.Aws.IsEnabled(), "AWS should be disabled explicitly")
+}
+
+func TestLoadConfigInvalidEnv(t *testing.T) {
+	defer setEnv("SSP_CONFIG", writeTestConfig(t, testConfig))()
+	defer setEnv("MAX_VOLUME_GB", "abc")()
+
+	_, err := LoadConfig()
+	assert(t, err != nil && strings.Contains(err.Error(), "MAX_VOLUME_GB"), "Invalid integers should be rejected")
+}
+
+func TestLoadConfigMissingFile(t *testing.T) {
+	defer setEnv("SSP_CONFIG", "/does/not/exist.yml")()
+
+	_, err := LoadConfig()
+	assert(t, err != nil, "An explicitly specified config file must exist")
+}
+
+func TestValidateEnabledModules(t *testing.T) {
+	defer setEnv("SSP_CONFIG", writeTestConfig(t, testConfig))()
+	defer setEnv("GLUSTER_API_URL", "http://gluster.example.com")()
+	defer setEnv("AWS_REGION", "eu-central-1")()
+
+	_, err := LoadConfig()
+	assert(t, err != nil, "Incomplete modules should be rejected")
+	for _, key := range []string{"GLUSTER_SECRET", "GLUSTER_IPS", "MAX_VOLUME_GB", "AWS_S3_BUCKET_PREFIX"} {
+		assert(t, strings.Contains(err.Error(), key), "Missing value %v should be reported", key)
+	}
+	assert(t, !strings.Contains(err.Error(), "SEMATEXT"), "Disabled modules should not be validated")
+}
+
+func TestOpenshiftClusters(t *testing.T) {
+	defer setEnv("SSP_CONFIG", writeTestConfig(t, testConfig))()
+
+	cfg, err := LoadConfig()
+	ok(t, err)
+	clusters := cfg.Openshift.GetClusters()
+	equals(t, 1, len(clusters))
+	equals(t, "default", clusters[0].ID)
+	equals(t, "https://master.example.com", clusters[0].APIURL)
+
+	defer setEnv("SSP_CONFIG", writeTestConfig(t, testConfig+`
+  clusters:
+  - id: prod
+    name: Produktion
+    apiUrl: https://prod.example.com
+    token: prod
+    gluster:
+      apiUrl: http://gluster.example.com
+  - id: prod
+    name: Test
+    apiUrl: https://test.example.com
+`))()
+
+	_, err = LoadConfig()
+	assert(t, err != nil, "Incomplete clusters should be rejected")
+	for _, key := range []string{"clusters[0].gluster.secret", "clusters[1].id", "clusters[1].token"} {
+		assert(t, strings.Contains(err.Error(), key), "Missing value %v should be reported", key)
+	}
+	assert(t, !strings.Contains(err.Error(), "clusters[0].token"), "Complete values should not be reported")
+}
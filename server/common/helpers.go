@@ -1,7 +1,8 @@
 package common
 
 import (
-	"log"
+	"crypto/x509"
+	"io/ioutil"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
@@ -12,24 +13,33 @@ import (
 )
 
 // ValidateIntInput checks if a the value is bigger than the specified maxValue
-func ValidateIntInput(maxValue string, input string) error {
-	maxInt, err := strconv.Atoi(maxValue)
-	if err != nil {
-		log.Fatal("Could not parse 'MAX' value of", maxValue)
-	}
-
+func ValidateIntInput(maxValue int, input string) error {
 	inputInt, err := strconv.Atoi(input)
 	if err != nil {
 		return errors.New("Bitte eine gültige Zahl eintragen")
 	}
 
-	if inputInt > maxInt {
+	if inputInt > maxValue {
 		return fmt.Errorf("Der Maximalwert für diese Eingabe ist: %v", maxValue)
 	}
 
 	return nil
 }
 
+// LoadCertPool reads a CA bundle, e.g. to verify the certificate of a backend
+func LoadCertPool(caFile string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading CA file %v: %v", caFile, err.Error())
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("The CA file %v does not contain any certificate", caFile)
+	}
+	return pool, nil
+}
+
 // GetUserName returns the username based of the gin.Context
 func GetUserName(c *gin.Context) string {
 	// AuthUserKey is set by basic auth
@@ -37,19 +47,19 @@ func GetUserName(c *gin.Context) string {
 	if exists {
 		return user.(string)
 	}
+	// Set for tokens of the identity provider
+	if user, exists := c.Get(userIDKey); exists {
+		return user.(string)
+	}
 	jwtClaims := jwt.ExtractClaims(c)
 	return jwtClaims["id"].(string)
 }
 
 // GetUserMail returns the users mail address based of the gin.Context
 func GetUserMail(c *gin.Context) string {
+	if mail, exists := c.Get(userMailKey); exists {
+		return mail.(string)
+	}
 	jwtClaims := jwt.ExtractClaims(c)
 	return jwtClaims["mail"].(string)
 }
-
-// DebugMode returns if gin is running in debug mode
-func DebugMode() bool {
-	mode := gin.Mode()
-
-	return mode != gin.ReleaseMode
-}
@@ -0,0 +1,83 @@
+package common
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// HTTPClientConfig configures the connection to an upstream api.
+// The certificate of the upstream is verified against caFile or the system CAs,
+// unless insecureSkipVerify is set explicitly.
+type HTTPClientConfig struct {
+	CAFile             string        `yaml:"caFile" env:"CA_FILE"`
+	CertFile           string        `yaml:"certFile" env:"CERT_FILE"`
+	KeyFile            string        `yaml:"keyFile" env:"KEY_FILE"`
+	InsecureSkipVerify bool          `yaml:"insecureSkipVerify" env:"INSECURE_SKIP_VERIFY"`
+	Timeout            time.Duration `yaml:"timeout" env:"TIMEOUT"`
+	Proxy              string        `yaml:"proxy" env:"PROXY"`
+}
+
+// DefaultHTTPTimeout is the timeout of the calls to an upstream without a configured timeout
+const DefaultHTTPTimeout = 30 * time.Second
+
+// NewHTTPClient returns the client for an upstream. Create it once per upstream and share it,
+// its transport keeps the connections open for the following calls.
+func NewHTTPClient(name string, config HTTPClientConfig) (*http.Client, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+	if config.InsecureSkipVerify {
+		Log.WithField("upstream", name).Warn("The certificate of the upstream is not verified")
+	}
+
+	if len(config.CAFile) > 0 {
+		pool, err := LoadCertPool(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("Error creating the http client of %v: %v", name, err.Error())
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if len(config.CertFile) > 0 || len(config.KeyFile) > 0 {
+		if len(config.CertFile) == 0 || len(config.KeyFile) == 0 {
+			return nil, fmt.Errorf("Error creating the http client of %v: %v", name, errors.New("certFile and keyFile are required together"))
+		}
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Error loading the client certificate of %v: %v", name, err.Error())
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if len(config.Proxy) > 0 {
+		proxyURL, err := url.Parse(config.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid proxy of %v: %v", name, err.Error())
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	transport := &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:     tlsConfig,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+
+	// A hanging upstream must not block the requests forever
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = DefaultHTTPTimeout
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
@@ -0,0 +1,60 @@
+package common
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHTTPClientVerifiesTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client, err := NewHTTPClient("test", HTTPClientConfig{})
+	ok(t, err)
+	_, err = client.Get(server.URL)
+	assert(t, err != nil, "An unknown certificate should be rejected")
+
+	client, err = NewHTTPClient("test", HTTPClientConfig{InsecureSkipVerify: true})
+	ok(t, err)
+	resp, err := client.Get(server.URL)
+	ok(t, err)
+	resp.Body.Close()
+
+	dir, err := ioutil.TempDir("", "ca")
+	ok(t, err)
+	caFile := filepath.Join(dir, "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.TLS.Certificates[0].Certificate[0]})
+	ok(t, ioutil.WriteFile(caFile, cert, 0600))
+
+	client, err = NewHTTPClient("test", HTTPClientConfig{CAFile: caFile})
+	ok(t, err)
+	resp, err = client.Get(server.URL)
+	ok(t, err)
+	resp.Body.Close()
+}
+
+func TestHTTPClientTimeout(t *testing.T) {
+	client, err := NewHTTPClient("test", HTTPClientConfig{})
+	ok(t, err)
+	equals(t, DefaultHTTPTimeout, client.Timeout)
+
+	client, err = NewHTTPClient("test", HTTPClientConfig{Timeout: time.Minute})
+	ok(t, err)
+	equals(t, time.Minute, client.Timeout)
+}
+
+func TestHTTPClientInvalidConfig(t *testing.T) {
+	_, err := NewHTTPClient("test", HTTPClientConfig{CAFile: "missing.pem"})
+	assert(t, err != nil, "A missing CA file should be rejected")
+
+	_, err = NewHTTPClient("test", HTTPClientConfig{CertFile: "client.pem"})
+	assert(t, err != nil, "A client certificate without key should be rejected")
+
+	_, err = NewHTTPClient("test", HTTPClientConfig{Proxy: "://proxy"})
+	assert(t, err != nil, "An invalid proxy should be rejected")
+}
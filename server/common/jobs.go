@@ -0,0 +1,276 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Status of a job
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+const (
+	jobIDKey = "SSP_JOB_ID"
+
+	// jobQueueSize is the number of jobs which can wait for a worker
+	jobQueueSize = 100
+	// jobRetention is how long finished jobs can be polled
+	jobRetention = 7 * 24 * time.Hour
+
+	jobQueueFullError   = "Es sind zu viele Aufträge in Bearbeitung. Bitte versuche es später nochmals"
+	jobInterruptedError = "Der Auftrag wurde durch einen Neustart des Servers abgebrochen. Bitte prüfe den Zustand und erstelle bei Bedarf ein Ticket"
+	jobPanicError       = "Der Auftrag ist fehlgeschlagen. Bitte erstelle ein Ticket"
+)
+
+// JobFunc is the work of a job. Its result is returned to the client when the job is done.
+type JobFunc func(ctx context.Context) (interface{}, error)
+
+// jobs is the queue of the background jobs, set by InitJobs
+var jobs *jobQueue
+
+type jobQueue struct {
+	store *jobStore
+	queue chan queuedJob
+}
+
+type queuedJob struct {
+	id  string
+	ctx context.Context
+	fn  JobFunc
+}
+
+// InitJobs starts the workers of the background jobs. The jobs are kept in memory and, if a path is set, in a json file.
+// Jobs interrupted by a restart are marked as failed.
+func InitJobs(path string, workers int) error {
+	store, err := newJobStore(path)
+	if err != nil {
+		return err
+	}
+
+	q := &jobQueue{store: store, queue: make(chan queuedJob, jobQueueSize)}
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+	jobs = q
+	return nil
+}
+
+// StartJob queues the job and returns its id. The job keeps the values of the request, e.g. its id, but not its cancellation.
+func StartJob(c *gin.Context, jobType string, fn JobFunc) (string, error) {
+	id, err := RandomString()
+	if err != nil {
+		Logger(c).WithError(err).Error("Error generating the job id")
+		return "", errors.New(jobQueueFullError)
+	}
+
+	job := Job{
+		ID:      id,
+		Type:    jobType,
+		User:    GetUserName(c),
+		Status:  JobQueued,
+		Created: time.Now(),
+	}
+	if err := jobs.store.save(job); err != nil {
+		Logger(c).WithError(err).Error("Error saving the job")
+		return "", errors.New(jobQueueFullError)
+	}
+
+	select {
+	case jobs.queue <- queuedJob{id: id, ctx: jobContext{values: c.Copy(), id: id}, fn: fn}:
+	default:
+		jobs.store.update(id, func(j *Job) {
+			now := time.Now()
+			j.Status = JobFailed
+			j.Error = jobQueueFullError
+			j.Finished = &now
+		})
+		Logger(c).WithField("job", id).Warn("Job queue is full")
+		return "", errors.New(jobQueueFullError)
+	}
+
+	Logger(c).WithFields(logrus.Fields{"job": id, "type": jobType}).Info("Queued job")
+	return id, nil
+}
+
+// SetJobProgress sets the progress of the job of the context in percent. Outside of a job it does nothing.
+func SetJobProgress(ctx context.Context, progress float64) {
+	id, ok := ctx.Value(jobIDKey).(string)
+	if !ok || jobs == nil {
+		return
+	}
+	jobs.store.setProgress(id, progress)
+}
+
+// JobHandler returns a job of the user, platform admins see every job
+func JobHandler(c *gin.Context) {
+	job, ok := jobs.store.get(c.Param("id"))
+	if !ok || (job.User != GetUserName(c) && !HasRole(c, RolePlatformAdmin)) {
+		c.JSON(http.StatusNotFound, ErrorResponse(c, fmt.Sprintf("Der Auftrag %v existiert nicht", c.Param("id"))))
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+func (q *jobQueue) work() {
+	for j := range q.queue {
+		q.run(j)
+	}
+}
+
+func (q *jobQueue) run(j queuedJob) {
+	q.store.update(j.id, func(job *Job) {
+		now := time.Now()
+		job.Status = JobRunning
+		job.Started = &now
+	})
+
+	result, err := runJob(j)
+
+	q.store.update(j.id, func(job *Job) {
+		now := time.Now()
+		job.Finished = &now
+		if err != nil {
+			job.Status = JobFailed
+			job.Error = err.Error()
+		} else {
+			job.Status = JobDone
+			job.Progress = 100
+			job.Result = result
+		}
+	})
+	Logger(j.ctx).WithFields(logrus.Fields{"job": j.id, "failed": err != nil}).Info("Finished job")
+}
+
+// runJob runs the job, a panic only fails the job and not the server
+func runJob(j queuedJob) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			Logger(j.ctx).WithField("job", j.id).Errorf("Job panicked: %v", r)
+			err = errors.New(jobPanicError)
+		}
+	}()
+	return j.fn(j.ctx)
+}
+
+// jobContext keeps the values of the request after it is finished and adds the id of the job
+type jobContext struct {
+	values context.Context
+	id     string
+}
+
+func (c jobContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (c jobContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (c jobContext) Err() error {
+	return nil
+}
+
+func (c jobContext) Value(key interface{}) interface{} {
+	if key == jobIDKey {
+		return c.id
+	}
+	return c.values.Value(key)
+}
+
+// jobStore keeps the jobs in memory and, if a path is set, in a json file.
+// The progress is only written with the next change of the status.
+type jobStore struct {
+	path string
+	mu   sync.Mutex
+	jobs map[string]Job
+}
+
+func newJobStore(path string) (*jobStore, error) {
+	s := &jobStore{path: path, jobs: map[string]Job{}}
+	if len(path) == 0 {
+		return s, nil
+	}
+
+	var list []Job
+	if err := ReadJSONFile(path, &list); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, j := range list {
+		if j.Status == JobQueued || j.Status == JobRunning {
+			j.Status = JobFailed
+			j.Error = jobInterruptedError
+			j.Finished = &now
+		}
+		s.jobs[j.ID] = j
+	}
+	return s, s.write()
+}
+
+func (s *jobStore) get(id string) (Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j, ok := s.jobs[id]
+	return j, ok
+}
+
+func (s *jobStore) save(j Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs[j.ID] = j
+	return s.write()
+}
+
+// update changes the job and writes the file. A failed write is only logged, the job goes on anyway.
+func (s *jobStore) update(id string, change func(j *Job)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j := s.jobs[id]
+	change(&j)
+	s.jobs[id] = j
+	if err := s.write(); err != nil {
+		Log.WithError(err).WithField("job", id).Error("Error writing the job file")
+	}
+}
+
+func (s *jobStore) setProgress(id string, progress float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if j, ok := s.jobs[id]; ok {
+		j.Progress = progress
+		s.jobs[id] = j
+	}
+}
+
+// write removes the expired jobs and writes the file
+func (s *jobStore) write() error {
+	for id, j := range s.jobs {
+		if j.Finished != nil && time.Since(*j.Finished) > jobRetention {
+			delete(s.jobs, id)
+		}
+	}
+	if len(s.path) == 0 {
+		return nil
+	}
+
+	var list []Job
+	for _, j := range s.jobs {
+		list = append(list, j)
+	}
+	return WriteJSONFile(s.path, list)
+}
@@ -0,0 +1,138 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setupJobs returns a router which starts jobs with the function and returns them, called as the given user
+func setupJobs(t *testing.T, path string, fn JobFunc) *gin.Engine {
+	ok(t, InitJobs(path, 1))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		user := c.GetHeader("X-User")
+		c.Set(userIDKey, user)
+		c.Set(userRolesKey, []string{RoleUser})
+		c.Set(requestIDKey, "request-"+user)
+	})
+	router.POST("/jobs", func(c *gin.Context) {
+		id, err := StartJob(c, "test", fn)
+		ok(t, err)
+		c.JSON(http.StatusAccepted, JobApiResponse{JobID: id})
+	})
+	router.GET("/jobs/:id", JobHandler)
+	return router
+}
+
+func callJobs(router *gin.Engine, method string, path string, user string) (int, Job) {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("X-User", user)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var job Job
+	json.Unmarshal(w.Body.Bytes(), &job)
+	if len(job.ID) == 0 {
+		var res JobApiResponse
+		json.Unmarshal(w.Body.Bytes(), &res)
+		job.ID = res.JobID
+	}
+	return w.Code, job
+}
+
+// waitForJob polls the job until it is finished
+func waitForJob(t *testing.T, router *gin.Engine, id string) Job {
+	for i := 0; i < 100; i++ {
+		status, job := callJobs(router, "GET", "/jobs/"+id, "u123456")
+		equals(t, http.StatusOK, status)
+		if job.Status == JobDone || job.Status == JobFailed {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Job did not finish")
+	return Job{}
+}
+
+func TestJob(t *testing.T) {
+	router := setupJobs(t, "", func(ctx context.Context) (interface{}, error) {
+		// The values of the request are kept
+		SetJobProgress(ctx, 50)
+		return GetRequestID(ctx), nil
+	})
+
+	status, started := callJobs(router, "POST", "/jobs", "u123456")
+	equals(t, http.StatusAccepted, status)
+
+	job := waitForJob(t, router, started.ID)
+	equals(t, JobDone, job.Status)
+	equals(t, "u123456", job.User)
+	equals(t, 100.0, job.Progress)
+	equals(t, "request-u123456", job.Result)
+	assert(t, job.Started != nil && job.Finished != nil, "Start and end should be set")
+
+	// Other users don't see the job
+	status, _ = callJobs(router, "GET", "/jobs/"+started.ID, "u654321")
+	equals(t, http.StatusNotFound, status)
+}
+
+func TestJob_Failed(t *testing.T) {
+	router := setupJobs(t, "", func(ctx context.Context) (interface{}, error) {
+		return nil, errors.New("Das Volume konnte nicht erstellt werden")
+	})
+
+	_, started := callJobs(router, "POST", "/jobs", "u123456")
+	job := waitForJob(t, router, started.ID)
+	equals(t, JobFailed, job.Status)
+	equals(t, "Das Volume konnte nicht erstellt werden", job.Error)
+}
+
+func TestJob_Panic(t *testing.T) {
+	router := setupJobs(t, "", func(ctx context.Context) (interface{}, error) {
+		var m map[string]string
+		m["panic"] = "nil map"
+		return nil, nil
+	})
+
+	_, started := callJobs(router, "POST", "/jobs", "u123456")
+	job := waitForJob(t, router, started.ID)
+	equals(t, JobFailed, job.Status)
+	equals(t, jobPanicError, job.Error)
+}
+
+func TestJobStore_Restart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jobs")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "jobs.json")
+
+	finished := time.Now()
+	expired := time.Now().Add(-jobRetention - time.Hour)
+	store, err := newJobStore(path)
+	ok(t, err)
+	ok(t, store.save(Job{ID: "running", Status: JobRunning}))
+	ok(t, store.save(Job{ID: "done", Status: JobDone, Finished: &finished}))
+	ok(t, store.save(Job{ID: "expired", Status: JobDone, Finished: &expired}))
+
+	store, err = newJobStore(path)
+	ok(t, err)
+	running, _ := store.get("running")
+	equals(t, JobFailed, running.Status)
+	equals(t, jobInterruptedError, running.Error)
+	done, _ := store.get("done")
+	equals(t, JobDone, done.Status)
+	_, exists := store.get("expired")
+	assert(t, !exists, "Expired job should be removed")
+}
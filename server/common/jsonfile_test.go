@@ -0,0 +1,29 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJSONFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsonfile")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "store.json")
+
+	// A missing file is an empty store
+	var list []string
+	ok(t, ReadJSONFile(path, &list))
+	equals(t, 0, len(list))
+
+	ok(t, WriteJSONFile(path, []string{"a", "b"}))
+	ok(t, ReadJSONFile(path, &list))
+	equals(t, []string{"a", "b"}, list)
+	_, err = os.Stat(path + ".tmp")
+	assert(t, os.IsNotExist(err), "Temporary file should be renamed")
+
+	ok(t, ioutil.WriteFile(path, []byte("{"), 0600))
+	assert(t, ReadJSONFile(path, &list) != nil, "Invalid json should be rejected")
+}
@@ -0,0 +1,232 @@
+package common
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/ldap.v2"
+)
+
+// errInvalidCredentials is returned if the user does not exist or the password is wrong
+var errInvalidCredentials = errors.New("invalid credentials")
+
+// ldapUser is the user found in the directory
+type ldapUser struct {
+	ID     string
+	Mail   string
+	Groups []string
+}
+
+// ldapClient authenticates users against the directory.
+// Connections bound with the service account are reused via a pool.
+type ldapClient struct {
+	config    LdapConfig
+	tlsConfig *tls.Config
+	pool      chan *ldap.Conn
+}
+
+func newLdapClient(config LdapConfig) (*ldapClient, error) {
+	tlsConfig, err := newLdapTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ldapClient{
+		config:    config,
+		tlsConfig: tlsConfig,
+		pool:      make(chan *ldap.Conn, config.PoolSize),
+	}, nil
+}
+
+// newLdapTLSConfig returns the tls config of the connection, trusting the CA bundle if one is configured
+func newLdapTLSConfig(config LdapConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{ServerName: config.Host}
+
+	if len(config.CAFile) > 0 {
+		pool, err := LoadCertPool(config.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
+
+// Authenticate checks the password of the user and returns its attributes
+func (c *ldapClient) Authenticate(username string, password string) (*ldapUser, error) {
+	if len(username) == 0 || len(password) == 0 {
+		return nil, errInvalidCredentials
+	}
+
+	conn, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+
+	user, dn, err := c.search(conn, username)
+	if ldap.IsErrorWithCode(err, ldap.ErrorNetwork) {
+		// The pooled connection might have been closed by the server, so retry once on a new one
+		conn.Close()
+		if conn, err = c.dial(); err != nil {
+			return nil, err
+		}
+		user, dn, err = c.search(conn, username)
+	}
+	if err != nil {
+		c.put(conn)
+		return nil, err
+	}
+
+	if err := conn.Bind(dn, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			c.rebind(conn)
+			return nil, errInvalidCredentials
+		}
+		conn.Close()
+		return nil, err
+	}
+
+	// Switch back to the service account before the connection is reused
+	c.rebind(conn)
+
+	return user, nil
+}
+
+// Lookup returns the attributes of the user without checking a password
+func (c *ldapClient) Lookup(username string) (*ldapUser, error) {
+	conn, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+
+	user, _, err := c.search(conn, username)
+	if ldap.IsErrorWithCode(err, ldap.ErrorNetwork) {
+		conn.Close()
+		if conn, err = c.dial(); err != nil {
+			return nil, err
+		}
+		user, _, err = c.search(conn, username)
+	}
+	c.put(conn)
+	return user, err
+}
+
+// LookupUserMail returns the mail address of the user in the directory
+func LookupUserMail(username string) (string, error) {
+	if directory == nil {
+		return "", errors.New("ldap is not enabled")
+	}
+	user, err := directory.Lookup(username)
+	if err == errInvalidCredentials {
+		return "", fmt.Errorf("user %v not found in the directory", username)
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(user.Mail) == 0 {
+		return "", fmt.Errorf("user %v has no mail address", username)
+	}
+	return user.Mail, nil
+}
+
+func (c *ldapClient) search(conn *ldap.Conn, username string) (*ldapUser, string, error) {
+	req := ldap.NewSearchRequest(
+		c.config.SearchBase,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		fmt.Sprintf(c.config.Filter, ldap.EscapeFilter(username)),
+		[]string{c.config.MailAttribute, c.config.GroupAttribute},
+		nil,
+	)
+
+	res, err := conn.Search(req)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(res.Entries) != 1 {
+		if len(res.Entries) > 1 {
+			Log.WithFields(logrus.Fields{"user": username, "entries": len(res.Entries)}).Warn("Ldap search for user returned more than one entry")
+		}
+		return nil, "", errInvalidCredentials
+	}
+
+	entry := res.Entries[0]
+	return &ldapUser{
+		ID:     username,
+		Mail:   entry.GetAttributeValue(c.config.MailAttribute),
+		Groups: entry.GetAttributeValues(c.config.GroupAttribute),
+	}, entry.DN, nil
+}
+
+// get returns a connection of the pool or a new one if the pool is empty
+func (c *ldapClient) get() (*ldap.Conn, error) {
+	select {
+	case conn := <-c.pool:
+		return conn, nil
+	default:
+		return c.dial()
+	}
+}
+
+// put returns the connection to the pool or closes it if the pool is full
+func (c *ldapClient) put(conn *ldap.Conn) {
+	select {
+	case c.pool <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+// rebind binds the connection with the service account again and returns it to the pool
+func (c *ldapClient) rebind(conn *ldap.Conn) {
+	if len(c.config.BindDN) == 0 {
+		// Connections are only reused with a service account, they would stay bound to the user otherwise
+		conn.Close()
+		return
+	}
+	if err := c.bindServiceAccount(conn); err != nil {
+		Log.WithError(err).Error("Error binding ldap service account")
+		conn.Close()
+		return
+	}
+	c.put(conn)
+}
+
+func (c *ldapClient) dial() (*ldap.Conn, error) {
+	var conn *ldap.Conn
+	var err error
+
+	switch c.config.TLS {
+	case LdapTLSLdaps:
+		conn, err = ldap.DialTLS("tcp", c.config.Address(), c.tlsConfig)
+	default:
+		conn, err = ldap.Dial("tcp", c.config.Address())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if c.config.TLS == LdapTLSStartTLS {
+		if err := conn.StartTLS(c.tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	if err := c.bindServiceAccount(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func (c *ldapClient) bindServiceAccount(conn *ldap.Conn) error {
+	if len(c.config.BindDN) == 0 {
+		return nil
+	}
+	return conn.Bind(c.config.BindDN, c.config.BindPassword)
+}
@@ -0,0 +1,56 @@
+package common
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestLdapAddress(t *testing.T) {
+	equals(t, "ldap.example.com:389", LdapConfig{Host: "ldap.example.com", TLS: LdapTLSNone}.Address())
+	equals(t, "ldap.example.com:389", LdapConfig{Host: "ldap.example.com", TLS: LdapTLSStartTLS}.Address())
+	equals(t, "ldap.example.com:636", LdapConfig{Host: "ldap.example.com", TLS: LdapTLSLdaps}.Address())
+	equals(t, "ldap.example.com:1636", LdapConfig{Host: "ldap.example.com", TLS: LdapTLSLdaps, Port: 1636}.Address())
+}
+
+func TestLdapTLSConfigCAFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+
+	f, err := ioutil.TempFile("", "ca")
+	ok(t, err)
+	defer os.Remove(f.Name())
+	ok(t, pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+	f.Close()
+
+	tlsConfig, err := newLdapTLSConfig(LdapConfig{Host: "ldap.example.com", CAFile: f.Name()})
+	ok(t, err)
+	equals(t, "ldap.example.com", tlsConfig.ServerName)
+	assert(t, tlsConfig.RootCAs != nil, "The CA bundle should be trusted")
+}
+
+func TestLdapTLSConfigInvalidCAFile(t *testing.T) {
+	_, err := newLdapTLSConfig(LdapConfig{CAFile: "/does/not/exist.pem"})
+	assert(t, err != nil, "A missing CA file should be rejected")
+
+	f, err := ioutil.TempFile("", "ca")
+	ok(t, err)
+	defer os.Remove(f.Name())
+	f.WriteString("no certificate")
+	f.Close()
+
+	_, err = newLdapTLSConfig(LdapConfig{CAFile: f.Name()})
+	assert(t, err != nil, "A CA file without certificates should be rejected")
+}
+
+func TestLdapAuthenticateEmptyPassword(t *testing.T) {
+	client, err := newLdapClient(LdapConfig{Host: "localhost", PoolSize: 1})
+	ok(t, err)
+
+	// Empty passwords would result in an unauthenticated bind, which succeeds on most directories
+	_, err = client.Authenticate("u123456", "")
+	equals(t, errInvalidCredentials, err)
+}
@@ -0,0 +1,113 @@
+package common
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// RequestIDHeader contains the id of a request. It is returned to the client
+// and passed on to the backends called while handling the request.
+const RequestIDHeader = "X-Request-ID"
+
+const requestIDKey = "SSP_REQUEST_ID"
+
+// validRequestID restricts the ids accepted from clients, so they can't inject anything into our logs
+var validRequestID = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,64}$`)
+
+// Log is the logger of the backend, it writes json lines to stderr
+var Log = newLogger()
+
+func newLogger() *logrus.Logger {
+	l := logrus.New()
+	l.Formatter = &logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano}
+	return l
+}
+
+// SetLogLevel sets the minimal level of the logged messages: debug, info, warning or error
+func SetLogLevel(level string) error {
+	l, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	Log.SetLevel(l)
+	return nil
+}
+
+// Logger returns the logger for the context, its messages contain the id of the request
+func Logger(ctx context.Context) *logrus.Entry {
+	if id := GetRequestID(ctx); len(id) > 0 {
+		return Log.WithField("request_id", id)
+	}
+	return logrus.NewEntry(Log)
+}
+
+// GetRequestID returns the id of the request of the context, it is empty for background jobs
+func GetRequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// SetRequestIDHeader passes the id of the request on to a called backend
+func SetRequestIDHeader(ctx context.Context, req *http.Request) {
+	if id := GetRequestID(ctx); len(id) > 0 {
+		req.Header.Set(RequestIDHeader, id)
+	}
+}
+
+// RequestIDMiddleware assigns an id to every request. The id of a proxy in front of us is kept.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			var err error
+			if id, err = RandomString(); err != nil {
+				Log.WithError(err).Error("Error generating request id")
+			}
+		}
+
+		c.Set(requestIDKey, id)
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+// RequestLogger logs every request after it was handled
+func RequestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		entry := Logger(c).WithFields(logrus.Fields{
+			"method":   c.Request.Method,
+			"path":     c.Request.URL.Path,
+			"status":   c.Writer.Status(),
+			"duration": time.Since(start).String(),
+			"client":   c.ClientIP(),
+		})
+		if len(c.Errors) > 0 {
+			entry = entry.WithField("errors", c.Errors.String())
+		}
+
+		switch {
+		case c.Writer.Status() >= http.StatusInternalServerError:
+			entry.Error("Request failed")
+		case c.Writer.Status() >= http.StatusBadRequest:
+			entry.Warn("Request rejected")
+		default:
+			entry.Info("Request handled")
+		}
+	}
+}
+
+// ErrorResponse returns the response for a failed request, it contains the request id for support tickets
+func ErrorResponse(c *gin.Context, message string) ApiResponse {
+	return ApiResponse{Message: message, RequestID: GetRequestID(c)}
+}
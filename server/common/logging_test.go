@@ -0,0 +1,60 @@
+package common
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var backendHeader string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendHeader = r.Header.Get(RequestIDHeader)
+	}))
+	defer backend.Close()
+
+	router := gin.New()
+	router.Use(RequestIDMiddleware())
+	router.GET("/", func(c *gin.Context) {
+		req, _ := http.NewRequest("GET", backend.URL, nil)
+		SetRequestIDHeader(c, req)
+		http.DefaultClient.Do(req)
+
+		c.JSON(http.StatusBadRequest, ErrorResponse(c, "Fehler"))
+	})
+
+	call := func(id string) (string, ApiResponse) {
+		req := httptest.NewRequest("GET", "/", nil)
+		if len(id) > 0 {
+			req.Header.Set(RequestIDHeader, id)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var res ApiResponse
+		json.Unmarshal(w.Body.Bytes(), &res)
+		return w.Header().Get(RequestIDHeader), res
+	}
+
+	// A new id is assigned
+	header, res := call("")
+	assert(t, len(header) > 0, "Request id should be assigned")
+	equals(t, header, res.RequestID)
+	equals(t, header, backendHeader)
+	equals(t, "Fehler", res.Message)
+
+	// The id of a proxy is kept
+	header, res = call("abc-123")
+	equals(t, "abc-123", header)
+	equals(t, "abc-123", res.RequestID)
+	equals(t, "abc-123", backendHeader)
+
+	// Invalid ids are replaced
+	header, _ = call("abc\ninjected")
+	assert(t, header != "abc\ninjected" && len(header) > 0, "Invalid request id should be replaced")
+}
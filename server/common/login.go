@@ -1,100 +1,164 @@
 package common
 
 import (
-	"log"
-	"os"
+	"context"
+	"net/http"
 	"time"
 
+	jwtgo "github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 
-	"github.com/jtblin/go-ldap-client"
 	"github.com/patrickmn/go-cache"
 	"gopkg.in/appleboy/gin-jwt.v2"
 )
 
+const (
+	tokenTimeout = time.Hour
+
+	// Context keys of users authenticated with a token of the identity provider
+	userIDKey   = "SSP_USER_ID"
+	userMailKey = "SSP_USER_MAIL"
+)
+
 var userCache *cache.Cache
 
-// GetAuthMiddleware returns a gin middleware for JWT with cookie based auth
-func GetAuthMiddleware() *jwt.GinJWTMiddleware {
-	key := os.Getenv("SESSION_KEY")
+// cachedUser contains the attributes of the directory, which are written into the token
+type cachedUser struct {
+	Mail  string
+	Roles []string
+}
 
-	if len(key) == 0 {
-		log.Fatal("Env variable 'SESSION_KEY' must be specified")
-	}
+var directory *ldapClient
 
+// GetAuthMiddleware returns a gin middleware for JWT with cookie based auth.
+// It initializes the configured authentication backends.
+func GetAuthMiddleware() (*jwt.GinJWTMiddleware, error) {
 	// Initialize the user cache
 	userCache = cache.New(10*time.Minute, 24*time.Hour)
 
+	var err error
+	if len(cfg.RevocationFile) > 0 {
+		if revocations, err = NewFileRevocationStore(cfg.RevocationFile); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.AuthBackendEnabled(AuthBackendLdap) {
+		if directory, err = newLdapClient(cfg.Ldap); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.AuthBackendEnabled(AuthBackendOidc) {
+		if identityProvider, err = newOidcProvider(context.Background(), cfg.Oidc); err != nil {
+			return nil, err
+		}
+	}
+
 	return &jwt.GinJWTMiddleware{
 		Realm:         "CLOUD_SSP",
-		Key:           []byte(key),
-		Timeout:       time.Hour,
-		MaxRefresh:    time.Hour,
+		Key:           []byte(cfg.SessionKey),
+		Timeout:       tokenTimeout,
+		MaxRefresh:    cfg.TokenMaxRefresh,
 		Authenticator: ldapAuthenticator,
+		// Tokens without roles were issued before roles existed, the user has to log in again
 		Authorizator: func(userId interface{}, c *gin.Context) bool {
-			return true
+			return len(GetUserRoles(c)) > 0
 		},
 		Unauthorized: func(c *gin.Context, code int, message string) {
 			c.JSON(code, gin.H{
-				"code":    code,
-				"message": message,
+				"code":      code,
+				"message":   message,
+				"requestId": GetRequestID(c),
 			})
 		},
 		PayloadFunc: userPayloadFunc,
 		TokenLookup: "header:Authorization",
 		TimeFunc:    time.Now,
+	}, nil
+}
+
+// AuthMiddleware accepts our own tokens and, if OpenID Connect is enabled, the tokens of the identity provider
+func AuthMiddleware(mw *jwt.GinJWTMiddleware) gin.HandlerFunc {
+	jwtMiddleware := mw.MiddlewareFunc()
+
+	return func(c *gin.Context) {
+		if isRevokedToken(getBearerToken(c)) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse(c, revokedTokenError))
+			return
+		}
+
+		if identityProvider != nil {
+			if token := getBearerToken(c); len(token) > 0 {
+				if user, err := identityProvider.verifyBearer(c.Request.Context(), token); err == nil {
+					c.Set(userIDKey, user.ID)
+					c.Set(userMailKey, user.Mail)
+					c.Set(userRolesKey, getRoles(user.ID, user.Groups))
+					c.Next()
+					return
+				}
+			}
+		}
+
+		jwtMiddleware(c)
 	}
 }
 
+// generateToken returns a token with the same claims as the ones of the ldap login
+func generateToken(userID string, mail string, roles []string) (string, time.Time, error) {
+	session, err := RandomString()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return signToken(jwtgo.MapClaims{
+		"id":         userID,
+		"mail":       mail,
+		rolesClaim:   roles,
+		sessionClaim: session,
+		"orig_iat":   time.Now().Unix(),
+	})
+}
+
+// signToken signs the claims with a new expiry
+func signToken(claims jwtgo.MapClaims) (string, time.Time, error) {
+	expire := time.Now().Add(tokenTimeout)
+	claims["exp"] = expire.Unix()
+
+	signed, err := jwtgo.NewWithClaims(jwtgo.SigningMethodHS256, claims).SignedString([]byte(cfg.SessionKey))
+	return signed, expire, err
+}
+
 func userPayloadFunc(userID interface{}) jwt.MapClaims {
-	if mail, ok := userCache.Get(userID.(string)); ok {
+	session, err := RandomString()
+	if err != nil {
+		Log.WithError(err).Error("Error generating session id")
+		return nil
+	}
+
+	if user, ok := userCache.Get(userID.(string)); ok {
 		res := make(map[string]interface{})
-		res["mail"] = mail
+		res[sessionClaim] = session
+		res["mail"] = user.(cachedUser).Mail
+		res[rolesClaim] = user.(cachedUser).Roles
 		return res
 	} else {
-		log.Println("Error, could not find mail for user: " + userID.(string) + " - Sematext functions will not work correctly")
+		Log.WithField("user", userID).Error("Could not find mail and roles for user, the token will be rejected")
 		return nil
 	}
 }
 
 func ldapAuthenticator(userID string, password string, c *gin.Context) (interface{}, bool) {
-	//ldapHost := os.Getenv("LDAP_URL")
-	//ldapBind := os.Getenv("LDAP_BIND_DN")
-	//ldapBindPw := os.Getenv("LDAP_BIND_CRED")
-	//ldapFilter := os.Getenv("LDAP_FILTER")
-	//ldapSearchBase := os.Getenv("LDAP_SEARCH_BASE")
-	
-	ldapHost := xplat.fis.vn
-	ldapBind := xplat\\Administrator
-	ldapBindPw := Abcd@1234
-	ldapFilter := os.Getenv("LDAP_FILTER")
-	ldapSearchBase := os.Getenv("LDAP_SEARCH_BASE")
-
-	client := &ldap.LDAPClient{
-		Attributes:   []string{"givenName", "sn", "mail", "uid"},
-		Base:         ldapSearchBase,
-		Host:         ldapHost,
-		Port:         389,
-		UseSSL:       false,
-		SkipTLS:      true,
-		BindDN:       ldapBind,
-		BindPassword: ldapBindPw,
-		UserFilter:   ldapFilter,
+	user, err := directory.Authenticate(userID, password)
+	if err == errInvalidCredentials {
+		Logger(c).WithField("user", userID).Info("Authenticating failed")
+		return userID, false
 	}
-
-	// It is the responsibility of the caller to close the connection
-	defer client.Close()
-
-	ok, user, err := client.Authenticate(userID, password)
 	if err != nil {
-		log.Printf("Error authenticating user %s: %+v", userID, err)
-	}
-	if !ok {
-		log.Printf("Authenticating failed for user %s", userID)
+		Logger(c).WithError(err).WithField("user", userID).Error("Error authenticating user")
+		return userID, false
 	}
 
-	// Put the user mail address in the cache for the payload function
-	userCache.Add(userID, user["mail"], cache.DefaultExpiration)
+	// Put the user mail address and roles in the cache for the payload function
+	userCache.Set(userID, cachedUser{Mail: user.Mail, Roles: getRoles(userID, user.Groups)}, cache.DefaultExpiration)
 
-	return userID, ok
+	return userID, true
 }
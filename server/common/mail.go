@@ -0,0 +1,29 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/smtp"
+)
+
+// SendMail sends a plain text mail to the recipient via the configured smtp server
+func SendMail(to string, subject string, body string) error {
+	server := cfg.Mail.Server
+	sender := cfg.Mail.Sender
+
+	if len(server) == 0 || len(sender) == 0 {
+		Log.Warn("The mail server and sender must be configured to send mails")
+		return errors.New("Mailversand ist nicht konfiguriert")
+	}
+
+	msg := fmt.Sprintf("From: %v\r\nTo: %v\r\nSubject: %v\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%v",
+		sender, to, mime.QEncoding.Encode("utf-8", subject), body)
+
+	if err := smtp.SendMail(server, nil, sender, []string{to}, []byte(msg)); err != nil {
+		Log.WithError(err).WithField("to", to).Error("Error sending mail")
+		return err
+	}
+
+	return nil
+}
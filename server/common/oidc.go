@@ -0,0 +1,264 @@
+package common
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+)
+
+const (
+	oidcLoginError = "Die Anmeldung ist fehlgeschlagen"
+	oidcStateTTL   = 10 * time.Minute
+	// oidcStateCookie binds a login to the browser which started it
+	oidcStateCookie = "ssp_oidc_state"
+)
+
+// identityProvider is the OpenID Connect provider, set by GetAuthMiddleware if the backend is enabled
+var identityProvider *oidcProvider
+
+// oidcUser is the user of a verified token of the identity provider
+type oidcUser struct {
+	ID     string
+	Mail   string
+	Groups []string
+}
+
+type oidcProvider struct {
+	config         OidcConfig
+	oauth2         oauth2.Config
+	idTokenChecker *oidc.IDTokenVerifier
+	bearerChecker  *oidc.IDTokenVerifier
+}
+
+// newOidcProvider discovers the endpoints and keys of the identity provider
+func newOidcProvider(ctx context.Context, config OidcConfig) (*oidcProvider, error) {
+	provider, err := oidc.NewProvider(ctx, config.IssuerURL)
+	if err != nil {
+		return nil, errors.New("Error discovering the OpenID Connect provider: " + err.Error())
+	}
+
+	audience := config.Audience
+	if len(audience) == 0 {
+		audience = config.ClientID
+	}
+
+	return &oidcProvider{
+		config: config,
+		oauth2: oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			RedirectURL:  config.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       config.Scopes,
+		},
+		idTokenChecker: provider.Verifier(&oidc.Config{ClientID: config.ClientID}),
+		bearerChecker:  provider.Verifier(&oidc.Config{ClientID: audience}),
+	}, nil
+}
+
+// OidcLoginHandler redirects the user to the identity provider
+func OidcLoginHandler(c *gin.Context) {
+	state, err := RandomString()
+	if err != nil {
+		Logger(c).WithError(err).Error("Error generating oidc state")
+		c.JSON(http.StatusInternalServerError, ErrorResponse(c, oidcLoginError))
+		return
+	}
+	nonce, err := RandomString()
+	if err != nil {
+		Logger(c).WithError(err).Error("Error generating oidc nonce")
+		c.JSON(http.StatusInternalServerError, ErrorResponse(c, oidcLoginError))
+		return
+	}
+
+	// The state and the nonce are kept in the browser, so the callback can reach any replica
+	identityProvider.setStateCookie(c, signOidcState(state, nonce, time.Now().Add(oidcStateTTL)), int(oidcStateTTL.Seconds()))
+
+	c.Redirect(http.StatusFound, identityProvider.oauth2.AuthCodeURL(state, oidc.Nonce(nonce)))
+}
+
+// OidcCallbackHandler exchanges the authorization code of the identity provider for our own token.
+// The token is passed to the frontend in the url fragment if a frontend url is configured.
+func OidcCallbackHandler(c *gin.Context) {
+	var stateCookie string
+	if cookie, err := c.Request.Cookie(oidcStateCookie); err == nil {
+		stateCookie = cookie.Value
+	}
+	// The state is only used once
+	identityProvider.setStateCookie(c, "", -1)
+
+	user, err := identityProvider.handleCallback(c.Request.Context(), stateCookie, c.Query("state"), c.Query("code"), c.Query("error"))
+	if err != nil {
+		Logger(c).WithError(err).Warn("OpenID Connect login failed")
+		c.JSON(http.StatusUnauthorized, ErrorResponse(c, oidcLoginError))
+		return
+	}
+
+	token, expire, err := generateToken(user.ID, user.Mail, getRoles(user.ID, user.Groups))
+	if err != nil {
+		Logger(c).WithError(err).Error("Error generating token")
+		c.JSON(http.StatusInternalServerError, ErrorResponse(c, oidcLoginError))
+		return
+	}
+
+	Logger(c).WithField("user", user.ID).Info("User logged in with OpenID Connect")
+
+	if len(identityProvider.config.FrontendURL) > 0 {
+		fragment := url.Values{}
+		fragment.Set("token", token)
+		fragment.Set("expire", expire.Format(time.RFC3339))
+		c.Redirect(http.StatusFound, identityProvider.config.FrontendURL+"#"+fragment.Encode())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":   http.StatusOK,
+		"token":  token,
+		"expire": expire.Format(time.RFC3339),
+	})
+}
+
+// handleCallback checks that the login was started by the same browser and returns the user of the id token
+func (p *oidcProvider) handleCallback(ctx context.Context, stateCookie string, state string, code string, idpError string) (*oidcUser, error) {
+	if len(idpError) > 0 {
+		return nil, errors.New("identity provider returned error: " + idpError)
+	}
+
+	cookieState, nonce, err := parseOidcState(stateCookie)
+	if err != nil {
+		return nil, err
+	}
+	if len(state) == 0 || !hmac.Equal([]byte(state), []byte(cookieState)) {
+		return nil, errors.New("state did not match the state cookie")
+	}
+
+	token, err := p.oauth2.Exchange(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("token response did not contain an id_token")
+	}
+
+	idToken, err := p.idTokenChecker.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+	if idToken.Nonce != nonce {
+		return nil, errors.New("nonce of the id_token did not match")
+	}
+
+	return p.getUser(idToken)
+}
+
+// setStateCookie sets the state cookie for the callback, a negative maxAge deletes it
+func (p *oidcProvider) setStateCookie(c *gin.Context, value string, maxAge int) {
+	path := "/"
+	if u, err := url.Parse(p.config.RedirectURL); err == nil && len(u.Path) > 0 {
+		path = u.Path
+	}
+	cookie := &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     path,
+		MaxAge:   maxAge,
+		Secure:   true,
+		HttpOnly: true,
+	}
+	// Lax sends the cookie along with the redirect of the identity provider
+	c.Writer.Header().Add("Set-Cookie", cookie.String()+"; SameSite=Lax")
+}
+
+// signOidcState returns the value of the state cookie: the state, the nonce and the expiry, signed with the session key
+func signOidcState(state string, nonce string, expire time.Time) string {
+	value := state + "." + nonce + "." + strconv.FormatInt(expire.Unix(), 10)
+	return value + "." + oidcStateMAC(value)
+}
+
+// parseOidcState checks the signature and the expiry of the state cookie and returns its state and nonce
+func parseOidcState(cookie string) (string, string, error) {
+	parts := strings.Split(cookie, ".")
+	if len(parts) != 4 {
+		return "", "", errors.New("missing or invalid state cookie")
+	}
+	value := strings.Join(parts[:3], ".")
+	if !hmac.Equal([]byte(parts[3]), []byte(oidcStateMAC(value))) {
+		return "", "", errors.New("invalid signature of the state cookie")
+	}
+	expire, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil || time.Now().Unix() > expire {
+		return "", "", errors.New("expired state cookie")
+	}
+	return parts[0], parts[1], nil
+}
+
+func oidcStateMAC(value string) string {
+	mac := hmac.New(sha256.New, []byte(cfg.SessionKey))
+	// The prefix separates the signatures of the state from the ones of other values
+	mac.Write([]byte("oidc-state:" + value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyBearer validates a token of the identity provider against its published keys
+func (p *oidcProvider) verifyBearer(ctx context.Context, rawToken string) (*oidcUser, error) {
+	token, err := p.bearerChecker.Verify(ctx, rawToken)
+	if err != nil {
+		return nil, err
+	}
+	return p.getUser(token)
+}
+
+func (p *oidcProvider) getUser(token *oidc.IDToken) (*oidcUser, error) {
+	var claims map[string]interface{}
+	if err := token.Claims(&claims); err != nil {
+		return nil, err
+	}
+
+	id, _ := claims[p.config.UserClaim].(string)
+	if len(id) == 0 {
+		return nil, errors.New("token did not contain the claim " + p.config.UserClaim)
+	}
+	mail, _ := claims[p.config.MailClaim].(string)
+
+	var groups []string
+	claim, _ := claims[p.config.GroupsClaim].([]interface{})
+	for _, g := range claim {
+		if group, ok := g.(string); ok {
+			groups = append(groups, group)
+		}
+	}
+
+	return &oidcUser{ID: id, Mail: mail, Groups: groups}, nil
+}
+
+// getBearerToken returns the token of the authorization header
+func getBearerToken(c *gin.Context) string {
+	header := c.GetHeader("Authorization")
+	if strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer ")
+	}
+	return ""
+}
+
+// RandomString returns 32 random hex characters, e.g. for ids and sessions
+func RandomString() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
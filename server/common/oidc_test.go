@@ -0,0 +1,244 @@
+package common
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/square/go-jose.v2"
+)
+
+const (
+	testClientID = "ssp"
+	testCode     = "auth-code"
+)
+
+// mockIdentityProvider is a minimal OpenID Connect provider
+type mockIdentityProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	nonce  string
+}
+
+func newMockIdentityProvider(t *testing.T) *mockIdentityProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	ok(t, err)
+
+	idp := &mockIdentityProvider{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/auth",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "test", Algorithm: "RS256", Use: "sig"},
+		}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != testCode {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idp.sign(t, map[string]interface{}{"nonce": idp.nonce}),
+		})
+	})
+	idp.server = httptest.NewServer(mux)
+
+	return idp
+}
+
+// sign returns a token of the user u123456, the claims overwrite the defaults
+func (idp *mockIdentityProvider) sign(t *testing.T, claims map[string]interface{}) string {
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: idp.key},
+		(&jose.SignerOptions{}).WithHeader("kid", "test"))
+	ok(t, err)
+
+	payload := map[string]interface{}{
+		"iss":                idp.server.URL,
+		"aud":                testClientID,
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"iat":                time.Now().Unix(),
+		"preferred_username": "u123456",
+		"email":              "max.muster@example.com",
+		"groups":             []string{"billing"},
+	}
+	for k, v := range claims {
+		payload[k] = v
+	}
+	b, err := json.Marshal(payload)
+	ok(t, err)
+
+	jws, err := signer.Sign(b)
+	ok(t, err)
+	token, err := jws.CompactSerialize()
+	ok(t, err)
+	return token
+}
+
+func setupOidc(t *testing.T) (*mockIdentityProvider, *gin.Engine) {
+	idp := newMockIdentityProvider(t)
+
+	cfg = defaultConfig()
+	cfg.SessionKey = "secret"
+	cfg.AuthBackends = []string{AuthBackendOidc}
+	cfg.Oidc.IssuerURL = idp.server.URL
+	cfg.Oidc.ClientID = testClientID
+	cfg.Oidc.ClientSecret = "client-secret"
+	cfg.Oidc.RedirectURL = "http://localhost:8080/login/oidc/callback"
+	cfg.BillingAdminGroups = []string{"billing"}
+
+	mw, err := GetAuthMiddleware()
+	ok(t, err)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/login/oidc", OidcLoginHandler)
+	router.GET("/login/oidc/callback", OidcCallbackHandler)
+	router.GET("/api/user", AuthMiddleware(mw), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"id": GetUserName(c), "mail": GetUserMail(c), "roles": GetUserRoles(c)})
+	})
+
+	return idp, router
+}
+
+type testUser struct {
+	ID    string
+	Mail  string
+	Roles []string
+}
+
+func getUser(router *gin.Engine, token string) (int, testUser) {
+	req := httptest.NewRequest("GET", "/api/user", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var user testUser
+	json.Unmarshal(w.Body.Bytes(), &user)
+	return w.Code, user
+}
+
+func TestOidcLogin(t *testing.T) {
+	idp, router := setupOidc(t)
+	defer idp.server.Close()
+	defer func() { identityProvider = nil }()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/login/oidc", nil))
+	equals(t, http.StatusFound, w.Code)
+
+	redirect, err := url.Parse(w.Header().Get("Location"))
+	ok(t, err)
+	equals(t, idp.server.URL+"/auth", redirect.Scheme+"://"+redirect.Host+redirect.Path)
+	equals(t, testClientID, redirect.Query().Get("client_id"))
+	state := redirect.Query().Get("state")
+	idp.nonce = redirect.Query().Get("nonce")
+	cookie := w.Result().Cookies()[0]
+	equals(t, oidcStateCookie, cookie.Name)
+	equals(t, "/login/oidc/callback", cookie.Path)
+	assert(t, cookie.HttpOnly && cookie.Secure, "State cookie should be HttpOnly and Secure")
+	assert(t, strings.HasSuffix(w.Header().Get("Set-Cookie"), "; SameSite=Lax"), "State cookie should be SameSite=Lax")
+
+	w = callback(router, "code="+testCode+"&state="+state, cookie)
+	equals(t, http.StatusOK, w.Code)
+	equals(t, -1, w.Result().Cookies()[0].MaxAge)
+
+	var res struct{ Token string }
+	ok(t, json.Unmarshal(w.Body.Bytes(), &res))
+
+	// Our own token has the same claims as the ones of the ldap login
+	code, user := getUser(router, res.Token)
+	equals(t, http.StatusOK, code)
+	equals(t, "u123456", user.ID)
+	equals(t, "max.muster@example.com", user.Mail)
+	equals(t, []string{RoleUser, RoleBillingAdmin}, user.Roles)
+
+	// The state is deleted with the cookie
+	w = callback(router, "code="+testCode+"&state="+state, nil)
+	equals(t, http.StatusUnauthorized, w.Code)
+}
+
+// callback calls the callback of the login with the state cookie of the browser
+func callback(router *gin.Engine, query string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/login/oidc/callback?"+query, nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// startLogin starts a login and returns its state and state cookie
+func startLogin(t *testing.T, router *gin.Engine) (string, *http.Cookie) {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/login/oidc", nil))
+	redirect, err := url.Parse(w.Header().Get("Location"))
+	ok(t, err)
+	return redirect.Query().Get("state"), w.Result().Cookies()[0]
+}
+
+func TestOidcLoginOtherBrowser(t *testing.T) {
+	idp, router := setupOidc(t)
+	defer idp.server.Close()
+	defer func() { identityProvider = nil }()
+
+	// An attacker can't log in the victim with the state and code of their own login
+	attackerState, attackerCookie := startLogin(t, router)
+	_, victimCookie := startLogin(t, router)
+	equals(t, http.StatusUnauthorized, callback(router, "code="+testCode+"&state="+attackerState, nil).Code)
+	equals(t, http.StatusUnauthorized, callback(router, "code="+testCode+"&state="+attackerState, victimCookie).Code)
+
+	// The cookie can't be changed
+	attackerCookie.Value = strings.Replace(attackerCookie.Value, attackerState, "0123", 1)
+	equals(t, http.StatusUnauthorized, callback(router, "code="+testCode+"&state=0123", attackerCookie).Code)
+
+	_, _, err := parseOidcState(signOidcState("state", "nonce", time.Now().Add(-time.Second)))
+	equals(t, "expired state cookie", err.Error())
+}
+
+func TestOidcLoginInvalidNonce(t *testing.T) {
+	idp, router := setupOidc(t)
+	defer idp.server.Close()
+	defer func() { identityProvider = nil }()
+
+	state, cookie := startLogin(t, router)
+	idp.nonce = "other"
+
+	equals(t, http.StatusUnauthorized, callback(router, "code="+testCode+"&state="+state, cookie).Code)
+}
+
+func TestOidcBearerToken(t *testing.T) {
+	idp, router := setupOidc(t)
+	defer idp.server.Close()
+	defer func() { identityProvider = nil }()
+
+	code, user := getUser(router, idp.sign(t, nil))
+	equals(t, http.StatusOK, code)
+	equals(t, "u123456", user.ID)
+	equals(t, "max.muster@example.com", user.Mail)
+	equals(t, []string{RoleUser, RoleBillingAdmin}, user.Roles)
+
+	code, _ = getUser(router, idp.sign(t, map[string]interface{}{"aud": "other-client"}))
+	equals(t, http.StatusUnauthorized, code)
+
+	code, _ = getUser(router, idp.sign(t, map[string]interface{}{"exp": time.Now().Add(-time.Minute).Unix()}))
+	equals(t, http.StatusUnauthorized, code)
+}
@@ -0,0 +1,107 @@
+package common
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/appleboy/gin-jwt.v2"
+)
+
+// Roles of the users, every authenticated user has the role user
+const (
+	RoleUser          = "user"
+	RolePlatformAdmin = "platform-admin"
+	RoleBillingAdmin  = "billing-admin"
+)
+
+const (
+	rolesClaim       = "roles"
+	userRolesKey     = "SSP_USER_ROLES"
+	missingRoleError = "Du hast keine Berechtigung für diese Funktion"
+)
+
+// getRoles returns the roles of the user based on its groups in the directory
+func getRoles(username string, groups []string) []string {
+	roles := []string{RoleUser}
+
+	platformAdmin := containsGroup(groups, cfg.PlatformAdminGroups)
+	for _, a := range cfg.PlatformAdmins {
+		if strings.EqualFold(a, username) {
+			platformAdmin = true
+		}
+	}
+	if platformAdmin {
+		roles = append(roles, RolePlatformAdmin)
+	}
+
+	if containsGroup(groups, cfg.BillingAdminGroups) {
+		roles = append(roles, RoleBillingAdmin)
+	}
+
+	return roles
+}
+
+// containsGroup returns if one of the groups matches a configured group.
+// Configured groups match the full DN or the CN of a group.
+func containsGroup(groups []string, configured []string) bool {
+	for _, g := range groups {
+		for _, c := range configured {
+			if strings.EqualFold(g, c) || strings.EqualFold(getCN(g), c) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getCN returns the CN of a DN like 'CN=ssp-admins,OU=Groups,DC=xzw,DC=ch'
+func getCN(dn string) string {
+	first := strings.SplitN(dn, ",", 2)[0]
+	if kv := strings.SplitN(first, "=", 2); len(kv) == 2 && strings.EqualFold(strings.TrimSpace(kv[0]), "cn") {
+		return strings.TrimSpace(kv[1])
+	}
+	return ""
+}
+
+// GetUserRoles returns the roles of the user based of the gin.Context
+func GetUserRoles(c *gin.Context) []string {
+	// The basic auth user of the secure api has full access
+	if _, exists := c.Get(gin.AuthUserKey); exists {
+		return []string{RoleUser, RolePlatformAdmin}
+	}
+	// Set for tokens of the identity provider
+	if roles, exists := c.Get(userRolesKey); exists {
+		return roles.([]string)
+	}
+
+	var roles []string
+	claim, _ := jwt.ExtractClaims(c)[rolesClaim].([]interface{})
+	for _, r := range claim {
+		if role, ok := r.(string); ok {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// HasRole returns if the user has the role. Platform admins have every role.
+func HasRole(c *gin.Context, role string) bool {
+	for _, r := range GetUserRoles(c) {
+		if r == role || r == RolePlatformAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireRole returns a middleware which only allows users with the role
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasRole(c, role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse(c, missingRoleError))
+			return
+		}
+		c.Next()
+	}
+}
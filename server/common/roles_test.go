@@ -0,0 +1,48 @@
+package common
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetRoles(t *testing.T) {
+	cfg = defaultConfig()
+	cfg.PlatformAdmins = []string{"u111111"}
+	cfg.PlatformAdminGroups = []string{"ssp-admins"}
+	cfg.BillingAdminGroups = []string{"CN=Billing,OU=Groups,DC=example,DC=com"}
+
+	equals(t, []string{RoleUser}, getRoles("u123456", nil))
+	equals(t, []string{RoleUser}, getRoles("u123456", []string{"CN=ssp-users,OU=Groups,DC=example,DC=com"}))
+	equals(t, []string{RoleUser, RolePlatformAdmin}, getRoles("U111111", nil))
+	equals(t, []string{RoleUser, RolePlatformAdmin}, getRoles("u123456", []string{"cn=SSP-Admins,ou=Groups,dc=example,dc=com"}))
+	equals(t, []string{RoleUser, RolePlatformAdmin}, getRoles("u123456", []string{"ssp-admins"}))
+	equals(t, []string{RoleUser, RoleBillingAdmin}, getRoles("u123456", []string{"cn=billing,ou=groups,dc=example,dc=com"}))
+	// Only the full DN is configured for billing admins
+	equals(t, []string{RoleUser}, getRoles("u123456", []string{"CN=Billing,OU=Other,DC=example,DC=com"}))
+}
+
+func TestRequireRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	call := func(roles []string, role string) int {
+		router := gin.New()
+		router.GET("/", func(c *gin.Context) {
+			c.Set(userRolesKey, roles)
+		}, RequireRole(role), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		return w.Code
+	}
+
+	equals(t, http.StatusOK, call([]string{RoleUser}, RoleUser))
+	equals(t, http.StatusForbidden, call([]string{RoleUser}, RoleBillingAdmin))
+	equals(t, http.StatusOK, call([]string{RoleUser, RoleBillingAdmin}, RoleBillingAdmin))
+	equals(t, http.StatusOK, call([]string{RoleUser, RolePlatformAdmin}, RoleBillingAdmin))
+	equals(t, http.StatusForbidden, call([]string{RoleUser, RoleBillingAdmin}, RolePlatformAdmin))
+}
@@ -0,0 +1,235 @@
+package common
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/patrickmn/go-cache"
+)
+
+const (
+	sessionClaim      = "sid"
+	revokedTokenError = "Deine Sitzung wurde beendet. Bitte melde dich neu an"
+	refreshError      = "Das Token kann nicht erneuert werden. Bitte melde dich neu an"
+	wrongTokenError   = "Ungültiges Token"
+)
+
+// revocations contains the sessions which ended with a logout, set by GetAuthMiddleware
+var revocations RevocationStore = NewMemoryRevocationStore()
+
+// RevocationStore contains the sessions which ended with a logout.
+// A session is the login of a user, it keeps its id when the token is refreshed.
+type RevocationStore interface {
+	Revoke(session string, until time.Time) error
+	IsRevoked(session string) bool
+}
+
+// MemoryRevocationStore keeps the revoked sessions until their tokens can no longer be refreshed
+type MemoryRevocationStore struct {
+	sessions *cache.Cache
+}
+
+// NewMemoryRevocationStore returns an empty RevocationStore, which is lost on restart
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{sessions: cache.New(cache.NoExpiration, 10*time.Minute)}
+}
+
+// Revoke adds the session to the store
+func (s *MemoryRevocationStore) Revoke(session string, until time.Time) error {
+	// go-cache keeps entries with a negative duration forever
+	if ttl := until.Sub(time.Now()); ttl > 0 {
+		s.sessions.Set(session, until, ttl)
+	}
+	return nil
+}
+
+// IsRevoked returns if the session was revoked
+func (s *MemoryRevocationStore) IsRevoked(session string) bool {
+	_, revoked := s.sessions.Get(session)
+	return revoked
+}
+
+type revocation struct {
+	Session string    `json:"session"`
+	Until   time.Time `json:"until"`
+}
+
+// FileRevocationStore additionally writes the revoked sessions as json lines into a file, so they survive a restart
+type FileRevocationStore struct {
+	*MemoryRevocationStore
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileRevocationStore loads the sessions of the file which are still revoked
+// and removes the expired ones from the file
+func NewFileRevocationStore(path string) (*FileRevocationStore, error) {
+	s := &FileRevocationStore{MemoryRevocationStore: NewMemoryRevocationStore(), path: path}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var active []revocation
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r revocation
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			Log.WithError(err).Warn("Skipping invalid line in revocation file")
+			continue
+		}
+		if r.Until.After(time.Now()) {
+			active = append(active, r)
+			s.MemoryRevocationStore.Revoke(r.Session, r.Until)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return s, s.rewrite(active)
+}
+
+// Revoke adds the session to the store and the file
+func (s *FileRevocationStore) Revoke(session string, until time.Time) error {
+	s.MemoryRevocationStore.Revoke(session, until)
+
+	line, err := json.Marshal(revocation{Session: session, Until: until})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+func (s *FileRevocationStore) rewrite(revocations []revocation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_TRUNC|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for _, r := range revocations {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RefreshHandler returns a new token for a valid or expired token of the same session.
+// Tokens can be refreshed until the configured duration after the login.
+func RefreshHandler(c *gin.Context) {
+	claims, err := parseSessionToken(getBearerToken(c))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, ErrorResponse(c, refreshError))
+		return
+	}
+
+	session, _ := claims[sessionClaim].(string)
+	if revocations.IsRevoked(session) {
+		c.JSON(http.StatusUnauthorized, ErrorResponse(c, revokedTokenError))
+		return
+	}
+	if time.Now().After(getRefreshLimit(claims)) {
+		c.JSON(http.StatusUnauthorized, ErrorResponse(c, refreshError))
+		return
+	}
+
+	token, expire, err := signToken(claims)
+	if err != nil {
+		Logger(c).WithError(err).Error("Error refreshing token")
+		c.JSON(http.StatusInternalServerError, ErrorResponse(c, refreshError))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":   http.StatusOK,
+		"token":  token,
+		"expire": expire.Format(time.RFC3339),
+	})
+}
+
+// LogoutHandler revokes the session of the token, so neither it nor its refreshed tokens are accepted anymore
+func LogoutHandler(c *gin.Context) {
+	claims, err := parseSessionToken(getBearerToken(c))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, ErrorResponse(c, wrongTokenError))
+		return
+	}
+
+	if err := revocations.Revoke(claims[sessionClaim].(string), getRefreshLimit(claims)); err != nil {
+		Logger(c).WithError(err).Error("Error revoking session")
+		c.JSON(http.StatusInternalServerError, ErrorResponse(c, "Die Abmeldung ist fehlgeschlagen"))
+		return
+	}
+
+	Logger(c).WithField("user", claims["id"]).Info("User logged out")
+	c.JSON(http.StatusOK, ApiResponse{Message: "Du wurdest abgemeldet"})
+}
+
+// parseSessionToken validates the signature of one of our tokens, it may have expired
+func parseSessionToken(raw string) (jwtgo.MapClaims, error) {
+	parser := jwtgo.Parser{
+		ValidMethods:         []string{jwtgo.SigningMethodHS256.Alg()},
+		SkipClaimsValidation: true,
+	}
+	token, err := parser.Parse(raw, func(*jwtgo.Token) (interface{}, error) {
+		return []byte(cfg.SessionKey), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims := token.Claims.(jwtgo.MapClaims)
+	if session, ok := claims[sessionClaim].(string); !ok || len(session) == 0 {
+		return nil, errors.New("token without session")
+	}
+	return claims, nil
+}
+
+// isRevokedToken returns if the token belongs to a revoked session.
+// The signature is not checked, as the token is rejected anyway or validated afterwards.
+func isRevokedToken(raw string) bool {
+	token, _, err := new(jwtgo.Parser).ParseUnverified(raw, jwtgo.MapClaims{})
+	if err != nil {
+		return false
+	}
+	session, _ := token.Claims.(jwtgo.MapClaims)[sessionClaim].(string)
+	return len(session) > 0 && revocations.IsRevoked(session)
+}
+
+// getRefreshLimit returns until when the token can be refreshed
+func getRefreshLimit(claims jwtgo.MapClaims) time.Time {
+	origIat, _ := claims["orig_iat"].(float64)
+	return time.Unix(int64(origIat), 0).Add(cfg.TokenMaxRefresh)
+}
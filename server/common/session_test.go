@@ -0,0 +1,161 @@
+package common
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+)
+
+func setupSession(t *testing.T) *gin.Engine {
+	cfg = defaultConfig()
+	cfg.SessionKey = "secret"
+	cfg.AuthBackends = nil
+	revocations = NewMemoryRevocationStore()
+
+	mw, err := GetAuthMiddleware()
+	ok(t, err)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/refresh_token", RefreshHandler)
+	router.POST("/logout", LogoutHandler)
+	router.GET("/api/user", AuthMiddleware(mw), func(c *gin.Context) {
+		c.String(http.StatusOK, GetUserName(c))
+	})
+	return router
+}
+
+func callWithToken(router *gin.Engine, method string, path string, token string) (int, string) {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var res struct{ Token string }
+	json.Unmarshal(w.Body.Bytes(), &res)
+	return w.Code, res.Token
+}
+
+// expiredToken returns a token of a login, which happened the given duration ago
+func expiredToken(t *testing.T, loginAgo time.Duration) string {
+	token, _, err := signToken(jwtgo.MapClaims{
+		"id":         "u123456",
+		rolesClaim:   []string{RoleUser},
+		sessionClaim: "session",
+		"orig_iat":   time.Now().Add(-loginAgo).Unix(),
+	})
+	ok(t, err)
+
+	// Sign again with an expiry in the past
+	claims, err := parseSessionToken(token)
+	ok(t, err)
+	claims["exp"] = time.Now().Add(-time.Minute).Unix()
+	expired, err := jwtgo.NewWithClaims(jwtgo.SigningMethodHS256, claims).SignedString([]byte(cfg.SessionKey))
+	ok(t, err)
+	return expired
+}
+
+func TestRefreshToken(t *testing.T) {
+	router := setupSession(t)
+
+	token, _, err := generateToken("u123456", "max.muster@example.com", []string{RoleUser})
+	ok(t, err)
+
+	code, refreshed := callWithToken(router, "GET", "/refresh_token", token)
+	equals(t, http.StatusOK, code)
+
+	claims, err := parseSessionToken(refreshed)
+	ok(t, err)
+	original, err := parseSessionToken(token)
+	ok(t, err)
+	equals(t, original[sessionClaim], claims[sessionClaim])
+	equals(t, original["orig_iat"], claims["orig_iat"])
+	equals(t, "max.muster@example.com", claims["mail"])
+}
+
+func TestRefreshExpiredToken(t *testing.T) {
+	router := setupSession(t)
+
+	code, _ := callWithToken(router, "GET", "/api/user", expiredToken(t, 2*time.Hour))
+	equals(t, http.StatusUnauthorized, code)
+
+	code, refreshed := callWithToken(router, "GET", "/refresh_token", expiredToken(t, 2*time.Hour))
+	equals(t, http.StatusOK, code)
+	code, _ = callWithToken(router, "GET", "/api/user", refreshed)
+	equals(t, http.StatusOK, code)
+
+	// The session is too old
+	code, _ = callWithToken(router, "GET", "/refresh_token", expiredToken(t, 13*time.Hour))
+	equals(t, http.StatusUnauthorized, code)
+}
+
+func TestRefreshForgedToken(t *testing.T) {
+	router := setupSession(t)
+
+	token, err := jwtgo.NewWithClaims(jwtgo.SigningMethodHS256, jwtgo.MapClaims{
+		"id":         "u123456",
+		sessionClaim: "session",
+		"orig_iat":   time.Now().Unix(),
+	}).SignedString([]byte("other"))
+	ok(t, err)
+
+	code, _ := callWithToken(router, "GET", "/refresh_token", token)
+	equals(t, http.StatusUnauthorized, code)
+}
+
+func TestLogout(t *testing.T) {
+	router := setupSession(t)
+
+	token, _, err := generateToken("u123456", "max.muster@example.com", []string{RoleUser})
+	ok(t, err)
+	code, refreshed := callWithToken(router, "GET", "/refresh_token", token)
+	equals(t, http.StatusOK, code)
+
+	code, _ = callWithToken(router, "GET", "/api/user", token)
+	equals(t, http.StatusOK, code)
+
+	code, _ = callWithToken(router, "POST", "/logout", token)
+	equals(t, http.StatusOK, code)
+
+	// All tokens of the session are revoked
+	code, _ = callWithToken(router, "GET", "/api/user", token)
+	equals(t, http.StatusUnauthorized, code)
+	code, _ = callWithToken(router, "GET", "/api/user", refreshed)
+	equals(t, http.StatusUnauthorized, code)
+	code, _ = callWithToken(router, "GET", "/refresh_token", refreshed)
+	equals(t, http.StatusUnauthorized, code)
+}
+
+func TestFileRevocationStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "revocations")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "revocations")
+
+	store, err := NewFileRevocationStore(path)
+	ok(t, err)
+	ok(t, store.Revoke("active", time.Now().Add(time.Hour)))
+	ok(t, store.Revoke("expired", time.Now().Add(-time.Hour)))
+	assert(t, store.IsRevoked("active"), "Session should be revoked")
+	assert(t, !store.IsRevoked("other"), "Session should not be revoked")
+
+	// Reload after a restart
+	store, err = NewFileRevocationStore(path)
+	ok(t, err)
+	assert(t, store.IsRevoked("active"), "Session should still be revoked after a restart")
+	assert(t, !store.IsRevoked("expired"), "Expired revocations should be dropped")
+
+	content, err := ioutil.ReadFile(path)
+	ok(t, err)
+	var r revocation
+	ok(t, json.Unmarshal(content, &r))
+	equals(t, "active", r.Session)
+}
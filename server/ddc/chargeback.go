@@ -1,18 +1,14 @@
 package ddc
 
 import (
-	"crypto/tls"
-	"log"
+	"context"
 	"net/http"
-	"os"
 
 	"encoding/csv"
 	"errors"
 	"strconv"
 	"strings"
 
-	"bytes"
-
 	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
 	"github.com/gin-gonic/gin"
 	"time"
@@ -20,61 +16,66 @@ import (
 
 const apiErrorDDC = "Fehler beim Aufruf der DDC-API. Bitte erstelle ein Ticket bei DDC."
 
-// RegisterRoutes registers the routes for OpenShift
-func RegisterRoutes(r *gin.RouterGroup) {
-	r.GET("/ddc/billing", getDDCBillingHandler)
+// config is the DDC section of the configuration, set by RegisterRoutes
+var config common.DDCConfig
+
+// ddcClient is the http client of the DDC api, set by RegisterRoutes
+var ddcClient *http.Client
+
+// RegisterRoutes registers the routes for DDC
+func RegisterRoutes(r *gin.RouterGroup, cfg common.DDCConfig) error {
+	config = cfg
+
+	var err error
+	if ddcClient, err = common.NewHTTPClient("ddc", cfg.HTTPClientConfig); err != nil {
+		return err
+	}
+
+	r.GET("/ddc/billing", common.RequireRole(common.RoleBillingAdmin), getDDCBillingHandler)
+	return nil
 }
 
 func getDDCBillingHandler(c *gin.Context) {
 	username := common.GetUserName(c)
-	log.Println("Called DDC Billing: ", username)
+	common.Logger(c).WithField("user", username).Info("Called DDC Billing")
 
-	rows, err := calculateDDCBilling()
+	rows, err := calculateDDCBilling(c)
 	result := createCSVReport(rows)
 
 	if err == nil {
 		c.JSON(http.StatusOK, result)
 	} else {
-		c.JSON(http.StatusBadRequest, err.Error())
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
 	}
 }
 
 func createCSVReport(rows []common.DDCBillingRow) common.DDCBilling {
-	b := &bytes.Buffer{}
-	wr := csv.NewWriter(b)
-	wr.Comma = ';'
-
-	// Title row
-	title := []string{"SendStelle", "SendAuftrag", "Sender-PSP-Element",
-		"SendKdAuft", "SndPos", "SendNetzplan", "SendervorgangSVrg",
-		"Kostenart", "Betrag", "Waehrung",
-		"EmpfStelle", "EmpfAuftrag", "Empfaenger-PSP-Element",
-		"EmpfKdAuft", "EmpPos", "EmpfNetzplan", "Evrg",
-		"Menge gesamt", "ME", "PersNr", "Text", "Sys ID"}
-	wr.Write(title)
-
+	var sapRows []common.SAPChargebackRow
 	for _, r := range rows {
-		totalString := strconv.FormatFloat(r.Total, 'f', 2, 64)
-		row := []string{"", r.Sender, "", "", "", "", "", r.Art, totalString, "CHF",
-			r.ReceptionAssignment, r.OrderReception, r.PspElement,
-			"", "", "", "", "1", "ST", "", r.Text, r.Project + ": " + r.Host}
-		wr.Write(row)
+		sapRows = append(sapRows, common.SAPChargebackRow{
+			Sender:              r.Sender,
+			Art:                 r.Art,
+			Total:               r.Total,
+			ReceptionAssignment: r.ReceptionAssignment,
+			OrderReception:      r.OrderReception,
+			PspElement:          r.PspElement,
+			Text:                r.Text,
+			SysID:               r.Project + ": " + r.Host,
+		})
 	}
 
-	wr.Flush()
-
 	return common.DDCBilling{
-		CSV:  b.String(),
+		CSV:  common.CreateSAPCSV(sapRows),
 		Rows: rows,
 	}
 }
 
-func calculateDDCBilling() ([]common.DDCBillingRow, error) {
-	client, req := getDDCClient()
+func calculateDDCBilling(ctx context.Context) ([]common.DDCBillingRow, error) {
+	client, req := getDDCClient(ctx)
 
 	resp, err := client.Do(req)
 	if err != nil {
-		log.Println("Error calling ddc api: ", err.Error())
+		common.Logger(ctx).WithError(err).Error("Error calling ddc api")
 		return nil, errors.New(apiErrorDDC)
 	} else {
 		defer resp.Body.Close()
@@ -85,7 +86,7 @@ func calculateDDCBilling() ([]common.DDCBillingRow, error) {
 
 	records, err := csvReader.ReadAll()
 	if err != nil {
-		log.Println("Error parsing CSV.", err.Error())
+		common.Logger(ctx).WithError(err).Error("Error parsing CSV")
 		return nil, errors.New(apiErrorDDC)
 	}
 
@@ -146,22 +147,11 @@ func calculateDDCBilling() ([]common.DDCBillingRow, error) {
 	return result, nil
 }
 
-func getDDCClient() (*http.Client, *http.Request) {
-	api := os.Getenv("DDC_API")
-	if len(api) == 0 {
-		log.Fatal("Env variable 'DDC_API' must be specified")
-	}
-
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	}
-	client := &http.Client{Transport: tr}
-
-	req, _ := http.NewRequest("GET", api, nil)
+func getDDCClient(ctx context.Context) (*http.Client, *http.Request) {
+	req, _ := http.NewRequest("GET", config.APIURL, nil)
 
-	if common.DebugMode() {
-		log.Print("Calling ", req.URL.String())
-	}
+	common.Logger(ctx).WithField("url", req.URL.String()).Debug("Calling backend")
+	common.SetRequestIDHeader(ctx, req)
 
-	return client, req
+	return ddcClient, req
 }
@@ -1,9 +1,6 @@
 package main
 
 import (
-	"log"
-	"os"
-
 	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/aws"
 	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
 	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/ddc"
@@ -11,50 +8,112 @@ import (
 	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/sematext"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 )
 
 func main() {
+	cfg, err := common.LoadConfig()
+	if err != nil {
+		common.Log.WithError(err).Fatal("Error loading the config")
+	}
+
 	router := gin.New()
-	router.Use(gin.Recovery())
+	router.Use(common.RequestIDMiddleware(), common.RequestLogger(), gin.Recovery())
 
 	// Allow cors
 	corsConfig := cors.DefaultConfig()
 	corsConfig.AllowAllOrigins = true
-	corsConfig.AddAllowHeaders("authorization", "*")
+	corsConfig.AddAllowHeaders("authorization", common.RequestIDHeader, "*")
+	corsConfig.ExposeHeaders = []string{common.RequestIDHeader}
 	corsConfig.AddAllowMethods("DELETE")
 	router.Use(cors.New(corsConfig))
 
 	// Public routes
-	authMiddleware := common.GetAuthMiddleware()
-	router.POST("/login", authMiddleware.LoginHandler)
+	authMiddleware, err := common.GetAuthMiddleware()
+	if err != nil {
+		common.Log.WithError(err).Fatal("Error initializing the authentication")
+	}
+	if cfg.AuthBackendEnabled(common.AuthBackendLdap) {
+		router.POST("/login", authMiddleware.LoginHandler)
+	}
+	router.GET("/refresh_token", common.RefreshHandler)
+	router.POST("/logout", common.LogoutHandler)
+	if cfg.AuthBackendEnabled(common.AuthBackendOidc) {
+		router.GET("/login/oidc", common.OidcLoginHandler)
+		router.GET("/login/oidc/callback", common.OidcCallbackHandler)
+	}
 	router.GET("/config", common.ConfigHandler)
 
+	// Long-running operations are executed in the background
+	if err := common.InitJobs(cfg.JobFile, cfg.JobWorkers); err != nil {
+		common.Log.WithError(err).Fatal("Error loading the jobs")
+	}
+
+	// Billing numbers are checked against the configured sources
+	if err := common.InitBillingValidators(cfg.Billing); err != nil {
+		common.Log.WithError(err).Fatal("Error initializing the billing validation")
+	}
+
+	// Every mutating call is written to the audit log
+	auditStore := common.NewFileAuditStore(cfg.AuditLogFile)
+
 	// Protected routes
 	auth := router.Group("/api/")
-	auth.Use(authMiddleware.MiddlewareFunc())
+	auth.Use(common.AuthMiddleware(authMiddleware), common.AuditMiddleware(auditStore))
 	{
+		// Audit log
+		auth.GET("/audit", common.RequireRole(common.RolePlatformAdmin), common.AuditQueryHandler(auditStore))
+
+		// Status of the background jobs
+		auth.GET("/jobs/:id", common.JobHandler)
+
 		// Openshift routes
-		openshift.RegisterRoutes(auth)
+		if cfg.Openshift.IsEnabled() {
+			if err := openshift.RegisterRoutes(auth, cfg.Openshift); err != nil {
+				common.Log.WithError(err).Fatal("Error initializing the OpenShift module")
+			}
+		}
 
 		// DDC routes
-		ddc.RegisterRoutes(auth)
+		if cfg.DDC.IsEnabled() {
+			if err := ddc.RegisterRoutes(auth, cfg.DDC); err != nil {
+				common.Log.WithError(err).Fatal("Error initializing the DDC module")
+			}
+		}
 
 		// AWS routes
-		aws.RegisterRoutes(auth)
+		if cfg.Aws.IsEnabled() {
+			aws.RegisterRoutes(auth, cfg.Aws)
+		}
 
 		// Sematext routes
-		sematext.RegisterRoutes(auth)
+		if cfg.Sematext.IsEnabled() {
+			if err := sematext.RegisterRoutes(auth, cfg.Sematext); err != nil {
+				common.Log.WithError(err).Fatal("Error initializing the Sematext module")
+			}
+		}
 	}
 
-	secApiPassword, ok := os.LookupEnv("SEC_API_PASSWORD")
-	if ok {
-		log.Println("Activating secure api (basic auth)")
-		sec := router.Group("/sec", gin.BasicAuth(gin.Accounts{"SEC_API": secApiPassword}))
+	if len(cfg.SecApiPassword) > 0 && cfg.Openshift.IsEnabled() {
+		common.Log.Info("Activating secure api (basic auth)")
+		sec := router.Group("/sec", gin.BasicAuth(gin.Accounts{"SEC_API": cfg.SecApiPassword}), common.AuditMiddleware(auditStore))
 		openshift.RegisterSecRoutes(sec)
 	} else {
-		log.Println("Secure api (basic auth) won't be activated, because SEC_API_PASSWORD isn't set")
+		common.Log.Info("Secure api (basic auth) won't be activated, because SEC_API_PASSWORD isn't set")
+	}
+
+	// Delete expired test projects in the background
+	if cfg.Openshift.IsEnabled() {
+		openshift.StartTestProjectReaper()
 	}
 
-	log.Println("Cloud SSP is running")
+	common.Log.WithFields(logrus.Fields{
+		"openshift": cfg.Openshift.IsEnabled(),
+		"ddc":       cfg.DDC.IsEnabled(),
+		"aws":       cfg.Aws.IsEnabled(),
+		"sematext":  cfg.Sematext.IsEnabled(),
+	}).Info("Enabled modules")
+
+	common.Log.Info("Cloud SSP is running")
 	router.Run()
 }
@@ -0,0 +1,156 @@
+package openshift
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+func getProjectAdminsHandler(c *gin.Context) {
+	username := common.GetUserName(c)
+	project := c.Param("project")
+
+	common.Logger(c).WithFields(logrus.Fields{"user": username, "project": project}).Info("Queried the admins of the project")
+
+	if admins, err := getProjectAdmins(c, project); err != nil {
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
+	} else {
+		// Users are added in lower and upper case
+		users := []string{}
+		for _, u := range admins.Users {
+			if !containsIgnoreCase(users, u) {
+				users = append(users, strings.ToLower(u))
+			}
+		}
+		c.JSON(http.StatusOK, common.AdminList{
+			Admins: users,
+			Groups: append([]string{}, admins.Groups...),
+		})
+	}
+}
+
+func addProjectAdminHandler(c *gin.Context) {
+	username := common.GetUserName(c)
+	project := c.Param("project")
+
+	var data common.ProjectAdminCommand
+	if c.BindJSON(&data) == nil {
+		if err := validateProjectAdmin(c, username, project, data); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
+			return
+		}
+
+		if err := addProjectAdmin(c, project, data, username); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
+		} else {
+			c.JSON(http.StatusOK, common.ApiResponse{
+				Message: fmt.Sprintf("%v ist jetzt Admin des Projekts %v", describeProjectAdmin(data), project),
+			})
+		}
+	} else {
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, wrongAPIUsageError))
+	}
+}
+
+func removeProjectAdminHandler(c *gin.Context) {
+	username := common.GetUserName(c)
+	project := c.Param("project")
+
+	var data common.ProjectAdminCommand
+	if c.BindJSON(&data) == nil {
+		if err := validateProjectAdmin(c, username, project, data); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
+			return
+		}
+
+		if err := removeProjectAdmin(c, project, data, username); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
+		} else {
+			c.JSON(http.StatusOK, common.ApiResponse{
+				Message: fmt.Sprintf("%v ist nicht mehr Admin des Projekts %v", describeProjectAdmin(data), project),
+			})
+		}
+	} else {
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, wrongAPIUsageError))
+	}
+}
+
+func validateProjectAdmin(ctx context.Context, username string, project string, data common.ProjectAdminCommand) error {
+	if len(project) == 0 {
+		return errors.New("Projektname muss angegeben werden")
+	}
+
+	if len(data.User) == 0 && len(data.Group) == 0 {
+		return errors.New("Benutzer oder Gruppe muss angegeben werden")
+	}
+	if len(data.User) > 0 && len(data.Group) > 0 {
+		return errors.New("Es kann nur ein Benutzer oder eine Gruppe angegeben werden")
+	}
+
+	// Validate permissions
+	return checkAdminPermissions(ctx, username, project)
+}
+
+func describeProjectAdmin(data common.ProjectAdminCommand) string {
+	if len(data.User) > 0 {
+		return fmt.Sprintf("Der Benutzer %v", data.User)
+	}
+	return fmt.Sprintf("Die Gruppe %v", data.Group)
+}
+
+func addProjectAdmin(ctx context.Context, project string, data common.ProjectAdminCommand, username string) error {
+	err := changeProjectAdmins(ctx, project, func(admins *projectAdmins) error {
+		if len(data.User) > 0 {
+			if admins.hasUser(data.User) {
+				return fmt.Errorf("Der Benutzer %v ist bereits Admin des Projekts", data.User)
+			}
+			admins.Users = append(admins.Users, strings.ToLower(data.User), strings.ToUpper(data.User))
+			return nil
+		}
+
+		if admins.hasGroup(data.Group) {
+			return fmt.Errorf("Die Gruppe %v ist bereits Admin des Projekts", data.Group)
+		}
+		admins.Groups = append(admins.Groups, data.Group)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	common.Logger(ctx).WithFields(logrus.Fields{"user": username, "project": project, "admin_user": data.User, "admin_group": data.Group}).Info("Added an admin to the project")
+	return nil
+}
+
+func removeProjectAdmin(ctx context.Context, project string, data common.ProjectAdminCommand, username string) error {
+	err := changeProjectAdmins(ctx, project, func(admins *projectAdmins) error {
+		if len(data.User) > 0 {
+			if !admins.hasUser(data.User) {
+				return fmt.Errorf("Der Benutzer %v ist kein Admin des Projekts", data.User)
+			}
+			admins.Users = removeIgnoreCase(admins.Users, data.User)
+		} else {
+			if !admins.hasGroup(data.Group) {
+				return fmt.Errorf("Die Gruppe %v ist kein Admin des Projekts", data.Group)
+			}
+			admins.Groups = removeIgnoreCase(admins.Groups, data.Group)
+		}
+
+		if len(admins.Users) == 0 && len(admins.Groups) == 0 {
+			return errors.New("Der letzte Admin des Projekts kann nicht entfernt werden")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	common.Logger(ctx).WithFields(logrus.Fields{"user": username, "project": project, "admin_user": data.User, "admin_group": data.Group}).Info("Removed an admin from the project")
+	return nil
+}
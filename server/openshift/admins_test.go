@@ -0,0 +1,65 @@
+package openshift
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
+)
+
+func TestAddAndRemoveAdmins(t *testing.T) {
+	fake, router := setupFake("u123456")
+	fake.addProject("project", "u123456", "U123456")
+
+	code, msg := call(router, "POST", "/api/ose/project/project/admins", common.ProjectAdminCommand{User: "u000001"})
+	equals(t, http.StatusOK, code)
+	equals(t, "Der Benutzer u000001 ist jetzt Admin des Projekts project", msg)
+
+	code, _ = call(router, "POST", "/api/ose/project/project/admins", common.ProjectAdminCommand{Group: "team"})
+	equals(t, http.StatusOK, code)
+
+	code, msg = call(router, "POST", "/api/ose/project/project/admins", common.ProjectAdminCommand{User: "U000001"})
+	equals(t, http.StatusBadRequest, code)
+	equals(t, "Der Benutzer U000001 ist bereits Admin des Projekts", msg)
+
+	req := httptest.NewRequest("GET", "/api/ose/project/project/admins", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var list common.AdminList
+	ok(t, json.Unmarshal(w.Body.Bytes(), &list))
+	equals(t, []string{"u123456", "u000001"}, list.Admins)
+	equals(t, []string{"team"}, list.Groups)
+
+	code, _ = call(router, "DELETE", "/api/ose/project/project/admins", common.ProjectAdminCommand{User: "u000001"})
+	equals(t, http.StatusOK, code)
+	code, _ = call(router, "DELETE", "/api/ose/project/project/admins", common.ProjectAdminCommand{Group: "team"})
+	equals(t, http.StatusOK, code)
+
+	// The last admin stays
+	code, msg = call(router, "DELETE", "/api/ose/project/project/admins", common.ProjectAdminCommand{User: "u123456"})
+	equals(t, http.StatusBadRequest, code)
+	equals(t, "Der letzte Admin des Projekts kann nicht entfernt werden", msg)
+	equals(t, 2, len(fake.roleBindings["project"][0].Subjects))
+}
+
+func TestChangeAdminsValidation(t *testing.T) {
+	fake, router := setupFake("u123456")
+	fake.addProject("project", "u000000")
+
+	code, _ := call(router, "POST", "/api/ose/project/project/admins", common.ProjectAdminCommand{User: "u123456"})
+	equals(t, http.StatusBadRequest, code)
+
+	fake.addProject("mine", "u123456")
+	code, msg := call(router, "POST", "/api/ose/project/mine/admins", common.ProjectAdminCommand{User: "a", Group: "b"})
+	equals(t, http.StatusBadRequest, code)
+	equals(t, "Es kann nur ein Benutzer oder eine Gruppe angegeben werden", msg)
+
+	// Removals work on clusters without rbac api as well
+	fake.rbac = false
+	fake.policyBindings["mine"].RoleBindings[0].RoleBinding.GroupNames = []string{"team"}
+	code, _ = call(router, "DELETE", "/api/ose/project/mine/admins", common.ProjectAdminCommand{Group: "team"})
+	equals(t, http.StatusOK, code)
+	equals(t, []string(nil), fake.policyBindings["mine"].RoleBindings[0].RoleBinding.GroupNames)
+}
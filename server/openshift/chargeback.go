@@ -0,0 +1,179 @@
+package openshift
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// chargebackQuotas are the quotas which are charged, the first one a quota has is taken.
+// 'cpu' and 'memory' are the same as their requests.
+var chargebackQuotas = map[string][]string{
+	"cpu":    {"requests.cpu", "cpu", "limits.cpu"},
+	"memory": {"requests.memory", "memory", "limits.memory"},
+}
+
+func getBillingReportHandler(c *gin.Context) {
+	username := common.GetUserName(c)
+	common.Logger(c).WithFields(logrus.Fields{"user": username, "cluster": getCluster(c).ID}).Info("Called OpenShift Billing")
+
+	if report, err := calculateOpenshiftBilling(c); err != nil {
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
+	} else {
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// calculateOpenshiftBilling charges the cpu and memory of the projects and the size of their persistent volumes,
+// grouped by the billing numbers of the projects
+func calculateOpenshiftBilling(ctx context.Context) (*common.OpenshiftBilling, error) {
+	namespaces, err := ose(ctx).ListNamespaces(ctx)
+	if err != nil {
+		common.Logger(ctx).WithError(err).Error("Error getting the namespaces")
+		return nil, errors.New(genericAPIError)
+	}
+
+	rows := map[string]*common.OpenshiftBillingRow{}
+	unbilled := []string{}
+	for _, ns := range namespaces {
+		project := ns.Metadata.Name
+		billing := strings.TrimSpace(ns.Metadata.Annotations[billingAnnotation])
+		if billing == noBilling {
+			continue
+		}
+		if len(billing) == 0 {
+			unbilled = append(unbilled, project)
+			continue
+		}
+
+		cpu, memory, err := getChargedResources(ctx, project)
+		if err != nil {
+			return nil, err
+		}
+		storage, err := getChargedStorage(ctx, project)
+		if err != nil {
+			return nil, err
+		}
+
+		row, ok := rows[billing]
+		if !ok {
+			row = &common.OpenshiftBillingRow{Billing: billing}
+			rows[billing] = row
+		}
+		row.Projects = append(row.Projects, project)
+		row.CPU += cpu
+		row.Memory += memory
+		row.Storage += storage
+	}
+
+	prices := config.Chargeback
+	result := &common.OpenshiftBilling{Rows: []common.OpenshiftBillingRow{}, Unbilled: unbilled}
+	for _, row := range rows {
+		sort.Strings(row.Projects)
+		row.TotalCPU = row.CPU * prices.CPU
+		row.TotalMemory = row.Memory * prices.Memory
+		row.TotalStorage = row.Storage * prices.Storage
+		row.Total = row.TotalCPU + row.TotalMemory + row.TotalStorage
+		result.Rows = append(result.Rows, *row)
+	}
+	sort.Slice(result.Rows, func(i, j int) bool {
+		return result.Rows[i].Billing < result.Rows[j].Billing
+	})
+	sort.Strings(result.Unbilled)
+
+	result.CSV = createOpenshiftCSVReport(getCluster(ctx).ID, result.Rows)
+	return result, nil
+}
+
+// createOpenshiftCSVReport returns the rows in the SAP format of the DDC billing
+func createOpenshiftCSVReport(cluster string, rows []common.OpenshiftBillingRow) string {
+	// Text field contains YYMM, like the DDC billing
+	text := "LM" + time.Now().Format("0601") + " OpenShift"
+
+	var sapRows []common.SAPChargebackRow
+	for _, r := range rows {
+		sapRows = append(sapRows, common.SAPChargebackRow{
+			Sender:     config.Chargeback.Sender,
+			Art:        config.Chargeback.Art,
+			Total:      r.Total,
+			PspElement: r.Billing,
+			Text:       text,
+			SysID:      cluster + ": " + strings.Join(r.Projects, ", "),
+		})
+	}
+	return common.CreateSAPCSV(sapRows)
+}
+
+// getChargedResources returns the cores and GiB memory of the project. A project with several quotas is charged for the biggest one.
+func getChargedResources(ctx context.Context, project string) (float64, float64, error) {
+	quotas, err := ose(ctx).ListResourceQuotas(ctx, project)
+	if err != nil {
+		common.Logger(ctx).WithError(err).WithField("project", project).Error("Error getting the quotas of the project")
+		return 0, 0, errors.New(genericAPIError)
+	}
+
+	var cpu, memory float64
+	for _, q := range quotas {
+		values := q.Spec.Hard
+		if config.Chargeback.Source == common.ChargebackSourceUsage {
+			values = nil
+			if q.Status != nil {
+				values = q.Status.Used
+			}
+		}
+		if c := chargedQuota(ctx, project, values, "cpu"); c > cpu {
+			cpu = c
+		}
+		if m := chargedQuota(ctx, project, values, "memory") / (1 << 30); m > memory {
+			memory = m
+		}
+	}
+	return cpu, memory, nil
+}
+
+func chargedQuota(ctx context.Context, project string, values map[string]string, resource string) float64 {
+	for _, key := range chargebackQuotas[resource] {
+		quantity, ok := values[key]
+		if !ok {
+			continue
+		}
+		value, err := parseQuantity(quantity)
+		if err != nil {
+			common.Logger(ctx).WithFields(logrus.Fields{"project": project, "quota": key, "value": quantity}).Warn("Invalid quota, it isn't charged")
+			return 0
+		}
+		return value
+	}
+	return 0
+}
+
+// getChargedStorage returns the GiB of the bound persistent volumes of the project
+func getChargedStorage(ctx context.Context, project string) (float64, error) {
+	pvcs, err := ose(ctx).ListPersistentVolumeClaims(ctx, project)
+	if err != nil {
+		common.Logger(ctx).WithError(err).WithField("project", project).Error("Error getting the pvcs of the project")
+		return 0, errors.New(genericAPIError)
+	}
+
+	var storage float64
+	for _, pvc := range pvcs {
+		size, ok := pvc.Status.Capacity["storage"]
+		if pvc.Status.Phase != "Bound" || !ok {
+			continue
+		}
+		value, err := parseQuantity(size)
+		if err != nil {
+			common.Logger(ctx).WithFields(logrus.Fields{"project": project, "pvc": pvc.Metadata.Name, "size": size}).Warn("Invalid size of the pvc, it isn't charged")
+			continue
+		}
+		storage += value / (1 << 30)
+	}
+	return storage, nil
+}
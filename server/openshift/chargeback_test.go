@@ -0,0 +1,75 @@
+package openshift
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
+)
+
+func TestOpenshiftBilling(t *testing.T) {
+	fake, router := setupFake("u123456")
+	config.Chargeback = common.ChargebackConfig{Source: common.ChargebackSourceQuota, Sender: "70029508", Art: "816750", CPU: 30, Memory: 10, Storage: 1}
+
+	for project, billing := range map[string]string{"a": "R.123456.01", "b": "R.123456.01", "c": "R.654321.01", "test": noBilling, "system": ""} {
+		fake.addProject(project, "u123456")
+		if len(billing) > 0 {
+			fake.namespaces[project].Metadata.Annotations[billingAnnotation] = billing
+		}
+	}
+	fake.quotas["a"] = []ResourceQuota{{Spec: ResourceQuotaSpec{Hard: map[string]string{"requests.cpu": "2", "limits.cpu": "4", "requests.memory": "4Gi"}}}}
+	fake.quotas["b"] = []ResourceQuota{
+		{Spec: ResourceQuotaSpec{Hard: map[string]string{"cpu": "1", "memory": "2Gi"}}},
+		// Only the biggest quota is charged
+		{Spec: ResourceQuotaSpec{Hard: map[string]string{"cpu": "500m", "memory": "1Gi"}}},
+	}
+	fake.pvcs["a"] = map[string]*PersistentVolumeClaim{
+		"data":    {Status: PersistentVolumeClaimStatus{Phase: "Bound", Capacity: map[string]string{"storage": "10Gi"}}},
+		"pending": {Status: PersistentVolumeClaimStatus{Phase: "Pending"}},
+	}
+
+	report, err := calculateOpenshiftBilling(context.Background())
+	ok(t, err)
+	equals(t, []string{"system"}, report.Unbilled)
+	equals(t, 2, len(report.Rows))
+	equals(t, common.OpenshiftBillingRow{
+		Billing:      "R.123456.01",
+		Projects:     []string{"a", "b"},
+		CPU:          3,
+		Memory:       6,
+		Storage:      10,
+		TotalCPU:     90,
+		TotalMemory:  60,
+		TotalStorage: 10,
+		Total:        160,
+	}, report.Rows[0])
+	// 2 cores and 4Gi of the quota of new projects
+	equals(t, 100.0, report.Rows[1].Total)
+
+	lines := strings.Split(strings.TrimSpace(report.CSV), "\n")
+	equals(t, 3, len(lines))
+	assert(t, strings.HasPrefix(lines[1], ";70029508;;;;;;816750;160.00;CHF;;;R.123456.01;"), "Unexpected csv row: %v", lines[1])
+	assert(t, strings.HasSuffix(lines[1], ";default: a, b"), "Unexpected csv row: %v", lines[1])
+
+	status, _ := call(router, "GET", "/api/ose/billing/report", nil)
+	equals(t, http.StatusOK, status)
+}
+
+func TestOpenshiftBilling_Usage(t *testing.T) {
+	fake, _ := setupFake("u123456")
+	config.Chargeback = common.ChargebackConfig{Source: common.ChargebackSourceUsage, CPU: 30, Memory: 10}
+	fake.addProject("a", "u123456")
+	fake.namespaces["a"].Metadata.Annotations[billingAnnotation] = "R.123456.01"
+	fake.quotas["a"] = []ResourceQuota{{
+		Spec:   ResourceQuotaSpec{Hard: map[string]string{"requests.cpu": "2", "requests.memory": "4Gi"}},
+		Status: &ResourceQuotaSpec{Used: map[string]string{"requests.cpu": "500m", "requests.memory": "512Mi"}},
+	}}
+
+	report, err := calculateOpenshiftBilling(context.Background())
+	ok(t, err)
+	equals(t, 0.5, report.Rows[0].CPU)
+	equals(t, 0.5, report.Rows[0].Memory)
+	equals(t, 20.0, report.Rows[0].Total)
+}
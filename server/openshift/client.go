@@ -0,0 +1,546 @@
+package openshift
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
+	"github.com/sirupsen/logrus"
+)
+
+// Client is the access to the OpenShift api. The handlers only use this interface, the tests replace it by a fake.
+type Client interface {
+	CreateProjectRequest(ctx context.Context, name string) error
+	DeleteProject(ctx context.Context, name string) error
+
+	ListNamespaces(ctx context.Context) ([]Namespace, error)
+	GetNamespace(ctx context.Context, name string) (*Namespace, error)
+	// PatchNamespaceAnnotations sets and removes annotations without touching the other fields of the namespace
+	PatchNamespaceAnnotations(ctx context.Context, name string, set map[string]string, remove []string) error
+	PatchNamespaceLabels(ctx context.Context, name string, set map[string]string) error
+
+	ListResourceQuotas(ctx context.Context, namespace string) ([]ResourceQuota, error)
+	CreateResourceQuota(ctx context.Context, quota *ResourceQuota) error
+	// PatchResourceQuotaHard sets limits of the quota without touching its other limits and its scopes
+	PatchResourceQuotaHard(ctx context.Context, namespace string, name string, set map[string]string) error
+	ListLimitRanges(ctx context.Context, namespace string) ([]LimitRange, error)
+	CreateLimitRange(ctx context.Context, limitRange *LimitRange) error
+	CreateNetworkPolicy(ctx context.Context, policy *NetworkPolicy) error
+
+	CreatePersistentVolume(ctx context.Context, pv *PersistentVolume) error
+	GetPersistentVolume(ctx context.Context, name string) (*PersistentVolume, error)
+	DeletePersistentVolume(ctx context.Context, name string) error
+	PatchPersistentVolumeAnnotations(ctx context.Context, name string, set map[string]string) error
+
+	ListPersistentVolumeClaims(ctx context.Context, namespace string) ([]PersistentVolumeClaim, error)
+	GetPersistentVolumeClaim(ctx context.Context, namespace string, name string) (*PersistentVolumeClaim, error)
+	CreatePersistentVolumeClaim(ctx context.Context, pvc *PersistentVolumeClaim) error
+	DeletePersistentVolumeClaim(ctx context.Context, namespace string, name string) error
+
+	CreateService(ctx context.Context, service *Service) error
+	CreateEndpoints(ctx context.Context, endpoints *Endpoints) error
+	ListPods(ctx context.Context, namespace string) ([]Pod, error)
+
+	ListServiceAccounts(ctx context.Context, namespace string) ([]ServiceAccount, error)
+	CreateServiceAccount(ctx context.Context, sa *ServiceAccount) error
+	GetServiceAccount(ctx context.Context, namespace string, name string) (*ServiceAccount, error)
+	// PatchServiceAccountAnnotations sets annotations without touching the other fields, e.g. the pull secrets
+	PatchServiceAccountAnnotations(ctx context.Context, namespace string, name string, set map[string]string) error
+	DeleteServiceAccount(ctx context.Context, namespace string, name string) error
+	GetSecret(ctx context.Context, namespace string, name string) (*Secret, error)
+	CreateSecret(ctx context.Context, secret *Secret) error
+	UpdateSecret(ctx context.Context, secret *Secret) error
+	DeleteSecret(ctx context.Context, namespace string, name string) error
+
+	GetGroup(ctx context.Context, name string) (*Group, error)
+
+	// HasRBAC returns true if the cluster has the rbac api. Older clusters only have the policy bindings.
+	HasRBAC(ctx context.Context) (bool, error)
+	ListRoleBindings(ctx context.Context, namespace string) ([]RoleBinding, error)
+	// ListLabeledRoleBindings returns the role bindings with the labels in all namespaces
+	ListLabeledRoleBindings(ctx context.Context, labels map[string]string) ([]RoleBinding, error)
+	GetRoleBinding(ctx context.Context, namespace string, name string) (*RoleBinding, error)
+	CreateRoleBinding(ctx context.Context, binding *RoleBinding) error
+	UpdateRoleBinding(ctx context.Context, binding *RoleBinding) error
+	DeleteRoleBinding(ctx context.Context, namespace string, name string) error
+	GetPolicyBinding(ctx context.Context, namespace string) (*PolicyBinding, error)
+	UpdatePolicyBinding(ctx context.Context, binding *PolicyBinding) error
+}
+
+// StatusError is returned if OpenShift answers with an error status
+type StatusError struct {
+	Code    int
+	Reason  string
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("openshift api returned %v %v: %v", e.Code, e.Reason, e.Message)
+}
+
+func hasStatus(err error, code int) bool {
+	statusErr, ok := err.(*StatusError)
+	return ok && statusErr.Code == code
+}
+
+// IsNotFound returns true if the object does not exist
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsConflict returns true if the object already exists or was changed in the meantime
+func IsConflict(err error) bool {
+	return hasStatus(err, http.StatusConflict)
+}
+
+// IsForbidden returns true if our service account is not allowed to do the call
+func IsForbidden(err error) bool {
+	return hasStatus(err, http.StatusForbidden)
+}
+
+const (
+	rbacGroup      = "rbac.authorization.k8s.io"
+	rbacAPIVersion = rbacGroup + "/v1"
+	rbacAPI        = "apis/" + rbacAPIVersion
+)
+
+// httpClient calls the OpenShift api with the token of our service account
+type httpClient struct {
+	baseURL string
+	token   string
+	timeout time.Duration
+	client  *http.Client
+
+	// apis are the api groups detected by hasAPI, by their path
+	apisLock sync.Mutex
+	apis     map[string]bool
+}
+
+func newHTTPClient(cluster common.OpenshiftClusterConfig) (Client, error) {
+	client, err := common.NewHTTPClient("openshift "+cluster.ID, cluster.HTTPClientConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &httpClient{
+		baseURL: cluster.APIURL,
+		token:   cluster.Token,
+		timeout: cluster.Timeout,
+		client:  client,
+		apis:    map[string]bool{},
+	}, nil
+}
+
+// do sends the object in to OpenShift and decodes the answer into out, both are optional
+func (o *httpClient) do(ctx context.Context, method string, path string, contentType string, in interface{}, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, o.baseURL+"/"+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	if o.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.timeout)
+		defer cancel()
+	}
+	req = req.WithContext(ctx)
+
+	common.Logger(ctx).WithFields(logrus.Fields{"method": method, "url": req.URL.String()}).Debug("Calling backend")
+	common.SetRequestIDHeader(ctx, req)
+	req.Header.Set("Authorization", "Bearer "+o.token)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// OpenShift describes the error in a Status object
+		var status struct {
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(respBody, &status) != nil || len(status.Message) == 0 {
+			status.Message = string(respBody)
+		}
+		return &StatusError{Code: resp.StatusCode, Reason: status.Reason, Message: status.Message}
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return fmt.Errorf("Error decoding %v from openshift api: %v", path, err)
+		}
+	}
+	return nil
+}
+
+func (o *httpClient) get(ctx context.Context, path string, out interface{}) error {
+	return o.do(ctx, "GET", path, "", nil, out)
+}
+
+func (o *httpClient) create(ctx context.Context, path string, in interface{}) error {
+	return o.do(ctx, "POST", path, "application/json", in, nil)
+}
+
+func (o *httpClient) update(ctx context.Context, path string, in interface{}) error {
+	return o.do(ctx, "PUT", path, "application/json", in, nil)
+}
+
+func (o *httpClient) delete(ctx context.Context, path string) error {
+	return o.do(ctx, "DELETE", path, "", nil, nil)
+}
+
+// hasAPI returns true if the cluster has the api group, it is only asked once
+func (o *httpClient) hasAPI(ctx context.Context, path string) (bool, error) {
+	o.apisLock.Lock()
+	defer o.apisLock.Unlock()
+
+	if has, ok := o.apis[path]; ok {
+		return has, nil
+	}
+	err := o.get(ctx, path, nil)
+	if err != nil && !IsNotFound(err) {
+		return false, err
+	}
+
+	has := err == nil
+	common.Logger(ctx).WithFields(logrus.Fields{"api": path, "available": has}).Info("Detected api of OpenShift")
+	o.apis[path] = has
+	return has, nil
+}
+
+// openshiftAPI returns the path and the version of an api group of OpenShift.
+// OpenShift 4 only has the api groups, clusters before 3.6 only the legacy oapi.
+func (o *httpClient) openshiftAPI(ctx context.Context, group string) (string, string, error) {
+	has, err := o.hasAPI(ctx, "apis/"+group+"/v1")
+	if err != nil {
+		return "", "", err
+	}
+	if has {
+		return "apis/" + group + "/v1", group + "/v1", nil
+	}
+	return "oapi/v1", "v1", nil
+}
+
+func (o *httpClient) CreateProjectRequest(ctx context.Context, name string) error {
+	api, version, err := o.openshiftAPI(ctx, "project.openshift.io")
+	if err != nil {
+		return err
+	}
+	request := struct {
+		TypeMeta
+		Metadata ObjectMeta `json:"metadata"`
+	}{TypeMeta{Kind: "ProjectRequest", APIVersion: version}, ObjectMeta{Name: name}}
+
+	return o.create(ctx, api+"/projectrequests", request)
+}
+
+func (o *httpClient) DeleteProject(ctx context.Context, name string) error {
+	api, _, err := o.openshiftAPI(ctx, "project.openshift.io")
+	if err != nil {
+		return err
+	}
+	return o.delete(ctx, api+"/projects/"+name)
+}
+
+func (o *httpClient) ListNamespaces(ctx context.Context) ([]Namespace, error) {
+	var list struct {
+		Items []Namespace `json:"items"`
+	}
+	err := o.get(ctx, "api/v1/namespaces", &list)
+	return list.Items, err
+}
+
+func (o *httpClient) GetNamespace(ctx context.Context, name string) (*Namespace, error) {
+	var ns Namespace
+	if err := o.get(ctx, "api/v1/namespaces/"+name, &ns); err != nil {
+		return nil, err
+	}
+	return &ns, nil
+}
+
+func (o *httpClient) PatchNamespaceAnnotations(ctx context.Context, name string, set map[string]string, remove []string) error {
+	// In a merge patch null removes a field
+	annotations := map[string]interface{}{}
+	for _, k := range remove {
+		annotations[k] = nil
+	}
+	for k, v := range set {
+		annotations[k] = v
+	}
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": annotations},
+	}
+
+	return o.do(ctx, "PATCH", "api/v1/namespaces/"+name, "application/merge-patch+json", patch, nil)
+}
+
+func (o *httpClient) PatchNamespaceLabels(ctx context.Context, name string, set map[string]string) error {
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{"labels": set},
+	}
+
+	return o.do(ctx, "PATCH", "api/v1/namespaces/"+name, "application/merge-patch+json", patch, nil)
+}
+
+func (o *httpClient) ListResourceQuotas(ctx context.Context, namespace string) ([]ResourceQuota, error) {
+	var list struct {
+		Items []ResourceQuota `json:"items"`
+	}
+	err := o.get(ctx, "api/v1/namespaces/"+namespace+"/resourcequotas", &list)
+	return list.Items, err
+}
+
+func (o *httpClient) CreateResourceQuota(ctx context.Context, quota *ResourceQuota) error {
+	quota.TypeMeta = newTypeMeta("ResourceQuota")
+	return o.create(ctx, "api/v1/namespaces/"+quota.Metadata.Namespace+"/resourcequotas", quota)
+}
+
+func (o *httpClient) PatchResourceQuotaHard(ctx context.Context, namespace string, name string, set map[string]string) error {
+	patch := map[string]interface{}{
+		"spec": map[string]interface{}{"hard": set},
+	}
+
+	return o.do(ctx, "PATCH", "api/v1/namespaces/"+namespace+"/resourcequotas/"+name, "application/merge-patch+json", patch, nil)
+}
+
+func (o *httpClient) ListLimitRanges(ctx context.Context, namespace string) ([]LimitRange, error) {
+	var list struct {
+		Items []LimitRange `json:"items"`
+	}
+	err := o.get(ctx, "api/v1/namespaces/"+namespace+"/limitranges", &list)
+	return list.Items, err
+}
+
+func (o *httpClient) CreateLimitRange(ctx context.Context, limitRange *LimitRange) error {
+	limitRange.TypeMeta = newTypeMeta("LimitRange")
+	return o.create(ctx, "api/v1/namespaces/"+limitRange.Metadata.Namespace+"/limitranges", limitRange)
+}
+
+func (o *httpClient) CreateNetworkPolicy(ctx context.Context, policy *NetworkPolicy) error {
+	policy.TypeMeta = TypeMeta{Kind: "NetworkPolicy", APIVersion: "networking.k8s.io/v1"}
+	return o.create(ctx, "apis/networking.k8s.io/v1/namespaces/"+policy.Metadata.Namespace+"/networkpolicies", policy)
+}
+
+func (o *httpClient) CreatePersistentVolume(ctx context.Context, pv *PersistentVolume) error {
+	pv.TypeMeta = newTypeMeta("PersistentVolume")
+	return o.create(ctx, "api/v1/persistentvolumes", pv)
+}
+
+func (o *httpClient) GetPersistentVolume(ctx context.Context, name string) (*PersistentVolume, error) {
+	var pv PersistentVolume
+	if err := o.get(ctx, "api/v1/persistentvolumes/"+name, &pv); err != nil {
+		return nil, err
+	}
+	return &pv, nil
+}
+
+func (o *httpClient) DeletePersistentVolume(ctx context.Context, name string) error {
+	return o.delete(ctx, "api/v1/persistentvolumes/"+name)
+}
+
+func (o *httpClient) PatchPersistentVolumeAnnotations(ctx context.Context, name string, set map[string]string) error {
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": set},
+	}
+
+	return o.do(ctx, "PATCH", "api/v1/persistentvolumes/"+name, "application/merge-patch+json", patch, nil)
+}
+
+func (o *httpClient) ListPersistentVolumeClaims(ctx context.Context, namespace string) ([]PersistentVolumeClaim, error) {
+	var list struct {
+		Items []PersistentVolumeClaim `json:"items"`
+	}
+	err := o.get(ctx, "api/v1/namespaces/"+namespace+"/persistentvolumeclaims", &list)
+	return list.Items, err
+}
+
+func (o *httpClient) GetPersistentVolumeClaim(ctx context.Context, namespace string, name string) (*PersistentVolumeClaim, error) {
+	var pvc PersistentVolumeClaim
+	if err := o.get(ctx, "api/v1/namespaces/"+namespace+"/persistentvolumeclaims/"+name, &pvc); err != nil {
+		return nil, err
+	}
+	return &pvc, nil
+}
+
+func (o *httpClient) CreatePersistentVolumeClaim(ctx context.Context, pvc *PersistentVolumeClaim) error {
+	pvc.TypeMeta = newTypeMeta("PersistentVolumeClaim")
+	return o.create(ctx, "api/v1/namespaces/"+pvc.Metadata.Namespace+"/persistentvolumeclaims", pvc)
+}
+
+func (o *httpClient) DeletePersistentVolumeClaim(ctx context.Context, namespace string, name string) error {
+	return o.delete(ctx, "api/v1/namespaces/"+namespace+"/persistentvolumeclaims/"+name)
+}
+
+func (o *httpClient) CreateService(ctx context.Context, service *Service) error {
+	service.TypeMeta = newTypeMeta("Service")
+	return o.create(ctx, "api/v1/namespaces/"+service.Metadata.Namespace+"/services", service)
+}
+
+func (o *httpClient) CreateEndpoints(ctx context.Context, endpoints *Endpoints) error {
+	endpoints.TypeMeta = newTypeMeta("Endpoints")
+	return o.create(ctx, "api/v1/namespaces/"+endpoints.Metadata.Namespace+"/endpoints", endpoints)
+}
+
+func (o *httpClient) ListPods(ctx context.Context, namespace string) ([]Pod, error) {
+	var list struct {
+		Items []Pod `json:"items"`
+	}
+	err := o.get(ctx, "api/v1/namespaces/"+namespace+"/pods", &list)
+	return list.Items, err
+}
+
+func (o *httpClient) ListServiceAccounts(ctx context.Context, namespace string) ([]ServiceAccount, error) {
+	var list struct {
+		Items []ServiceAccount `json:"items"`
+	}
+	err := o.get(ctx, "api/v1/namespaces/"+namespace+"/serviceaccounts", &list)
+	return list.Items, err
+}
+
+func (o *httpClient) CreateServiceAccount(ctx context.Context, sa *ServiceAccount) error {
+	sa.TypeMeta = newTypeMeta("ServiceAccount")
+	return o.create(ctx, "api/v1/namespaces/"+sa.Metadata.Namespace+"/serviceaccounts", sa)
+}
+
+func (o *httpClient) GetServiceAccount(ctx context.Context, namespace string, name string) (*ServiceAccount, error) {
+	var sa ServiceAccount
+	if err := o.get(ctx, "api/v1/namespaces/"+namespace+"/serviceaccounts/"+name, &sa); err != nil {
+		return nil, err
+	}
+	return &sa, nil
+}
+
+func (o *httpClient) PatchServiceAccountAnnotations(ctx context.Context, namespace string, name string, set map[string]string) error {
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": set},
+	}
+
+	return o.do(ctx, "PATCH", "api/v1/namespaces/"+namespace+"/serviceaccounts/"+name, "application/merge-patch+json", patch, nil)
+}
+
+func (o *httpClient) DeleteServiceAccount(ctx context.Context, namespace string, name string) error {
+	return o.delete(ctx, "api/v1/namespaces/"+namespace+"/serviceaccounts/"+name)
+}
+
+func (o *httpClient) GetSecret(ctx context.Context, namespace string, name string) (*Secret, error) {
+	var secret Secret
+	if err := o.get(ctx, "api/v1/namespaces/"+namespace+"/secrets/"+name, &secret); err != nil {
+		return nil, err
+	}
+	return &secret, nil
+}
+
+func (o *httpClient) CreateSecret(ctx context.Context, secret *Secret) error {
+	secret.TypeMeta = newTypeMeta("Secret")
+	return o.create(ctx, "api/v1/namespaces/"+secret.Metadata.Namespace+"/secrets", secret)
+}
+
+func (o *httpClient) UpdateSecret(ctx context.Context, secret *Secret) error {
+	secret.TypeMeta = newTypeMeta("Secret")
+	return o.update(ctx, "api/v1/namespaces/"+secret.Metadata.Namespace+"/secrets/"+secret.Metadata.Name, secret)
+}
+
+func (o *httpClient) DeleteSecret(ctx context.Context, namespace string, name string) error {
+	return o.delete(ctx, "api/v1/namespaces/"+namespace+"/secrets/"+name)
+}
+
+func (o *httpClient) GetGroup(ctx context.Context, name string) (*Group, error) {
+	api, _, err := o.openshiftAPI(ctx, "user.openshift.io")
+	if err != nil {
+		return nil, err
+	}
+	var group Group
+	if err := o.get(ctx, api+"/groups/"+name, &group); err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+func (o *httpClient) GetPolicyBinding(ctx context.Context, namespace string) (*PolicyBinding, error) {
+	var binding PolicyBinding
+	if err := o.get(ctx, "oapi/v1/namespaces/"+namespace+"/policybindings/:default", &binding); err != nil {
+		return nil, err
+	}
+	return &binding, nil
+}
+
+func (o *httpClient) UpdatePolicyBinding(ctx context.Context, binding *PolicyBinding) error {
+	binding.TypeMeta = newTypeMeta("PolicyBinding")
+	return o.update(ctx, "oapi/v1/namespaces/"+binding.Metadata.Namespace+"/policybindings/:default", binding)
+}
+
+func (o *httpClient) HasRBAC(ctx context.Context) (bool, error) {
+	return o.hasAPI(ctx, rbacAPI)
+}
+
+func (o *httpClient) ListRoleBindings(ctx context.Context, namespace string) ([]RoleBinding, error) {
+	var list struct {
+		Items []RoleBinding `json:"items"`
+	}
+	err := o.get(ctx, rbacAPI+"/namespaces/"+namespace+"/rolebindings", &list)
+	return list.Items, err
+}
+
+func (o *httpClient) ListLabeledRoleBindings(ctx context.Context, labels map[string]string) ([]RoleBinding, error) {
+	var selector []string
+	for k, v := range labels {
+		selector = append(selector, k+"="+v)
+	}
+	sort.Strings(selector)
+
+	var list struct {
+		Items []RoleBinding `json:"items"`
+	}
+	err := o.get(ctx, rbacAPI+"/rolebindings?labelSelector="+url.QueryEscape(strings.Join(selector, ",")), &list)
+	return list.Items, err
+}
+
+func (o *httpClient) GetRoleBinding(ctx context.Context, namespace string, name string) (*RoleBinding, error) {
+	var binding RoleBinding
+	if err := o.get(ctx, rbacAPI+"/namespaces/"+namespace+"/rolebindings/"+name, &binding); err != nil {
+		return nil, err
+	}
+	return &binding, nil
+}
+
+func (o *httpClient) CreateRoleBinding(ctx context.Context, binding *RoleBinding) error {
+	binding.TypeMeta = TypeMeta{Kind: "RoleBinding", APIVersion: rbacAPIVersion}
+	return o.create(ctx, rbacAPI+"/namespaces/"+binding.Metadata.Namespace+"/rolebindings", binding)
+}
+
+func (o *httpClient) UpdateRoleBinding(ctx context.Context, binding *RoleBinding) error {
+	binding.TypeMeta = TypeMeta{Kind: "RoleBinding", APIVersion: rbacAPIVersion}
+	return o.update(ctx, rbacAPI+"/namespaces/"+binding.Metadata.Namespace+"/rolebindings/"+binding.Metadata.Name, binding)
+}
+
+func (o *httpClient) DeleteRoleBinding(ctx context.Context, namespace string, name string) error {
+	return o.delete(ctx, rbacAPI+"/namespaces/"+namespace+"/rolebindings/"+name)
+}
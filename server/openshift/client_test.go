@@ -0,0 +1,146 @@
+package openshift
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
+	"github.com/gin-gonic/gin"
+)
+
+func TestClientErrors(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/namespaces/missing":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"kind":"Status","status":"Failure","reason":"NotFound","message":"namespaces \"missing\" not found","code":404}`))
+		case "/apis/project.openshift.io/v1", "/apis/user.openshift.io/v1":
+			// Clusters before 3.6 only have the legacy oapi
+			w.WriteHeader(http.StatusNotFound)
+		case "/oapi/v1/projectrequests":
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"kind":"Status","reason":"AlreadyExists","code":409}`))
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("forbidden"))
+		}
+	}))
+	defer api.Close()
+
+	client := newTestClient(t, common.OpenshiftClusterConfig{APIURL: api.URL}, time.Second)
+
+	_, err := client.GetNamespace(context.Background(), "missing")
+	assert(t, IsNotFound(err), "Should be not found: %v", err)
+	equals(t, `namespaces "missing" not found`, err.(*StatusError).Message)
+
+	err = client.CreateProjectRequest(context.Background(), "existing")
+	assert(t, IsConflict(err), "Should be a conflict: %v", err)
+
+	_, err = client.GetGroup(context.Background(), "operator")
+	assert(t, IsForbidden(err), "Should be forbidden: %v", err)
+	equals(t, "forbidden", err.(*StatusError).Message)
+}
+
+func TestClientAPIGroups(t *testing.T) {
+	var paths []string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		switch r.URL.Path {
+		case "/apis/user.openshift.io/v1/groups/operator":
+			w.Write([]byte(`{"metadata":{"name":"operator"},"users":["u123456"]}`))
+		}
+	}))
+	defer api.Close()
+
+	client := newTestClient(t, common.OpenshiftClusterConfig{APIURL: api.URL}, time.Second)
+
+	group, err := client.GetGroup(context.Background(), "operator")
+	ok(t, err)
+	equals(t, []string{"u123456"}, group.Users)
+	ok(t, client.CreateProjectRequest(context.Background(), "project"))
+	ok(t, client.DeleteProject(context.Background(), "project"))
+	_, err = client.GetGroup(context.Background(), "operator")
+	ok(t, err)
+
+	// The api groups are only detected once
+	equals(t, []string{
+		"GET /apis/user.openshift.io/v1",
+		"GET /apis/user.openshift.io/v1/groups/operator",
+		"GET /apis/project.openshift.io/v1",
+		"POST /apis/project.openshift.io/v1/projectrequests",
+		"DELETE /apis/project.openshift.io/v1/projects/project",
+		"GET /apis/user.openshift.io/v1/groups/operator",
+	}, paths)
+}
+
+func TestClientRequests(t *testing.T) {
+	var patch map[string]map[string]map[string]interface{}
+	var header http.Header
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		switch r.Method {
+		case "PATCH":
+			body, _ := ioutil.ReadAll(r.Body)
+			json.Unmarshal(body, &patch)
+		case "GET":
+			w.Write([]byte(`{"items":[{"metadata":{"name":"pvc1"},"spec":{"volumeName":"gl-pv1"},"status":{"capacity":{"storage":"1G"}}}]}`))
+		}
+	}))
+	defer api.Close()
+
+	client := newTestClient(t, common.OpenshiftClusterConfig{APIURL: api.URL, Token: "token"}, time.Second)
+
+	// Calls of a request contain its id
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(common.RequestIDMiddleware())
+	router.GET("/", func(c *gin.Context) {
+		ok(t, client.PatchNamespaceAnnotations(c, "project", map[string]string{"a": "1"}, []string{"b"}))
+	})
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(common.RequestIDHeader, "abc-123")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	equals(t, "abc-123", header.Get(common.RequestIDHeader))
+	equals(t, "Bearer token", header.Get("Authorization"))
+	equals(t, "application/merge-patch+json", header.Get("Content-Type"))
+	equals(t, map[string]interface{}{"a": "1", "b": nil}, patch["metadata"]["annotations"])
+
+	// Only the annotations of a service account are sent, so its pull secrets are kept
+	patch = nil
+	ok(t, client.PatchServiceAccountAnnotations(context.Background(), "project", "app", map[string]string{"a": "1"}))
+	equals(t, "application/merge-patch+json", header.Get("Content-Type"))
+	equals(t, map[string]map[string]map[string]interface{}{"metadata": {"annotations": {"a": "1"}}}, patch)
+
+	// Only the limits of a quota are sent, so its scope selector is kept
+	patch = nil
+	ok(t, client.PatchResourceQuotaHard(context.Background(), "project", "default", map[string]string{"pods": "10"}))
+	equals(t, map[string]map[string]map[string]interface{}{"spec": {"hard": {"pods": "10"}}}, patch)
+
+	pvcs, err := client.ListPersistentVolumeClaims(context.Background(), "project")
+	ok(t, err)
+	equals(t, 1, len(pvcs))
+	equals(t, "gl-pv1", pvcs[0].Spec.VolumeName)
+	equals(t, "1G", pvcs[0].Status.Capacity["storage"])
+}
+
+func TestClientTimeout(t *testing.T) {
+	done := make(chan bool)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer api.Close()
+	defer close(done)
+
+	client := newTestClient(t, common.OpenshiftClusterConfig{APIURL: api.URL}, 50*time.Millisecond)
+
+	start := time.Now()
+	_, err := client.ListNamespaces(context.Background())
+	assert(t, err != nil, "Should fail after the timeout")
+	assert(t, time.Since(start) < time.Second, "Should not wait for the api")
+}
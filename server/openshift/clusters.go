@@ -0,0 +1,108 @@
+package openshift
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
+	"github.com/gin-gonic/gin"
+)
+
+// clusterKey is the key of the chosen cluster in the gin and request context
+const clusterKey = "SSP_OSE_CLUSTER"
+
+// cluster is a configured OpenShift cluster with the clients for its api and storage backends
+type cluster struct {
+	common.OpenshiftClusterConfig
+	client        Client
+	glusterClient *http.Client
+	nfsClient     *http.Client
+}
+
+// clusters are the configured clusters, the first one is used if a request doesn't choose one
+var clusters []*cluster
+
+func registerClusters(cfg common.OpenshiftConfig) error {
+	clusters = nil
+	for _, c := range cfg.GetClusters() {
+		if c.Timeout == 0 {
+			c.Timeout = cfg.Timeout
+		}
+		cl := &cluster{OpenshiftClusterConfig: c}
+
+		var err error
+		if cl.client, err = newHTTPClient(c); err != nil {
+			return fmt.Errorf("Error creating the client of the OpenShift cluster %v: %v", c.ID, err.Error())
+		}
+		if len(c.Gluster.APIURL) > 0 {
+			if cl.glusterClient, err = common.NewHTTPClient("gluster "+c.ID, c.Gluster.HTTPClientConfig); err != nil {
+				return err
+			}
+		}
+		if len(c.Nfs.APIURL) > 0 {
+			if cl.nfsClient, err = common.NewHTTPClient("nfs "+c.ID, c.Nfs.HTTPClientConfig); err != nil {
+				return err
+			}
+		}
+		clusters = append(clusters, cl)
+	}
+	return nil
+}
+
+func findCluster(id string) *cluster {
+	for _, c := range clusters {
+		if c.ID == id {
+			return c
+		}
+	}
+	return nil
+}
+
+// getCluster returns the cluster of the request, or the default cluster
+func getCluster(ctx context.Context) *cluster {
+	if c, ok := ctx.Value(clusterKey).(*cluster); ok {
+		return c
+	}
+	return clusters[0]
+}
+
+// ose returns the api client of the cluster of the request
+func ose(ctx context.Context) Client {
+	return getCluster(ctx).client
+}
+
+func withCluster(ctx context.Context, c *cluster) context.Context {
+	return context.WithValue(ctx, clusterKey, c)
+}
+
+// clusterMiddleware stores the cluster of the query parameter 'cluster' in the context.
+// The permissions are checked afterwards by the handlers on this cluster.
+func clusterMiddleware(c *gin.Context) {
+	id := c.Query("cluster")
+	if len(id) == 0 {
+		c.Set(clusterKey, clusters[0])
+		return
+	}
+
+	cl := findCluster(id)
+	if cl == nil {
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, fmt.Sprintf("Der Cluster %v existiert nicht", id)))
+		c.Abort()
+		return
+	}
+	c.Set(clusterKey, cl)
+}
+
+func getClustersHandler(c *gin.Context) {
+	result := []common.OseCluster{}
+	for _, cl := range clusters {
+		result = append(result, common.OseCluster{
+			ID:      cl.ID,
+			Name:    cl.Name,
+			Gluster: len(cl.Gluster.APIURL) > 0,
+			Nfs:     len(cl.Nfs.APIURL) > 0,
+		})
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,59 @@
+package openshift
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
+)
+
+func TestGetClusters(t *testing.T) {
+	_, router := setupFake("u123456")
+
+	req := httptest.NewRequest("GET", "/api/ose/clusters", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	equals(t, http.StatusOK, w.Code)
+
+	var res []common.OseCluster
+	ok(t, json.Unmarshal(w.Body.Bytes(), &res))
+	equals(t, []common.OseCluster{
+		{ID: "default", Name: "Default", Gluster: true},
+		{ID: "other", Name: "Other"},
+	}, res)
+}
+
+func TestClusterParameter(t *testing.T) {
+	fake, router := setupFake("u123456")
+	other := clusters[1].client.(*fakeClient)
+	fake.addProject("project", "u123456")
+	other.addProject("project", "u000000")
+
+	// The permissions are checked on the chosen cluster
+	code, _ := call(router, "DELETE", "/api/ose/project/project?cluster=other", nil)
+	equals(t, http.StatusBadRequest, code)
+	assert(t, other.namespaces["project"] != nil, "Project on the other cluster should not be deleted")
+
+	other.addProject("mine", "u123456")
+	code, _ = call(router, "DELETE", "/api/ose/project/mine?cluster=other", nil)
+	equals(t, http.StatusOK, code)
+	assert(t, other.namespaces["mine"] == nil, "Project should be deleted on the other cluster")
+
+	// Without parameter the default cluster is used
+	code, _ = call(router, "DELETE", "/api/ose/project/project", nil)
+	equals(t, http.StatusOK, code)
+	assert(t, fake.namespaces["project"] == nil, "Project should be deleted on the default cluster")
+
+	code, msg := call(router, "DELETE", "/api/ose/project/project?cluster=missing", nil)
+	equals(t, http.StatusBadRequest, code)
+	equals(t, "Der Cluster missing existiert nicht", msg)
+}
+
+func TestClusterCAFile(t *testing.T) {
+	cluster := common.OpenshiftClusterConfig{APIURL: "https://ose"}
+	cluster.CAFile = "missing.pem"
+	_, err := newHTTPClient(cluster)
+	assert(t, err != nil, "A missing CA file should be an error")
+}
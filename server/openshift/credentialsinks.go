@@ -0,0 +1,457 @@
+package openshift
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// credentialSinkAnnotation is the json of the credential sink which has the token of the service account
+	credentialSinkAnnotation = "openshift.io/credential-sink"
+	// credentialSourceAnnotation marks the secrets with a copied token by the service account they come from
+	credentialSourceAnnotation = "openshift.io/credential-source"
+
+	// gitlabMaintainer is the access level of the maintainers of a GitLab project
+	gitlabMaintainer = 40
+)
+
+// serviceAccountCredential is the token of a service account, which is stored in a credential sink
+type serviceAccountCredential struct {
+	Project        string
+	ServiceAccount string
+	Token          string
+}
+
+// credentialSink stores the tokens of service accounts outside of their project
+type credentialSink interface {
+	// validate checks the sink before the service account is created or its token is rotated
+	validate(ctx context.Context, username string, sink common.CredentialSink) error
+	store(ctx context.Context, sink common.CredentialSink, cred serviceAccountCredential) error
+	// describe tells the user where to find the token
+	describe(sink common.CredentialSink) string
+}
+
+var credentialSinks = map[string]credentialSink{
+	"jenkins": jenkinsSink{},
+	"webhook": webhookSink{},
+	"gitlab":  gitlabSink{},
+	"secret":  secretSink{},
+}
+
+var gitlabVariableRegex = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+var (
+	// gitlabClient is the http client of GitLab, if it is configured
+	gitlabClient *http.Client
+	// webhookClients are the http clients of the configured credential webhooks
+	webhookClients map[string]*http.Client
+)
+
+// registerCredentialSinks creates the clients of the credential sinks
+func registerCredentialSinks(cfg common.OpenshiftConfig) error {
+	var err error
+	if len(cfg.WZUBackend.URL) > 0 {
+		if wzuClient, err = common.NewHTTPClient("wzu backend", cfg.WZUBackend.HTTPClientConfig); err != nil {
+			return err
+		}
+	}
+	if len(cfg.GitLab.URL) > 0 {
+		if gitlabClient, err = common.NewHTTPClient("gitlab", cfg.GitLab.HTTPClientConfig); err != nil {
+			return err
+		}
+	}
+	webhookClients = map[string]*http.Client{}
+	for name, h := range cfg.CredentialWebhooks {
+		if webhookClients[name], err = common.NewHTTPClient("credential webhook "+name, h.HTTPClientConfig); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getCredentialSink(sink common.CredentialSink) (credentialSink, error) {
+	s, ok := credentialSinks[sink.Type]
+	if !ok {
+		var types []string
+		for t := range credentialSinks {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+		return nil, fmt.Errorf("Der Ablageort %v ist unbekannt. Erlaubt sind: %v", sink.Type, strings.Join(types, ", "))
+	}
+	return s, nil
+}
+
+func validateCredentialSink(ctx context.Context, username string, sink common.CredentialSink) error {
+	s, err := getCredentialSink(sink)
+	if err != nil {
+		return err
+	}
+	return s.validate(ctx, username, sink)
+}
+
+func describeCredentialSink(sink common.CredentialSink) string {
+	s, err := getCredentialSink(sink)
+	if err != nil {
+		return sink.Type
+	}
+	return s.describe(sink)
+}
+
+// serviceAccountCredentialSink returns the credential sink of the service account, or nil if it has none.
+// Older service accounts only have the organization of their Jenkins.
+func serviceAccountCredentialSink(ctx context.Context, sa *ServiceAccount) *common.CredentialSink {
+	if value, ok := sa.Metadata.Annotations[credentialSinkAnnotation]; ok {
+		var sink common.CredentialSink
+		if err := json.Unmarshal([]byte(value), &sink); err != nil {
+			common.Logger(ctx).WithError(err).WithField("service_account", sa.Metadata.Name).Error("Error parsing the credential sink of the service account")
+			return nil
+		}
+		return &sink
+	}
+	if organizationKey := sa.Metadata.Annotations[jenkinsOrganizationAnnotation]; len(organizationKey) > 0 {
+		return &common.CredentialSink{Type: "jenkins", Target: organizationKey}
+	}
+	return nil
+}
+
+// setCredentialSinkAnnotation records the credential sink of the service account
+func setCredentialSinkAnnotation(ctx context.Context, sa *ServiceAccount, sink common.CredentialSink) error {
+	value, err := json.Marshal(sink)
+	if err != nil {
+		common.Logger(ctx).WithError(err).Error("Error encoding the credential sink")
+		return errors.New(genericAPIError)
+	}
+	if sa.Metadata.Annotations == nil {
+		sa.Metadata.Annotations = map[string]string{}
+	}
+	sa.Metadata.Annotations[credentialSinkAnnotation] = string(value)
+	return nil
+}
+
+// storeServiceAccountToken stores the current token of the service account in the credential sink
+func storeServiceAccountToken(ctx context.Context, project string, serviceaccount string, sink common.CredentialSink) error {
+	s, err := getCredentialSink(sink)
+	if err != nil {
+		return err
+	}
+
+	sa, err := getServiceAccount(ctx, project, serviceaccount)
+	if err != nil {
+		return err
+	}
+	tokens, err := getServiceAccountTokens(ctx, sa)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		common.Logger(ctx).WithField("service_account", serviceaccount).Error("Service account has no token")
+		return errors.New(genericAPIError)
+	}
+	token, err := base64.StdEncoding.DecodeString(tokens[0].Data["token"])
+	if err != nil {
+		common.Logger(ctx).WithError(err).WithField("service_account", serviceaccount).Error("Error decoding the token of the service account")
+		return errors.New(genericAPIError)
+	}
+
+	cred := serviceAccountCredential{Project: project, ServiceAccount: serviceaccount, Token: string(token)}
+	if err := s.store(ctx, sink, cred); err != nil {
+		return err
+	}
+	common.Logger(ctx).WithFields(logrus.Fields{"project": project, "service_account": serviceaccount, "sink": sink.Type, "target": sink.Target}).Info("Stored the token of the service account")
+	return nil
+}
+
+// jenkinsSink stores the token as credential in the Jenkins of an organization, via the WZU backend
+type jenkinsSink struct{}
+
+type newJenkinsCredentialsCommand struct {
+	OrganizationKey string `json:"organizationKey"`
+	Secret          string `json:"secret"`
+	Description     string `json:"description"`
+}
+
+func (jenkinsSink) validate(ctx context.Context, username string, sink common.CredentialSink) error {
+	if len(config.WZUBackend.URL) == 0 {
+		return errors.New("Das Hinterlegen im Jenkins ist nicht konfiguriert")
+	}
+	if len(sink.Target) == 0 {
+		return errors.New("Die Organisation des Jenkins muss angegeben werden")
+	}
+	return nil
+}
+
+func (jenkinsSink) store(ctx context.Context, sink common.CredentialSink, cred serviceAccountCredential) error {
+	command := newJenkinsCredentialsCommand{
+		OrganizationKey: sink.Target,
+		Description:     fmt.Sprintf("OpenShift Deployer - project: %v, service-account: %v", cred.Project, cred.ServiceAccount),
+		Secret:          base64.StdEncoding.EncodeToString([]byte(cred.Token)),
+	}
+	byteJson, err := json.Marshal(command)
+	if err != nil {
+		common.Logger(ctx).WithError(err).Error("Error encoding the jenkins credential")
+		return errors.New(genericAPIError)
+	}
+
+	client, wzuRequest := getWZUBackendClient(ctx, "POST", "sec/jenkins/credentials", bytes.NewReader(byteJson))
+	wzuResponse, err := client.Do(wzuRequest)
+	if err != nil {
+		common.Logger(ctx).WithError(err).Error("Error calling the WZU backend")
+		return errors.New(genericAPIError)
+	}
+	defer wzuResponse.Body.Close()
+
+	if wzuResponse.StatusCode != http.StatusOK {
+		bodyBytes, _ := ioutil.ReadAll(wzuResponse.Body)
+		return fmt.Errorf("Fehler vom WZU-Backend: StatusCode: %v, Nachricht: %v", wzuResponse.StatusCode, string(bodyBytes))
+	}
+	return nil
+}
+
+func (jenkinsSink) describe(sink common.CredentialSink) string {
+	return fmt.Sprintf("<a href='%v' target='_blank'>Jenkins</a>", config.JenkinsURL+"/job/"+sink.Target+"/credentials")
+}
+
+// webhookSink posts the token to a configured webhook. Only configured webhooks can be chosen, so tokens never go to arbitrary urls.
+type webhookSink struct{}
+
+type credentialWebhookCommand struct {
+	Project        string `json:"project"`
+	ServiceAccount string `json:"serviceAccount"`
+	Cluster        string `json:"cluster"`
+	Token          string `json:"token"`
+}
+
+func (webhookSink) validate(ctx context.Context, username string, sink common.CredentialSink) error {
+	if _, ok := config.CredentialWebhooks[sink.Target]; !ok {
+		return fmt.Errorf("Der Webhook %v ist nicht konfiguriert", sink.Target)
+	}
+	return nil
+}
+
+func (webhookSink) store(ctx context.Context, sink common.CredentialSink, cred serviceAccountCredential) error {
+	hook, ok := config.CredentialWebhooks[sink.Target]
+	if !ok {
+		common.Logger(ctx).WithField("webhook", sink.Target).Error("Credential webhook isn't configured anymore")
+		return fmt.Errorf("Der Webhook %v ist nicht konfiguriert", sink.Target)
+	}
+
+	byteJson, err := json.Marshal(credentialWebhookCommand{
+		Project:        cred.Project,
+		ServiceAccount: cred.ServiceAccount,
+		Cluster:        getCluster(ctx).ID,
+		Token:          cred.Token,
+	})
+	if err != nil {
+		common.Logger(ctx).WithError(err).Error("Error encoding the webhook call")
+		return errors.New(genericAPIError)
+	}
+
+	req, _ := http.NewRequest("POST", hook.URL, bytes.NewReader(byteJson))
+	req.Header.Set("Content-Type", "application/json")
+	if len(hook.Secret) > 0 {
+		req.Header.Set("Authorization", "Bearer "+hook.Secret)
+	}
+	common.SetRequestIDHeader(ctx, req)
+
+	resp, err := webhookClients[sink.Target].Do(req)
+	if err != nil {
+		common.Logger(ctx).WithError(err).WithField("webhook", sink.Target).Error("Error calling the credential webhook")
+		return errors.New(genericAPIError)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		bodyBytes, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("Fehler vom Webhook %v: StatusCode: %v, Nachricht: %v", sink.Target, resp.StatusCode, string(bodyBytes))
+	}
+	return nil
+}
+
+func (webhookSink) describe(sink common.CredentialSink) string {
+	if hook := config.CredentialWebhooks[sink.Target]; len(hook.Description) > 0 {
+		return hook.Description
+	}
+	return "Webhook " + sink.Target
+}
+
+// gitlabSink stores the token as CI variable of a GitLab project. The user has to be maintainer of the project.
+type gitlabSink struct{}
+
+// gitlabVariable is masked, so the token never appears in the job logs
+type gitlabVariable struct {
+	Key       string `json:"key"`
+	Value     string `json:"value"`
+	Masked    bool   `json:"masked"`
+	Protected bool   `json:"protected"`
+}
+
+func (gitlabSink) validate(ctx context.Context, username string, sink common.CredentialSink) error {
+	if len(config.GitLab.URL) == 0 {
+		return errors.New("Das Hinterlegen im GitLab ist nicht konfiguriert")
+	}
+	if len(sink.Target) == 0 {
+		return errors.New("Das GitLab-Projekt muss angegeben werden")
+	}
+	if !gitlabVariableRegex.MatchString(sink.Name) {
+		return errors.New("Der Name der GitLab-Variable darf nur Buchstaben, Zahlen und _ enthalten")
+	}
+
+	var users []struct {
+		ID int `json:"id"`
+	}
+	status, err := callGitLab(ctx, "GET", "users?username="+url.QueryEscape(username), nil, &users)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK || len(users) == 0 {
+		return fmt.Errorf("Du hast keinen Benutzer im GitLab (%v)", username)
+	}
+
+	var member struct {
+		AccessLevel int `json:"access_level"`
+	}
+	status, err = callGitLab(ctx, "GET", fmt.Sprintf("projects/%v/members/all/%v", url.PathEscape(sink.Target), users[0].ID), nil, &member)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK || member.AccessLevel < gitlabMaintainer {
+		return fmt.Errorf("Du bist nicht Maintainer des GitLab-Projekts %v", sink.Target)
+	}
+	return nil
+}
+
+// store updates the variable, or creates it if it doesn't exist yet
+func (gitlabSink) store(ctx context.Context, sink common.CredentialSink, cred serviceAccountCredential) error {
+	variables := fmt.Sprintf("projects/%v/variables", url.PathEscape(sink.Target))
+	variable := gitlabVariable{Key: sink.Name, Value: cred.Token, Masked: true, Protected: !config.GitLab.UnprotectedVariables}
+
+	status, err := callGitLab(ctx, "PUT", variables+"/"+sink.Name, variable, nil)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusNotFound {
+		if status, err = callGitLab(ctx, "POST", variables, variable, nil); err != nil {
+			return err
+		}
+	}
+	if status < 200 || status > 299 {
+		return fmt.Errorf("Fehler vom GitLab: StatusCode: %v", status)
+	}
+	return nil
+}
+
+func (gitlabSink) describe(sink common.CredentialSink) string {
+	return fmt.Sprintf("GitLab-Variable %v im Projekt %v", sink.Name, sink.Target)
+}
+
+// callGitLab calls the api of GitLab and decodes a successful response into out. It returns the status code.
+func callGitLab(ctx context.Context, method string, path string, in interface{}, out interface{}) (int, error) {
+	var body io.Reader
+	if in != nil {
+		byteJson, err := json.Marshal(in)
+		if err != nil {
+			common.Logger(ctx).WithError(err).Error("Error encoding the GitLab call")
+			return 0, errors.New(genericAPIError)
+		}
+		body = bytes.NewReader(byteJson)
+	}
+
+	req, _ := http.NewRequest(method, config.GitLab.URL+"/api/v4/"+path, body)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("PRIVATE-TOKEN", config.GitLab.Token)
+	common.SetRequestIDHeader(ctx, req)
+	common.Logger(ctx).WithField("url", req.URL.Path).Debug("Calling GitLab")
+
+	resp, err := gitlabClient.Do(req)
+	if err != nil {
+		common.Logger(ctx).WithError(err).Error("Error calling GitLab")
+		return 0, errors.New(genericAPIError)
+	}
+	defer resp.Body.Close()
+
+	if out != nil && resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			common.Logger(ctx).WithError(err).Error("Error decoding the GitLab response")
+			return 0, errors.New(genericAPIError)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// secretSink copies the token as secret into another project. The user has to be admin of that project.
+type secretSink struct{}
+
+func (secretSink) validate(ctx context.Context, username string, sink common.CredentialSink) error {
+	if len(sink.Target) == 0 {
+		return errors.New("Das Projekt des Secrets muss angegeben werden")
+	}
+	if err := checkAdminPermissions(ctx, username, sink.Target); err != nil {
+		return fmt.Errorf("Projekt %v: %v", sink.Target, err.Error())
+	}
+	return nil
+}
+
+// store creates the secret, or updates it if it has the token of the same service account
+func (secretSink) store(ctx context.Context, sink common.CredentialSink, cred serviceAccountCredential) error {
+	source := cred.Project + "/" + cred.ServiceAccount
+	secret := &Secret{
+		Metadata: ObjectMeta{
+			Name:        secretSinkName(sink, cred),
+			Namespace:   sink.Target,
+			Annotations: map[string]string{credentialSourceAnnotation: source},
+		},
+		Type: "Opaque",
+		Data: map[string]string{"token": base64.StdEncoding.EncodeToString([]byte(cred.Token))},
+	}
+
+	err := ose(ctx).CreateSecret(ctx, secret)
+	if IsConflict(err) {
+		var existing *Secret
+		if existing, err = ose(ctx).GetSecret(ctx, sink.Target, secret.Metadata.Name); err != nil {
+			common.Logger(ctx).WithError(err).Error("Error getting the existing secret")
+			return errors.New(genericAPIError)
+		}
+		if existing.Metadata.Annotations[credentialSourceAnnotation] != source {
+			return fmt.Errorf("Das Secret %v existiert bereits im Projekt %v", secret.Metadata.Name, sink.Target)
+		}
+		existing.Data = secret.Data
+		err = ose(ctx).UpdateSecret(ctx, existing)
+	}
+	if err != nil {
+		common.Logger(ctx).WithError(err).WithField("project", sink.Target).Error("Error storing the token as secret")
+		return errors.New(genericAPIError)
+	}
+	return nil
+}
+
+func (secretSink) describe(sink common.CredentialSink) string {
+	if len(sink.Name) > 0 {
+		return fmt.Sprintf("Secret %v im Projekt %v", sink.Name, sink.Target)
+	}
+	return "Secret im Projekt " + sink.Target
+}
+
+// secretSinkName is the name of the secret, by default the project and name of the service account
+func secretSinkName(sink common.CredentialSink, cred serviceAccountCredential) string {
+	if len(sink.Name) > 0 {
+		return sink.Name
+	}
+	return fmt.Sprintf("sa-%v-%v", cred.Project, cred.ServiceAccount)
+}
@@ -0,0 +1,160 @@
+package openshift
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
+)
+
+func TestWebhookSink(t *testing.T) {
+	fake, router := setupFake("u123456")
+	fake.addProject("project", "u123456")
+
+	var auth string
+	var received credentialWebhookCommand
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer server.Close()
+	config.CredentialWebhooks = map[string]common.CredentialWebhookConfig{"vault": {Description: "Vault", URL: server.URL, Secret: "secret"}}
+	webhookClients = map[string]*http.Client{"vault": http.DefaultClient}
+
+	status, message := call(router, "POST", "/api/ose/serviceaccount", common.NewServiceAccountCommand{
+		ProjectName:    common.ProjectName{Project: "project"},
+		ServiceAccount: "deployer-sa",
+		Sink:           &common.CredentialSink{Type: "webhook", Target: "vault"},
+	})
+	equals(t, http.StatusOK, status)
+	equals(t, "Der Service Account deployer-sa wurde angelegt und das Token hinterlegt: Vault", message)
+	equals(t, "Bearer secret", auth)
+	equals(t, credentialWebhookCommand{Project: "project", ServiceAccount: "deployer-sa", Cluster: "default", Token: "deployer-sa-token-1"}, received)
+
+	// Only configured webhooks can receive tokens
+	err := validateNewServiceAccount(context.Background(), "u123456", "project", "app", &common.CredentialSink{Type: "webhook", Target: "http://example.com"}, nil)
+	equals(t, "Der Webhook http://example.com ist nicht konfiguriert", err.Error())
+}
+
+// fakeGitLab has the project group/app with the given maintainer and stores its variables
+func fakeGitLab(maintainer string, variables map[string]gitlabVariable) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("PRIVATE-TOKEN") != "gitlab-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var variable gitlabVariable
+		switch r.Method + " " + r.URL.EscapedPath() {
+		case "GET /api/v4/users":
+			if r.URL.Query().Get("username") == maintainer {
+				w.Write([]byte(`[{"id": 7}]`))
+			} else {
+				w.Write([]byte(`[]`))
+			}
+		case "GET /api/v4/projects/group%2Fapp/members/all/7":
+			w.Write([]byte(`{"id": 7, "access_level": 40}`))
+		case "PUT /api/v4/projects/group%2Fapp/variables/OPENSHIFT_TOKEN":
+			if _, ok := variables["OPENSHIFT_TOKEN"]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewDecoder(r.Body).Decode(&variable)
+			variables[variable.Key] = variable
+		case "POST /api/v4/projects/group%2Fapp/variables":
+			json.NewDecoder(r.Body).Decode(&variable)
+			variables[variable.Key] = variable
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	config.GitLab = common.GitLabConfig{URL: server.URL, Token: "gitlab-token"}
+	gitlabClient = http.DefaultClient
+	return server
+}
+
+func TestGitLabSink(t *testing.T) {
+	fake, router := setupFake("u123456")
+	fake.addProject("project", "u123456")
+	variables := map[string]gitlabVariable{}
+	server := fakeGitLab("u123456", variables)
+	defer server.Close()
+
+	sink := &common.CredentialSink{Type: "gitlab", Target: "group/app", Name: "OPENSHIFT_TOKEN"}
+	ok(t, validateNewServiceAccount(context.Background(), "u123456", "project", "app", sink, nil))
+	ok(t, createNewServiceAccount(context.Background(), "u123456", "project", "app", sink, nil))
+	equals(t, map[string]gitlabVariable{"OPENSHIFT_TOKEN": {Key: "OPENSHIFT_TOKEN", Value: "app-token-1", Masked: true, Protected: true}}, variables)
+
+	// The variable is updated with the new token
+	status, message := call(router, "POST", "/api/ose/project/project/serviceaccounts/app/rotate", nil)
+	equals(t, http.StatusOK, status)
+	equals(t, "Das Token des Service Accounts app wurde erneuert und hinterlegt: GitLab-Variable OPENSHIFT_TOKEN im Projekt group/app", message)
+	equals(t, "app-token-2", variables["OPENSHIFT_TOKEN"].Value)
+
+	// The variable can be used by the pipelines of all branches, but it is still masked
+	config.GitLab.UnprotectedVariables = true
+	status, _ = call(router, "POST", "/api/ose/project/project/serviceaccounts/app/rotate", nil)
+	equals(t, http.StatusOK, status)
+	equals(t, gitlabVariable{Key: "OPENSHIFT_TOKEN", Value: "app-token-3", Masked: true}, variables["OPENSHIFT_TOKEN"])
+}
+
+func TestGitLabSink_Validation(t *testing.T) {
+	fake, _ := setupFake("u123456")
+	fake.addProject("project", "u123456", "u654321")
+	server := fakeGitLab("u654321", map[string]gitlabVariable{})
+	defer server.Close()
+
+	err := validateNewServiceAccount(context.Background(), "u123456", "project", "app", &common.CredentialSink{Type: "gitlab", Target: "group/app", Name: "OPENSHIFT-TOKEN"}, nil)
+	equals(t, "Der Name der GitLab-Variable darf nur Buchstaben, Zahlen und _ enthalten", err.Error())
+
+	err = validateNewServiceAccount(context.Background(), "u123456", "project", "app", &common.CredentialSink{Type: "gitlab", Target: "group/app", Name: "OPENSHIFT_TOKEN"}, nil)
+	equals(t, "Du hast keinen Benutzer im GitLab (u123456)", err.Error())
+
+	err = validateNewServiceAccount(context.Background(), "u654321", "project", "app", &common.CredentialSink{Type: "gitlab", Target: "group/other", Name: "OPENSHIFT_TOKEN"}, nil)
+	equals(t, "Du bist nicht Maintainer des GitLab-Projekts group/other", err.Error())
+}
+
+func TestSecretSink(t *testing.T) {
+	fake, router := setupFake("u123456")
+	fake.addProject("project", "u123456")
+	fake.addProject("ci", "u123456")
+
+	sink := &common.CredentialSink{Type: "secret", Target: "ci"}
+	ok(t, createNewServiceAccount(context.Background(), "u123456", "project", "app", sink, nil))
+	secret := fake.secrets["ci"]["sa-project-app"]
+	equals(t, "Opaque", secret.Type)
+	equals(t, base64.StdEncoding.EncodeToString([]byte("app-token-1")), secret.Data["token"])
+
+	// The copy is updated with the new token
+	status, _ := call(router, "POST", "/api/ose/project/project/serviceaccounts/app/rotate", nil)
+	equals(t, http.StatusOK, status)
+	equals(t, base64.StdEncoding.EncodeToString([]byte("app-token-2")), fake.secrets["ci"]["sa-project-app"].Data["token"])
+
+	// Other secrets are never overwritten
+	fake.secrets["ci"]["registry"] = &Secret{Metadata: ObjectMeta{Name: "registry", Namespace: "ci"}}
+	err := createNewServiceAccount(context.Background(), "u123456", "project", "other", &common.CredentialSink{Type: "secret", Target: "ci", Name: "registry"}, nil)
+	equals(t, "Der Service Account other wurde angelegt, das Token konnte aber nicht hinterlegt werden: Das Secret registry existiert bereits im Projekt ci", err.Error())
+}
+
+func TestCredentialSink_Validation(t *testing.T) {
+	fake, _ := setupFake("u123456")
+	fake.addProject("project", "u123456")
+	fake.addProject("foreign", "u654321")
+
+	err := validateNewServiceAccount(context.Background(), "u123456", "project", "app", &common.CredentialSink{Type: "vault"}, nil)
+	equals(t, "Der Ablageort vault ist unbekannt. Erlaubt sind: gitlab, jenkins, secret, webhook", err.Error())
+
+	err = validateNewServiceAccount(context.Background(), "u123456", "project", "app", &common.CredentialSink{Type: "secret", Target: "foreign"}, nil)
+	equals(t, "Projekt foreign: Du hast keine Admin Rechte auf dem Projekt. Bestehende Admins sind folgende Benutzer: u654321", err.Error())
+}
+
+func TestServiceAccountCredentialSink_Jenkins(t *testing.T) {
+	// Service accounts from before the credential sinks only have the organization of their Jenkins
+	sa := &ServiceAccount{Metadata: ObjectMeta{Annotations: map[string]string{jenkinsOrganizationAnnotation: "org"}}}
+	equals(t, &common.CredentialSink{Type: "jenkins", Target: "org"}, serviceAccountCredentialSink(context.Background(), sa))
+}
@@ -0,0 +1,566 @@
+package openshift
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// fakeClient keeps the OpenShift objects in memory, it answers like the api would
+type fakeClient struct {
+	// rbac selects the permission api, the policy bindings are used without it
+	rbac            bool
+	namespaces      map[string]*Namespace
+	roleBindings    map[string][]RoleBinding
+	policyBindings  map[string]*PolicyBinding
+	groups          map[string]*Group
+	quotas          map[string][]ResourceQuota
+	limitRanges     map[string][]LimitRange
+	networkPolicies map[string][]NetworkPolicy
+	pvs             map[string]*PersistentVolume
+	pvcs            map[string]map[string]*PersistentVolumeClaim
+	pods            map[string][]Pod
+	services        map[string]*Service
+	endpoints       map[string]*Endpoints
+	serviceAccounts map[string]map[string]*ServiceAccount
+	secrets         map[string]map[string]*Secret
+	tokens          int
+
+	// failing are the errors returned by the named methods, e.g. to test a rollback
+	failing map[string]error
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{
+		rbac:            true,
+		namespaces:      map[string]*Namespace{},
+		roleBindings:    map[string][]RoleBinding{},
+		policyBindings:  map[string]*PolicyBinding{},
+		groups:          map[string]*Group{},
+		quotas:          map[string][]ResourceQuota{},
+		limitRanges:     map[string][]LimitRange{},
+		networkPolicies: map[string][]NetworkPolicy{},
+		pvs:             map[string]*PersistentVolume{},
+		pvcs:            map[string]map[string]*PersistentVolumeClaim{},
+		pods:            map[string][]Pod{},
+		services:        map[string]*Service{},
+		endpoints:       map[string]*Endpoints{},
+		serviceAccounts: map[string]map[string]*ServiceAccount{},
+		secrets:         map[string]map[string]*Secret{},
+		failing:         map[string]error{},
+	}
+}
+
+func notFound(kind string, name string) error {
+	return &StatusError{Code: http.StatusNotFound, Reason: "NotFound", Message: fmt.Sprintf("%v %q not found", kind, name)}
+}
+
+func alreadyExists(kind string, name string) error {
+	return &StatusError{Code: http.StatusConflict, Reason: "AlreadyExists", Message: fmt.Sprintf("%v %q already exists", kind, name)}
+}
+
+// addProject adds a project with its namespace and the role bindings of the given admins
+func (f *fakeClient) addProject(name string, admins ...string) {
+	f.namespaces[name] = &Namespace{
+		Metadata: ObjectMeta{
+			Name:              name,
+			CreationTimestamp: time.Now().UTC().Format(time.RFC3339),
+			Annotations:       map[string]string{},
+		},
+	}
+
+	var subjects []Subject
+	for _, a := range admins {
+		subjects = append(subjects, Subject{Kind: "User", APIGroup: rbacGroup, Name: a})
+	}
+	f.roleBindings[name] = []RoleBinding{
+		{
+			Metadata: ObjectMeta{Name: "admin", Namespace: name},
+			Subjects: subjects,
+			RoleRef:  RoleRef{APIGroup: rbacGroup, Kind: "ClusterRole", Name: "admin"},
+		},
+		{
+			Metadata: ObjectMeta{Name: "system:image-pullers", Namespace: name},
+			Subjects: []Subject{{Kind: "Group", APIGroup: rbacGroup, Name: "system:serviceaccounts:" + name}},
+			RoleRef:  RoleRef{APIGroup: rbacGroup, Kind: "ClusterRole", Name: "system:image-puller"},
+		},
+	}
+	f.policyBindings[name] = &PolicyBinding{
+		Metadata: ObjectMeta{Name: ":default", Namespace: name},
+		RoleBindings: []NamedRoleBinding{
+			{Name: "admin", RoleBinding: LegacyRoleBinding{UserNames: admins}},
+			{Name: "edit", RoleBinding: LegacyRoleBinding{}},
+		},
+	}
+	f.quotas[name] = []ResourceQuota{{
+		Metadata: ObjectMeta{Name: "default", Namespace: name},
+		Spec:     ResourceQuotaSpec{Hard: map[string]string{"cpu": "2", "memory": "4Gi"}},
+	}}
+}
+
+func (f *fakeClient) CreateProjectRequest(ctx context.Context, name string) error {
+	if _, ok := f.namespaces[name]; ok {
+		return alreadyExists("project", name)
+	}
+	f.addProject(name)
+	return nil
+}
+
+func (f *fakeClient) DeleteProject(ctx context.Context, name string) error {
+	if _, ok := f.namespaces[name]; !ok {
+		return notFound("project", name)
+	}
+	delete(f.namespaces, name)
+	delete(f.roleBindings, name)
+	delete(f.policyBindings, name)
+	delete(f.quotas, name)
+	delete(f.limitRanges, name)
+	delete(f.networkPolicies, name)
+	delete(f.serviceAccounts, name)
+	delete(f.secrets, name)
+	return nil
+}
+
+func (f *fakeClient) ListNamespaces(ctx context.Context) ([]Namespace, error) {
+	var list []Namespace
+	for _, ns := range f.namespaces {
+		list = append(list, *ns)
+	}
+	return list, nil
+}
+
+func (f *fakeClient) GetNamespace(ctx context.Context, name string) (*Namespace, error) {
+	ns, ok := f.namespaces[name]
+	if !ok {
+		return nil, notFound("namespace", name)
+	}
+	result := *ns
+	return &result, nil
+}
+
+func (f *fakeClient) PatchNamespaceAnnotations(ctx context.Context, name string, set map[string]string, remove []string) error {
+	ns, ok := f.namespaces[name]
+	if !ok {
+		return notFound("namespace", name)
+	}
+	if ns.Metadata.Annotations == nil {
+		ns.Metadata.Annotations = map[string]string{}
+	}
+	for _, k := range remove {
+		delete(ns.Metadata.Annotations, k)
+	}
+	for k, v := range set {
+		ns.Metadata.Annotations[k] = v
+	}
+	return nil
+}
+
+func (f *fakeClient) PatchNamespaceLabels(ctx context.Context, name string, set map[string]string) error {
+	ns, ok := f.namespaces[name]
+	if !ok {
+		return notFound("namespace", name)
+	}
+	if ns.Metadata.Labels == nil {
+		ns.Metadata.Labels = map[string]string{}
+	}
+	for k, v := range set {
+		ns.Metadata.Labels[k] = v
+	}
+	return nil
+}
+
+func (f *fakeClient) ListResourceQuotas(ctx context.Context, namespace string) ([]ResourceQuota, error) {
+	// Copies, changes are only stored by PatchResourceQuotaHard
+	var result []ResourceQuota
+	for _, q := range f.quotas[namespace] {
+		hard := map[string]string{}
+		for k, v := range q.Spec.Hard {
+			hard[k] = v
+		}
+		q.Spec.Hard = hard
+		result = append(result, q)
+	}
+	return result, nil
+}
+
+func (f *fakeClient) CreateResourceQuota(ctx context.Context, quota *ResourceQuota) error {
+	for _, q := range f.quotas[quota.Metadata.Namespace] {
+		if q.Metadata.Name == quota.Metadata.Name {
+			return alreadyExists("resourcequota", quota.Metadata.Name)
+		}
+	}
+	f.quotas[quota.Metadata.Namespace] = append(f.quotas[quota.Metadata.Namespace], *quota)
+	return nil
+}
+
+func (f *fakeClient) PatchResourceQuotaHard(ctx context.Context, namespace string, name string, set map[string]string) error {
+	for i, q := range f.quotas[namespace] {
+		if q.Metadata.Name == name {
+			if q.Spec.Hard == nil {
+				f.quotas[namespace][i].Spec.Hard = map[string]string{}
+			}
+			for k, v := range set {
+				f.quotas[namespace][i].Spec.Hard[k] = v
+			}
+			return nil
+		}
+	}
+	return notFound("resourcequota", name)
+}
+
+func (f *fakeClient) ListLimitRanges(ctx context.Context, namespace string) ([]LimitRange, error) {
+	return f.limitRanges[namespace], nil
+}
+
+func (f *fakeClient) CreateLimitRange(ctx context.Context, limitRange *LimitRange) error {
+	for _, l := range f.limitRanges[limitRange.Metadata.Namespace] {
+		if l.Metadata.Name == limitRange.Metadata.Name {
+			return alreadyExists("limitrange", limitRange.Metadata.Name)
+		}
+	}
+	f.limitRanges[limitRange.Metadata.Namespace] = append(f.limitRanges[limitRange.Metadata.Namespace], *limitRange)
+	return nil
+}
+
+func (f *fakeClient) CreateNetworkPolicy(ctx context.Context, policy *NetworkPolicy) error {
+	if err := f.failing["CreateNetworkPolicy"]; err != nil {
+		return err
+	}
+	for _, p := range f.networkPolicies[policy.Metadata.Namespace] {
+		if p.Metadata.Name == policy.Metadata.Name {
+			return alreadyExists("networkpolicy", policy.Metadata.Name)
+		}
+	}
+	f.networkPolicies[policy.Metadata.Namespace] = append(f.networkPolicies[policy.Metadata.Namespace], *policy)
+	return nil
+}
+
+func (f *fakeClient) CreatePersistentVolume(ctx context.Context, pv *PersistentVolume) error {
+	if _, ok := f.pvs[pv.Metadata.Name]; ok {
+		return alreadyExists("persistentvolume", pv.Metadata.Name)
+	}
+	f.pvs[pv.Metadata.Name] = pv
+	return nil
+}
+
+func (f *fakeClient) GetPersistentVolume(ctx context.Context, name string) (*PersistentVolume, error) {
+	pv, ok := f.pvs[name]
+	if !ok {
+		return nil, notFound("persistentvolume", name)
+	}
+	return pv, nil
+}
+
+func (f *fakeClient) DeletePersistentVolume(ctx context.Context, name string) error {
+	if err := f.failing["DeletePersistentVolume"]; err != nil {
+		return err
+	}
+	if _, ok := f.pvs[name]; !ok {
+		return notFound("persistentvolume", name)
+	}
+	delete(f.pvs, name)
+	return nil
+}
+
+func (f *fakeClient) PatchPersistentVolumeAnnotations(ctx context.Context, name string, set map[string]string) error {
+	pv, ok := f.pvs[name]
+	if !ok {
+		return notFound("persistentvolume", name)
+	}
+	if pv.Metadata.Annotations == nil {
+		pv.Metadata.Annotations = map[string]string{}
+	}
+	for k, v := range set {
+		pv.Metadata.Annotations[k] = v
+	}
+	return nil
+}
+
+func (f *fakeClient) ListPersistentVolumeClaims(ctx context.Context, namespace string) ([]PersistentVolumeClaim, error) {
+	var list []PersistentVolumeClaim
+	for _, pvc := range f.pvcs[namespace] {
+		list = append(list, *pvc)
+	}
+	return list, nil
+}
+
+func (f *fakeClient) GetPersistentVolumeClaim(ctx context.Context, namespace string, name string) (*PersistentVolumeClaim, error) {
+	pvc, ok := f.pvcs[namespace][name]
+	if !ok {
+		return nil, notFound("persistentvolumeclaim", name)
+	}
+	return pvc, nil
+}
+
+func (f *fakeClient) CreatePersistentVolumeClaim(ctx context.Context, pvc *PersistentVolumeClaim) error {
+	if err := f.failing["CreatePersistentVolumeClaim"]; err != nil {
+		return err
+	}
+	ns := pvc.Metadata.Namespace
+	if _, ok := f.pvcs[ns][pvc.Metadata.Name]; ok {
+		return alreadyExists("persistentvolumeclaim", pvc.Metadata.Name)
+	}
+	if f.pvcs[ns] == nil {
+		f.pvcs[ns] = map[string]*PersistentVolumeClaim{}
+	}
+	f.pvcs[ns][pvc.Metadata.Name] = pvc
+	return nil
+}
+
+func (f *fakeClient) DeletePersistentVolumeClaim(ctx context.Context, namespace string, name string) error {
+	if _, ok := f.pvcs[namespace][name]; !ok {
+		return notFound("persistentvolumeclaim", name)
+	}
+	delete(f.pvcs[namespace], name)
+	return nil
+}
+
+func (f *fakeClient) CreateService(ctx context.Context, service *Service) error {
+	key := service.Metadata.Namespace + "/" + service.Metadata.Name
+	if _, ok := f.services[key]; ok {
+		return alreadyExists("service", service.Metadata.Name)
+	}
+	f.services[key] = service
+	return nil
+}
+
+func (f *fakeClient) CreateEndpoints(ctx context.Context, endpoints *Endpoints) error {
+	key := endpoints.Metadata.Namespace + "/" + endpoints.Metadata.Name
+	if _, ok := f.endpoints[key]; ok {
+		return alreadyExists("endpoints", endpoints.Metadata.Name)
+	}
+	f.endpoints[key] = endpoints
+	return nil
+}
+
+func (f *fakeClient) ListPods(ctx context.Context, namespace string) ([]Pod, error) {
+	return f.pods[namespace], nil
+}
+
+func (f *fakeClient) CreateServiceAccount(ctx context.Context, sa *ServiceAccount) error {
+	ns := sa.Metadata.Namespace
+	if _, ok := f.serviceAccounts[ns][sa.Metadata.Name]; ok {
+		return alreadyExists("serviceaccount", sa.Metadata.Name)
+	}
+	if f.serviceAccounts[ns] == nil {
+		f.serviceAccounts[ns] = map[string]*ServiceAccount{}
+		f.secrets[ns] = map[string]*Secret{}
+	}
+
+	f.serviceAccounts[ns][sa.Metadata.Name] = sa
+	f.createToken(sa)
+	return nil
+}
+
+// createToken creates a token secret for the service account, like the token controller of OpenShift
+func (f *fakeClient) createToken(sa *ServiceAccount) {
+	f.tokens++
+	ns := sa.Metadata.Namespace
+	secretName := fmt.Sprintf("%v-token-%v", sa.Metadata.Name, f.tokens)
+	f.secrets[ns][secretName] = &Secret{
+		Metadata: ObjectMeta{Name: secretName, Namespace: ns},
+		Type:     serviceAccountTokenType,
+		Data:     map[string]string{"token": base64.StdEncoding.EncodeToString([]byte(secretName))},
+	}
+	sa.Secrets = append(sa.Secrets, ObjectReference{Name: secretName})
+}
+
+func (f *fakeClient) ListServiceAccounts(ctx context.Context, namespace string) ([]ServiceAccount, error) {
+	var list []ServiceAccount
+	for _, sa := range f.serviceAccounts[namespace] {
+		list = append(list, *sa)
+	}
+	return list, nil
+}
+
+func (f *fakeClient) DeleteServiceAccount(ctx context.Context, namespace string, name string) error {
+	sa, ok := f.serviceAccounts[namespace][name]
+	if !ok {
+		return notFound("serviceaccount", name)
+	}
+	for _, s := range sa.Secrets {
+		delete(f.secrets[namespace], s.Name)
+	}
+	delete(f.serviceAccounts[namespace], name)
+	return nil
+}
+
+// DeleteSecret deletes the secret, a deleted token is replaced by a new one
+func (f *fakeClient) DeleteSecret(ctx context.Context, namespace string, name string) error {
+	if _, ok := f.secrets[namespace][name]; !ok {
+		return notFound("secret", name)
+	}
+	delete(f.secrets[namespace], name)
+
+	for _, sa := range f.serviceAccounts[namespace] {
+		for i, s := range sa.Secrets {
+			if s.Name == name {
+				sa.Secrets = append(sa.Secrets[:i], sa.Secrets[i+1:]...)
+				f.createToken(sa)
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+func (f *fakeClient) GetServiceAccount(ctx context.Context, namespace string, name string) (*ServiceAccount, error) {
+	sa, ok := f.serviceAccounts[namespace][name]
+	if !ok {
+		return nil, notFound("serviceaccount", name)
+	}
+	return sa, nil
+}
+
+func (f *fakeClient) PatchServiceAccountAnnotations(ctx context.Context, namespace string, name string, set map[string]string) error {
+	sa, ok := f.serviceAccounts[namespace][name]
+	if !ok {
+		return notFound("serviceaccount", name)
+	}
+	if sa.Metadata.Annotations == nil {
+		sa.Metadata.Annotations = map[string]string{}
+	}
+	for k, v := range set {
+		sa.Metadata.Annotations[k] = v
+	}
+	return nil
+}
+
+func (f *fakeClient) GetSecret(ctx context.Context, namespace string, name string) (*Secret, error) {
+	secret, ok := f.secrets[namespace][name]
+	if !ok {
+		return nil, notFound("secret", name)
+	}
+	return secret, nil
+}
+
+func (f *fakeClient) CreateSecret(ctx context.Context, secret *Secret) error {
+	ns := secret.Metadata.Namespace
+	if _, ok := f.secrets[ns][secret.Metadata.Name]; ok {
+		return alreadyExists("secret", secret.Metadata.Name)
+	}
+	if f.secrets[ns] == nil {
+		f.secrets[ns] = map[string]*Secret{}
+	}
+	f.secrets[ns][secret.Metadata.Name] = secret
+	return nil
+}
+
+func (f *fakeClient) UpdateSecret(ctx context.Context, secret *Secret) error {
+	ns := secret.Metadata.Namespace
+	if _, ok := f.secrets[ns][secret.Metadata.Name]; !ok {
+		return notFound("secret", secret.Metadata.Name)
+	}
+	f.secrets[ns][secret.Metadata.Name] = secret
+	return nil
+}
+
+func (f *fakeClient) GetGroup(ctx context.Context, name string) (*Group, error) {
+	group, ok := f.groups[name]
+	if !ok {
+		return nil, notFound("group", name)
+	}
+	return group, nil
+}
+
+func (f *fakeClient) HasRBAC(ctx context.Context) (bool, error) {
+	return f.rbac, nil
+}
+
+func (f *fakeClient) ListRoleBindings(ctx context.Context, namespace string) ([]RoleBinding, error) {
+	// The caller may change the returned bindings, it must not change ours
+	var list []RoleBinding
+	for _, b := range f.roleBindings[namespace] {
+		b.Subjects = append([]Subject(nil), b.Subjects...)
+		list = append(list, b)
+	}
+	return list, nil
+}
+
+func (f *fakeClient) ListLabeledRoleBindings(ctx context.Context, labels map[string]string) ([]RoleBinding, error) {
+	var list []RoleBinding
+	for _, bindings := range f.roleBindings {
+	next:
+		for _, b := range bindings {
+			for k, v := range labels {
+				if b.Metadata.Labels[k] != v {
+					continue next
+				}
+			}
+			list = append(list, b)
+		}
+	}
+	return list, nil
+}
+
+func (f *fakeClient) GetRoleBinding(ctx context.Context, namespace string, name string) (*RoleBinding, error) {
+	for _, b := range f.roleBindings[namespace] {
+		if b.Metadata.Name == name {
+			b.Subjects = append([]Subject(nil), b.Subjects...)
+			return &b, nil
+		}
+	}
+	return nil, notFound("rolebinding", name)
+}
+
+func (f *fakeClient) CreateRoleBinding(ctx context.Context, binding *RoleBinding) error {
+	if err := f.failing["CreateRoleBinding"]; err != nil {
+		return err
+	}
+	ns := binding.Metadata.Namespace
+	for _, b := range f.roleBindings[ns] {
+		if b.Metadata.Name == binding.Metadata.Name {
+			return alreadyExists("rolebinding", binding.Metadata.Name)
+		}
+	}
+	f.roleBindings[ns] = append(f.roleBindings[ns], *binding)
+	return nil
+}
+
+func (f *fakeClient) UpdateRoleBinding(ctx context.Context, binding *RoleBinding) error {
+	ns := binding.Metadata.Namespace
+	for i, b := range f.roleBindings[ns] {
+		if b.Metadata.Name == binding.Metadata.Name {
+			f.roleBindings[ns][i] = *binding
+			return nil
+		}
+	}
+	return notFound("rolebinding", binding.Metadata.Name)
+}
+
+func (f *fakeClient) DeleteRoleBinding(ctx context.Context, namespace string, name string) error {
+	for i, b := range f.roleBindings[namespace] {
+		if b.Metadata.Name == name {
+			f.roleBindings[namespace] = append(f.roleBindings[namespace][:i], f.roleBindings[namespace][i+1:]...)
+			return nil
+		}
+	}
+	return notFound("rolebinding", name)
+}
+
+func (f *fakeClient) GetPolicyBinding(ctx context.Context, namespace string) (*PolicyBinding, error) {
+	binding, ok := f.policyBindings[namespace]
+	if !ok {
+		return nil, notFound("policybinding", namespace)
+	}
+
+	// The caller may change the returned binding, it must not change ours
+	result := *binding
+	result.RoleBindings = make([]NamedRoleBinding, len(binding.RoleBindings))
+	for i, rb := range binding.RoleBindings {
+		rb.RoleBinding.UserNames = append([]string(nil), rb.RoleBinding.UserNames...)
+		rb.RoleBinding.GroupNames = append([]string(nil), rb.RoleBinding.GroupNames...)
+		result.RoleBindings[i] = rb
+	}
+	return &result, nil
+}
+
+func (f *fakeClient) UpdatePolicyBinding(ctx context.Context, binding *PolicyBinding) error {
+	if _, ok := f.policyBindings[binding.Metadata.Namespace]; !ok {
+		return notFound("policybinding", binding.Metadata.Namespace)
+	}
+	f.policyBindings[binding.Metadata.Namespace] = binding
+	return nil
+}
@@ -0,0 +1,92 @@
+package openshift
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
+	"github.com/gin-gonic/gin"
+)
+
+func assert(tb testing.TB, condition bool, msg string, v ...interface{}) {
+	if !condition {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: "+msg+"\033[39m\n\n", append([]interface{}{filepath.Base(file), line}, v...)...)
+		tb.FailNow()
+	}
+}
+
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}
+
+// setupFake replaces the OpenShift api by a fake and returns a router with our routes, called as the given user
+func setupFake(username string) (*fakeClient, *gin.Engine) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set(gin.AuthUserKey, username)
+		c.Set("SSP_USER_MAIL", username+"@example.com")
+	})
+
+	RegisterRoutes(router.Group("/api"), common.OpenshiftConfig{
+		MaxQuotaCPU:    10,
+		MaxQuotaMemory: 20,
+		MaxQuotas:      map[string]int{"pods": 50, "requests.storage": 100},
+		MaxVolumeGB:    100,
+		Clusters: []common.OpenshiftClusterConfig{
+			{ID: "default", Name: "Default", APIURL: "http://ose", Gluster: common.GlusterConfig{APIURL: "http://gluster", IPs: []string{"10.0.0.1"}}},
+			{ID: "other", Name: "Other", APIURL: "http://other-ose"},
+		},
+	})
+
+	common.InitJobs("", 1)
+
+	fake := newFakeClient()
+	clusters[0].client = fake
+	clusters[1].client = newFakeClient()
+	return fake, router
+}
+
+// newTestClient returns the http client for the api of the cluster
+func newTestClient(tb testing.TB, cluster common.OpenshiftClusterConfig, timeout time.Duration) Client {
+	cluster.Timeout = timeout
+	client, err := newHTTPClient(cluster)
+	ok(tb, err)
+	return client
+}
+
+// call sends the command as json to the router and returns the status and the message of the answer
+func call(router *gin.Engine, method string, path string, command interface{}) (int, string) {
+	var body []byte
+	if command != nil {
+		body, _ = json.Marshal(command)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var res common.ApiResponse
+	json.Unmarshal(w.Body.Bytes(), &res)
+	return w.Code, res.Message
+}
@@ -1,18 +1,23 @@
 package openshift
 
 import (
-	"bytes"
+	"context"
 	"errors"
-	"io/ioutil"
-	"log"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"fmt"
 
-	"github.com/Jeffail/gabs"
 	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	billingAnnotation = "openshift.io/kontierung-element"
+	// noBilling is the billing number of test projects, they aren't charged
+	noBilling = "keine-verrechnung"
 )
 
 func newProjectHandler(c *gin.Context) {
@@ -20,60 +25,64 @@ func newProjectHandler(c *gin.Context) {
 
 	var data common.NewProjectCommand
 	if c.BindJSON(&data) == nil {
-		if err := validateNewProject(data.Project, data.Billing, false); err != nil {
-			c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
+		if err := validateNewProject(c, data.Project, data.Billing, false); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
 			return
 		}
 
-		if err := createNewProject(data.Project, username, data.Billing, data.MegaId, false); err != nil {
-			c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
+		if err := createNewProject(c, data.Project, username, "", data.Billing, data.MegaId, data.Template, false); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
 		} else {
 			c.JSON(http.StatusOK, common.ApiResponse{
 				Message: fmt.Sprintf("Das Projekt %v wurde erstellt", data.Project),
 			})
 		}
 	} else {
-		c.JSON(http.StatusBadRequest, common.ApiResponse{Message: wrongAPIUsageError})
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, wrongAPIUsageError))
 	}
 }
 
 func newTestProjectHandler(c *gin.Context) {
 	username := common.GetUserName(c)
+	mail := common.GetUserMail(c)
 
 	var data common.NewTestProjectCommand
 	if c.BindJSON(&data) == nil {
 		// Special values for a test project
-		billing := "keine-verrechnung"
+		billing := noBilling
 		data.Project = username + "-" + data.Project
 
-		if err := validateNewProject(data.Project, billing, true); err != nil {
-			c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
+		if err := validateNewProject(c, data.Project, billing, true); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
 			return
 		}
 
-		if err := createNewProject(data.Project, username, billing, "", true); err != nil {
-			c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
+		if err := createNewProject(c, data.Project, username, mail, billing, "", "", true); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
 		} else {
 			c.JSON(http.StatusOK, common.ApiResponse{
 				Message: fmt.Sprintf("Das Test-Projekt %v wurde erstellt", data.Project),
 			})
 		}
 	} else {
-		c.JSON(http.StatusBadRequest, common.ApiResponse{Message: wrongAPIUsageError})
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, wrongAPIUsageError))
 	}
 }
 
-func getProjectAdminsHandler(c *gin.Context) {
+func deleteProjectHandler(c *gin.Context) {
 	username := common.GetUserName(c)
 	project := c.Param("project")
 
-	log.Printf("%v has queried all the admins of project %v", username, project)
+	if err := validateAdminAccess(c, username, project); err != nil {
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
+		return
+	}
 
-	if admins, _, err := getProjectAdminsAndOperators(project); err != nil {
-		c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
+	if err := deleteProject(c, project, username); err != nil {
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
 	} else {
-		c.JSON(http.StatusOK, common.AdminList{
-			Admins: admins,
+		c.JSON(http.StatusOK, common.ApiResponse{
+			Message: fmt.Sprintf("Das Projekt %v wurde gelöscht", project),
 		})
 	}
 }
@@ -82,13 +91,13 @@ func getBillingHandler(c *gin.Context) {
 	username := common.GetUserName(c)
 	project := c.Param("project")
 
-	if err := validateAdminAccess(username, project); err != nil {
-		c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
+	if err := validateAdminAccess(c, username, project); err != nil {
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
 		return
 	}
 
-	if billingData, err := getProjectBillingInformation(project); err != nil {
-		c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
+	if billingData, err := getProjectBillingInformation(c, project); err != nil {
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
 	} else {
 		c.JSON(http.StatusOK, common.ApiResponse{
 			Message: fmt.Sprintf("Aktuelle Verrechnungsdaten für Projekt %v: %v", project, billingData),
@@ -101,49 +110,53 @@ func updateBillingHandler(c *gin.Context) {
 
 	var data common.EditBillingDataCommand
 	if c.BindJSON(&data) == nil {
-		if err := validateBillingInformation(data.Project, data.Billing, username); err != nil {
-			c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
+		if err := validateBillingInformation(c, data.Project, data.Billing, username); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
 			return
 		}
 
-		if err := createOrUpdateMetadata(data.Project, data.Billing, "", username, false); err != nil {
-			c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
+		if err := createOrUpdateMetadata(c, data.Project, data.Billing, "", username, "", false); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
 		} else {
 			c.JSON(http.StatusOK, common.ApiResponse{
 				Message: fmt.Sprintf("Die Verrechnungsdaten wurden gespeichert: %v", data.Billing),
 			})
 		}
 	} else {
-		c.JSON(http.StatusBadRequest, common.ApiResponse{Message: wrongAPIUsageError})
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, wrongAPIUsageError))
 	}
 }
 
-func validateNewProject(project string, billing string, testProject bool) error {
+func validateNewProject(ctx context.Context, project string, billing string, testProject bool) error {
 	if len(project) == 0 {
 		return errors.New("Projektname muss angegeben werden")
 	}
 
-	if !testProject && len(billing) == 0 {
+	// Test projects aren't billed
+	if testProject {
+		return nil
+	}
+	if len(billing) == 0 {
 		return errors.New("Kontierungsnummer muss angegeben werden")
 	}
 
-	return nil
+	return common.ValidateBilling(ctx, billing)
 }
 
-func validateAdminAccess(username string, project string) error {
+func validateAdminAccess(ctx context.Context, username string, project string) error {
 	if len(project) == 0 {
 		return errors.New("Projektname muss angegeben werden")
 	}
 
 	// Validate permissions
-	if err := checkAdminPermissions(username, project); err != nil {
+	if err := checkAdminPermissions(ctx, username, project); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func validateBillingInformation(project string, billing string, username string) error {
+func validateBillingInformation(ctx context.Context, project string, billing string, username string) error {
 	if len(project) == 0 {
 		return errors.New("Projektname muss angegeben werden")
 	}
@@ -153,158 +166,121 @@ func validateBillingInformation(project string, billing string, username string)
 	}
 
 	// Validate permissions
-	if err := checkAdminPermissions(username, project); err != nil {
+	if err := checkAdminPermissions(ctx, username, project); err != nil {
 		return err
 	}
 
-	return nil
+	return common.ValidateBilling(ctx, billing)
 }
 
-func createNewProject(project string, username string, billing string, megaid string, testProject bool) error {
+func createNewProject(ctx context.Context, project string, username string, mail string, billing string, megaid string, templateName string, testProject bool) error {
 	project = strings.ToLower(project)
-	p := newObjectRequest("ProjectRequest", project)
-
-	client, req := getOseHTTPClient("POST",
-		"oapi/v1/projectrequests",
-		bytes.NewReader(p.Bytes()))
 
-	resp, err := client.Do(req)
-	if err == nil {
-		defer resp.Body.Close()
+	template, err := getProjectTemplate(templateName)
+	if err != nil {
+		return err
 	}
 
-	if resp.StatusCode == http.StatusCreated {
-		log.Printf("%v created a new project: %v", username, project)
-
-		if err := changeProjectPermission(project, username); err != nil {
-			return err
-		}
-
-		if err := createOrUpdateMetadata(project, billing, megaid, username, testProject); err != nil {
-			return err
-		}
-		return nil
-	}
-	if resp.StatusCode == http.StatusConflict {
+	err = ose(ctx).CreateProjectRequest(ctx, project)
+	if IsConflict(err) {
 		return errors.New("Das Projekt existiert bereits")
 	}
+	if err != nil {
+		common.Logger(ctx).WithError(err).Error("Error creating new project")
+		return errors.New(genericAPIError)
+	}
 
-	errMsg, _ := ioutil.ReadAll(resp.Body)
-	log.Println("Error creating new project:", err, resp.StatusCode, string(errMsg))
+	common.Logger(ctx).WithFields(logrus.Fields{"user": username, "project": project, "template": templateName}).Info("Created a new project")
 
-	return errors.New(genericAPIError)
+	// A project is either set up completely or deleted again
+	if err := setupNewProject(ctx, project, username, mail, billing, megaid, template, testProject); err != nil {
+		if deleteErr := ose(ctx).DeleteProject(ctx, project); deleteErr != nil {
+			common.Logger(ctx).WithError(deleteErr).WithField("project", project).Error("Error deleting the project after its setup failed")
+			return fmt.Errorf("Das Projekt %v konnte nicht eingerichtet und nicht wieder gelöscht werden. Bitte erstelle ein Ticket", project)
+		}
+		common.Logger(ctx).WithField("project", project).Warn("Deleted the project after its setup failed")
+		return fmt.Errorf("Das Projekt %v konnte nicht eingerichtet werden und wurde wieder gelöscht: %v", project, err.Error())
+	}
+	return nil
 }
 
-func changeProjectPermission(project string, username string) error {
-	// Get existing policybindings
-	policyBindings, err := getPolicyBindings(project)
-
-	if policyBindings == nil {
+func setupNewProject(ctx context.Context, project string, username string, mail string, billing string, megaid string, template *common.ProjectTemplate, testProject bool) error {
+	if err := changeProjectPermission(ctx, project, username); err != nil {
 		return err
 	}
 
-	children, err := policyBindings.S("roleBindings").Children()
-	if err != nil {
-		log.Println("Unable to parse roleBindings", err.Error())
-		return errors.New(genericAPIError)
-	}
-	for _, v := range children {
-		if v.Path("name").Data().(string) == "admin" {
-			v.ArrayAppend(strings.ToLower(username), "roleBinding", "userNames")
-			v.ArrayAppend(strings.ToUpper(username), "roleBinding", "userNames")
-		}
+	if err := createOrUpdateMetadata(ctx, project, billing, megaid, username, mail, testProject); err != nil {
+		return err
 	}
 
-	// Update the policyBindings on the api
-	client, req := getOseHTTPClient("PUT",
-		"oapi/v1/namespaces/"+project+"/policybindings/:default",
-		bytes.NewReader(policyBindings.Bytes()))
+	if template != nil {
+		return applyProjectTemplate(ctx, project, template)
+	}
+	return nil
+}
 
-	resp, err := client.Do(req)
+func deleteProject(ctx context.Context, project string, username string) error {
+	err := ose(ctx).DeleteProject(ctx, project)
+	if IsNotFound(err) {
+		return errors.New("Das Projekt existiert nicht")
+	}
 	if err != nil {
-		log.Println("Error from server: ", err.Error())
+		common.Logger(ctx).WithError(err).Error("Error deleting project")
 		return errors.New(genericAPIError)
 	}
 
-	defer resp.Body.Close()
-
-	if resp.StatusCode == http.StatusOK {
-		log.Print(username + " is now admin of " + project)
-		return nil
-	}
-
-	errMsg, _ := ioutil.ReadAll(resp.Body)
-	log.Println("Error updating project permissions:", err, resp.StatusCode, string(errMsg))
-	return errors.New(genericAPIError)
+	common.Logger(ctx).WithFields(logrus.Fields{"user": username, "project": project}).Info("Deleted the project")
+	return nil
 }
 
-func getProjectBillingInformation(project string) (string, error) {
-	client, req := getOseHTTPClient("GET", "api/v1/namespaces/"+project, nil)
-	resp, err := client.Do(req)
+func changeProjectPermission(ctx context.Context, project string, username string) error {
+	err := changeProjectAdmins(ctx, project, func(admins *projectAdmins) error {
+		admins.Users = append(admins.Users, strings.ToLower(username), strings.ToUpper(username))
+		return nil
+	})
 	if err != nil {
-		log.Println("Error from server: ", err.Error())
-		return "", errors.New(genericAPIError)
+		return err
 	}
 
-	defer resp.Body.Close()
+	common.Logger(ctx).WithFields(logrus.Fields{"user": username, "project": project}).Info("User is now admin of the project")
+	return nil
+}
 
-	json, err := gabs.ParseJSONBuffer(resp.Body)
+func getProjectBillingInformation(ctx context.Context, project string) (string, error) {
+	namespace, err := getNamespace(ctx, project)
 	if err != nil {
-		log.Println("error decoding json:", err, resp.StatusCode)
-		return "", errors.New(genericAPIError)
+		return "", err
 	}
 
-	billing := json.Path("metadata.annotations").S("openshift.io/kontierung-element").Data()
-	if billing != nil {
-		return billing.(string), nil
-	} else {
-		return "Keine Daten hinterlegt", nil
+	if billing, ok := namespace.Metadata.Annotations[billingAnnotation]; ok {
+		return billing, nil
 	}
+	return "Keine Daten hinterlegt", nil
 }
 
-func createOrUpdateMetadata(project string, billing string, megaid string, username string, testProject bool) error {
-	client, req := getOseHTTPClient("GET", "api/v1/namespaces/"+project, nil)
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Println("Error from server: ", err.Error())
-		return errors.New(genericAPIError)
+func createOrUpdateMetadata(ctx context.Context, project string, billing string, megaid string, username string, mail string, testProject bool) error {
+	annotations := map[string]string{
+		billingAnnotation:        billing,
+		"openshift.io/requester": username,
 	}
 
-	defer resp.Body.Close()
-
-	json, err := gabs.ParseJSONBuffer(resp.Body)
-	if err != nil {
-		log.Println("error decoding json:", err, resp.StatusCode)
-		return errors.New(genericAPIError)
+	if testProject {
+		annotations[testProjectDeletionAnnotation] = strconv.Itoa(testProjectDeletionDays)
+		annotations["openshift.io/description"] = fmt.Sprintf("Dieses Testprojekt wird in %v Tagen automatisch gelöscht!", testProjectDeletionDays)
 	}
 
-	annotations := json.Path("metadata.annotations")
-	annotations.Set(billing, "openshift.io/kontierung-element")
-	annotations.Set(username, "openshift.io/requester")
-
-	if testProject {
-		annotations.Set(testProjectDeletionDays, "openshift.io/testproject-daystodeletion")
-		annotations.Set(fmt.Sprintf("Dieses Testprojekt wird in %v Tagen automatisch gelöscht!", testProjectDeletionDays), "openshift.io/description")
+	if len(mail) > 0 {
+		annotations[requesterMailAnnotation] = mail
 	}
 
 	if len(megaid) > 0 {
-		annotations.Set(megaid, "openshift.io/MEGAID")
+		annotations["openshift.io/MEGAID"] = megaid
 	}
 
-	client, req = getOseHTTPClient("PUT",
-		"api/v1/namespaces/"+project,
-		bytes.NewReader(json.Bytes()))
-
-	resp, err = client.Do(req)
-
-	if resp.StatusCode == http.StatusOK {
-		resp.Body.Close()
-		log.Println("User "+username+" changed changed config of project project "+project+". Kontierungsnummer: "+billing, ", MegaID: "+megaid)
-		return nil
+	if err := updateProjectAnnotations(ctx, project, annotations, nil); err != nil {
+		return err
 	}
 
-	errMsg, _ := ioutil.ReadAll(resp.Body)
-	log.Println("Error updating project config:", err, resp.StatusCode, string(errMsg))
-
-	return errors.New(genericAPIError)
+	common.Logger(ctx).WithFields(logrus.Fields{"user": username, "project": project, "billing": billing, "megaid": megaid}).Info("Changed the config of the project")
+	return nil
 }
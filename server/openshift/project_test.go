@@ -0,0 +1,82 @@
+package openshift
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
+)
+
+func TestNewProject(t *testing.T) {
+	fake, router := setupFake("u123456")
+
+	code, _ := call(router, "POST", "/api/ose/project", common.NewProjectCommand{ProjectName: common.ProjectName{Project: "My-Project"}, Billing: "psp"})
+	equals(t, http.StatusOK, code)
+
+	equals(t, []Subject{
+		{Kind: "User", APIGroup: rbacGroup, Name: "u123456"},
+		{Kind: "User", APIGroup: rbacGroup, Name: "U123456"},
+	}, fake.roleBindings["my-project"][0].Subjects)
+	annotations := fake.namespaces["my-project"].Metadata.Annotations
+	equals(t, "psp", annotations["openshift.io/kontierung-element"])
+	equals(t, "u123456", annotations["openshift.io/requester"])
+
+	code, msg := call(router, "POST", "/api/ose/project", common.NewProjectCommand{ProjectName: common.ProjectName{Project: "my-project"}, Billing: "psp"})
+	equals(t, http.StatusBadRequest, code)
+	equals(t, "Das Projekt existiert bereits", msg)
+}
+
+func TestNewProject_Billing(t *testing.T) {
+	fake, router := setupFake("u123456")
+	fake.addProject("project", "u123456")
+	ok(t, common.InitBillingValidators(common.BillingConfig{Pattern: `R\.\d{6}`}))
+	defer common.InitBillingValidators(common.BillingConfig{})
+
+	code, msg := call(router, "POST", "/api/ose/project", common.NewProjectCommand{ProjectName: common.ProjectName{Project: "my-project"}, Billing: "R.12345"})
+	equals(t, http.StatusBadRequest, code)
+	equals(t, "Die Kontierungsnummer R.12345 ist ungültig", msg)
+
+	code, _ = call(router, "POST", "/api/ose/billing", common.EditBillingDataCommand{ProjectName: common.ProjectName{Project: "project"}, Billing: "R.123456"})
+	equals(t, http.StatusOK, code)
+
+	// Test projects aren't billed
+	code, _ = call(router, "POST", "/api/ose/testproject", common.NewTestProjectCommand{ProjectName: common.ProjectName{Project: "test"}})
+	equals(t, http.StatusOK, code)
+}
+
+func TestProjectAdmins(t *testing.T) {
+	fake, router := setupFake("u123456")
+	fake.addProject("project", "U123456")
+	fake.roleBindings["project"][0].Subjects = append(fake.roleBindings["project"][0].Subjects,
+		Subject{Kind: "Group", APIGroup: rbacGroup, Name: "operator"},
+		Subject{Kind: "Group", APIGroup: rbacGroup, Name: "deleted"})
+	fake.groups["operator"] = &Group{Users: []string{"U999999"}}
+
+	admins, operators, err := getProjectAdminsAndOperators(context.Background(), "project")
+	ok(t, err)
+	equals(t, []string{"u123456"}, admins)
+	equals(t, []string{"u999999"}, operators)
+
+	// Operators have access, other users don't
+	ok(t, checkAdminPermissions(context.Background(), "u999999", "project"))
+	assert(t, checkAdminPermissions(context.Background(), "u000000", "project") != nil, "Other users should not have access")
+
+	code, msg := call(router, "GET", "/api/ose/project/missing/admins", nil)
+	equals(t, http.StatusBadRequest, code)
+	equals(t, "Das Projekt existiert nicht", msg)
+}
+
+func TestDeleteProject(t *testing.T) {
+	fake, router := setupFake("u123456")
+	fake.addProject("mine", "u123456")
+	fake.addProject("other", "u000000")
+
+	code, _ := call(router, "DELETE", "/api/ose/project/other", nil)
+	equals(t, http.StatusBadRequest, code)
+	assert(t, fake.namespaces["other"] != nil, "Project of another user should not be deleted")
+
+	code, _ = call(router, "DELETE", "/api/ose/project/mine", nil)
+	equals(t, http.StatusOK, code)
+	assert(t, fake.namespaces["mine"] == nil, "Project should be deleted")
+}
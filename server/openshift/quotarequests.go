@@ -0,0 +1,289 @@
+package openshift
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	quotaRequestPending = "pending"
+	// quotaRequestApproving is the status while the quotas of an approved request are changed
+	quotaRequestApproving = "approving"
+	quotaRequestApproved  = "approved"
+	quotaRequestRejected  = "rejected"
+
+	quotaRequestStoreError = "Der Antrag konnte nicht gespeichert werden. Bitte erstelle ein Ticket"
+)
+
+var (
+	errQuotaRequestNotFound = errors.New("quota request not found")
+	errQuotaRequestNotOpen  = errors.New("quota request has another status")
+)
+
+// quotaRequests are the quota changes above the self-service limits, set by RegisterRoutes
+var quotaRequests *quotaRequestStore
+
+// quotaRequestStore keeps the quota requests in memory and, if a path is set, in a json file
+type quotaRequestStore struct {
+	path     string
+	mu       sync.Mutex
+	requests map[string]common.QuotaRequest
+}
+
+func newQuotaRequestStore(path string) (*quotaRequestStore, error) {
+	s := &quotaRequestStore{path: path, requests: map[string]common.QuotaRequest{}}
+	if len(path) == 0 {
+		return s, nil
+	}
+
+	var requests []common.QuotaRequest
+	if err := common.ReadJSONFile(path, &requests); err != nil {
+		return nil, err
+	}
+	for _, r := range requests {
+		// The approval was interrupted, the admins can approve the request again
+		if r.Status == quotaRequestApproving {
+			r.Status = quotaRequestPending
+		}
+		s.requests[r.ID] = r
+	}
+	return s, nil
+}
+
+// list returns the requests with the status, or all requests if it is empty, the newest first
+func (s *quotaRequestStore) list(status string) []common.QuotaRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := []common.QuotaRequest{}
+	for _, r := range s.requests {
+		if len(status) == 0 || r.Status == status {
+			result = append(result, r)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Created.After(result[j].Created)
+	})
+	return result
+}
+
+func (s *quotaRequestStore) get(id string) (common.QuotaRequest, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.requests[id]
+	return r, ok
+}
+
+// add adds the request unless the project already has an open request, which is returned instead
+func (s *quotaRequestStore) add(r common.QuotaRequest) (*common.QuotaRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.requests {
+		if existing.Cluster == r.Cluster && existing.Project == r.Project &&
+			(existing.Status == quotaRequestPending || existing.Status == quotaRequestApproving) {
+			return &existing, nil
+		}
+	}
+
+	s.requests[r.ID] = r
+	if err := s.write(); err != nil {
+		delete(s.requests, r.ID)
+		return nil, err
+	}
+	return nil, nil
+}
+
+// update changes the request if it still has the status from and writes the file.
+// Of two concurrent decisions only the first one gets the request.
+func (s *quotaRequestStore) update(id string, from string, change func(r *common.QuotaRequest)) (common.QuotaRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, ok := s.requests[id]
+	if !ok {
+		return old, errQuotaRequestNotFound
+	}
+	if old.Status != from {
+		return old, errQuotaRequestNotOpen
+	}
+
+	r := old
+	change(&r)
+	s.requests[id] = r
+	if err := s.write(); err != nil {
+		s.requests[id] = old
+		return old, err
+	}
+	return r, nil
+}
+
+func (s *quotaRequestStore) write() error {
+	if len(s.path) == 0 {
+		return nil
+	}
+
+	var requests []common.QuotaRequest
+	for _, r := range s.requests {
+		requests = append(requests, r)
+	}
+	return common.WriteJSONFile(s.path, requests)
+}
+
+// createQuotaRequest stores the quota change for the approval of the platform admins
+func createQuotaRequest(ctx context.Context, username string, mail string, project string, resources map[string]string) (*common.QuotaRequest, error) {
+	id, err := common.RandomString()
+	if err != nil {
+		common.Logger(ctx).WithError(err).Error("Error generating the quota request id")
+		return nil, errors.New(quotaRequestStoreError)
+	}
+
+	request := common.QuotaRequest{
+		ID:            id,
+		Cluster:       getCluster(ctx).ID,
+		Project:       project,
+		Requester:     username,
+		RequesterMail: mail,
+		Resources:     resources,
+		Status:        quotaRequestPending,
+		Created:       time.Now(),
+	}
+	open, err := quotaRequests.add(request)
+	if err != nil {
+		common.Logger(ctx).WithError(err).Error("Error saving the quota request")
+		return nil, errors.New(quotaRequestStoreError)
+	}
+	if open != nil {
+		return nil, fmt.Errorf("Für das Projekt %v ist bereits ein Antrag (%v) offen", project, open.ID)
+	}
+
+	common.Logger(ctx).WithFields(logrus.Fields{"user": username, "project": project, "quotas": resources, "request": id}).Info("Created quota request for approval")
+	return &request, nil
+}
+
+func getQuotaRequestsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, quotaRequests.list(c.Query("status")))
+}
+
+func approveQuotaRequestHandler(c *gin.Context) {
+	username := common.GetUserName(c)
+
+	request, err := decideQuotaRequest(c, username, c.Param("id"), quotaRequestApproved, "")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
+	} else {
+		c.JSON(http.StatusOK, common.ApiResponse{
+			Message: fmt.Sprintf("Der Antrag wurde bewilligt: Projekt %v, %v", request.Project, describeQuotas(request.Resources)),
+		})
+	}
+}
+
+func rejectQuotaRequestHandler(c *gin.Context) {
+	username := common.GetUserName(c)
+
+	var data common.DecideQuotaRequestCommand
+	if c.BindJSON(&data) == nil {
+		if len(data.Reason) == 0 {
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, "Bitte gib eine Begründung an"))
+			return
+		}
+
+		request, err := decideQuotaRequest(c, username, c.Param("id"), quotaRequestRejected, data.Reason)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
+		} else {
+			c.JSON(http.StatusOK, common.ApiResponse{
+				Message: fmt.Sprintf("Der Antrag für das Projekt %v wurde abgelehnt", request.Project),
+			})
+		}
+	} else {
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, wrongAPIUsageError))
+	}
+}
+
+// decideQuotaRequest approves or rejects a pending request. Approved quotas are applied on the cluster of the request.
+func decideQuotaRequest(ctx context.Context, username string, id string, status string, reason string) (*common.QuotaRequest, error) {
+	decide := func(r *common.QuotaRequest) {
+		now := time.Now()
+		r.Status = status
+		r.Reason = reason
+		r.DecidedBy = username
+		r.Decided = &now
+	}
+
+	// An approval reserves the request while the quotas are changed, so it is only applied once
+	from := quotaRequestPending
+	if status == quotaRequestApproved {
+		request, err := quotaRequests.update(id, quotaRequestPending, func(r *common.QuotaRequest) { r.Status = quotaRequestApproving })
+		if err != nil {
+			return nil, quotaRequestUpdateError(ctx, id, err)
+		}
+		if err := applyQuotaRequest(ctx, username, request); err != nil {
+			if _, err := quotaRequests.update(id, quotaRequestApproving, func(r *common.QuotaRequest) { r.Status = quotaRequestPending }); err != nil {
+				common.Logger(ctx).WithError(err).WithField("request", id).Error("Error resetting the quota request to pending")
+			}
+			return nil, err
+		}
+		from = quotaRequestApproving
+	}
+
+	request, err := quotaRequests.update(id, from, decide)
+	if err != nil {
+		return nil, quotaRequestUpdateError(ctx, id, err)
+	}
+
+	common.Logger(ctx).WithFields(logrus.Fields{"user": username, "project": request.Project, "request": id, "status": status}).Info("Decided quota request")
+	notifyQuotaRequester(ctx, request)
+	return &request, nil
+}
+
+func applyQuotaRequest(ctx context.Context, username string, request common.QuotaRequest) error {
+	cl := findCluster(request.Cluster)
+	if cl == nil {
+		return fmt.Errorf("Der Cluster %v existiert nicht", request.Cluster)
+	}
+	return updateQuotas(withCluster(ctx, cl), username, request.Project, request.Resources)
+}
+
+func quotaRequestUpdateError(ctx context.Context, id string, err error) error {
+	switch err {
+	case errQuotaRequestNotFound:
+		return fmt.Errorf("Der Antrag %v existiert nicht", id)
+	case errQuotaRequestNotOpen:
+		return fmt.Errorf("Der Antrag %v ist nicht mehr offen", id)
+	}
+	common.Logger(ctx).WithError(err).WithField("request", id).Error("Error saving the quota request")
+	return errors.New(quotaRequestStoreError)
+}
+
+func notifyQuotaRequester(ctx context.Context, request common.QuotaRequest) {
+	if len(request.RequesterMail) == 0 {
+		common.Logger(ctx).WithField("request", request.ID).Warn("Quota request was decided, but no requester mail is known")
+		return
+	}
+
+	var subject, body string
+	if request.Status == quotaRequestApproved {
+		subject = fmt.Sprintf("Dein Antrag für die Quotas des Projekts %v wurde bewilligt", request.Project)
+		body = fmt.Sprintf("Hallo\n\nDie Quotas des Projekts %v wurden geändert: %v\n", request.Project, describeQuotas(request.Resources))
+	} else {
+		subject = fmt.Sprintf("Dein Antrag für die Quotas des Projekts %v wurde abgelehnt", request.Project)
+		body = fmt.Sprintf("Hallo\n\nDein Antrag für die Quotas des Projekts %v (%v) wurde abgelehnt.\nBegründung: %v\n",
+			request.Project, describeQuotas(request.Resources), request.Reason)
+	}
+
+	// The decision is made anyway, a failed mail is only logged
+	if err := common.SendMail(request.RequesterMail, subject, body); err != nil {
+		common.Logger(ctx).WithError(err).WithField("request", request.ID).Warn("Could not notify the requester of the quota request")
+	}
+}
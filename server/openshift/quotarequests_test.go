@@ -0,0 +1,156 @@
+package openshift
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
+)
+
+func getQuotaRequests(t *testing.T, router http.Handler, query string) []common.QuotaRequest {
+	req := httptest.NewRequest("GET", "/api/ose/quotarequests"+query, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	equals(t, http.StatusOK, w.Code)
+
+	var res []common.QuotaRequest
+	ok(t, json.Unmarshal(w.Body.Bytes(), &res))
+	return res
+}
+
+func TestQuotaRequestApproval(t *testing.T) {
+	fake, router := setupFake("u123456")
+	fake.addProject("project", "u123456")
+
+	// Above the maximum the quotas are not changed, but requested
+	code, _ := call(router, "POST", "/api/ose/quotas", common.EditQuotasCommand{ProjectName: common.ProjectName{Project: "project"}, CPU: "16", Memory: "8"})
+	equals(t, http.StatusAccepted, code)
+	equals(t, "2", fake.quotas["project"][0].Spec.Hard["cpu"])
+
+	code, msg := call(router, "POST", "/api/ose/quotas", common.EditQuotasCommand{ProjectName: common.ProjectName{Project: "project"}, CPU: "12"})
+	equals(t, http.StatusBadRequest, code)
+	assert(t, len(msg) > 0, "A second pending request should be rejected")
+
+	requests := getQuotaRequests(t, router, "?status=pending")
+	equals(t, 1, len(requests))
+	equals(t, "u123456", requests[0].Requester)
+	equals(t, "u123456@example.com", requests[0].RequesterMail)
+	equals(t, map[string]string{"cpu": "16", "memory": "8"}, requests[0].Resources)
+
+	code, _ = call(router, "POST", "/api/ose/quotarequests/"+requests[0].ID+"/approve", nil)
+	equals(t, http.StatusOK, code)
+	equals(t, map[string]string{"cpu": "16", "memory": "8Gi"}, fake.quotas["project"][0].Spec.Hard)
+
+	requests = getQuotaRequests(t, router, "")
+	equals(t, quotaRequestApproved, requests[0].Status)
+	equals(t, "u123456", requests[0].DecidedBy)
+
+	code, msg = call(router, "POST", "/api/ose/quotarequests/"+requests[0].ID+"/approve", nil)
+	equals(t, http.StatusBadRequest, code)
+	equals(t, "Der Antrag "+requests[0].ID+" ist nicht mehr offen", msg)
+}
+
+func TestQuotaRequestRejection(t *testing.T) {
+	fake, router := setupFake("u123456")
+	fake.addProject("project", "u123456")
+
+	code, _ := call(router, "POST", "/api/ose/quotas", common.EditQuotasCommand{ProjectName: common.ProjectName{Project: "project"}, Resources: map[string]string{"pods": "80"}})
+	equals(t, http.StatusAccepted, code)
+	id := getQuotaRequests(t, router, "")[0].ID
+
+	code, msg := call(router, "POST", "/api/ose/quotarequests/"+id+"/reject", common.DecideQuotaRequestCommand{})
+	equals(t, http.StatusBadRequest, code)
+	equals(t, "Bitte gib eine Begründung an", msg)
+
+	code, _ = call(router, "POST", "/api/ose/quotarequests/"+id+"/reject", common.DecideQuotaRequestCommand{Reason: "Zu viele Pods"})
+	equals(t, http.StatusOK, code)
+	equals(t, "", fake.quotas["project"][0].Spec.Hard["pods"])
+
+	requests := getQuotaRequests(t, router, "?status=rejected")
+	equals(t, 1, len(requests))
+	equals(t, "Zu viele Pods", requests[0].Reason)
+
+	code, _ = call(router, "POST", "/api/ose/quotarequests/missing/approve", nil)
+	equals(t, http.StatusBadRequest, code)
+}
+
+func TestQuotaRequestStoreFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quotarequests")
+	ok(t, err)
+	path := filepath.Join(dir, "requests.json")
+
+	store, err := newQuotaRequestStore(path)
+	ok(t, err)
+	open, err := store.add(common.QuotaRequest{ID: "1", Project: "project", Status: quotaRequestPending})
+	ok(t, err)
+	assert(t, open == nil, "The project has no open request")
+	_, err = store.update("1", quotaRequestPending, func(r *common.QuotaRequest) { r.Status = quotaRequestRejected })
+	ok(t, err)
+	_, err = store.add(common.QuotaRequest{ID: "2", Project: "project", Status: quotaRequestApproving})
+	ok(t, err)
+
+	store, err = newQuotaRequestStore(path)
+	ok(t, err)
+	equals(t, 2, len(store.list("")))
+	r, _ := store.get("1")
+	equals(t, quotaRequestRejected, r.Status)
+	// An interrupted approval can be approved again
+	r, _ = store.get("2")
+	equals(t, quotaRequestPending, r.Status)
+}
+
+func TestQuotaRequestConcurrentDecisions(t *testing.T) {
+	fake, _ := setupFake("u123456")
+	fake.addProject("project", "u123456")
+	request, err := createQuotaRequest(context.Background(), "u123456", "", "project", map[string]string{"cpu": "16"})
+	ok(t, err)
+
+	// Only one of the admins decides the request
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := decideQuotaRequest(context.Background(), "u654321", request.ID, quotaRequestRejected, "Nein")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	decided := 0
+	for err := range errs {
+		if err == nil {
+			decided++
+		}
+	}
+	equals(t, 1, decided)
+
+	// A request which is being approved can't be decided again
+	_, err = quotaRequests.update(request.ID, quotaRequestRejected, func(r *common.QuotaRequest) { r.Status = quotaRequestApproving })
+	ok(t, err)
+	_, err = decideQuotaRequest(context.Background(), "u654321", request.ID, quotaRequestApproved, "")
+	equals(t, "Der Antrag "+request.ID+" ist nicht mehr offen", err.Error())
+	_, err = createQuotaRequest(context.Background(), "u123456", "", "project", map[string]string{"cpu": "12"})
+	equals(t, "Für das Projekt project ist bereits ein Antrag ("+request.ID+") offen", err.Error())
+}
+
+func TestQuotaRequestApprovalFailed(t *testing.T) {
+	fake, _ := setupFake("u123456")
+	fake.addProject("project", "u123456")
+	request, err := createQuotaRequest(context.Background(), "u123456", "", "project", map[string]string{"cpu": "16"})
+	ok(t, err)
+
+	// A failed change of the quotas leaves the request open
+	delete(fake.quotas, "project")
+	_, err = decideQuotaRequest(context.Background(), "u654321", request.ID, quotaRequestApproved, "")
+	assert(t, err != nil, "Approval should fail")
+	r, _ := quotaRequests.get(request.ID)
+	equals(t, quotaRequestPending, r.Status)
+}
@@ -1,139 +1,331 @@
 package openshift
 
 import (
-	"bytes"
+	"context"
 	"errors"
-	"io/ioutil"
-	"log"
 	"net/http"
-	"os"
+	"sort"
 
 	"fmt"
 	"strconv"
 	"strings"
 
-	"github.com/Jeffail/gabs"
 	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 )
 
-const (
-	getQuotasApiError = "Error getting quotas from ose-api: %v"
-	jsonDecodingError = "Error decoding json from ose api: %v"
-)
+const getQuotasApiError = "Error getting quotas from ose-api"
+
+// quotaUnits are the units of the editable quotas, the users enter whole numbers in these units
+var quotaUnits = map[string]string{
+	"cpu":                    "",
+	"requests.cpu":           "",
+	"limits.cpu":             "",
+	"memory":                 "Gi",
+	"requests.memory":        "Gi",
+	"limits.memory":          "Gi",
+	"requests.storage":       "Gi",
+	"pods":                   "",
+	"persistentvolumeclaims": "",
+	"services":               "",
+	"secrets":                "",
+	"configmaps":             "",
+}
+
+// quantitySuffixes are the suffixes of kubernetes quantities, e.g. 500m or 4Gi
+var quantitySuffixes = []struct {
+	suffix string
+	factor float64
+}{
+	{"Ki", 1 << 10}, {"Mi", 1 << 20}, {"Gi", 1 << 30}, {"Ti", 1 << 40},
+	{"m", 0.001}, {"k", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12},
+}
+
+func getQuotasHandler(c *gin.Context) {
+	username := common.GetUserName(c)
+	project := c.Param("project")
+
+	if err := validateAdminAccess(c, username, project); err != nil {
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
+		return
+	}
+
+	if quotas, err := getQuotas(c, project); err != nil {
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
+	} else {
+		c.JSON(http.StatusOK, quotas)
+	}
+}
 
 func editQuotasHandler(c *gin.Context) {
 	username := common.GetUserName(c)
 
 	var data common.EditQuotasCommand
 	if c.BindJSON(&data) == nil {
-		if err := validateEditQuotas(username, data.Project, data.CPU, data.Memory); err != nil {
-			c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
+		resources := quotasOfCommand(data)
+		overLimit, err := validateEditQuotas(c, username, data.Project, resources)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
 			return
 		}
 
-		if err := updateQuotas(username, data.Project, data.CPU, data.Memory); err != nil {
-			c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
+		// Quotas above the self-service limits need the approval of the platform admins
+		if overLimit {
+			if request, err := createQuotaRequest(c, username, common.GetUserMail(c), data.Project, resources); err != nil {
+				c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
+			} else {
+				c.JSON(http.StatusAccepted, common.ApiResponse{
+					Message: fmt.Sprintf("Die Quotas überschreiten die Self-Service-Limiten. Dein Antrag %v wurde an die Plattform-Admins weitergeleitet, du wirst per Mail über den Entscheid informiert", request.ID),
+				})
+			}
+			return
+		}
+
+		if err := updateQuotas(c, username, data.Project, resources); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
 		} else {
 			c.JSON(http.StatusOK, common.ApiResponse{
-				Message: fmt.Sprintf("Die neuen Quotas wurden gespeichert: Projekt %v, CPU: %v, Memory: %v",
-					data.Project, data.CPU, data.Memory),
+				Message: fmt.Sprintf("Die neuen Quotas wurden gespeichert: Projekt %v, %v", data.Project, describeQuotas(resources)),
 			})
 		}
 	} else {
-		c.JSON(http.StatusBadRequest, common.ApiResponse{Message: wrongAPIUsageError})
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, wrongAPIUsageError))
+	}
+}
+
+// quotasOfCommand returns the changed quotas, cpu and memory can also be set by their own fields
+func quotasOfCommand(data common.EditQuotasCommand) map[string]string {
+	resources := map[string]string{}
+	for k, v := range data.Resources {
+		resources[k] = v
+	}
+	if len(data.CPU) > 0 {
+		resources["cpu"] = data.CPU
+	}
+	if len(data.Memory) > 0 {
+		resources["memory"] = data.Memory
 	}
+	return resources
 }
 
-func validateEditQuotas(username string, project string, cpu string, memory string) error {
-	maxCPU := os.Getenv("MAX_QUOTA_CPU")
-	maxMemory := os.Getenv("MAX_QUOTA_MEMORY")
+func describeQuotas(resources map[string]string) string {
+	var names []string
+	for k := range resources {
+		names = append(names, k)
+	}
+	sort.Strings(names)
 
-	if len(maxCPU) == 0 || len(maxMemory) == 0 {
-		log.Fatal("Env variables 'MAX_QUOTA_MEMORY' and 'MAX_QUOTA_CPU' must be specified")
+	var parts []string
+	for _, k := range names {
+		parts = append(parts, fmt.Sprintf("%v: %v%v", k, resources[k], quotaUnits[k]))
 	}
+	return strings.Join(parts, ", ")
+}
+
+// maxQuota returns the configured maximum of a resource. Resources without maximum can't be edited.
+func maxQuota(resource string) (int, bool) {
+	if max, ok := config.MaxQuotas[resource]; ok {
+		return max, true
+	}
+	switch resource {
+	case "cpu", "requests.cpu", "limits.cpu":
+		return config.MaxQuotaCPU, true
+	case "memory", "requests.memory", "limits.memory":
+		return config.MaxQuotaMemory, true
+	}
+	return 0, false
+}
 
+// validateEditQuotas checks the quotas and the permissions. It returns if a quota is above its maximum.
+func validateEditQuotas(ctx context.Context, username string, project string, resources map[string]string) (bool, error) {
 	// Validate user input
 	if len(project) == 0 {
-		return errors.New("Projekt muss angegeben werden")
+		return false, errors.New("Projekt muss angegeben werden")
 	}
-	if err := common.ValidateIntInput(maxCPU, cpu); err != nil {
-		return err
+	if len(resources) == 0 {
+		return false, errors.New("Es muss mindestens eine Quota angegeben werden")
 	}
-	if err := common.ValidateIntInput(maxMemory, memory); err != nil {
-		return err
+	overLimit := false
+	for resource, value := range resources {
+		if _, ok := quotaUnits[resource]; !ok {
+			return false, fmt.Errorf("Die Quota %v kann nicht geändert werden", resource)
+		}
+		max, ok := maxQuota(resource)
+		if !ok {
+			return false, fmt.Errorf("Die Quota %v kann nicht geändert werden", resource)
+		}
+		v, err := strconv.Atoi(value)
+		if err != nil || v < 0 {
+			return false, fmt.Errorf("%v: Bitte eine gültige Zahl eintragen", resource)
+		}
+		if v > max {
+			overLimit = true
+		}
 	}
 
 	// Validate permissions
-	resp := checkAdminPermissions(username, project)
-	return resp
+	return overLimit, checkAdminPermissions(ctx, username, project)
 }
 
-func GetQuotas(project string) (int, int) {
-	client, req := getOseHTTPClient("GET", "api/v1/namespaces/"+project+"/resourcequotas", nil)
-	resp, err := client.Do(req)
-
+// getQuotas returns the hard and used values of all resource quotas and the limit ranges of the project
+func getQuotas(ctx context.Context, project string) (*common.ProjectQuotas, error) {
+	quotas, err := ose(ctx).ListResourceQuotas(ctx, project)
 	if err != nil {
-		log.Fatalf(getQuotasApiError, err.Error())
+		common.Logger(ctx).WithError(err).Error(getQuotasApiError)
+		return nil, errors.New(genericAPIError)
 	}
-	defer resp.Body.Close()
-
-	json, err := gabs.ParseJSONBuffer(resp.Body)
+	limitRanges, err := ose(ctx).ListLimitRanges(ctx, project)
 	if err != nil {
-		log.Fatalf(jsonDecodingError, err)
+		common.Logger(ctx).WithError(err).Error("Error getting the limit ranges")
+		return nil, errors.New(genericAPIError)
 	}
 
-	firstQuota := json.S("items").Index(0)
-
-	cpu := firstQuota.Path("spec.hard.cpu").String()
-	mem := strings.Replace(firstQuota.Path("spec.hard.memory").String(), "Gi", "", 1)
-
-	cpuInt, err := strconv.Atoi(cpu)
-	if err != nil {
-		log.Fatalf("Error parsing cpu quota. value: %v, err: %v", cpu, err.Error())
+	result := &common.ProjectQuotas{
+		Project:     project,
+		Quotas:      []common.ProjectQuota{},
+		LimitRanges: []common.ProjectLimitRange{},
 	}
-	memInt, err := strconv.Atoi(mem)
-	if err != nil {
-		log.Fatalf("Error parsing memory quota. value: %v, err: %v", mem, err.Error())
+	for _, q := range quotas {
+		quota := common.ProjectQuota{
+			Name:   q.Metadata.Name,
+			Scopes: q.Spec.Scopes,
+			Hard:   q.Spec.Hard,
+			Used:   map[string]string{},
+		}
+		if q.Status != nil && q.Status.Used != nil {
+			quota.Used = q.Status.Used
+		}
+		result.Quotas = append(result.Quotas, quota)
 	}
-
-	return cpuInt, memInt
+	for _, lr := range limitRanges {
+		limitRange := common.ProjectLimitRange{Name: lr.Metadata.Name, Limits: []common.ProjectLimit{}}
+		for _, l := range lr.Spec.Limits {
+			limitRange.Limits = append(limitRange.Limits, common.ProjectLimit{
+				Type:                 l.Type,
+				Min:                  l.Min,
+				Max:                  l.Max,
+				Default:              l.Default,
+				DefaultRequest:       l.DefaultRequest,
+				MaxLimitRequestRatio: l.MaxLimitRequestRatio,
+			})
+		}
+		result.LimitRanges = append(result.LimitRanges, limitRange)
+	}
+	return result, nil
 }
 
-func updateQuotas(username string, project string, cpu string, memory string) error {
-	client, req := getOseHTTPClient("GET", "api/v1/namespaces/"+project+"/resourcequotas", nil)
-	resp, err := client.Do(req)
-
+func updateQuotas(ctx context.Context, username string, project string, resources map[string]string) error {
+	quotas, err := ose(ctx).ListResourceQuotas(ctx, project)
 	if err != nil {
-		log.Printf(getQuotasApiError, err.Error())
+		common.Logger(ctx).WithError(err).Error(getQuotasApiError)
 		return errors.New(genericAPIError)
 	}
-	defer resp.Body.Close()
-
-	json, err := gabs.ParseJSONBuffer(resp.Body)
-	if err != nil {
-		log.Printf(jsonDecodingError, err)
+	if len(quotas) == 0 {
+		common.Logger(ctx).WithField("project", project).Error("Project has no resourceQuota")
 		return errors.New(genericAPIError)
 	}
 
-	firstQuota := json.S("items").Index(0)
+	// A resource is changed in the quota which already limits it, otherwise in the first quota without scopes
+	changed := map[int]map[string]string{}
+	for resource, value := range resources {
+		i, err := quotaOfResource(quotas, resource)
+		if err != nil {
+			common.Logger(ctx).WithFields(logrus.Fields{"project": project, "resource": resource}).Error("Project has no resourceQuota without scopes")
+			return err
+		}
+		if quotas[i].Spec.Hard == nil {
+			quotas[i].Spec.Hard = map[string]string{}
+		}
+		quotas[i].Spec.Hard[resource] = value + quotaUnits[resource]
+		if changed[i] == nil {
+			changed[i] = map[string]string{}
+		}
+		changed[i][resource] = value + quotaUnits[resource]
+	}
+
+	if err := validateRequestsAndLimits(quotas); err != nil {
+		return err
+	}
+
+	// Only the changed limits are sent, the quota might have fields we don't know
+	for i, hard := range changed {
+		if err := ose(ctx).PatchResourceQuotaHard(ctx, project, quotas[i].Metadata.Name, hard); err != nil {
+			common.Logger(ctx).WithError(err).Error("Error updating resourceQuota")
+			return errors.New(genericAPIError)
+		}
+	}
 
-	firstQuota.SetP(cpu, "spec.hard.cpu")
-	firstQuota.SetP(memory+"Gi", "spec.hard.memory")
+	common.Logger(ctx).WithFields(logrus.Fields{"user": username, "project": project, "quotas": resources}).Info("Changed the quotas of the project")
+	return nil
+}
+
+// quotaOfResource returns the index of the quota without scopes which limits the resource, or else the first quota without scopes.
+// A quota with scopes or a scope selector only limits some of the pods, e.g. BestEffort, so it is never changed.
+func quotaOfResource(quotas []ResourceQuota, resource string) (int, error) {
+	for i, q := range quotas {
+		if _, ok := q.Spec.Hard[resource]; ok && !q.Spec.IsScoped() {
+			return i, nil
+		}
+	}
+	for i, q := range quotas {
+		if !q.Spec.IsScoped() {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("Das Projekt hat keine Quota ohne Scopes, in der %v geändert werden kann. Bitte erstelle ein Ticket", resource)
+}
 
-	client, req = getOseHTTPClient("PUT",
-		"api/v1/namespaces/"+project+"/resourcequotas/"+firstQuota.Path("metadata.name").Data().(string),
-		bytes.NewReader(firstQuota.Bytes()))
+// validateRequestsAndLimits checks that the requests of cpu and memory aren't bigger than their limits.
+// The quota 'cpu' is the same as 'requests.cpu'.
+func validateRequestsAndLimits(quotas []ResourceQuota) error {
+	for _, q := range quotas {
+		if q.Spec.IsScoped() {
+			continue
+		}
+		for _, resource := range []string{"cpu", "memory"} {
+			limit, hasLimit := q.Spec.Hard["limits."+resource]
+			if !hasLimit {
+				continue
+			}
+			for _, key := range []string{resource, "requests." + resource} {
+				request, hasRequest := q.Spec.Hard[key]
+				if !hasRequest {
+					continue
+				}
 
-	resp, err = client.Do(req)
-	if err == nil && resp.StatusCode == http.StatusOK {
-		defer resp.Body.Close()
-		log.Println("User "+username+" changed quotas for the project "+project+". CPU: "+cpu, ", Mem: "+memory)
-		return nil
+				requestValue, err := parseQuantity(request)
+				if err != nil {
+					return err
+				}
+				limitValue, err := parseQuantity(limit)
+				if err != nil {
+					return err
+				}
+				if requestValue > limitValue {
+					return fmt.Errorf("Die Quota %v (%v) darf nicht grösser als limits.%v (%v) sein", key, request, resource, limit)
+				}
+			}
+		}
 	}
+	return nil
+}
 
-	errMsg, _ := ioutil.ReadAll(resp.Body)
-	log.Println("Error updating resourceQuota:", err.Error(), resp.StatusCode, string(errMsg))
+// parseQuantity returns the value of a kubernetes quantity like 500m or 4Gi
+func parseQuantity(quantity string) (float64, error) {
+	factor := 1.0
+	number := quantity
+	for _, s := range quantitySuffixes {
+		if strings.HasSuffix(quantity, s.suffix) {
+			factor = s.factor
+			number = strings.TrimSuffix(quantity, s.suffix)
+			break
+		}
+	}
 
-	return errors.New(genericAPIError)
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Ungültiger Wert: %v", quantity)
+	}
+	return value * factor, nil
 }
@@ -0,0 +1,113 @@
+package openshift
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
+)
+
+func TestEditQuotas(t *testing.T) {
+	fake, router := setupFake("u123456")
+	fake.addProject("project", "u123456")
+
+	code, _ := call(router, "POST", "/api/ose/quotas", common.EditQuotasCommand{ProjectName: common.ProjectName{Project: "project"}, CPU: "4", Memory: "8"})
+	equals(t, http.StatusOK, code)
+	equals(t, map[string]string{"cpu": "4", "memory": "8Gi"}, fake.quotas["project"][0].Spec.Hard)
+
+	// Other resources need a maximum in the config
+	code, msg := call(router, "POST", "/api/ose/quotas", common.EditQuotasCommand{ProjectName: common.ProjectName{Project: "project"}, Resources: map[string]string{"services": "5"}})
+	equals(t, http.StatusBadRequest, code)
+	equals(t, "Die Quota services kann nicht geändert werden", msg)
+
+	code, msg = call(router, "POST", "/api/ose/quotas", common.EditQuotasCommand{ProjectName: common.ProjectName{Project: "project"}, Resources: map[string]string{"pods": "many"}})
+	equals(t, http.StatusBadRequest, code)
+	equals(t, "pods: Bitte eine gültige Zahl eintragen", msg)
+
+	code, msg = call(router, "POST", "/api/ose/quotas", common.EditQuotasCommand{ProjectName: common.ProjectName{Project: "project"}, Resources: map[string]string{"pods": "20", "requests.storage": "10"}})
+	equals(t, http.StatusOK, code)
+	equals(t, "Die neuen Quotas wurden gespeichert: Projekt project, pods: 20, requests.storage: 10Gi", msg)
+	equals(t, "20", fake.quotas["project"][0].Spec.Hard["pods"])
+	equals(t, "10Gi", fake.quotas["project"][0].Spec.Hard["requests.storage"])
+}
+
+func TestEditQuotasRequestsAndLimits(t *testing.T) {
+	fake, router := setupFake("u123456")
+	fake.addProject("project", "u123456")
+	fake.quotas["project"] = append(fake.quotas["project"], ResourceQuota{
+		Metadata: ObjectMeta{Name: "terminating", Namespace: "project"},
+		Spec:     ResourceQuotaSpec{Hard: map[string]string{"pods": "5"}, Scopes: []string{"Terminating"}},
+	})
+
+	code, msg := call(router, "POST", "/api/ose/quotas", common.EditQuotasCommand{ProjectName: common.ProjectName{Project: "project"}, Resources: map[string]string{"limits.cpu": "1"}})
+	equals(t, http.StatusBadRequest, code)
+	equals(t, "Die Quota cpu (2) darf nicht grösser als limits.cpu (1) sein", msg)
+
+	code, _ = call(router, "POST", "/api/ose/quotas", common.EditQuotasCommand{ProjectName: common.ProjectName{Project: "project"}, Resources: map[string]string{"limits.memory": "6", "pods": "10"}})
+	equals(t, http.StatusOK, code)
+	equals(t, map[string]string{"cpu": "2", "memory": "4Gi", "limits.memory": "6Gi", "pods": "10"}, fake.quotas["project"][0].Spec.Hard)
+	equals(t, map[string]string{"pods": "5"}, fake.quotas["project"][1].Spec.Hard)
+}
+
+func TestEditQuotasOnlyScoped(t *testing.T) {
+	fake, router := setupFake("u123456")
+	fake.addProject("project", "u123456")
+	fake.quotas["project"][0].Spec.Scopes = []string{"BestEffort"}
+
+	code, msg := call(router, "POST", "/api/ose/quotas", common.EditQuotasCommand{ProjectName: common.ProjectName{Project: "project"}, Resources: map[string]string{"pods": "10"}})
+	equals(t, http.StatusBadRequest, code)
+	equals(t, "Das Projekt hat keine Quota ohne Scopes, in der pods geändert werden kann. Bitte erstelle ein Ticket", msg)
+	equals(t, map[string]string{"cpu": "2", "memory": "4Gi"}, fake.quotas["project"][0].Spec.Hard)
+
+	// A scope selector limits the quota as well
+	fake.quotas["project"][0].Spec.Scopes = nil
+	fake.quotas["project"][0].Spec.ScopeSelector = &ScopeSelector{MatchExpressions: []ScopedResourceSelectorRequirement{
+		{ScopeName: "PriorityClass", Operator: "In", Values: []string{"high"}},
+	}}
+	code, _ = call(router, "POST", "/api/ose/quotas", common.EditQuotasCommand{ProjectName: common.ProjectName{Project: "project"}, Resources: map[string]string{"pods": "10"}})
+	equals(t, http.StatusBadRequest, code)
+	equals(t, map[string]string{"cpu": "2", "memory": "4Gi"}, fake.quotas["project"][0].Spec.Hard)
+}
+
+func TestGetQuotas(t *testing.T) {
+	fake, router := setupFake("u123456")
+	fake.addProject("project", "u123456")
+	fake.addProject("other", "u000000")
+	fake.quotas["project"][0].Status = &ResourceQuotaSpec{Used: map[string]string{"cpu": "500m"}}
+	fake.limitRanges["project"] = []LimitRange{{
+		Metadata: ObjectMeta{Name: "limits", Namespace: "project"},
+		Spec:     LimitRangeSpec{Limits: []LimitRangeItem{{Type: "Container", Max: map[string]string{"memory": "2Gi"}}}},
+	}}
+
+	req := httptest.NewRequest("GET", "/api/ose/quotas/project", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	equals(t, http.StatusOK, w.Code)
+
+	var res common.ProjectQuotas
+	ok(t, json.Unmarshal(w.Body.Bytes(), &res))
+	equals(t, common.ProjectQuotas{
+		Project: "project",
+		Quotas: []common.ProjectQuota{
+			{Name: "default", Hard: map[string]string{"cpu": "2", "memory": "4Gi"}, Used: map[string]string{"cpu": "500m"}},
+		},
+		LimitRanges: []common.ProjectLimitRange{
+			{Name: "limits", Limits: []common.ProjectLimit{{Type: "Container", Max: map[string]string{"memory": "2Gi"}}}},
+		},
+	}, res)
+
+	code, _ := call(router, "GET", "/api/ose/quotas/other", nil)
+	equals(t, http.StatusBadRequest, code)
+}
+
+func TestParseQuantity(t *testing.T) {
+	for quantity, exp := range map[string]float64{"2": 2, "500m": 0.5, "4Gi": 4 << 30, "1k": 1000} {
+		value, err := parseQuantity(quantity)
+		ok(t, err)
+		equals(t, exp, value)
+	}
+	_, err := parseQuantity("lots")
+	assert(t, err != nil, "Invalid quantities should be rejected")
+}
@@ -0,0 +1,246 @@
+package openshift
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
+	"github.com/sirupsen/logrus"
+)
+
+// adminRole is the cluster role of the project admins
+const adminRole = "admin"
+
+// projectAdmins are the users and groups with the admin role of a project.
+// They are read from the rbac role bindings, or the policy binding on older clusters.
+type projectAdmins struct {
+	Users  []string
+	Groups []string
+}
+
+func (a *projectAdmins) hasUser(name string) bool {
+	return containsIgnoreCase(a.Users, name)
+}
+
+func (a *projectAdmins) hasGroup(name string) bool {
+	return containsIgnoreCase(a.Groups, name)
+}
+
+func removeIgnoreCase(list []string, value string) []string {
+	var result []string
+	for _, v := range list {
+		if !strings.EqualFold(v, value) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func containsIgnoreCase(list []string, value string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasRBAC(ctx context.Context) (bool, error) {
+	rbac, err := ose(ctx).HasRBAC(ctx)
+	if err != nil {
+		common.Logger(ctx).WithError(err).Error("Error detecting the permission api")
+		return false, errors.New(genericAPIError)
+	}
+	return rbac, nil
+}
+
+func getProjectAdmins(ctx context.Context, project string) (*projectAdmins, error) {
+	rbac, err := hasRBAC(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if rbac {
+		bindings, err := getAdminRoleBindings(ctx, project)
+		if err != nil {
+			return nil, err
+		}
+		return adminsOfRoleBindings(bindings), nil
+	}
+
+	policyBinding, err := getPolicyBinding(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	admins := &projectAdmins{}
+	for _, v := range policyBinding.RoleBindings {
+		if v.Name == adminRole {
+			admins.Users = append(admins.Users, v.RoleBinding.UserNames...)
+			admins.Groups = append(admins.Groups, v.RoleBinding.GroupNames...)
+		}
+	}
+	return admins, nil
+}
+
+// changeProjectAdmins applies the change to the admins of the project and saves them.
+// Nothing is saved if the change returns an error.
+func changeProjectAdmins(ctx context.Context, project string, change func(admins *projectAdmins) error) error {
+	rbac, err := hasRBAC(ctx)
+	if err != nil {
+		return err
+	}
+
+	if rbac {
+		return changeAdminRoleBindings(ctx, project, change)
+	}
+	return changeAdminPolicyBinding(ctx, project, change)
+}
+
+func getPolicyBinding(ctx context.Context, project string) (*PolicyBinding, error) {
+	policyBinding, err := ose(ctx).GetPolicyBinding(ctx, project)
+	if IsNotFound(err) {
+		common.Logger(ctx).WithField("project", project).Info("Project was not found")
+		return nil, errors.New("Das Projekt existiert nicht")
+	}
+	if err != nil {
+		common.Logger(ctx).WithError(err).Error("Error getting the policy binding")
+		return nil, errors.New(genericAPIError)
+	}
+
+	return policyBinding, nil
+}
+
+func changeAdminPolicyBinding(ctx context.Context, project string, change func(admins *projectAdmins) error) error {
+	policyBinding, err := getPolicyBinding(ctx, project)
+	if err != nil {
+		return err
+	}
+
+	for i, v := range policyBinding.RoleBindings {
+		if v.Name == adminRole {
+			admins := &projectAdmins{Users: v.RoleBinding.UserNames, Groups: v.RoleBinding.GroupNames}
+			if err := change(admins); err != nil {
+				return err
+			}
+
+			rb := &policyBinding.RoleBindings[i].RoleBinding
+			rb.UserNames = admins.Users
+			rb.GroupNames = admins.Groups
+			// OpenShift derives the subjects from the names
+			rb.Subjects = nil
+		}
+	}
+
+	if err := ose(ctx).UpdatePolicyBinding(ctx, policyBinding); err != nil {
+		common.Logger(ctx).WithError(err).Error("Error updating project permissions")
+		return errors.New(genericAPIError)
+	}
+	return nil
+}
+
+// getAdminRoleBindings returns the rbac role bindings of the admin role of the project
+func getAdminRoleBindings(ctx context.Context, project string) ([]RoleBinding, error) {
+	// The role bindings of a missing project are an empty list
+	if _, err := getNamespace(ctx, project); err != nil {
+		return nil, err
+	}
+
+	bindings, err := ose(ctx).ListRoleBindings(ctx, project)
+	if err != nil {
+		common.Logger(ctx).WithError(err).Error("Error getting the role bindings")
+		return nil, errors.New(genericAPIError)
+	}
+
+	var result []RoleBinding
+	for _, b := range bindings {
+		if b.RoleRef.Kind == "ClusterRole" && b.RoleRef.Name == adminRole {
+			result = append(result, b)
+		}
+	}
+	return result, nil
+}
+
+func adminsOfRoleBindings(bindings []RoleBinding) *projectAdmins {
+	admins := &projectAdmins{}
+	for _, b := range bindings {
+		for _, s := range b.Subjects {
+			switch s.Kind {
+			case "User":
+				admins.Users = append(admins.Users, s.Name)
+			case "Group":
+				admins.Groups = append(admins.Groups, s.Name)
+			}
+		}
+	}
+	return admins
+}
+
+func changeAdminRoleBindings(ctx context.Context, project string, change func(admins *projectAdmins) error) error {
+	bindings, err := getAdminRoleBindings(ctx, project)
+	if err != nil {
+		return err
+	}
+
+	before := adminsOfRoleBindings(bindings)
+	after := adminsOfRoleBindings(bindings)
+	if err := change(after); err != nil {
+		return err
+	}
+
+	// Removed admins are removed from every binding, new ones are added to the binding named admin
+	target := -1
+	changed := map[int]bool{}
+	for i, b := range bindings {
+		if b.Metadata.Name == adminRole {
+			target = i
+		}
+
+		var subjects []Subject
+		for _, s := range b.Subjects {
+			if (s.Kind == "User" && !after.hasUser(s.Name)) || (s.Kind == "Group" && !after.hasGroup(s.Name)) {
+				changed[i] = true
+				continue
+			}
+			subjects = append(subjects, s)
+		}
+		bindings[i].Subjects = subjects
+	}
+
+	var added []Subject
+	for _, u := range after.Users {
+		if !before.hasUser(u) {
+			added = append(added, Subject{Kind: "User", APIGroup: rbacGroup, Name: u})
+		}
+	}
+	for _, g := range after.Groups {
+		if !before.hasGroup(g) {
+			added = append(added, Subject{Kind: "Group", APIGroup: rbacGroup, Name: g})
+		}
+	}
+
+	if len(added) > 0 {
+		if target < 0 {
+			binding := &RoleBinding{
+				Metadata: ObjectMeta{Name: adminRole, Namespace: project},
+				Subjects: added,
+				RoleRef:  RoleRef{APIGroup: rbacGroup, Kind: "ClusterRole", Name: adminRole},
+			}
+			if err := ose(ctx).CreateRoleBinding(ctx, binding); err != nil {
+				common.Logger(ctx).WithError(err).Error("Error creating the admin role binding")
+				return errors.New(genericAPIError)
+			}
+		} else {
+			bindings[target].Subjects = append(bindings[target].Subjects, added...)
+			changed[target] = true
+		}
+	}
+
+	for i := range changed {
+		if err := ose(ctx).UpdateRoleBinding(ctx, &bindings[i]); err != nil {
+			common.Logger(ctx).WithError(err).WithFields(logrus.Fields{"project": project, "rolebinding": bindings[i].Metadata.Name}).Error("Error updating the role binding")
+			return errors.New(genericAPIError)
+		}
+	}
+	return nil
+}
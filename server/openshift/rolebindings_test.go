@@ -0,0 +1,83 @@
+package openshift
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
+)
+
+func TestHasRBAC(t *testing.T) {
+	calls := 0
+	rbac := true
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if !rbac || r.URL.Path != "/"+rbacAPI {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer api.Close()
+
+	cfg := common.OpenshiftClusterConfig{APIURL: api.URL}
+	client := newTestClient(t, cfg, time.Second)
+	hasRBAC, err := client.HasRBAC(context.Background())
+	ok(t, err)
+	assert(t, hasRBAC, "Should detect the rbac api")
+
+	// The result is cached
+	client.HasRBAC(context.Background())
+	equals(t, 1, calls)
+
+	rbac = false
+	hasRBAC, err = newTestClient(t, cfg, time.Second).HasRBAC(context.Background())
+	ok(t, err)
+	assert(t, !hasRBAC, "Should detect a cluster without rbac api")
+}
+
+func TestChangeAdminsLegacy(t *testing.T) {
+	fake, _ := setupFake("u123456")
+	fake.rbac = false
+	fake.addProject("project", "u000000")
+	fake.policyBindings["project"].RoleBindings[0].RoleBinding.GroupNames = []string{"operator"}
+
+	ok(t, changeProjectPermission(context.Background(), "project", "u123456"))
+
+	admins, err := getProjectAdmins(context.Background(), "project")
+	ok(t, err)
+	equals(t, []string{"u000000", "u123456", "U123456"}, admins.Users)
+	equals(t, []string{"operator"}, admins.Groups)
+
+	_, err = getProjectAdmins(context.Background(), "missing")
+	equals(t, "Das Projekt existiert nicht", err.Error())
+}
+
+func TestChangeAdminsRBAC(t *testing.T) {
+	fake, _ := setupFake("u123456")
+	fake.addProject("project", "u000000")
+
+	ok(t, changeProjectAdmins(context.Background(), "project", func(admins *projectAdmins) error {
+		admins.Users = []string{"u123456"}
+		admins.Groups = []string{"operator"}
+		return nil
+	}))
+
+	equals(t, []Subject{
+		{Kind: "User", APIGroup: rbacGroup, Name: "u123456"},
+		{Kind: "Group", APIGroup: rbacGroup, Name: "operator"},
+	}, fake.roleBindings["project"][0].Subjects)
+	// Bindings of other roles are not changed
+	equals(t, "system:serviceaccounts:project", fake.roleBindings["project"][1].Subjects[0].Name)
+
+	// The admin binding is created if it is missing
+	fake.roleBindings["project"] = fake.roleBindings["project"][1:]
+	ok(t, changeProjectPermission(context.Background(), "project", "u123456"))
+	admins, err := getProjectAdmins(context.Background(), "project")
+	ok(t, err)
+	equals(t, []string{"u123456", "U123456"}, admins.Users)
+
+	_, err = getProjectAdmins(context.Background(), "missing")
+	equals(t, "Das Projekt existiert nicht", err.Error())
+}
@@ -0,0 +1,88 @@
+package openshift
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
+)
+
+const (
+	stepExecuted           = "executed"
+	stepCompensated        = "compensated"
+	stepCompensationFailed = "compensation failed"
+)
+
+// saga executes steps one after another. If a step fails, the steps already executed
+// are compensated in reverse order, so a failed order leaves nothing behind.
+type saga struct {
+	ctx           context.Context
+	steps         []common.VolumeStep
+	compensations []func() error
+}
+
+func newSaga(ctx context.Context) *saga {
+	return &saga{ctx: ctx}
+}
+
+// run executes the action. The compensation undoes it and may be nil if there is nothing to undo.
+// If the action fails, the saga is rolled back and the error contains the report of the steps.
+func (s *saga) run(name string, action func() error, compensation func() error) error {
+	return s.runCreated(name, func() (bool, error) {
+		err := action()
+		return err == nil, err
+	}, compensation)
+}
+
+// runCreated is run for actions which can fail after they created something, e.g. a workflow whose result can't be read.
+// If the action returns created, it is compensated like the executed steps.
+func (s *saga) runCreated(name string, action func() (bool, error), compensation func() error) error {
+	created, err := action()
+	if created {
+		s.steps = append(s.steps, common.VolumeStep{Name: name, Status: stepExecuted})
+		s.compensations = append(s.compensations, compensation)
+	}
+	if err != nil {
+		common.Logger(s.ctx).WithField("step", name).Warn("Step failed, rolling back the executed steps")
+		s.rollback()
+		return s.failure(err)
+	}
+	return nil
+}
+
+func (s *saga) rollback() {
+	for i := len(s.steps) - 1; i >= 0; i-- {
+		if s.compensations[i] == nil {
+			continue
+		}
+		if err := s.compensations[i](); err != nil {
+			common.Logger(s.ctx).WithError(err).WithField("step", s.steps[i].Name).Error("Error compensating step")
+			s.steps[i].Status = stepCompensationFailed
+		} else {
+			s.steps[i].Status = stepCompensated
+		}
+	}
+}
+
+// failure extends the error of the failed step with the steps which were undone or left behind
+func (s *saga) failure(err error) error {
+	var compensated, failed []string
+	for _, step := range s.steps {
+		switch step.Status {
+		case stepCompensated:
+			compensated = append(compensated, step.Name)
+		case stepCompensationFailed:
+			failed = append(failed, step.Name)
+		}
+	}
+
+	msg := err.Error()
+	if len(compensated) > 0 {
+		msg += fmt.Sprintf(". Rückgängig gemacht: %v", strings.Join(compensated, ", "))
+	}
+	if len(failed) > 0 {
+		msg += fmt.Sprintf(". Nicht rückgängig gemacht werden konnte: %v. Bitte erstelle ein Ticket", strings.Join(failed, ", "))
+	}
+	return fmt.Errorf("%v", msg)
+}
@@ -1,171 +1,517 @@
 package openshift
 
 import (
-	"bytes"
+	"context"
 	"errors"
-	"io/ioutil"
-	"log"
 	"net/http"
+	"sort"
+	"strings"
+	"time"
 
 	"fmt"
 
-	"encoding/json"
-	"github.com/Jeffail/gabs"
 	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
 	"github.com/gin-gonic/gin"
-	"os"
-	"strings"
+	"github.com/sirupsen/logrus"
 )
 
-var jenkinsUrl string
+const (
+	serviceAccountTokenType = "kubernetes.io/service-account-token"
+	// jenkinsOrganizationAnnotation is the organization whose Jenkins has the token of service accounts created before the credential sinks
+	jenkinsOrganizationAnnotation = "openshift.io/jenkins-organization"
 
-type newJenkinsCredentialsCommand struct {
-	OrganizationKey string `json:"organizationKey"`
-	Secret          string `json:"secret"`
-	Description     string `json:"description"`
+	// serviceAccountProjectLabel and serviceAccountNameLabel mark the role bindings which grant roles to a service account
+	serviceAccountProjectLabel = "openshift.io/service-account-project"
+	serviceAccountNameLabel    = "openshift.io/service-account-name"
+)
+
+// serviceAccountRoles are the cluster roles users can grant to their service accounts, by their name in the api
+var serviceAccountRoles = map[string]string{
+	"edit":         "edit",
+	"view":         "view",
+	"image-puller": "system:image-puller",
 }
 
-func init() {
-	jenkinsUrl = os.Getenv("JENKINS_URL")
+// builtinServiceAccounts are created by OpenShift in every project
+var builtinServiceAccounts = []string{"builder", "default", "deployer"}
 
-	if len(jenkinsUrl) == 0 {
-		log.Fatal("Env variable 'JENKINS_URL' must be specified")
-	}
-}
+// serviceAccountTokenTimeout is how long we wait for OpenShift to create the new token of a service account
+var (
+	serviceAccountTokenTimeout      = 30 * time.Second
+	serviceAccountTokenPollInterval = time.Second
+)
 
 func newServiceAccountHandler(c *gin.Context) {
 	username := common.GetUserName(c)
 
 	var data common.NewServiceAccountCommand
 	if c.BindJSON(&data) == nil {
-		if err := validateNewServiceAccount(username, data.Project, data.ServiceAccount); err != nil {
-			c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
+		sink := data.Sink
+		if sink == nil && len(data.OrganizationKey) > 0 {
+			// Clients from before the credential sinks only send the organization of the Jenkins
+			sink = &common.CredentialSink{Type: "jenkins", Target: data.OrganizationKey}
+		}
+
+		if err := validateNewServiceAccount(c, username, data.Project, data.ServiceAccount, sink, data.Roles); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
 			return
 		}
 
-		if err := createNewServiceAccount(username, data.Project, data.ServiceAccount, data.OrganizationKey); err != nil {
-			c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
+		if err := createNewServiceAccount(c, username, data.Project, data.ServiceAccount, sink, data.Roles); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
 		} else {
 
-			if len(data.OrganizationKey) > 0 {
+			roles := ""
+			if len(data.Roles) > 0 {
+				roles = fmt.Sprintf(" (Rollen: %v)", describeServiceAccountRoles(data.Project, data.Roles))
+			}
+			if sink != nil {
 				c.JSON(http.StatusOK, common.ApiResponse{
-					Message: fmt.Sprintf(`Der Service Account %v wurde angelegt und im Jenkins hinterlegt. Du findest das Credential & die CredentialId im Jenkins hier: <a href='%v' target='_blank'>Jenkins</a>`,
-						data.ServiceAccount, jenkinsUrl+"/job/"+data.OrganizationKey+"/credentials")})
+					Message: fmt.Sprintf("Der Service Account %v%v wurde angelegt und das Token hinterlegt: %v",
+						data.ServiceAccount, roles, describeCredentialSink(*sink))})
 			} else {
 				c.JSON(http.StatusOK, common.ApiResponse{
-					Message: fmt.Sprintf("Der Service Account %v wurde angelegt", data.ServiceAccount),
+					Message: fmt.Sprintf("Der Service Account %v%v wurde angelegt", data.ServiceAccount, roles),
 				})
 			}
 		}
 	} else {
-		c.JSON(http.StatusBadRequest, common.ApiResponse{Message: wrongAPIUsageError})
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, wrongAPIUsageError))
 	}
 }
 
-func validateNewServiceAccount(username string, project string, serviceAccountName string) error {
+func validateNewServiceAccount(ctx context.Context, username string, project string, serviceAccountName string, sink *common.CredentialSink, roles []common.ServiceAccountRole) error {
 	if len(serviceAccountName) == 0 {
 		return errors.New("Service Account muss angegeben werden")
 	}
 
 	// Validate permissions
-	if err := checkAdminPermissions(username, project); err != nil {
+	if err := checkAdminPermissions(ctx, username, project); err != nil {
 		return err
 	}
 
+	if sink != nil {
+		if err := validateCredentialSink(ctx, username, *sink); err != nil {
+			return err
+		}
+	}
+
+	if len(roles) == 0 {
+		return nil
+	}
+	rbac, err := hasRBAC(ctx)
+	if err != nil {
+		return err
+	}
+	if !rbac {
+		return errors.New("Rollen für Service Accounts benötigen die RBAC-API von OpenShift 3.7")
+	}
+	// The name is a label of the role bindings
+	if len(serviceAccountName) > 63 {
+		return errors.New("Der Name eines Service Accounts mit Rollen darf höchstens 63 Zeichen lang sein")
+	}
+	for _, r := range roles {
+		if _, ok := serviceAccountRoles[r.Role]; !ok {
+			return fmt.Errorf("Die Rolle %v kann nicht vergeben werden. Erlaubt sind: edit, view, image-puller", r.Role)
+		}
+		// Roles in other projects need the admin permissions on them too
+		if len(r.Project) > 0 && r.Project != project {
+			if err := checkAdminPermissions(ctx, username, r.Project); err != nil {
+				return fmt.Errorf("Projekt %v: %v", r.Project, err.Error())
+			}
+		}
+	}
+
 	return nil
 }
 
-func createNewServiceAccount(username string, project string, serviceaccount string, organizationKey string) error {
-	p := newObjectRequest("ServiceAccount", serviceaccount)
+func describeServiceAccountRoles(project string, roles []common.ServiceAccountRole) string {
+	var parts []string
+	for _, r := range roles {
+		parts = append(parts, fmt.Sprintf("%v auf %v", r.Role, roleProject(project, r)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// roleProject returns the project in which the role is granted
+func roleProject(project string, role common.ServiceAccountRole) string {
+	if len(role.Project) > 0 {
+		return role.Project
+	}
+	return project
+}
 
-	client, req := getOseHTTPClient("POST",
-		"api/v1/namespaces/"+project+"/serviceaccounts",
-		bytes.NewReader(p.Bytes()))
+func createNewServiceAccount(ctx context.Context, username string, project string, serviceaccount string, sink *common.CredentialSink, roles []common.ServiceAccountRole) error {
+	sa := &ServiceAccount{Metadata: ObjectMeta{Name: serviceaccount, Namespace: project}}
+	// The sink is needed to store the token again when it is rotated
+	if sink != nil {
+		if err := setCredentialSinkAnnotation(ctx, sa, *sink); err != nil {
+			return err
+		}
+	}
 
-	resp, err := client.Do(req)
+	err := ose(ctx).CreateServiceAccount(ctx, sa)
+	if IsConflict(err) {
+		return errors.New("Der Service-Account existiert bereits.")
+	}
+	if err != nil {
+		common.Logger(ctx).WithError(err).Error("Error creating new service account")
+		return errors.New(genericAPIError)
+	}
 
-	if resp.StatusCode == http.StatusCreated {
-		resp.Body.Close()
-		log.Print(username + " created a new service account: " + serviceaccount + " on project " + project)
+	common.Logger(ctx).WithFields(logrus.Fields{"user": username, "project": project, "service_account": serviceaccount}).Info("Created a new service account")
 
-		if len(organizationKey) > 0 {
-			if err = createJenkinsCredential(project, serviceaccount, organizationKey); err != nil {
-				log.Println("error creating jenkins credential for service-account", err.Error())
+	// A service account without its roles would only lead to tickets, so it is deleted again
+	if err := grantServiceAccountRoles(ctx, username, project, serviceaccount, roles); err != nil {
+		if err := deleteServiceAccountRoleBindings(ctx, username, project, serviceaccount); err != nil {
+			common.Logger(ctx).WithError(err).WithField("service_account", serviceaccount).Error("Error deleting the role bindings after the roles of the service account failed")
+		}
+		if err := ose(ctx).DeleteServiceAccount(ctx, project, serviceaccount); err != nil {
+			common.Logger(ctx).WithError(err).WithField("service_account", serviceaccount).Error("Error deleting the service account after its roles failed")
+		}
+		return fmt.Errorf("Der Service Account %v konnte nicht berechtigt werden und wurde wieder gelöscht: %v", serviceaccount, err.Error())
+	}
+
+	if sink != nil {
+		if err := storeServiceAccountToken(ctx, project, serviceaccount, *sink); err != nil {
+			return fmt.Errorf("Der Service Account %v wurde angelegt, das Token konnte aber nicht hinterlegt werden: %v", serviceaccount, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// grantServiceAccountRoles creates a role binding for every role of the service account.
+// The bindings are labeled with the service account, so they can be deleted with it.
+func grantServiceAccountRoles(ctx context.Context, username string, project string, serviceaccount string, roles []common.ServiceAccountRole) error {
+	labels := serviceAccountLabels(project, serviceaccount)
+	for _, r := range roles {
+		target := roleProject(project, r)
+		binding := &RoleBinding{
+			Metadata: ObjectMeta{Name: fmt.Sprintf("sa-%v-%v-%v", project, serviceaccount, r.Role), Namespace: target, Labels: labels},
+			RoleRef:  RoleRef{APIGroup: rbacGroup, Kind: "ClusterRole", Name: serviceAccountRoles[r.Role]},
+			Subjects: []Subject{{Kind: "ServiceAccount", Name: serviceaccount, Namespace: project}},
+		}
+
+		err := ose(ctx).CreateRoleBinding(ctx, binding)
+		if IsConflict(err) {
+			if err := adoptServiceAccountRoleBinding(ctx, binding); err != nil {
 				return err
 			}
+			continue
 		}
+		if err != nil {
+			common.Logger(ctx).WithError(err).WithFields(logrus.Fields{"project": target, "rolebinding": binding.Metadata.Name}).Error("Error creating the role binding of the service account")
+			return errors.New(genericAPIError)
+		}
+		common.Logger(ctx).WithFields(logrus.Fields{"user": username, "project": target, "service_account": serviceaccount, "role": r.Role}).Info("Granted role to the service account")
+	}
+	return nil
+}
 
-		return nil
+func serviceAccountLabels(project string, serviceaccount string) map[string]string {
+	return map[string]string{serviceAccountProjectLabel: project, serviceAccountNameLabel: serviceaccount}
+}
+
+// adoptServiceAccountRoleBinding takes over an existing role binding with the same name, if it grants the same role to the same service account.
+// The names of the bindings are ambiguous, e.g. project a-b with service account c and project a with service account b-c.
+func adoptServiceAccountRoleBinding(ctx context.Context, binding *RoleBinding) error {
+	existing, err := ose(ctx).GetRoleBinding(ctx, binding.Metadata.Namespace, binding.Metadata.Name)
+	if err != nil {
+		common.Logger(ctx).WithError(err).WithField("rolebinding", binding.Metadata.Name).Error("Error getting the existing role binding of the service account")
+		return errors.New(genericAPIError)
 	}
 
-	if resp.StatusCode == http.StatusConflict {
-		return errors.New("Der Service-Account existiert bereits.")
+	subject := binding.Subjects[0]
+	if existing.RoleRef != binding.RoleRef || len(existing.Subjects) != 1 || existing.Subjects[0].Kind != subject.Kind ||
+		existing.Subjects[0].Name != subject.Name || existing.Subjects[0].Namespace != subject.Namespace {
+		common.Logger(ctx).WithFields(logrus.Fields{"project": binding.Metadata.Namespace, "rolebinding": binding.Metadata.Name}).Warn("Existing role binding grants another role or to another subject")
+		return fmt.Errorf("Im Projekt %v existiert bereits das Rolebinding %v mit anderen Berechtigungen", binding.Metadata.Namespace, binding.Metadata.Name)
 	}
 
-	errMsg, _ := ioutil.ReadAll(resp.Body)
-	log.Println("Error creating new project:", err, resp.StatusCode, string(errMsg))
-	return errors.New(genericAPIError)
+	if existing.Metadata.Labels[serviceAccountProjectLabel] == binding.Metadata.Labels[serviceAccountProjectLabel] &&
+		existing.Metadata.Labels[serviceAccountNameLabel] == binding.Metadata.Labels[serviceAccountNameLabel] {
+		return nil
+	}
+	if existing.Metadata.Labels == nil {
+		existing.Metadata.Labels = map[string]string{}
+	}
+	for k, v := range binding.Metadata.Labels {
+		existing.Metadata.Labels[k] = v
+	}
+	if err := ose(ctx).UpdateRoleBinding(ctx, existing); err != nil {
+		common.Logger(ctx).WithError(err).WithField("rolebinding", binding.Metadata.Name).Error("Error labeling the existing role binding of the service account")
+		return errors.New(genericAPIError)
+	}
+	common.Logger(ctx).WithFields(logrus.Fields{"project": binding.Metadata.Namespace, "rolebinding": binding.Metadata.Name}).Info("Took over the existing role binding of the service account")
+	return nil
 }
 
-func createJenkinsCredential(project string, serviceaccount string, organizationKey string) error {
-	// Get the created service-account
-	client, saRequest := getOseHTTPClient("GET", "api/v1/namespaces/"+project+"/serviceaccounts/"+serviceaccount, nil)
-	saResponse, err := client.Do(saRequest)
+// deleteServiceAccountRoleBindings deletes the role bindings of the service account in all projects
+func deleteServiceAccountRoleBindings(ctx context.Context, username string, project string, serviceaccount string) error {
+	rbac, err := hasRBAC(ctx)
+	if err != nil || !rbac {
+		// Without rbac service accounts have no roles
+		return err
+	}
+
+	bindings, err := ose(ctx).ListLabeledRoleBindings(ctx, serviceAccountLabels(project, serviceaccount))
 	if err != nil {
+		common.Logger(ctx).WithError(err).Error("Error getting the role bindings of the service account")
 		return errors.New(genericAPIError)
 	}
-	defer saResponse.Body.Close()
+	for _, b := range bindings {
+		if err := ose(ctx).DeleteRoleBinding(ctx, b.Metadata.Namespace, b.Metadata.Name); err != nil && !IsNotFound(err) {
+			common.Logger(ctx).WithError(err).WithFields(logrus.Fields{"project": b.Metadata.Namespace, "rolebinding": b.Metadata.Name}).Error("Error deleting the role binding of the service account")
+			return errors.New(genericAPIError)
+		}
+		common.Logger(ctx).WithFields(logrus.Fields{"user": username, "project": b.Metadata.Namespace, "service_account": serviceaccount, "rolebinding": b.Metadata.Name}).Info("Deleted the role binding of the service account")
+	}
+	return nil
+}
 
-	saJson, err := gabs.ParseJSONBuffer(saResponse.Body)
+func getServiceAccountsHandler(c *gin.Context) {
+	username := common.GetUserName(c)
+	project := c.Param("project")
+
+	if err := validateAdminAccess(c, username, project); err != nil {
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
+		return
+	}
+
+	if accounts, err := getServiceAccounts(c, project); err != nil {
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
+	} else {
+		c.JSON(http.StatusOK, accounts)
+	}
+}
+
+func rotateServiceAccountTokenHandler(c *gin.Context) {
+	username := common.GetUserName(c)
+	project := c.Param("project")
+	serviceaccount := c.Param("serviceaccount")
+
+	if err := validateAdminAccess(c, username, project); err != nil {
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
+		return
+	}
+
+	// The body is optional, it is only needed for service accounts without a known credential sink
+	var data common.RotateServiceAccountTokenCommand
+	if c.Request.ContentLength != 0 && c.BindJSON(&data) != nil {
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, wrongAPIUsageError))
+		return
+	}
+	requested := data.Sink
+	if requested == nil && len(data.OrganizationKey) > 0 {
+		requested = &common.CredentialSink{Type: "jenkins", Target: data.OrganizationKey}
+	}
+
+	sink, err := rotateServiceAccountToken(c, username, project, serviceaccount, requested, data.WithoutSink)
 	if err != nil {
-		log.Println(err.Error())
-		return errors.New(genericAPIError)
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
+	} else if sink != nil {
+		c.JSON(http.StatusOK, common.ApiResponse{
+			Message: fmt.Sprintf("Das Token des Service Accounts %v wurde erneuert und hinterlegt: %v", serviceaccount, describeCredentialSink(*sink)),
+		})
+	} else {
+		c.JSON(http.StatusOK, common.ApiResponse{
+			Message: fmt.Sprintf("Das Token des Service Accounts %v wurde erneuert", serviceaccount),
+		})
 	}
+}
 
-	secret := saJson.S("secrets").Index(0)
-	secretName := strings.Trim(secret.Path("name").String(), "\"")
+func deleteServiceAccountHandler(c *gin.Context) {
+	username := common.GetUserName(c)
+	project := c.Param("project")
+	serviceaccount := c.Param("serviceaccount")
+
+	if err := validateAdminAccess(c, username, project); err != nil {
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
+		return
+	}
 
-	// Get the secret & token for the service-account
-	client, secretRequest := getOseHTTPClient("GET", "api/v1/namespaces/"+project+"/secrets/"+secretName, nil)
-	secretResponse, err := client.Do(secretRequest)
+	sink, err := deleteServiceAccount(c, username, project, serviceaccount)
 	if err != nil {
-		log.Println(err.Error())
-		return errors.New(genericAPIError)
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
+	} else if sink != nil {
+		c.JSON(http.StatusOK, common.ApiResponse{
+			Message: fmt.Sprintf("Der Service Account %v wurde gelöscht. Das hinterlegte Token ist nicht mehr gültig und kann gelöscht werden: %v", serviceaccount, describeCredentialSink(*sink)),
+		})
+	} else {
+		c.JSON(http.StatusOK, common.ApiResponse{
+			Message: fmt.Sprintf("Der Service Account %v wurde gelöscht", serviceaccount),
+		})
 	}
-	defer secretResponse.Body.Close()
+}
 
-	secretJson, err := gabs.ParseJSONBuffer(secretResponse.Body)
+func getServiceAccounts(ctx context.Context, project string) ([]common.ProjectServiceAccount, error) {
+	list, err := ose(ctx).ListServiceAccounts(ctx, project)
 	if err != nil {
-		log.Println(err.Error())
-		return errors.New(genericAPIError)
+		common.Logger(ctx).WithError(err).Error("Error getting the service accounts")
+		return nil, errors.New(genericAPIError)
 	}
 
-	tokenData := strings.Trim(secretJson.Path("data.token").String(), "\"")
+	result := []common.ProjectServiceAccount{}
+	for _, sa := range list {
+		result = append(result, common.ProjectServiceAccount{
+			Name:    sa.Metadata.Name,
+			Created: sa.Metadata.CreationTimestamp,
+			Sink:    serviceAccountCredentialSink(ctx, &sa),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
 
-	// Call the WZU backend
-	command := newJenkinsCredentialsCommand{
-		OrganizationKey: organizationKey,
-		Description:     fmt.Sprintf("OpenShift Deployer - project: %v, service-account: %v", project, serviceaccount),
-		Secret:          tokenData,
+func getServiceAccount(ctx context.Context, project string, serviceaccount string) (*ServiceAccount, error) {
+	sa, err := ose(ctx).GetServiceAccount(ctx, project, serviceaccount)
+	if IsNotFound(err) {
+		return nil, fmt.Errorf("Der Service Account %v existiert nicht", serviceaccount)
 	}
-	byteJson, err := json.Marshal(command)
 	if err != nil {
-		log.Println(err.Error())
-		return errors.New(genericAPIError)
+		common.Logger(ctx).WithError(err).Error("Error getting the service account")
+		return nil, errors.New(genericAPIError)
 	}
+	return sa, nil
+}
 
-	client, wzuRequest := getWZUBackendClient("POST", "sec/jenkins/credentials", bytes.NewReader(byteJson))
-	wzuResponse, err := client.Do(wzuRequest)
+// getServiceAccountTokens returns the token secrets of the service account.
+// The other secrets, e.g. the one to pull images, are skipped.
+func getServiceAccountTokens(ctx context.Context, sa *ServiceAccount) ([]*Secret, error) {
+	var tokens []*Secret
+	for _, ref := range sa.Secrets {
+		secret, err := ose(ctx).GetSecret(ctx, sa.Metadata.Namespace, ref.Name)
+		if IsNotFound(err) {
+			// Deleted secrets are removed from the service account a bit later
+			continue
+		}
+		if err != nil {
+			common.Logger(ctx).WithError(err).Error("Error getting the secret of the service account")
+			return nil, errors.New(genericAPIError)
+		}
+		if secret.Type == serviceAccountTokenType {
+			tokens = append(tokens, secret)
+		}
+	}
+	return tokens, nil
+}
+
+// rotateServiceAccountToken deletes the tokens of the service account and waits until OpenShift has created a new one.
+// The new token is stored in the requested credential sink, which is recorded for the next rotation, or in the sink of the service account.
+// Without a known sink the caller has to confirm that the token isn't stored anywhere. It returns the credential sink.
+func rotateServiceAccountToken(ctx context.Context, username string, project string, serviceaccount string, requested *common.CredentialSink, withoutSink bool) (*common.CredentialSink, error) {
+	sa, err := getServiceAccount(ctx, project, serviceaccount)
 	if err != nil {
-		log.Println(err.Error())
-		return errors.New(genericAPIError)
+		return nil, err
+	}
+	tokens, err := getServiceAccountTokens(ctx, sa)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("Der Service Account %v hat kein Token", serviceaccount)
 	}
-	defer saResponse.Body.Close()
 
-	if wzuResponse.StatusCode != http.StatusOK {
-		bodyBytes, _ := ioutil.ReadAll(wzuResponse.Body)
-		return fmt.Errorf("Fehler vom WZU-Backend: StatusCode: %v, Nachricht: %v", wzuResponse.StatusCode, string(bodyBytes))
+	// Service accounts from before the credential sinks might have a token in Jenkins, which would break silently
+	sink := serviceAccountCredentialSink(ctx, sa)
+	if requested != nil {
+		sink = requested
+	} else if sink == nil && !withoutSink {
+		return nil, fmt.Errorf("Es ist nicht bekannt, wo das Token des Service Accounts %v hinterlegt ist. "+
+			"Bitte gib den Ablageort an, oder bestätige, dass das Token nirgends hinterlegt ist", serviceaccount)
 	}
 
-	return nil
+	// The user might not be allowed to store the token where it was stored before
+	if sink != nil {
+		if err := validateCredentialSink(ctx, username, *sink); err != nil {
+			return nil, fmt.Errorf("Das Token kann nicht erneuert werden: %v", err.Error())
+		}
+	}
+	if requested != nil {
+		if err := setCredentialSinkAnnotation(ctx, sa, *requested); err != nil {
+			return nil, err
+		}
+		annotations := map[string]string{credentialSinkAnnotation: sa.Metadata.Annotations[credentialSinkAnnotation]}
+		if err := ose(ctx).PatchServiceAccountAnnotations(ctx, project, serviceaccount, annotations); err != nil {
+			common.Logger(ctx).WithError(err).WithField("service_account", serviceaccount).Error("Error saving the credential sink of the service account")
+			return nil, errors.New(genericAPIError)
+		}
+	}
+
+	deleted := map[string]bool{}
+	for _, t := range tokens {
+		if err := ose(ctx).DeleteSecret(ctx, project, t.Metadata.Name); err != nil && !IsNotFound(err) {
+			common.Logger(ctx).WithError(err).WithField("secret", t.Metadata.Name).Error("Error deleting the token of the service account")
+			return nil, errors.New(genericAPIError)
+		}
+		deleted[t.Metadata.Name] = true
+	}
+	common.Logger(ctx).WithFields(logrus.Fields{"user": username, "project": project, "service_account": serviceaccount}).Info("Deleted the token of the service account")
+
+	if err := waitForNewToken(ctx, project, serviceaccount, deleted); err != nil {
+		return nil, err
+	}
+
+	if sink == nil {
+		return nil, nil
+	}
+	if err := storeServiceAccountToken(ctx, project, serviceaccount, *sink); err != nil {
+		common.Logger(ctx).WithError(err).Error("Error storing the new token in the credential sink")
+		return nil, fmt.Errorf("Das Token wurde erneuert, konnte aber nicht hinterlegt werden: %v", err.Error())
+	}
+	return sink, nil
+}
+
+// waitForNewToken waits until the service account has a token which wasn't deleted
+func waitForNewToken(ctx context.Context, project string, serviceaccount string, deleted map[string]bool) error {
+	deadline := time.Now().Add(serviceAccountTokenTimeout)
+	for {
+		sa, err := getServiceAccount(ctx, project, serviceaccount)
+		if err != nil {
+			return err
+		}
+		tokens, err := getServiceAccountTokens(ctx, sa)
+		if err != nil {
+			return err
+		}
+		for _, t := range tokens {
+			if !deleted[t.Metadata.Name] {
+				return nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			common.Logger(ctx).WithField("service_account", serviceaccount).Error("Timeout waiting for the new token of the service account")
+			return errors.New("Das alte Token wurde gelöscht, OpenShift hat aber noch kein neues erstellt. Bitte versuche es später nochmals")
+		}
+		time.Sleep(serviceAccountTokenPollInterval)
+	}
+}
+
+// deleteServiceAccount deletes the service account, its tokens and its role bindings. It returns the credential sink which had its token.
+func deleteServiceAccount(ctx context.Context, username string, project string, serviceaccount string) (*common.CredentialSink, error) {
+	for _, b := range builtinServiceAccounts {
+		if serviceaccount == b {
+			return nil, fmt.Errorf("Der Service Account %v wird von OpenShift verwaltet und kann nicht gelöscht werden", serviceaccount)
+		}
+	}
+
+	sa, err := getServiceAccount(ctx, project, serviceaccount)
+	if err != nil {
+		return nil, err
+	}
+	// The role bindings would grant their roles to a new service account with the same name
+	if err := deleteServiceAccountRoleBindings(ctx, username, project, serviceaccount); err != nil {
+		return nil, err
+	}
+	if err := ose(ctx).DeleteServiceAccount(ctx, project, serviceaccount); err != nil {
+		common.Logger(ctx).WithError(err).Error("Error deleting the service account")
+		return nil, errors.New(genericAPIError)
+	}
+
+	common.Logger(ctx).WithFields(logrus.Fields{"user": username, "project": project, "service_account": serviceaccount}).Info("Deleted the service account")
+	return serviceAccountCredentialSink(ctx, sa), nil
 }
@@ -0,0 +1,193 @@
+package openshift
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
+)
+
+// fakeWZUBackend records the tokens stored in Jenkins
+func fakeWZUBackend(stored *[]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var cmd newJenkinsCredentialsCommand
+		json.NewDecoder(r.Body).Decode(&cmd)
+		token, _ := base64.StdEncoding.DecodeString(cmd.Secret)
+		*stored = append(*stored, cmd.OrganizationKey+":"+string(token))
+	}))
+	config.WZUBackend.URL = server.URL
+	wzuClient = http.DefaultClient
+	return server
+}
+
+func TestServiceAccounts(t *testing.T) {
+	fake, router := setupFake("u123456")
+	fake.addProject("project", "u123456")
+	var stored []string
+	server := fakeWZUBackend(&stored)
+	defer server.Close()
+
+	ok(t, createNewServiceAccount(context.Background(), "u123456", "project", "jenkins", &common.CredentialSink{Type: "jenkins", Target: "org"}, nil))
+	ok(t, createNewServiceAccount(context.Background(), "u123456", "project", "deployer", nil, nil))
+	equals(t, []string{"org:jenkins-token-1"}, stored)
+
+	accounts, err := getServiceAccounts(context.Background(), "project")
+	ok(t, err)
+	equals(t, []common.ProjectServiceAccount{{Name: "deployer"}, {Name: "jenkins", Sink: &common.CredentialSink{Type: "jenkins", Target: "org"}}}, accounts)
+
+	// The new token is stored in Jenkins again
+	status, _ := call(router, "POST", "/api/ose/project/project/serviceaccounts/jenkins/rotate", nil)
+	equals(t, http.StatusOK, status)
+	equals(t, []string{"org:jenkins-token-1", "org:jenkins-token-3"}, stored)
+	_, err = ose(context.Background()).GetSecret(context.Background(), "project", "jenkins-token-1")
+	assert(t, IsNotFound(err), "Old token should be deleted")
+
+	status, message := call(router, "DELETE", "/api/ose/project/project/serviceaccounts/deployer", nil)
+	equals(t, http.StatusBadRequest, status)
+	equals(t, "Der Service Account deployer wird von OpenShift verwaltet und kann nicht gelöscht werden", message)
+
+	status, _ = call(router, "DELETE", "/api/ose/project/project/serviceaccounts/jenkins", nil)
+	equals(t, http.StatusOK, status)
+	accounts, err = getServiceAccounts(context.Background(), "project")
+	ok(t, err)
+	equals(t, 1, len(accounts))
+}
+
+func TestRotateServiceAccountToken_NoToken(t *testing.T) {
+	fake, _ := setupFake("u123456")
+	fake.addProject("project", "u123456")
+	ok(t, createNewServiceAccount(context.Background(), "u123456", "project", "app", nil, nil))
+
+	// Only tokens are rotated, not the secret to pull images
+	sa := fake.serviceAccounts["project"]["app"]
+	sa.Secrets = []ObjectReference{{Name: "app-dockercfg-1"}}
+	fake.secrets["project"]["app-dockercfg-1"] = &Secret{Type: "kubernetes.io/dockercfg"}
+
+	_, err := rotateServiceAccountToken(context.Background(), "u123456", "project", "app", nil, true)
+	equals(t, "Der Service Account app hat kein Token", err.Error())
+	assert(t, fake.secrets["project"]["app-dockercfg-1"] != nil, "Other secrets should be kept")
+}
+
+func TestRotateServiceAccountToken_UnknownSink(t *testing.T) {
+	fake, router := setupFake("u123456")
+	fake.addProject("project", "u123456")
+	var stored []string
+	server := fakeWZUBackend(&stored)
+	defer server.Close()
+	ok(t, createNewServiceAccount(context.Background(), "u123456", "project", "jenkins", nil, nil))
+
+	// The token might be in a Jenkins since before the credential sinks
+	status, message := call(router, "POST", "/api/ose/project/project/serviceaccounts/jenkins/rotate", nil)
+	equals(t, http.StatusBadRequest, status)
+	equals(t, "Es ist nicht bekannt, wo das Token des Service Accounts jenkins hinterlegt ist. Bitte gib den Ablageort an, oder bestätige, dass das Token nirgends hinterlegt ist", message)
+	assert(t, fake.secrets["project"]["jenkins-token-1"] != nil, "Token should be kept")
+
+	// The given sink is kept for the next rotation
+	status, _ = call(router, "POST", "/api/ose/project/project/serviceaccounts/jenkins/rotate", common.RotateServiceAccountTokenCommand{OrganizationKey: "org"})
+	equals(t, http.StatusOK, status)
+	status, _ = call(router, "POST", "/api/ose/project/project/serviceaccounts/jenkins/rotate", nil)
+	equals(t, http.StatusOK, status)
+	equals(t, []string{"org:jenkins-token-2", "org:jenkins-token-3"}, stored)
+
+	ok(t, createNewServiceAccount(context.Background(), "u123456", "project", "app", nil, nil))
+	status, _ = call(router, "POST", "/api/ose/project/project/serviceaccounts/app/rotate", common.RotateServiceAccountTokenCommand{WithoutSink: true})
+	equals(t, http.StatusOK, status)
+}
+
+func TestServiceAccountRoles(t *testing.T) {
+	fake, router := setupFake("u123456")
+	fake.addProject("project", "u123456")
+	fake.addProject("images", "u123456")
+
+	status, message := call(router, "POST", "/api/ose/serviceaccount", common.NewServiceAccountCommand{
+		ProjectName:    common.ProjectName{Project: "project"},
+		ServiceAccount: "deployer-sa",
+		Roles:          []common.ServiceAccountRole{{Role: "edit"}, {Role: "image-puller", Project: "images"}},
+	})
+	equals(t, http.StatusOK, status)
+	equals(t, "Der Service Account deployer-sa (Rollen: edit auf project, image-puller auf images) wurde angelegt", message)
+
+	subject := []Subject{{Kind: "ServiceAccount", Name: "deployer-sa", Namespace: "project"}}
+	edit := fake.roleBindings["project"][len(fake.roleBindings["project"])-1]
+	equals(t, "sa-project-deployer-sa-edit", edit.Metadata.Name)
+	equals(t, RoleRef{APIGroup: rbacGroup, Kind: "ClusterRole", Name: "edit"}, edit.RoleRef)
+	equals(t, subject, edit.Subjects)
+	puller := fake.roleBindings["images"][len(fake.roleBindings["images"])-1]
+	equals(t, "system:image-puller", puller.RoleRef.Name)
+	equals(t, subject, puller.Subjects)
+	equals(t, map[string]string{serviceAccountProjectLabel: "project", serviceAccountNameLabel: "deployer-sa"}, puller.Metadata.Labels)
+}
+
+func TestServiceAccountRoles_ExistingBinding(t *testing.T) {
+	fake, _ := setupFake("u123456")
+	fake.addProject("project", "u123456")
+	fake.addProject("project-app", "u123456")
+
+	// A leftover binding of the same service account is taken over
+	subject := Subject{Kind: "ServiceAccount", Name: "app-x", Namespace: "project"}
+	ok(t, fake.CreateRoleBinding(context.Background(), &RoleBinding{
+		Metadata: ObjectMeta{Name: "sa-project-app-x-view", Namespace: "project"},
+		RoleRef:  RoleRef{APIGroup: rbacGroup, Kind: "ClusterRole", Name: "view"},
+		Subjects: []Subject{subject},
+	}))
+	ok(t, createNewServiceAccount(context.Background(), "u123456", "project", "app-x", nil, []common.ServiceAccountRole{{Role: "view"}}))
+	binding, err := fake.GetRoleBinding(context.Background(), "project", "sa-project-app-x-view")
+	ok(t, err)
+	equals(t, "app-x", binding.Metadata.Labels[serviceAccountNameLabel])
+
+	// The service account x of project-app has a binding with the same name
+	err = createNewServiceAccount(context.Background(), "u123456", "project-app", "x", nil, []common.ServiceAccountRole{{Role: "edit"}, {Role: "view", Project: "project"}})
+	equals(t, "Der Service Account x konnte nicht berechtigt werden und wurde wieder gelöscht: Im Projekt project existiert bereits das Rolebinding sa-project-app-x-view mit anderen Berechtigungen", err.Error())
+	// The binding created before is deleted with the service account
+	_, err = fake.GetRoleBinding(context.Background(), "project-app", "sa-project-app-x-edit")
+	assert(t, IsNotFound(err), "Role binding should be deleted")
+	binding, err = fake.GetRoleBinding(context.Background(), "project", "sa-project-app-x-view")
+	ok(t, err)
+	equals(t, []Subject{subject}, binding.Subjects)
+}
+
+func TestServiceAccountRoles_Validation(t *testing.T) {
+	fake, _ := setupFake("u123456")
+	fake.addProject("project", "u123456")
+	fake.addProject("foreign", "u654321")
+
+	err := validateNewServiceAccount(context.Background(), "u123456", "project", "app", nil, []common.ServiceAccountRole{{Role: "admin"}})
+	equals(t, "Die Rolle admin kann nicht vergeben werden. Erlaubt sind: edit, view, image-puller", err.Error())
+
+	err = validateNewServiceAccount(context.Background(), "u123456", "project", "app", nil, []common.ServiceAccountRole{{Role: "view", Project: "foreign"}})
+	equals(t, "Projekt foreign: Du hast keine Admin Rechte auf dem Projekt. Bestehende Admins sind folgende Benutzer: u654321", err.Error())
+
+	fake.rbac = false
+	err = validateNewServiceAccount(context.Background(), "u123456", "project", "app", nil, []common.ServiceAccountRole{{Role: "view"}})
+	equals(t, "Rollen für Service Accounts benötigen die RBAC-API von OpenShift 3.7", err.Error())
+}
+
+func TestServiceAccountRoles_Rollback(t *testing.T) {
+	fake, _ := setupFake("u123456")
+	fake.addProject("project", "u123456")
+	fake.failing["CreateRoleBinding"] = errors.New("forbidden")
+
+	err := createNewServiceAccount(context.Background(), "u123456", "project", "app", nil, []common.ServiceAccountRole{{Role: "edit"}})
+	equals(t, "Der Service Account app konnte nicht berechtigt werden und wurde wieder gelöscht: "+genericAPIError, err.Error())
+	assert(t, fake.serviceAccounts["project"]["app"] == nil, "Service account should be deleted")
+}
+
+func TestDeleteServiceAccount_Roles(t *testing.T) {
+	fake, _ := setupFake("u123456")
+	fake.addProject("project", "u123456")
+	fake.addProject("images", "u123456")
+	ok(t, createNewServiceAccount(context.Background(), "u123456", "project", "app", nil, []common.ServiceAccountRole{{Role: "edit"}, {Role: "image-puller", Project: "images"}}))
+	ok(t, createNewServiceAccount(context.Background(), "u123456", "project", "other", nil, []common.ServiceAccountRole{{Role: "view"}}))
+
+	_, err := deleteServiceAccount(context.Background(), "u123456", "project", "app")
+	ok(t, err)
+	bindings, err := fake.ListLabeledRoleBindings(context.Background(), map[string]string{serviceAccountProjectLabel: "project"})
+	ok(t, err)
+	equals(t, 1, len(bindings))
+	equals(t, "sa-project-other-view", bindings[0].Metadata.Name)
+}
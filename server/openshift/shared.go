@@ -1,111 +1,133 @@
 package openshift
 
 import (
-	"crypto/tls"
+	"context"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
-	"net/url"
-	"os"
 	"strings"
 
-	"github.com/Jeffail/gabs"
 	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 )
 
 const (
 	genericAPIError         = "Fehler beim Aufruf der OpenShift-API. Bitte erstelle ein Ticket"
 	wrongAPIUsageError      = "Invalid api call - parameters did not match to method definition"
-	testProjectDeletionDays = "30"
+	testProjectDeletionDays = 30
 )
 
+// config is the OpenShift section of the configuration, set by RegisterRoutes
+var config common.OpenshiftConfig
+
+// wzuClient is the http client of the WZU backend, if it is configured
+var wzuClient *http.Client
+
 // RegisterRoutes registers the routes for OpenShift
-func RegisterRoutes(r *gin.RouterGroup) {
+func RegisterRoutes(r *gin.RouterGroup, cfg common.OpenshiftConfig) error {
+	config = cfg
+	if err := registerClusters(cfg); err != nil {
+		return err
+	}
+	var err error
+	if quotaRequests, err = newQuotaRequestStore(cfg.QuotaRequestFile); err != nil {
+		return err
+	}
+	if err = registerCredentialSinks(cfg); err != nil {
+		return err
+	}
+
+	// Every route works on the cluster of the query parameter 'cluster'
+	o := r.Group("/ose", clusterMiddleware)
+
 	// OpenShift
-	r.POST("/ose/project", newProjectHandler)
-	r.GET("/ose/project/:project/admins", getProjectAdminsHandler)
-	r.POST("/ose/testproject", newTestProjectHandler)
-	r.POST("/ose/serviceaccount", newServiceAccountHandler)
-	r.GET("/ose/billing/:project", getBillingHandler)
-	r.POST("/ose/billing", updateBillingHandler)
-	r.POST("/ose/quotas", editQuotasHandler)
+	o.GET("/clusters", getClustersHandler)
+	o.GET("/projecttemplates", getProjectTemplatesHandler)
+	o.POST("/project", newProjectHandler)
+	o.DELETE("/project/:project", deleteProjectHandler)
+	o.GET("/project/:project/admins", getProjectAdminsHandler)
+	o.POST("/project/:project/admins", addProjectAdminHandler)
+	o.DELETE("/project/:project/admins", removeProjectAdminHandler)
+	o.GET("/project/:project/volumes", getProjectVolumesHandler)
+	o.POST("/testproject", newTestProjectHandler)
+	o.POST("/testproject/extend", extendTestProjectHandler)
+	o.POST("/serviceaccount", newServiceAccountHandler)
+	o.GET("/project/:project/serviceaccounts", getServiceAccountsHandler)
+	o.POST("/project/:project/serviceaccounts/:serviceaccount/rotate", rotateServiceAccountTokenHandler)
+	o.DELETE("/project/:project/serviceaccounts/:serviceaccount", deleteServiceAccountHandler)
+	o.GET("/billing/report", common.RequireRole(common.RoleBillingAdmin), getBillingReportHandler)
+	o.GET("/billing/:project", getBillingHandler)
+	o.POST("/billing", updateBillingHandler)
+	o.GET("/quotas/:project", getQuotasHandler)
+	o.POST("/quotas", editQuotasHandler)
+	o.GET("/quotarequests", common.RequireRole(common.RolePlatformAdmin), getQuotaRequestsHandler)
+	o.POST("/quotarequests/:id/approve", common.RequireRole(common.RolePlatformAdmin), approveQuotaRequestHandler)
+	o.POST("/quotarequests/:id/reject", common.RequireRole(common.RolePlatformAdmin), rejectQuotaRequestHandler)
 
 	// Volumes (Gluster and NFS)
-	r.POST("/ose/volume", newVolumeHandler)
-	r.POST("/ose/volume/grow", growVolumeHandler)
-	r.POST("/ose/volume/gluster/fix", fixVolumeHandler)
-	// Get job status for NFS volumes because it takes a while
-	r.GET("/ose/volume/jobs/:job", jobStatusHandler)
+	if config.VolumesEnabled() {
+		o.POST("/volume", newVolumeHandler)
+		o.DELETE("/volume", deleteVolumeHandler)
+		o.POST("/volume/grow", growVolumeHandler)
+		o.POST("/volume/gluster/fix", fixVolumeHandler)
+	}
+
+	return nil
 }
 
+// RegisterSecRoutes registers the routes of the secure api (basic auth)
 func RegisterSecRoutes(r *gin.RouterGroup) {
-	r.POST("/gluster/volume/fix", fixVolumeHandler)
+	for _, c := range clusters {
+		if len(c.Gluster.APIURL) > 0 {
+			r.POST("/gluster/volume/fix", clusterMiddleware, fixVolumeHandler)
+			return
+		}
+	}
 }
 
-func getProjectAdminsAndOperators(project string) ([]string, []string, error) {
-	policyBindings, err := getPolicyBindings(project)
+// getProjectAdminsAndOperators returns the admin users of the project and the members of its admin groups
+func getProjectAdminsAndOperators(ctx context.Context, project string) ([]string, []string, error) {
+	projectAdmins, err := getProjectAdmins(ctx, project)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	children, err := policyBindings.S("roleBindings").Children()
-	if err != nil {
-		log.Println("Unable to parse roleBindings", err.Error())
-		return nil, nil, errors.New(genericAPIError)
-	}
-
 	var admins []string
-	hasOperatorGroup := false
-	for _, v := range children {
-		if v.Path("name").Data().(string) == "admin" {
-			groups, err := v.Path("roleBinding.groupNames").Children()
-			if err == nil {
-				for _, g := range groups {
-					if strings.ToLower(g.Data().(string)) == "operator" {
-						hasOperatorGroup = true
-					}
-				}
-			}
-			usernames, err := v.Path("roleBinding.userNames").Children()
-			if err != nil {
-				log.Println("Unable to parse roleBinding", err.Error())
-				return nil, nil, errors.New(genericAPIError)
-			}
-			for _, u := range usernames {
-				admins = append(admins, strings.ToLower(u.Data().(string)))
-			}
-		}
+	for _, u := range projectAdmins.Users {
+		admins = append(admins, strings.ToLower(u))
 	}
 
 	var operators []string
-	if hasOperatorGroup {
-		// Going to add the operator group to the admins
-		json, err := getOperatorGroup()
-		if err != nil {
-			return nil, nil, err
+	for _, g := range projectAdmins.Groups {
+		// Groups of OpenShift itself, e.g. all service accounts, have no members
+		if strings.HasPrefix(g, "system:") {
+			continue
 		}
 
-		users, err := json.Path("users").Children()
+		group, err := ose(ctx).GetGroup(ctx, g)
+		if IsNotFound(err) {
+			common.Logger(ctx).WithFields(logrus.Fields{"project": project, "group": g}).Warn("Admin group of the project does not exist")
+			continue
+		}
 		if err != nil {
-			log.Println("Could not parse operator group:", json, err.Error())
+			common.Logger(ctx).WithError(err).WithField("group", g).Error("Error getting the admin group")
 			return nil, nil, errors.New(genericAPIError)
 		}
 
-		for _, u := range users {
-			operators = append(operators, strings.ToLower(u.Data().(string)))
+		for _, u := range group.Users {
+			operators = append(operators, strings.ToLower(u))
 		}
 	}
 
 	return admins, operators, nil
 }
 
-func checkAdminPermissions(username string, project string) error {
+func checkAdminPermissions(ctx context.Context, username string, project string) error {
 	// Check if user has admin-access
 	hasAccess := false
-	admins, operators, err := getProjectAdminsAndOperators(project)
+	admins, operators, err := getProjectAdminsAndOperators(ctx, project)
 	if err != nil {
 		return err
 	}
@@ -124,7 +146,7 @@ func checkAdminPermissions(username string, project string) error {
 		}
 	}
 
-	// Access for operators
+	// Access for members of the admin groups
 	for _, o := range operators {
 		if username == o {
 			hasAccess = true
@@ -138,169 +160,57 @@ func checkAdminPermissions(username string, project string) error {
 	return fmt.Errorf("Du hast keine Admin Rechte auf dem Projekt. Bestehende Admins sind folgende Benutzer: %v", strings.Join(admins, ", "))
 }
 
-func getOperatorGroup() (*gabs.Container, error) {
-	client, req := getOseHTTPClient("GET", "oapi/v1/groups/operator", nil)
-	resp, err := client.Do(req)
-
-	if err != nil {
-		log.Println("Error from OpenShift API: ", err.Error())
-		return nil, errors.New(genericAPIError)
-	}
+func getWZUBackendClient(ctx context.Context, method string, endUrl string, body io.Reader) (*http.Client, *http.Request) {
+	req, _ := http.NewRequest(method, config.WZUBackend.URL+"/"+endUrl, body)
 
-	defer resp.Body.Close()
+	common.Logger(ctx).WithField("url", req.URL.String()).Debug("Calling backend")
+	common.SetRequestIDHeader(ctx, req)
 
-	json, err := gabs.ParseJSONBuffer(resp.Body)
-	if err != nil {
-		log.Println("error parsing body of response:", err)
-		return nil, errors.New(genericAPIError)
-	}
+	req.SetBasicAuth("CLOUD_SSP", config.WZUBackend.Secret)
 
-	return json, nil
+	return wzuClient, req
 }
 
-func getPolicyBindings(project string) (*gabs.Container, error) {
-	client, req := getOseHTTPClient("GET", "oapi/v1/namespaces/"+project+"/policybindings/:default", nil)
-	resp, err := client.Do(req)
-
-	if err != nil {
-		log.Println("Error from OpenShift API: ", err.Error())
-		return nil, errors.New(genericAPIError)
+// getGlusterHTTPClient returns the client and the request for the gluster api of the cluster
+func getGlusterHTTPClient(ctx context.Context, method string, url string, body io.Reader) (*http.Client, *http.Request, error) {
+	cluster := getCluster(ctx)
+	if cluster.glusterClient == nil {
+		return nil, nil, fmt.Errorf("Gluster ist auf dem Cluster %v nicht konfiguriert", cluster.Name)
 	}
 
-	defer resp.Body.Close()
-
-	if resp.StatusCode == 404 {
-		log.Println("Project was not found", project)
-		return nil, errors.New("Das Projekt existiert nicht")
-	}
-
-	json, err := gabs.ParseJSONBuffer(resp.Body)
+	req, err := http.NewRequest(method, fmt.Sprintf("%v/%v", cluster.Gluster.APIURL, url), body)
 	if err != nil {
-		log.Println("error parsing body of response:", err)
-		return nil, errors.New(genericAPIError)
-	}
-
-	return json, nil
-}
-
-func getOseAddress(end string) string {
-	base := os.Getenv("OPENSHIFT_API")
-
-	if len(base) == 0 {
-		log.Fatal("Env variable 'OPENSHIFT_API' must be specified")
-	}
-
-	return base + "/" + end
-}
-
-func getOseHTTPClient(method string, endURL string, body io.Reader) (*http.Client, *http.Request) {
-	token := os.Getenv("OPENSHIFT_TOKEN")
-	if len(token) == 0 {
-		log.Fatal("Env variable 'OPENSHIFT_TOKEN' must be specified")
-	}
-
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	}
-	client := &http.Client{Transport: tr}
-
-	req, _ := http.NewRequest(method, getOseAddress(endURL), body)
-
-	if common.DebugMode() {
-		log.Print("Calling ", req.URL.String())
-	}
-
-	req.Header.Add("Authorization", "Bearer "+token)
-
-	return client, req
-}
-
-func getWZUBackendClient(method string, endUrl string, body io.Reader) (*http.Client, *http.Request) {
-	wzuBackendUrl := os.Getenv("WZUBACKEND_URL")
-	wzuBackendSecret := os.Getenv("WZUBACKEND_SECRET")
-	if len(wzuBackendUrl) == 0 || len(wzuBackendSecret) == 0 {
-		log.Fatal("Env variable 'wzuBackendUrl' and 'WZUBACKEND_SECRET' must be specified")
-	}
-
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	}
-	client := &http.Client{Transport: tr}
-	req, _ := http.NewRequest(method, wzuBackendUrl+"/"+endUrl, body)
-
-	if common.DebugMode() {
-		log.Print("Calling ", req.URL.String())
-	}
-
-	req.SetBasicAuth("CLOUD_SSP", wzuBackendSecret)
-
-	return client, req
-}
-
-func getGlusterHTTPClient(url string, body io.Reader) (*http.Client, *http.Request) {
-	apiUrl := os.Getenv("GLUSTER_API_URL")
-	apiSecret := os.Getenv("GLUSTER_SECRET")
-
-	if len(apiUrl) == 0 || len(apiSecret) == 0 {
-		log.Fatal("Env variables 'GLUSTER_API_URL' and 'GLUSTER_SECRET' must be specified")
+		common.Logger(ctx).WithError(err).Error("Error creating the gluster request")
+		return nil, nil, errors.New(genericAPIError)
 	}
 
-	client := &http.Client{}
-	req, _ := http.NewRequest("POST", fmt.Sprintf("%v/%v", apiUrl, url), body)
+	common.Logger(ctx).WithField("url", req.URL.String()).Debug("Calling backend")
+	common.SetRequestIDHeader(ctx, req)
 
-	if common.DebugMode() {
-		log.Printf("Calling %v", req.URL.String())
-	}
+	req.SetBasicAuth("GLUSTER_API", cluster.Gluster.Secret)
 
-	req.SetBasicAuth("GLUSTER_API", apiSecret)
-
-	return client, req
+	return cluster.glusterClient, req, nil
 }
 
-func getNfsHTTPClient(method string, apiPath string, body io.Reader) (*http.Client, *http.Request) {
-	apiUrl := os.Getenv("NFS_API_URL")
-	apiSecret := os.Getenv("NFS_API_SECRET")
-	nfsProxy := os.Getenv("NFS_PROXY")
-
-	if len(apiUrl) == 0 || len(apiSecret) == 0 || len(nfsProxy) == 0 {
-		log.Fatal("Env variables 'NFS_PROXY', 'NFS_API_URL' and 'NFS_API_SECRET' must be specified")
-	}
-
-	// Create http client with proxy:
-	// https://blog.abhi.host/blog/2016/02/27/golang-creating-https-connection-via/
-	proxyURL, err := url.Parse(nfsProxy)
-	if err != nil {
-		log.Printf(err.Error())
-	}
-
-	transport := http.Transport{
-		Proxy:           http.ProxyURL(proxyURL),
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+// getNfsHTTPClient returns the client and the request for the nfs api of the cluster
+func getNfsHTTPClient(ctx context.Context, method string, apiPath string, body io.Reader) (*http.Client, *http.Request, error) {
+	cluster := getCluster(ctx)
+	if cluster.nfsClient == nil {
+		return nil, nil, fmt.Errorf("NFS ist auf dem Cluster %v nicht konfiguriert", cluster.Name)
 	}
 
-	client := &http.Client{Transport: &transport}
-	req, err := http.NewRequest(method, fmt.Sprintf("%v/%v", apiUrl, apiPath), body)
+	req, err := http.NewRequest(method, fmt.Sprintf("%v/%v", cluster.Nfs.APIURL, apiPath), body)
 	if err != nil {
-		log.Printf(err.Error())
+		common.Logger(ctx).WithError(err).Error("Error creating the nfs request")
+		return nil, nil, errors.New(genericAPIError)
 	}
 
-	if common.DebugMode() {
-		log.Printf("Calling %v", req.URL.String())
-	}
+	common.Logger(ctx).WithField("url", req.URL.String()).Debug("Calling backend")
+	common.SetRequestIDHeader(ctx, req)
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Accept", "application/json")
-	req.SetBasicAuth("sbb_openshift", apiSecret)
-
-	return client, req
-}
-
-func newObjectRequest(kind string, name string) *gabs.Container {
-	json := gabs.New()
-
-	json.Set(kind, "kind")
-	json.Set("v1", "apiVersion")
-	json.SetP(name, "metadata.name")
+	req.SetBasicAuth("sbb_openshift", cluster.Nfs.Secret)
 
-	return json
+	return cluster.nfsClient, req, nil
 }
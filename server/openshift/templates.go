@@ -0,0 +1,204 @@
+package openshift
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultProjectTemplate is used for projects without template, if it is configured
+const defaultProjectTemplate = "default"
+
+func getProjectTemplatesHandler(c *gin.Context) {
+	result := []common.ProjectTemplateInfo{}
+	for name, t := range config.ProjectTemplates {
+		result = append(result, common.ProjectTemplateInfo{Name: name, Description: t.Description})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	c.JSON(http.StatusOK, result)
+}
+
+// getProjectTemplate returns the template of the name, or the default template if the name is empty.
+// It returns nil if there is no default template.
+func getProjectTemplate(name string) (*common.ProjectTemplate, error) {
+	if len(name) == 0 {
+		if t, ok := config.ProjectTemplates[defaultProjectTemplate]; ok {
+			return &t, nil
+		}
+		return nil, nil
+	}
+
+	t, ok := config.ProjectTemplates[name]
+	if !ok {
+		return nil, fmt.Errorf("Die Projektvorlage %v existiert nicht", name)
+	}
+	return &t, nil
+}
+
+// applyProjectTemplate creates the resources of the template in the new project.
+// Resources which already exist, e.g. from the project template of OpenShift itself, are kept.
+func applyProjectTemplate(ctx context.Context, project string, template *common.ProjectTemplate) error {
+	if len(template.Labels) > 0 {
+		if err := ose(ctx).PatchNamespaceLabels(ctx, project, template.Labels); err != nil {
+			common.Logger(ctx).WithError(err).Error("Error setting the labels of the project")
+			return errors.New(genericAPIError)
+		}
+	}
+
+	if err := applyTemplateQuotas(ctx, project, template.ResourceQuotas); err != nil {
+		return err
+	}
+
+	for _, l := range template.LimitRanges {
+		limitRange := &LimitRange{Metadata: ObjectMeta{Name: l.Name, Namespace: project}}
+		for _, item := range l.Limits {
+			limitRange.Spec.Limits = append(limitRange.Spec.Limits, LimitRangeItem{
+				Type:           item.Type,
+				Max:            item.Max,
+				Min:            item.Min,
+				Default:        item.Default,
+				DefaultRequest: item.DefaultRequest,
+			})
+		}
+		if err := createTemplateObject(ctx, "limitrange", l.Name, ose(ctx).CreateLimitRange(ctx, limitRange)); err != nil {
+			return err
+		}
+	}
+
+	for _, n := range template.NetworkPolicies {
+		policy := &NetworkPolicy{
+			Metadata: ObjectMeta{Name: n.Name, Namespace: project},
+			Spec:     jsonMap(n.Spec),
+		}
+		if err := createTemplateObject(ctx, "networkpolicy", n.Name, ose(ctx).CreateNetworkPolicy(ctx, policy)); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range template.ServiceAccounts {
+		sa := &ServiceAccount{Metadata: ObjectMeta{Name: name, Namespace: project}}
+		if err := createTemplateObject(ctx, "serviceaccount", name, ose(ctx).CreateServiceAccount(ctx, sa)); err != nil {
+			return err
+		}
+	}
+
+	if len(template.RoleBindings) > 0 {
+		rbac, err := hasRBAC(ctx)
+		if err != nil {
+			return err
+		}
+		if !rbac {
+			return errors.New("Rollen aus Projektvorlagen benötigen die RBAC-API von OpenShift 3.7")
+		}
+	}
+	for _, r := range template.RoleBindings {
+		binding := &RoleBinding{
+			Metadata: ObjectMeta{Name: r.Name, Namespace: project},
+			RoleRef:  RoleRef{APIGroup: rbacGroup, Kind: "ClusterRole", Name: r.Role},
+		}
+		for _, u := range r.Users {
+			binding.Subjects = append(binding.Subjects, Subject{Kind: "User", APIGroup: rbacGroup, Name: u})
+		}
+		for _, g := range r.Groups {
+			binding.Subjects = append(binding.Subjects, Subject{Kind: "Group", APIGroup: rbacGroup, Name: g})
+		}
+		for _, sa := range r.ServiceAccounts {
+			binding.Subjects = append(binding.Subjects, Subject{Kind: "ServiceAccount", Name: sa, Namespace: project})
+		}
+		if err := createTemplateObject(ctx, "rolebinding", r.Name, ose(ctx).CreateRoleBinding(ctx, binding)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyTemplateQuotas updates the quotas of the same name or creates them
+func applyTemplateQuotas(ctx context.Context, project string, templateQuotas []common.ProjectTemplateQuota) error {
+	if len(templateQuotas) == 0 {
+		return nil
+	}
+
+	quotas, err := ose(ctx).ListResourceQuotas(ctx, project)
+	if err != nil {
+		common.Logger(ctx).WithError(err).Error(getQuotasApiError)
+		return errors.New(genericAPIError)
+	}
+
+	for _, t := range templateQuotas {
+		var existing *ResourceQuota
+		for i := range quotas {
+			if quotas[i].Metadata.Name == t.Name {
+				existing = &quotas[i]
+			}
+		}
+
+		if existing == nil {
+			quota := &ResourceQuota{
+				Metadata: ObjectMeta{Name: t.Name, Namespace: project},
+				Spec:     ResourceQuotaSpec{Hard: t.Hard, Scopes: t.Scopes},
+			}
+			err = ose(ctx).CreateResourceQuota(ctx, quota)
+		} else {
+			// Only the limits of the template are sent, so the other limits and the scopes of the quota are kept
+			err = ose(ctx).PatchResourceQuotaHard(ctx, project, existing.Metadata.Name, t.Hard)
+		}
+		if err != nil {
+			common.Logger(ctx).WithError(err).WithField("resourcequota", t.Name).Error("Error applying the quota of the project template")
+			return errors.New(genericAPIError)
+		}
+	}
+	return nil
+}
+
+// createTemplateObject checks the result of the creation of an object of the template
+func createTemplateObject(ctx context.Context, kind string, name string, err error) error {
+	if IsConflict(err) {
+		common.Logger(ctx).WithFields(logrus.Fields{"kind": kind, "name": name}).Info("Object of the project template already existed, skipping")
+		return nil
+	}
+	if err != nil {
+		common.Logger(ctx).WithError(err).WithFields(logrus.Fields{"kind": kind, "name": name}).Error("Error creating the object of the project template")
+		return errors.New(genericAPIError)
+	}
+	return nil
+}
+
+// jsonMap converts the maps of a yaml config, which have interface keys, so they can be sent as json
+func jsonMap(m map[string]interface{}) map[string]interface{} {
+	result := map[string]interface{}{}
+	for k, v := range m {
+		result[k] = jsonValue(v)
+	}
+	return result
+}
+
+func jsonValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for k, value := range t {
+			m[fmt.Sprint(k)] = jsonValue(value)
+		}
+		return m
+	case map[string]interface{}:
+		return jsonMap(t)
+	case []interface{}:
+		// An empty list has a meaning, e.g. no allowed ingress
+		list := []interface{}{}
+		for _, value := range t {
+			list = append(list, jsonValue(value))
+		}
+		return list
+	default:
+		return v
+	}
+}
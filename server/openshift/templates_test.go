@@ -0,0 +1,101 @@
+package openshift
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
+	"gopkg.in/yaml.v2"
+)
+
+const testProjectTemplates = `
+team:
+  description: Projekt für ein Team
+  labels:
+    team: a
+  resourceQuotas:
+  - name: default
+    hard:
+      pods: "20"
+  - name: terminating
+    scopes: [Terminating]
+    hard:
+      pods: "5"
+  limitRanges:
+  - name: limits
+    limits:
+    - type: Container
+      default:
+        memory: 512Mi
+  networkPolicies:
+  - name: deny-other-namespaces
+    spec:
+      podSelector: {}
+      ingress:
+      - from:
+        - podSelector: {}
+  serviceAccounts: [deployer-ci]
+  roleBindings:
+  - name: ci-edit
+    role: edit
+    groups: [team-a]
+    serviceAccounts: [deployer-ci]
+`
+
+func setupTemplates(t *testing.T) {
+	var templates map[string]common.ProjectTemplate
+	ok(t, yaml.Unmarshal([]byte(testProjectTemplates), &templates))
+	config.ProjectTemplates = templates
+}
+
+func TestNewProjectWithTemplate(t *testing.T) {
+	fake, router := setupFake("u123456")
+	setupTemplates(t)
+
+	code, msg := call(router, "POST", "/api/ose/project", common.NewProjectCommand{ProjectName: common.ProjectName{Project: "team-project"}, Billing: "psp", Template: "team"})
+	equals(t, http.StatusOK, code)
+	equals(t, "Das Projekt team-project wurde erstellt", msg)
+
+	equals(t, map[string]string{"team": "a"}, fake.namespaces["team-project"].Metadata.Labels)
+	quotas := fake.quotas["team-project"]
+	equals(t, 2, len(quotas))
+	equals(t, map[string]string{"cpu": "2", "memory": "4Gi", "pods": "20"}, quotas[0].Spec.Hard)
+	equals(t, []string{"Terminating"}, quotas[1].Spec.Scopes)
+	equals(t, "512Mi", fake.limitRanges["team-project"][0].Spec.Limits[0].Default["memory"])
+
+	policy := fake.networkPolicies["team-project"][0]
+	equals(t, map[string]interface{}{
+		"podSelector": map[string]interface{}{},
+		"ingress":     []interface{}{map[string]interface{}{"from": []interface{}{map[string]interface{}{"podSelector": map[string]interface{}{}}}}},
+	}, policy.Spec)
+
+	assert(t, fake.serviceAccounts["team-project"]["deployer-ci"] != nil, "Service account of the template should be created")
+	var binding *RoleBinding
+	for i, b := range fake.roleBindings["team-project"] {
+		if b.Metadata.Name == "ci-edit" {
+			binding = &fake.roleBindings["team-project"][i]
+		}
+	}
+	assert(t, binding != nil, "Role binding of the template should be created")
+	equals(t, []Subject{
+		{Kind: "Group", APIGroup: rbacGroup, Name: "team-a"},
+		{Kind: "ServiceAccount", Name: "deployer-ci", Namespace: "team-project"},
+	}, binding.Subjects)
+}
+
+func TestNewProjectTemplateRollback(t *testing.T) {
+	fake, router := setupFake("u123456")
+	setupTemplates(t)
+
+	code, msg := call(router, "POST", "/api/ose/project", common.NewProjectCommand{ProjectName: common.ProjectName{Project: "project"}, Billing: "psp", Template: "missing"})
+	equals(t, http.StatusBadRequest, code)
+	equals(t, "Die Projektvorlage missing existiert nicht", msg)
+	assert(t, fake.namespaces["project"] == nil, "No project should be created for an unknown template")
+
+	fake.failing["CreateNetworkPolicy"] = errors.New("forbidden")
+	code, msg = call(router, "POST", "/api/ose/project", common.NewProjectCommand{ProjectName: common.ProjectName{Project: "project"}, Billing: "psp", Template: "team"})
+	equals(t, http.StatusBadRequest, code)
+	equals(t, "Das Projekt project konnte nicht eingerichtet werden und wurde wieder gelöscht: "+genericAPIError, msg)
+	assert(t, fake.namespaces["project"] == nil, "Project should be deleted after a failed setup")
+}
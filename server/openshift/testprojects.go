@@ -0,0 +1,241 @@
+package openshift
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	testProjectDeletionAnnotation = "openshift.io/testproject-daystodeletion"
+	// testProjectWarnedAnnotation is the deletion date announced to the requester. Older projects have "true".
+	testProjectWarnedAnnotation = "openshift.io/testproject-deletion-warned"
+	requesterAnnotation         = "openshift.io/requester"
+	requesterMailAnnotation     = "openshift.io/requester-mail"
+	testProjectWarningDays      = 7
+	// testProjectMaxDays is the longest lifetime of a test project, it can't be extended beyond
+	testProjectMaxDays        = 90
+	testProjectReaperInterval = time.Hour
+	testProjectReaperUser     = "testproject-reaper"
+	dateFormat                = "02.01.2006"
+)
+
+func extendTestProjectHandler(c *gin.Context) {
+	username := common.GetUserName(c)
+
+	var data common.ExtendTestProjectCommand
+	if c.BindJSON(&data) == nil {
+		if err := validateAdminAccess(c, username, data.Project); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
+			return
+		}
+
+		if expiry, err := extendTestProject(c, data.Project, username); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
+		} else {
+			c.JSON(http.StatusOK, common.ApiResponse{
+				Message: fmt.Sprintf("Das Test-Projekt %v wird neu am %v gelöscht", data.Project, expiry.Format(dateFormat)),
+			})
+		}
+	} else {
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, wrongAPIUsageError))
+	}
+}
+
+// StartTestProjectReaper deletes expired test projects in the background
+// and warns their requesters some days before the deletion
+func StartTestProjectReaper() {
+	go func() {
+		for {
+			for _, cl := range clusters {
+				reapTestProjects(withCluster(context.Background(), cl))
+			}
+			time.Sleep(testProjectReaperInterval)
+		}
+	}()
+}
+
+func reapTestProjects(ctx context.Context) {
+	namespaces, err := getNamespaces(ctx)
+	if err != nil {
+		common.Logger(ctx).WithError(err).WithField("cluster", getCluster(ctx).ID).Error("Test project reaper could not list the namespaces")
+		return
+	}
+
+	now := time.Now()
+	for _, ns := range namespaces {
+		project := ns.Metadata.Name
+		annotations := ns.Metadata.Annotations
+
+		days, ok := annotations[testProjectDeletionAnnotation]
+		if !ok {
+			continue
+		}
+
+		expiry, err := getTestProjectExpiry(ns.Metadata.CreationTimestamp, days)
+		if err != nil {
+			common.Logger(ctx).WithError(err).WithField("project", project).Error("Unable to calculate expiry of test project")
+			continue
+		}
+
+		// A project is only deleted after its requester was warned, e.g. existing projects when the reaper is introduced
+		deletion, warned := getAnnouncedDeletion(annotations[testProjectWarnedAnnotation], expiry)
+		if warned && now.After(expiry) && now.After(deletion) {
+			common.Logger(ctx).WithFields(logrus.Fields{"project": project, "expiry": expiry}).Info("Test project expired, going to delete it")
+			if err := deleteProject(ctx, project, testProjectReaperUser); err != nil {
+				common.Logger(ctx).WithError(err).WithField("project", project).Error("Test project reaper could not delete the project")
+			}
+			continue
+		}
+
+		if !warned && expiry.Sub(now) < testProjectWarningDays*24*time.Hour {
+			// The requester always gets the days of the warning, even if the project is already expired
+			deletion := now.Add(testProjectWarningDays * 24 * time.Hour)
+			if err := sendTestProjectWarning(ctx, project, annotations, deletion); err != nil {
+				// The project is kept until its requester could be warned
+				common.Logger(ctx).WithError(err).WithField("project", project).Error("Unable to warn the requester of the test project")
+				continue
+			}
+			if err := updateProjectAnnotations(ctx, project, map[string]string{testProjectWarnedAnnotation: deletion.Format(time.RFC3339)}, nil); err != nil {
+				common.Logger(ctx).WithError(err).WithField("project", project).Error("Unable to mark test project as warned")
+			}
+		}
+	}
+}
+
+// getAnnouncedDeletion returns the deletion date of the warning and whether the requester was warned.
+// Older warnings have no date, they were sent before the expiry of the project.
+func getAnnouncedDeletion(warned string, expiry time.Time) (time.Time, bool) {
+	if len(warned) == 0 {
+		return time.Time{}, false
+	}
+	deletion, err := time.Parse(time.RFC3339, warned)
+	if err != nil {
+		return expiry, true
+	}
+	return deletion, true
+}
+
+// getTestProjectExpiry returns the point in time when a test project expires,
+// based on its creation timestamp and the days until deletion
+func getTestProjectExpiry(creationTimestamp string, daysToDeletion string) (time.Time, error) {
+	created, err := time.Parse(time.RFC3339, creationTimestamp)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	days, err := strconv.Atoi(daysToDeletion)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return created.AddDate(0, 0, days), nil
+}
+
+// sendMail sends the warnings, the tests replace it
+var sendMail = common.SendMail
+
+// sendTestProjectWarning warns the requester of the test project by mail.
+// Projects from before the mail annotation are warned at the mail of the requester in the directory.
+func sendTestProjectWarning(ctx context.Context, project string, annotations map[string]string, deletion time.Time) error {
+	mail := annotations[requesterMailAnnotation]
+	if len(mail) == 0 {
+		var err error
+		if mail, err = common.LookupUserMail(annotations[requesterAnnotation]); err != nil {
+			return err
+		}
+	}
+
+	subject := fmt.Sprintf("Dein Testprojekt %v wird bald gelöscht", project)
+	body := fmt.Sprintf("Hallo\n\nDein Testprojekt %v wird am %v automatisch gelöscht.\n"+
+		"Du kannst die Laufzeit im Self-Service-Portal verlängern.\n", project, deletion.Format(dateFormat))
+
+	if err := sendMail(mail, subject, body); err != nil {
+		return err
+	}
+
+	common.Logger(ctx).WithFields(logrus.Fields{"project": project, "mail": mail}).Info("Sent deletion warning for test project")
+	return nil
+}
+
+func extendTestProject(ctx context.Context, project string, username string) (time.Time, error) {
+	namespace, err := getNamespace(ctx, project)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if _, ok := namespace.Metadata.Annotations[testProjectDeletionAnnotation]; !ok {
+		return time.Time{}, errors.New("Das Projekt ist kein Test-Projekt")
+	}
+
+	created, err := time.Parse(time.RFC3339, namespace.Metadata.CreationTimestamp)
+	if err != nil {
+		common.Logger(ctx).WithError(err).WithField("project", project).Error("Unable to parse creationTimestamp of project")
+		return time.Time{}, errors.New(genericAPIError)
+	}
+
+	// The project will live for the full period again, starting from today, but not longer than the maximum
+	days := int(math.Ceil(time.Since(created).Hours()/24)) + testProjectDeletionDays
+	if days > testProjectMaxDays {
+		days = testProjectMaxDays
+	}
+	if current, err := strconv.Atoi(namespace.Metadata.Annotations[testProjectDeletionAnnotation]); err == nil && current >= days {
+		return time.Time{}, fmt.Errorf("Ein Test-Projekt kann höchstens %v Tage bestehen. Bitte erstelle ein Projekt mit Kontierungsnummer", testProjectMaxDays)
+	}
+	expiry := created.AddDate(0, 0, days)
+
+	annotations := map[string]string{
+		testProjectDeletionAnnotation: strconv.Itoa(days),
+		"openshift.io/description":    fmt.Sprintf("Dieses Testprojekt wird am %v automatisch gelöscht!", expiry.Format(dateFormat)),
+	}
+	if err := updateProjectAnnotations(ctx, project, annotations, []string{testProjectWarnedAnnotation}); err != nil {
+		return time.Time{}, err
+	}
+
+	common.Logger(ctx).WithFields(logrus.Fields{"user": username, "project": project, "expiry": expiry}).Info("Extended the test project")
+	return expiry, nil
+}
+
+func getNamespaces(ctx context.Context) ([]Namespace, error) {
+	namespaces, err := ose(ctx).ListNamespaces(ctx)
+	if err != nil {
+		common.Logger(ctx).WithError(err).Error("Error getting the namespaces")
+		return nil, errors.New(genericAPIError)
+	}
+
+	return namespaces, nil
+}
+
+func getNamespace(ctx context.Context, project string) (*Namespace, error) {
+	namespace, err := ose(ctx).GetNamespace(ctx, project)
+	if IsNotFound(err) {
+		return nil, errors.New("Das Projekt existiert nicht")
+	}
+	if err != nil {
+		common.Logger(ctx).WithError(err).Error("Error getting the namespace")
+		return nil, errors.New(genericAPIError)
+	}
+
+	return namespace, nil
+}
+
+func updateProjectAnnotations(ctx context.Context, project string, set map[string]string, remove []string) error {
+	err := ose(ctx).PatchNamespaceAnnotations(ctx, project, set, remove)
+	if IsNotFound(err) {
+		return errors.New("Das Projekt existiert nicht")
+	}
+	if err != nil {
+		common.Logger(ctx).WithError(err).Error("Error updating project annotations")
+		return errors.New(genericAPIError)
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package openshift
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
+)
+
+// addTestProject adds a test project created the given days ago, which expires after the given days
+func addTestProject(fake *fakeClient, name string, age int, days int) {
+	fake.addProject(name, "u123456")
+	ns := fake.namespaces[name]
+	ns.Metadata.CreationTimestamp = time.Now().AddDate(0, 0, -age).UTC().Format(time.RFC3339)
+	ns.Metadata.Annotations[testProjectDeletionAnnotation] = strconv.Itoa(days)
+	ns.Metadata.Annotations[requesterAnnotation] = "u123456"
+	ns.Metadata.Annotations[requesterMailAnnotation] = name + "@example.com"
+}
+
+// fakeMail records the recipients of the sent mails
+func fakeMail(err error) (*[]string, func()) {
+	var sent []string
+	sendMail = func(to string, subject string, body string) error {
+		if err != nil {
+			return err
+		}
+		sent = append(sent, to)
+		return nil
+	}
+	return &sent, func() { sendMail = common.SendMail }
+}
+
+func TestReapTestProjects_Warning(t *testing.T) {
+	fake, _ := setupFake("u123456")
+	sent, restore := fakeMail(nil)
+	defer restore()
+	addTestProject(fake, "old", 100, testProjectDeletionDays)
+	addTestProject(fake, "expiring", 25, testProjectDeletionDays)
+	addTestProject(fake, "new", 1, testProjectDeletionDays)
+
+	// Expired projects which were never warned aren't deleted
+	reapTestProjects(context.Background())
+	equals(t, 2, len(*sent))
+	assert(t, fake.namespaces["old"] != nil, "Unwarned project should be kept")
+	warned := fake.namespaces["old"].Metadata.Annotations[testProjectWarnedAnnotation]
+	deletion, err := time.Parse(time.RFC3339, warned)
+	ok(t, err)
+	assert(t, deletion.After(time.Now().AddDate(0, 0, testProjectWarningDays-1)), "Requester should get the days of the warning")
+
+	assert(t, fake.namespaces["expiring"].Metadata.Annotations[testProjectWarnedAnnotation] != "", "Expiring project should be warned")
+	equals(t, "", fake.namespaces["new"].Metadata.Annotations[testProjectWarnedAnnotation])
+
+	// The announced date is kept
+	reapTestProjects(context.Background())
+	assert(t, fake.namespaces["old"] != nil, "Project should be kept until the announced date")
+	equals(t, warned, fake.namespaces["old"].Metadata.Annotations[testProjectWarnedAnnotation])
+	equals(t, 2, len(*sent))
+}
+
+func TestReapTestProjects_NotWarned(t *testing.T) {
+	fake, _ := setupFake("u123456")
+	_, restore := fakeMail(errors.New("smtp error"))
+	defer restore()
+	addTestProject(fake, "failed", 100, testProjectDeletionDays)
+	// Projects from before the mail annotation need the mail of the requester from the directory
+	addTestProject(fake, "legacy", 100, testProjectDeletionDays)
+	delete(fake.namespaces["legacy"].Metadata.Annotations, requesterMailAnnotation)
+
+	// The projects are kept until their requesters could be warned
+	reapTestProjects(context.Background())
+	reapTestProjects(context.Background())
+	for _, project := range []string{"failed", "legacy"} {
+		assert(t, fake.namespaces[project] != nil, "Unwarned project should be kept")
+		equals(t, "", fake.namespaces[project].Metadata.Annotations[testProjectWarnedAnnotation])
+	}
+}
+
+func TestReapTestProjects_Deletion(t *testing.T) {
+	fake, _ := setupFake("u123456")
+	addTestProject(fake, "announced", 40, testProjectDeletionDays)
+	fake.namespaces["announced"].Metadata.Annotations[testProjectWarnedAnnotation] = time.Now().Add(-time.Hour).Format(time.RFC3339)
+	addTestProject(fake, "legacy", 40, testProjectDeletionDays)
+	fake.namespaces["legacy"].Metadata.Annotations[testProjectWarnedAnnotation] = "true"
+	addTestProject(fake, "extended", 40, testProjectDeletionDays+20)
+	fake.namespaces["extended"].Metadata.Annotations[testProjectWarnedAnnotation] = time.Now().Add(-time.Hour).Format(time.RFC3339)
+
+	reapTestProjects(context.Background())
+	assert(t, fake.namespaces["announced"] == nil, "Announced project should be deleted")
+	assert(t, fake.namespaces["legacy"] == nil, "Warned project should be deleted")
+	assert(t, fake.namespaces["extended"] != nil, "Project should be kept until its expiry")
+}
+
+func TestExtendTestProject(t *testing.T) {
+	fake, router := setupFake("u123456")
+	addTestProject(fake, "test", 25, testProjectDeletionDays)
+	fake.namespaces["test"].Metadata.Annotations[testProjectWarnedAnnotation] = "true"
+
+	code, _ := call(router, "POST", "/api/ose/testproject/extend", common.ExtendTestProjectCommand{ProjectName: common.ProjectName{Project: "test"}})
+	equals(t, http.StatusOK, code)
+	annotations := fake.namespaces["test"].Metadata.Annotations
+	// The started day counts
+	equals(t, strconv.Itoa(26+testProjectDeletionDays), annotations[testProjectDeletionAnnotation])
+	equals(t, "", annotations[testProjectWarnedAnnotation])
+
+	// The extensions end at the maximum lifetime
+	addTestProject(fake, "long", testProjectMaxDays-10, testProjectMaxDays-5)
+	code, _ = call(router, "POST", "/api/ose/testproject/extend", common.ExtendTestProjectCommand{ProjectName: common.ProjectName{Project: "long"}})
+	equals(t, http.StatusOK, code)
+	equals(t, strconv.Itoa(testProjectMaxDays), fake.namespaces["long"].Metadata.Annotations[testProjectDeletionAnnotation])
+
+	code, msg := call(router, "POST", "/api/ose/testproject/extend", common.ExtendTestProjectCommand{ProjectName: common.ProjectName{Project: "long"}})
+	equals(t, http.StatusBadRequest, code)
+	equals(t, "Ein Test-Projekt kann höchstens 90 Tage bestehen. Bitte erstelle ein Projekt mit Kontierungsnummer", msg)
+}
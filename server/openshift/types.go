@@ -0,0 +1,288 @@
+package openshift
+
+// The types contain the fields of the OpenShift objects we work with.
+// Objects which we update with a PUT must have all their fields, otherwise we would delete the missing ones.
+
+// ObjectMeta is the metadata of every OpenShift object
+type ObjectMeta struct {
+	Name              string            `json:"name"`
+	Namespace         string            `json:"namespace,omitempty"`
+	UID               string            `json:"uid,omitempty"`
+	ResourceVersion   string            `json:"resourceVersion,omitempty"`
+	CreationTimestamp string            `json:"creationTimestamp,omitempty"`
+	Labels            map[string]string `json:"labels,omitempty"`
+	Annotations       map[string]string `json:"annotations,omitempty"`
+}
+
+// TypeMeta is the kind and version of an object sent to OpenShift
+type TypeMeta struct {
+	Kind       string `json:"kind,omitempty"`
+	APIVersion string `json:"apiVersion,omitempty"`
+}
+
+func newTypeMeta(kind string) TypeMeta {
+	return TypeMeta{Kind: kind, APIVersion: "v1"}
+}
+
+// Namespace is the kubernetes side of an OpenShift project, it contains the annotations of the project
+type Namespace struct {
+	TypeMeta
+	Metadata ObjectMeta `json:"metadata"`
+}
+
+// ResourceQuota limits the resources of a project
+type ResourceQuota struct {
+	TypeMeta
+	Metadata ObjectMeta         `json:"metadata"`
+	Spec     ResourceQuotaSpec  `json:"spec"`
+	Status   *ResourceQuotaSpec `json:"status,omitempty"`
+}
+
+// ResourceQuotaSpec contains the limited resources, e.g. cpu: 2, memory: 4Gi
+type ResourceQuotaSpec struct {
+	Hard          map[string]string `json:"hard,omitempty"`
+	Used          map[string]string `json:"used,omitempty"`
+	Scopes        []string          `json:"scopes,omitempty"`
+	ScopeSelector *ScopeSelector    `json:"scopeSelector,omitempty"`
+}
+
+// IsScoped returns true if the quota only limits some of the pods, by its scopes or its scope selector
+func (s ResourceQuotaSpec) IsScoped() bool {
+	return len(s.Scopes) > 0 || (s.ScopeSelector != nil && len(s.ScopeSelector.MatchExpressions) > 0)
+}
+
+// ScopeSelector selects the pods of a quota by their scopes, e.g. PriorityClass
+type ScopeSelector struct {
+	MatchExpressions []ScopedResourceSelectorRequirement `json:"matchExpressions,omitempty"`
+}
+
+// ScopedResourceSelectorRequirement is an expression of a scope selector
+type ScopedResourceSelectorRequirement struct {
+	ScopeName string   `json:"scopeName"`
+	Operator  string   `json:"operator"`
+	Values    []string `json:"values,omitempty"`
+}
+
+// NetworkPolicy restricts the network traffic of the pods of a project (networking.k8s.io/v1)
+type NetworkPolicy struct {
+	TypeMeta
+	Metadata ObjectMeta             `json:"metadata"`
+	Spec     map[string]interface{} `json:"spec"`
+}
+
+// LimitRange limits the resources of the pods and containers of a project
+type LimitRange struct {
+	TypeMeta
+	Metadata ObjectMeta     `json:"metadata"`
+	Spec     LimitRangeSpec `json:"spec"`
+}
+
+// LimitRangeSpec contains the limits per type of object
+type LimitRangeSpec struct {
+	Limits []LimitRangeItem `json:"limits"`
+}
+
+// LimitRangeItem are the limits of a type of object, e.g. Container or Pod
+type LimitRangeItem struct {
+	Type                 string            `json:"type"`
+	Max                  map[string]string `json:"max,omitempty"`
+	Min                  map[string]string `json:"min,omitempty"`
+	Default              map[string]string `json:"default,omitempty"`
+	DefaultRequest       map[string]string `json:"defaultRequest,omitempty"`
+	MaxLimitRequestRatio map[string]string `json:"maxLimitRequestRatio,omitempty"`
+}
+
+// PersistentVolume is a volume on gluster or nfs
+type PersistentVolume struct {
+	TypeMeta
+	Metadata ObjectMeta           `json:"metadata"`
+	Spec     PersistentVolumeSpec `json:"spec"`
+}
+
+// PersistentVolumeSpec is the backend and size of a volume
+type PersistentVolumeSpec struct {
+	Capacity                      map[string]string    `json:"capacity,omitempty"`
+	AccessModes                   []string             `json:"accessModes,omitempty"`
+	PersistentVolumeReclaimPolicy string               `json:"persistentVolumeReclaimPolicy,omitempty"`
+	NFS                           *NFSVolumeSource     `json:"nfs,omitempty"`
+	Glusterfs                     *GlusterVolumeSource `json:"glusterfs,omitempty"`
+	ClaimRef                      *ObjectReference     `json:"claimRef,omitempty"`
+}
+
+// NFSVolumeSource is a volume on a nfs server
+type NFSVolumeSource struct {
+	Server string `json:"server"`
+	Path   string `json:"path"`
+}
+
+// GlusterVolumeSource is a volume on gluster, reached by the endpoints in the project
+type GlusterVolumeSource struct {
+	Endpoints string `json:"endpoints"`
+	Path      string `json:"path"`
+	ReadOnly  bool   `json:"readOnly"`
+}
+
+// PersistentVolumeClaim is the claim of a project for a volume
+type PersistentVolumeClaim struct {
+	TypeMeta
+	Metadata ObjectMeta                  `json:"metadata"`
+	Spec     PersistentVolumeClaimSpec   `json:"spec"`
+	Status   PersistentVolumeClaimStatus `json:"status"`
+}
+
+// PersistentVolumeClaimSpec is the requested size of a claim and the volume it is bound to
+type PersistentVolumeClaimSpec struct {
+	AccessModes []string             `json:"accessModes,omitempty"`
+	Resources   ResourceRequirements `json:"resources"`
+	VolumeName  string               `json:"volumeName,omitempty"`
+}
+
+// ResourceRequirements are the requested resources, e.g. storage: 1G
+type ResourceRequirements struct {
+	Requests map[string]string `json:"requests,omitempty"`
+}
+
+// PersistentVolumeClaimStatus is the size of the bound volume
+type PersistentVolumeClaimStatus struct {
+	Phase       string            `json:"phase,omitempty"`
+	AccessModes []string          `json:"accessModes,omitempty"`
+	Capacity    map[string]string `json:"capacity,omitempty"`
+}
+
+// Service is a kubernetes service, we only create the one for gluster
+type Service struct {
+	TypeMeta
+	Metadata ObjectMeta  `json:"metadata"`
+	Spec     ServiceSpec `json:"spec"`
+}
+
+// ServiceSpec contains the ports of a service
+type ServiceSpec struct {
+	Ports []ServicePort `json:"ports"`
+}
+
+// ServicePort is a port of a service
+type ServicePort struct {
+	Port int `json:"port"`
+}
+
+// Endpoints are the ips behind a service
+type Endpoints struct {
+	TypeMeta
+	Metadata ObjectMeta       `json:"metadata"`
+	Subsets  []EndpointSubset `json:"subsets"`
+}
+
+// EndpointSubset is a group of ips with the same ports
+type EndpointSubset struct {
+	Addresses []EndpointAddress `json:"addresses"`
+	Ports     []EndpointPort    `json:"ports"`
+}
+
+// EndpointAddress is the ip of an endpoint
+type EndpointAddress struct {
+	IP string `json:"ip"`
+}
+
+// EndpointPort is the port of an endpoint
+type EndpointPort struct {
+	Port int `json:"port"`
+}
+
+// Pod is a running pod, we only need its volumes
+type Pod struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     PodSpec    `json:"spec"`
+}
+
+// PodSpec contains the volumes of a pod
+type PodSpec struct {
+	Volumes []PodVolume `json:"volumes,omitempty"`
+}
+
+// PodVolume is a volume of a pod, it references a pvc if it is persistent
+type PodVolume struct {
+	Name                  string                    `json:"name"`
+	PersistentVolumeClaim *PersistentVolumeClaimRef `json:"persistentVolumeClaim,omitempty"`
+}
+
+// PersistentVolumeClaimRef references the pvc of a pod volume
+type PersistentVolumeClaimRef struct {
+	ClaimName string `json:"claimName"`
+}
+
+// ServiceAccount is a technical user of a project
+type ServiceAccount struct {
+	TypeMeta
+	Metadata ObjectMeta        `json:"metadata"`
+	Secrets  []ObjectReference `json:"secrets,omitempty"`
+}
+
+// Secret contains the base64 encoded data of a secret, e.g. the token of a service account
+type Secret struct {
+	TypeMeta
+	Metadata ObjectMeta        `json:"metadata"`
+	Type     string            `json:"type,omitempty"`
+	Data     map[string]string `json:"data,omitempty"`
+}
+
+// Group is an OpenShift group of users
+type Group struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Users    []string   `json:"users"`
+}
+
+// ObjectReference references another object, e.g. a secret or the subject of a role binding
+type ObjectReference struct {
+	Kind      string `json:"kind,omitempty"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// PolicyBinding contains all role bindings of a project. It is the legacy api of OpenShift before 3.7.
+type PolicyBinding struct {
+	TypeMeta
+	Metadata     ObjectMeta         `json:"metadata"`
+	LastModified string             `json:"lastModified,omitempty"`
+	PolicyRef    ObjectReference    `json:"policyRef"`
+	RoleBindings []NamedRoleBinding `json:"roleBindings"`
+}
+
+// NamedRoleBinding is a role binding in a policy binding
+type NamedRoleBinding struct {
+	Name        string            `json:"name"`
+	RoleBinding LegacyRoleBinding `json:"roleBinding"`
+}
+
+// LegacyRoleBinding grants a role to users and groups in a policy binding
+type LegacyRoleBinding struct {
+	TypeMeta
+	Metadata   ObjectMeta        `json:"metadata"`
+	UserNames  []string          `json:"userNames"`
+	GroupNames []string          `json:"groupNames"`
+	Subjects   []ObjectReference `json:"subjects"`
+	RoleRef    ObjectReference   `json:"roleRef"`
+}
+
+// RoleBinding grants a role to users and groups (rbac.authorization.k8s.io/v1)
+type RoleBinding struct {
+	TypeMeta
+	Metadata ObjectMeta `json:"metadata"`
+	Subjects []Subject  `json:"subjects"`
+	RoleRef  RoleRef    `json:"roleRef"`
+}
+
+// Subject is a user, group or service account of a role binding
+type Subject struct {
+	Kind      string `json:"kind"`
+	APIGroup  string `json:"apiGroup,omitempty"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// RoleRef references the granted role of a role binding
+type RoleRef struct {
+	APIGroup string `json:"apiGroup"`
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+}
@@ -1,25 +1,25 @@
 package openshift
 
 import (
+	"context"
 	"errors"
 	"net/http"
 
 	"bytes"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"strings"
 	"time"
 
 	"encoding/json"
 
-	"os"
 	"strconv"
 
 	"github.com/Jeffail/gabs"
 	"github.com/SchweizerischeBundesbahnen/ssp-backend/glusterapi/models"
 	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 )
 
 const (
@@ -28,6 +28,8 @@ const (
 	apiCreateWorkflowUuid = "64b3b95b-0d79-4563-8b88-f8c4486b40a0"
 	apiChangeWorkflowUuid = "186b1295-1b82-42e4-b04d-477da967e1d4"
 	apiDeleteWorkflowUuid = "06090103-2313-4ad5-8e89-36d872349eaa"
+	// backendDeletedAnnotation marks a pv whose gluster or nfs volume is already deleted
+	backendDeletedAnnotation = "openshift.io/backend-volume-deleted"
 )
 
 func newVolumeHandler(c *gin.Context) {
@@ -35,47 +37,39 @@ func newVolumeHandler(c *gin.Context) {
 
 	var data common.NewVolumeCommand
 	if c.BindJSON(&data) == nil {
-		if err := validateNewVolume(data.Project, data.Size, data.PvcName, data.Mode, data.Technology, username); err != nil {
-			c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
+		if err := validateNewVolume(c, data.Project, data.Size, data.PvcName, data.Mode, data.Technology, username); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
 			return
 		}
 
-		newVolumeResponse, err := createNewVolume(data.Project, data.Size, data.PvcName, data.Mode, data.Technology, username)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
-			return
-		}
 		if data.Technology == "nfs" {
-			// Don't send a message because this only starts a job
-			// and the client polls the server to get the current progress
-			c.JSON(http.StatusOK, common.NewVolumeApiResponse{
-				Data: *newVolumeResponse,
+			// The nfs workflow takes a while, the client polls the job to get the current progress
+			jobID, err := common.StartJob(c, "volume-create", func(ctx context.Context) (interface{}, error) {
+				return createNewVolume(ctx, data.Project, data.Size, data.PvcName, data.Mode, data.Technology, username)
 			})
-		} else {
-			c.JSON(http.StatusOK, common.NewVolumeApiResponse{
-				Message: "Das Volume wurde erstellt. Deinem Projekt wurde das PVC, und der Gluster Service & Endpunkte hinzugefügt.",
-				Data:    *newVolumeResponse,
+			if err != nil {
+				c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
+				return
+			}
+			c.JSON(http.StatusAccepted, common.JobApiResponse{
+				Message: "Das Volume wird erstellt.",
+				JobID:   jobID,
 			})
+			return
 		}
-	} else {
-		c.JSON(http.StatusBadRequest, common.ApiResponse{Message: wrongAPIUsageError})
-	}
-}
 
-func jobStatusHandler(c *gin.Context) {
-	jobId, err := strconv.Atoi(c.Param("job"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, common.ApiResponse{Message: genericAPIError})
-		return
-	}
-	job, err := getJob(jobId)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
-		return
+		newVolumeResponse, err := createNewVolume(c, data.Project, data.Size, data.PvcName, data.Mode, data.Technology, username)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
+			return
+		}
+		c.JSON(http.StatusOK, common.NewVolumeApiResponse{
+			Message: "Das Volume wurde erstellt. Deinem Projekt wurde das PVC, und der Gluster Service & Endpunkte hinzugefügt.",
+			Data:    *newVolumeResponse,
+		})
+	} else {
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, wrongAPIUsageError))
 	}
-	progress := getJobProgress(*job)
-
-	c.JSON(http.StatusOK, progress)
 }
 
 func fixVolumeHandler(c *gin.Context) {
@@ -83,13 +77,13 @@ func fixVolumeHandler(c *gin.Context) {
 
 	var data common.FixVolumeCommand
 	if c.BindJSON(&data) == nil {
-		if err := validateFixVolume(data.Project, username); err != nil {
-			c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
+		if err := validateFixVolume(c, data.Project, username); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
 			return
 		}
 
-		if err := recreateGlusterObjects(data.Project, username); err != nil {
-			c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
+		if err := recreateGlusterObjects(c, data.Project, username); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
 		} else {
 			c.JSON(http.StatusOK, common.ApiResponse{
 				Message: "Die Gluster-Objekte wurden in deinem Projekt erzeugt.",
@@ -97,7 +91,7 @@ func fixVolumeHandler(c *gin.Context) {
 		}
 
 	} else {
-		c.JSON(http.StatusBadRequest, common.ApiResponse{Message: wrongAPIUsageError})
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, wrongAPIUsageError))
 	}
 }
 
@@ -106,23 +100,90 @@ func growVolumeHandler(c *gin.Context) {
 
 	var data common.GrowVolumeCommand
 	if c.BindJSON(&data) == nil {
-		if err := validateGrowVolume(data.Project, data.NewSize, data.PvName, username); err != nil {
-			c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
+		if err := validateGrowVolume(c, data.Project, data.NewSize, data.PvName, username); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
 			return
 		}
 
-		if err := growExistingVolume(data.Project, data.NewSize, data.PvName, username); err != nil {
-			c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
+		if getPvTechnology(data.PvName) == "nfs" {
+			jobID, err := common.StartJob(c, "volume-grow", func(ctx context.Context) (interface{}, error) {
+				return nil, growExistingVolume(ctx, data.Project, data.NewSize, data.PvName, username)
+			})
+			if err != nil {
+				c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
+			} else {
+				c.JSON(http.StatusAccepted, common.JobApiResponse{Message: "Das Volume wird vergrössert.", JobID: jobID})
+			}
+			return
+		}
+
+		if err := growExistingVolume(c, data.Project, data.NewSize, data.PvName, username); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
 		} else {
 			c.JSON(http.StatusOK, common.ApiResponse{Message: "Das Volume wurde vergrössert."})
 		}
 
 	} else {
-		c.JSON(http.StatusBadRequest, common.ApiResponse{Message: wrongAPIUsageError})
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, wrongAPIUsageError))
+	}
+}
+
+func deleteVolumeHandler(c *gin.Context) {
+	username := common.GetUserName(c)
+
+	var data common.DeleteVolumeCommand
+	if c.BindJSON(&data) == nil {
+		if err := validateDeleteVolume(c, data.Project, data.PvcName, username); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
+			return
+		}
+
+		// The nfs workflow takes a while, the client polls the job
+		if pvName, err := getBoundPvName(c, data.Project, data.PvcName); err == nil && getPvTechnology(pvName) == "nfs" {
+			jobID, err := common.StartJob(c, "volume-delete", func(ctx context.Context) (interface{}, error) {
+				return nil, deleteVolume(ctx, data.Project, data.PvcName, username)
+			})
+			if err != nil {
+				c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
+			} else {
+				c.JSON(http.StatusAccepted, common.JobApiResponse{
+					Message: fmt.Sprintf("Das Volume %v wird gelöscht.", data.PvcName),
+					JobID:   jobID,
+				})
+			}
+			return
+		}
+
+		if err := deleteVolume(c, data.Project, data.PvcName, username); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
+		} else {
+			c.JSON(http.StatusOK, common.ApiResponse{
+				Message: fmt.Sprintf("Das Volume %v wurde gelöscht.", data.PvcName),
+			})
+		}
+
+	} else {
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, wrongAPIUsageError))
 	}
 }
 
-func validateNewVolume(project string, size string, pvcName string, mode string, technology string, username string) error {
+func getProjectVolumesHandler(c *gin.Context) {
+	username := common.GetUserName(c)
+	project := c.Param("project")
+
+	if err := validateAdminAccess(c, username, project); err != nil {
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
+		return
+	}
+
+	if volumes, err := getProjectVolumes(c, project); err != nil {
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
+	} else {
+		c.JSON(http.StatusOK, volumes)
+	}
+}
+
+func validateNewVolume(ctx context.Context, project string, size string, pvcName string, mode string, technology string, username string) error {
 	// Required fields
 	if len(project) == 0 || len(pvcName) == 0 || len(size) == 0 || len(mode) == 0 {
 		return errors.New("Es müssen alle Felder ausgefüllt werden")
@@ -137,24 +198,24 @@ func validateNewVolume(project string, size string, pvcName string, mode string,
 	}
 
 	// Permissions on project
-	if err := checkAdminPermissions(username, project); err != nil {
+	if err := checkAdminPermissions(ctx, username, project); err != nil {
 		return err
 	}
 
 	// Check if pvc name already taken
-	if err := checkPvcName(project, pvcName); err != nil {
+	if err := checkPvcName(ctx, project, pvcName); err != nil {
 		return err
 	}
 
 	// Check if technology is nfs or gluster
-	if err := checkTechnology(technology); err != nil {
+	if err := checkTechnology(ctx, technology); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func validateGrowVolume(project string, newSize string, pvName string, username string) error {
+func validateGrowVolume(ctx context.Context, project string, newSize string, pvName string, username string) error {
 	// Required fields
 	if len(project) == 0 || len(pvName) == 0 || len(newSize) == 0 {
 		return errors.New("Es müssen alle Felder ausgefüllt werden")
@@ -169,21 +230,42 @@ func validateGrowVolume(project string, newSize string, pvName string, username
 		return err
 	}
 
+	if err := checkTechnology(ctx, getPvTechnology(pvName)); err != nil {
+		return err
+	}
+
 	// Permissions on project
-	if err := checkAdminPermissions(username, project); err != nil {
+	if err := checkAdminPermissions(ctx, username, project); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func validateFixVolume(project string, username string) error {
+func validateFixVolume(ctx context.Context, project string, username string) error {
 	if len(project) == 0 {
 		return errors.New("Projekt muss angegeben werden")
 	}
 
+	if err := checkTechnology(ctx, "gluster"); err != nil {
+		return err
+	}
+
 	// Permissions on project
-	if err := checkAdminPermissions(username, project); err != nil {
+	if err := checkAdminPermissions(ctx, username, project); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func validateDeleteVolume(ctx context.Context, project string, pvcName string, username string) error {
+	if len(project) == 0 || len(pvcName) == 0 {
+		return errors.New("Es müssen alle Felder ausgefüllt werden")
+	}
+
+	// Permissions on project
+	if err := checkAdminPermissions(ctx, username, project); err != nil {
 		return err
 	}
 
@@ -207,12 +289,7 @@ func validateSizeFormat(size string, technology string) error {
 func validateSize(size string) error {
 	minMB := 500
 	maxMB := 1024
-	maxGB := os.Getenv("MAX_VOLUME_GB")
-
-	maxGBInt, errGB := strconv.Atoi(maxGB)
-	if errGB != nil || maxGBInt <= 0 {
-		log.Fatal("Env variable 'MAX_VOLUME_GB' must be specified and a valid integer")
-	}
+	maxGB := config.MaxVolumeGB
 
 	// Size limits
 	if strings.HasSuffix(size, "M") {
@@ -234,7 +311,7 @@ func validateSize(size string) error {
 			return errors.New(wrongSizeFormatError)
 		}
 
-		if sizeInt > maxGBInt {
+		if sizeInt > maxGB {
 			return fmt.Errorf(wrongSizeLimitError, maxMB, maxGB)
 		}
 	}
@@ -242,30 +319,16 @@ func validateSize(size string) error {
 	return nil
 }
 
-func checkPvcName(project string, pvcName string) error {
-	client, req := getOseHTTPClient("GET", fmt.Sprintf("api/v1/namespaces/%v/persistentvolumeclaims", project), nil)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Println("Error from server while getting pvc-list: ", err.Error())
-		return errors.New(genericAPIError)
-	}
-	defer resp.Body.Close()
-
-	json, err := gabs.ParseJSONBuffer(resp.Body)
+func checkPvcName(ctx context.Context, project string, pvcName string) error {
+	pvcs, err := ose(ctx).ListPersistentVolumeClaims(ctx, project)
 	if err != nil {
-		log.Println("error parsing body of response:", err)
+		common.Logger(ctx).WithError(err).Error("Error from server while getting pvc-list")
 		return errors.New(genericAPIError)
 	}
 
 	// Check if pvc name is not already used
-	children, err := json.S("items").Children()
-	if err != nil {
-		log.Println("Unable to parse pvc list", err.Error())
-		return errors.New(genericAPIError)
-	}
-	for _, v := range children {
-		if v.Path("metadata.name").Data().(string) == pvcName {
+	for _, v := range pvcs {
+		if v.Metadata.Name == pvcName {
 			return fmt.Errorf("Der gewünschte PVC-Name %v existiert bereits.", pvcName)
 		}
 	}
@@ -273,52 +336,98 @@ func checkPvcName(project string, pvcName string) error {
 	return nil
 }
 
-func checkTechnology(technology string) error {
+// checkTechnology checks if the technology is nfs or gluster and configured on the cluster of the request
+func checkTechnology(ctx context.Context, technology string) error {
+	cluster := getCluster(ctx)
 	switch technology {
-	case
-		"nfs",
-		"gluster":
-		return nil
+	case "nfs":
+		if len(cluster.Nfs.APIURL) > 0 {
+			return nil
+		}
+	case "gluster":
+		if len(cluster.Gluster.APIURL) > 0 {
+			return nil
+		}
+	default:
+		return errors.New("Invalid technology. Must be either nfs or gluster")
 	}
-	return errors.New("Invalid technology. Must be either nfs or gluster")
+	return fmt.Errorf("Volumes mit %v sind auf dem Cluster %v nicht verfügbar", technology, cluster.Name)
 }
 
-func createNewVolume(project string, size string, pvcName string, mode string, technology string, username string) (*common.NewVolumeResponse, error) {
+// getPvTechnology returns the technology of a pv created by the SSP
+func getPvTechnology(pvName string) string {
+	if strings.HasPrefix(pvName, "gl-") {
+		return "gluster"
+	}
+	if strings.HasPrefix(pvName, "nfs-") {
+		return "nfs"
+	}
+	return ""
+}
+
+// createNewVolume creates the backend volume and its OpenShift objects.
+// If a step fails, the steps before are undone and the error reports them.
+func createNewVolume(ctx context.Context, project string, size string, pvcName string, mode string, technology string, username string) (*common.NewVolumeResponse, error) {
 	var newVolumeResponse *common.NewVolumeResponse
-	var err error
+	s := newSaga(ctx)
+
 	if technology == "nfs" {
-		newVolumeResponse, err = createNfsVolume(project, pvcName, size, username)
+		// The volume is returned as soon as the workflow created it, even if its result is unusable
+		err := s.runCreated("NFS-Volume erstellen", func() (bool, error) {
+			var err error
+			newVolumeResponse, err = createNfsVolume(ctx, project, pvcName, size, username)
+			return newVolumeResponse != nil, err
+		}, func() error {
+			return deleteNfsVolume(ctx, newVolumeResponse.PvName, username)
+		})
 		if err != nil {
 			return nil, err
 		}
 	} else {
-		newVolumeResponse, err = createGlusterVolume(project, size, username)
+		err := s.run("Gluster-Volume erstellen", func() error {
+			var err error
+			newVolumeResponse, err = createGlusterVolume(ctx, project, size, username)
+			return err
+		}, func() error {
+			return deleteGlusterVolume(ctx, newVolumeResponse.PvName, username)
+		})
 		if err != nil {
 			return nil, err
 		}
 
-		// Create Gluster Service & Endpoints in user project
-		if err := createOpenShiftGlusterService(project, username); err != nil {
+		// The Gluster Service & Endpoints are shared by all gluster volumes of the project, so they are kept
+		if err := s.run("Gluster Service erstellen", func() error {
+			return createOpenShiftGlusterService(ctx, project, username)
+		}, nil); err != nil {
 			return nil, err
 		}
 
-		if err := createOpenShiftGlusterEndpoint(project, username); err != nil {
+		if err := s.run("Gluster Endpunkte erstellen", func() error {
+			return createOpenShiftGlusterEndpoint(ctx, project, username)
+		}, nil); err != nil {
 			return nil, err
 		}
 	}
 
-	if err := createOpenShiftPV(size, newVolumeResponse.PvName, newVolumeResponse.Server, newVolumeResponse.Path, mode, technology, username); err != nil {
+	if err := s.run("PV erstellen", func() error {
+		return createOpenShiftPV(ctx, size, newVolumeResponse.PvName, newVolumeResponse.Server, newVolumeResponse.Path, mode, technology, username)
+	}, func() error {
+		return ose(ctx).DeletePersistentVolume(ctx, newVolumeResponse.PvName)
+	}); err != nil {
 		return nil, err
 	}
 
-	if err := createOpenShiftPVC(project, size, pvcName, mode, username); err != nil {
+	if err := s.run("PVC erstellen", func() error {
+		return createOpenShiftPVC(ctx, project, size, pvcName, mode, username)
+	}, nil); err != nil {
 		return nil, err
 	}
 
+	newVolumeResponse.Steps = s.steps
 	return newVolumeResponse, nil
 }
 
-func createGlusterVolume(project string, size string, username string) (*common.NewVolumeResponse, error) {
+func createGlusterVolume(ctx context.Context, project string, size string, username string) (*common.NewVolumeResponse, error) {
 	cmd := models.CreateVolumeCommand{
 		Project: project,
 		Size:    size,
@@ -326,28 +435,35 @@ func createGlusterVolume(project string, size string, username string) (*common.
 
 	b := new(bytes.Buffer)
 	if err := json.NewEncoder(b).Encode(cmd); err != nil {
-		log.Println(err.Error())
+		common.Logger(ctx).WithError(err).Error("Error encoding the command")
 		return nil, errors.New(genericAPIError)
 	}
 
-	client, req := getGlusterHTTPClient("sec/volume", b)
+	client, req, err := getGlusterHTTPClient(ctx, "POST", "sec/volume", b)
+	if err != nil {
+		return nil, err
+	}
 
 	resp, err := client.Do(req)
 	if err != nil {
-		log.Println("Error calling gluster-api", err.Error())
+		common.Logger(ctx).WithError(err).Error("Error calling gluster-api")
 		return nil, errors.New(genericAPIError)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusOK {
-		log.Printf("%v created a gluster volume. Project: %v, size: %v", username, project, size)
+		common.Logger(ctx).WithFields(logrus.Fields{"user": username, "project": project, "size": size}).Info("Created a gluster volume")
 
 		respJson, err := gabs.ParseJSONBuffer(resp.Body)
 		if err != nil {
-			log.Println("Error parsing respJson from gluster-api response", err.Error())
+			common.Logger(ctx).WithError(err).Error("Error parsing respJson from gluster-api response")
+			return nil, errors.New(genericAPIError)
+		}
+		message, ok := respJson.Path("message").Data().(string)
+		if !ok {
+			common.Logger(ctx).WithField("response", respJson.String()).Error("Missing message in gluster-api response")
 			return nil, errors.New(genericAPIError)
 		}
-		message := respJson.Path("message").Data().(string)
 
 		return &common.NewVolumeResponse{
 			// Add gl- to pvName because of conflicting PVs on other storage technology
@@ -358,12 +474,12 @@ func createGlusterVolume(project string, size string, username string) (*common.
 	}
 
 	errMsg, _ := ioutil.ReadAll(resp.Body)
-	log.Println("Error creating gluster volume:", err, resp.StatusCode, string(errMsg))
+	common.Logger(ctx).WithError(err).WithFields(logrus.Fields{"status": resp.StatusCode, "response": string(errMsg)}).Error("Error creating gluster volume")
 
 	return nil, fmt.Errorf("Fehlerhafte Antwort vom Gluster-API: %v", string(errMsg))
 }
 
-func createNfsVolume(project string, pvcName string, size string, username string) (*common.NewVolumeResponse, error) {
+func createNfsVolume(ctx context.Context, project string, pvcName string, size string, username string) (*common.NewVolumeResponse, error) {
 	cmd := common.WorkflowCommand{
 		UserInputValues: []common.WorkflowKeyValue{
 			{
@@ -379,77 +495,73 @@ func createNfsVolume(project string, pvcName string, size string, username strin
 
 	body := new(bytes.Buffer)
 	if err := json.NewEncoder(body).Encode(cmd); err != nil {
-		log.Println(err.Error())
+		common.Logger(ctx).WithError(err).Error("Error encoding the command")
 		return nil, errors.New(genericAPIError)
 	}
 
-	client, req := getNfsHTTPClient("POST", fmt.Sprintf("workflows/%v/jobs", apiCreateWorkflowUuid), body)
+	client, req, err := getNfsHTTPClient(ctx, "POST", fmt.Sprintf("workflows/%v/jobs", apiCreateWorkflowUuid), body)
+	if err != nil {
+		return nil, err
+	}
 
 	resp, err := client.Do(req)
 	if err != nil {
-		log.Println("Error calling nfs-api", err.Error())
+		common.Logger(ctx).WithError(err).Error("Error calling nfs-api")
 		return nil, errors.New(genericAPIError)
 	}
 	defer resp.Body.Close()
 
 	job := &common.WorkflowJob{}
 	if resp.StatusCode == http.StatusCreated {
-		log.Printf("%v is creating an nfs volume. Project: %v, size: %v", username, project, size)
+		common.Logger(ctx).WithFields(logrus.Fields{"user": username, "project": project, "size": size}).Info("Creating an nfs volume")
 		bodyBytes, _ := ioutil.ReadAll(resp.Body)
 
 		if err := json.Unmarshal(bodyBytes, job); err != nil {
-			log.Println("Error unmarshalling workflow job", err.Error())
+			common.Logger(ctx).WithError(err).Error("Error unmarshalling workflow job")
 			return nil, errors.New(genericAPIError)
 		}
 
-		// wait until job is executing
-		for {
-			job, err = getJob(job.JobId)
-			if err != nil {
-				log.Println("Error unmarshalling workflow job", err.Error())
-				return nil, errors.New(genericAPIError)
-			}
-			if job.JobStatus.JobStatus == "EXECUTING" {
-				break
-			}
-			time.Sleep(time.Second)
+		// The server and path of the volume are known when the workflow is completed
+		if job, err = waitForWorkflowJob(ctx, job.JobId); err != nil {
+			return nil, err
 		}
 
-		server := ""
-		path := ""
+		// Add nfs_ to pvName because of conflicting PVs on other storage technology.
+		// From here on the volume exists, so it is returned with the errors to be deleted again.
+		volume := &common.NewVolumeResponse{
+			PvName: fmt.Sprintf("nfs-%v-%v", project, pvcName),
+			JobId:  job.JobId,
+		}
 		for _, parameter := range job.JobStatus.ReturnParameters {
 			if parameter.Key == "'Server' + $Projectname" {
-				s := strings.Split(parameter.Value, ":")
-				server, path = s[0], s[1]
+				if s := strings.SplitN(parameter.Value, ":", 2); len(s) == 2 {
+					volume.Server, volume.Path = s[0], s[1]
+				}
 				break
 			}
 		}
-		if server == "" || path == "" {
-			log.Println("Couldn't parse nfs server or path")
-			return nil, errors.New(genericAPIError)
+		if volume.Server == "" || volume.Path == "" {
+			common.Logger(ctx).WithField("job", job.JobId).Error("Couldn't parse nfs server or path")
+			return volume, errors.New(genericAPIError)
 		}
-
-		// Add nfs_ to pvName because of conflicting PVs on other storage technology
-		return &common.NewVolumeResponse{
-			PvName: fmt.Sprintf("nfs-%v-%v", project, pvcName),
-			Server: server,
-			Path:   path,
-			JobId:  job.JobId,
-		}, nil
+		return volume, nil
 	}
 
 	errMsg, _ := ioutil.ReadAll(resp.Body)
-	log.Println("Error creating nfs volume:", err, resp.StatusCode, string(errMsg))
+	common.Logger(ctx).WithError(err).WithFields(logrus.Fields{"status": resp.StatusCode, "response": string(errMsg)}).Error("Error creating nfs volume")
 
 	return nil, fmt.Errorf("Fehlerhafte Antwort vom nfs-api: %v", string(errMsg))
 }
 
-func getJob(jobId int) (*common.WorkflowJob, error) {
-	client, req := getNfsHTTPClient("GET", fmt.Sprintf("workflows/jobs/%v", jobId), nil)
+func getJob(ctx context.Context, jobId int) (*common.WorkflowJob, error) {
+	client, req, err := getNfsHTTPClient(ctx, "GET", fmt.Sprintf("workflows/jobs/%v", jobId), nil)
+	if err != nil {
+		return nil, err
+	}
 
 	resp, err := client.Do(req)
 	if err != nil {
-		log.Println("Error calling nfs-api", err.Error())
+		common.Logger(ctx).WithError(err).Error("Error calling nfs-api")
 		return nil, errors.New(genericAPIError)
 	}
 	defer resp.Body.Close()
@@ -458,11 +570,11 @@ func getJob(jobId int) (*common.WorkflowJob, error) {
 		var body common.WorkflowJob
 		bodyBytes, _ := ioutil.ReadAll(resp.Body)
 		if err := json.Unmarshal(bodyBytes, &body); err != nil {
-			log.Println("Error unmarshalling workflow job", err.Error())
+			common.Logger(ctx).WithError(err).Error("Error unmarshalling workflow job")
 			return nil, errors.New(genericAPIError)
 		}
 		if body.JobStatus.JobStatus == "FAILED" {
-			log.Println("Workflow job failed: ", body.JobStatus.ErrorMessage)
+			common.Logger(ctx).WithField("error_message", body.JobStatus.ErrorMessage).Info("Workflow job failed")
 			return nil, errors.New(genericAPIError)
 		}
 		return &body, nil
@@ -470,6 +582,9 @@ func getJob(jobId int) (*common.WorkflowJob, error) {
 	return nil, errors.New(genericAPIError)
 }
 
+// workflowPollInterval is the time between the status calls of a running nfs workflow
+var workflowPollInterval = time.Second
+
 func getJobProgress(job common.WorkflowJob) float64 {
 	currentProgress := job.JobStatus.WorkflowExecutionProgress.CurrentCommandIndex
 	maxProgress := job.JobStatus.WorkflowExecutionProgress.CommandsNumber
@@ -479,15 +594,30 @@ func getJobProgress(job common.WorkflowJob) float64 {
 	return 100.0 / maxProgress * currentProgress
 }
 
-func growExistingVolume(project string, newSize string, pvName string, username string) error {
+// waitForWorkflowJob polls the nfs workflow until it is completed and sets its progress as progress of our job
+func waitForWorkflowJob(ctx context.Context, jobId int) (*common.WorkflowJob, error) {
+	for {
+		job, err := getJob(ctx, jobId)
+		if err != nil {
+			return nil, err
+		}
+		common.SetJobProgress(ctx, getJobProgress(*job))
+		if job.JobStatus.JobStatus == "COMPLETED" {
+			return job, nil
+		}
+		time.Sleep(workflowPollInterval)
+	}
+}
+
+func growExistingVolume(ctx context.Context, project string, newSize string, pvName string, username string) error {
 	if strings.HasPrefix(pvName, "gl-") {
-		if err := growGlusterVolume(project, newSize, pvName, username); err != nil {
+		if err := growGlusterVolume(ctx, project, newSize, pvName, username); err != nil {
 			return err
 		}
 		return nil
 	}
 	if strings.HasPrefix(pvName, "nfs-") {
-		if err := growNfsVolume(project, newSize, pvName, username); err != nil {
+		if err := growNfsVolume(ctx, project, newSize, pvName, username); err != nil {
 			return err
 		}
 		return nil
@@ -495,7 +625,7 @@ func growExistingVolume(project string, newSize string, pvName string, username
 	return errors.New("Wrong pv name")
 }
 
-func growNfsVolume(project string, newSize string, pvName string, username string) error {
+func growNfsVolume(ctx context.Context, project string, newSize string, pvName string, username string) error {
 	cmd := common.WorkflowCommand{
 		UserInputValues: []common.WorkflowKeyValue{
 			{
@@ -511,47 +641,39 @@ func growNfsVolume(project string, newSize string, pvName string, username strin
 
 	body := new(bytes.Buffer)
 	if err := json.NewEncoder(body).Encode(cmd); err != nil {
-		log.Println(err.Error())
+		common.Logger(ctx).WithError(err).Error("Error encoding the command")
 		return errors.New(genericAPIError)
 	}
 
-	client, req := getNfsHTTPClient("POST", fmt.Sprintf("workflows/%v/jobs", apiChangeWorkflowUuid), body)
+	client, req, err := getNfsHTTPClient(ctx, "POST", fmt.Sprintf("workflows/%v/jobs", apiChangeWorkflowUuid), body)
+	if err != nil {
+		return err
+	}
 
 	resp, err := client.Do(req)
 	if err != nil {
-		log.Println("Error calling nfs-api", err.Error())
+		common.Logger(ctx).WithError(err).Error("Error calling nfs-api")
 		return errors.New(genericAPIError)
 	}
 	defer resp.Body.Close()
 
 	job := &common.WorkflowJob{}
 	if resp.StatusCode == http.StatusCreated {
-		log.Printf("%v grew nfs volume. pv: %v, size: %v", username, pvName, newSize)
+		common.Logger(ctx).WithFields(logrus.Fields{"user": username, "pv": pvName, "size": newSize}).Info("Grew nfs volume")
 		bodyBytes, _ := ioutil.ReadAll(resp.Body)
 
 		if err := json.Unmarshal(bodyBytes, job); err != nil {
-			log.Println("Error unmarshalling workflow job", err.Error())
+			common.Logger(ctx).WithError(err).Error("Error unmarshalling workflow job")
 			return errors.New(genericAPIError)
 		}
 
-		// wait until job is executing
-		for {
-			job, err = getJob(job.JobId)
-			if err != nil {
-				log.Println("Error unmarshalling workflow job", err.Error())
-				return errors.New(genericAPIError)
-			}
-			if job.JobStatus.JobStatus == "COMPLETED" {
-				break
-			}
-			time.Sleep(time.Second)
-		}
-		return nil
+		_, err = waitForWorkflowJob(ctx, job.JobId)
+		return err
 	}
 	return errors.New(genericAPIError)
 }
 
-func growGlusterVolume(project string, newSize string, pvName string, username string) error {
+func growGlusterVolume(ctx context.Context, project string, newSize string, pvName string, username string) error {
 	// Renaming Rules:
 	// OpenShift cannot use _ in names. Thus the pvName will be gl-<project>-pv<number>
 	// 1. Remove gl-
@@ -563,205 +685,441 @@ func growGlusterVolume(project string, newSize string, pvName string, username s
 
 	b := new(bytes.Buffer)
 	if err := json.NewEncoder(b).Encode(cmd); err != nil {
-		log.Println(err.Error())
+		common.Logger(ctx).WithError(err).Error("Error encoding the command")
 		return errors.New(genericAPIError)
 	}
 
-	client, req := getGlusterHTTPClient("sec/volume/grow", b)
+	client, req, err := getGlusterHTTPClient(ctx, "POST", "sec/volume/grow", b)
+	if err != nil {
+		return err
+	}
 
 	resp, err := client.Do(req)
 	if err != nil {
-		log.Println("Error calling gluster-api", err.Error())
+		common.Logger(ctx).WithError(err).Error("Error calling gluster-api")
 		return errors.New(genericAPIError)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusOK {
-		log.Printf("%v grew gluster volume. Project: %v, newSize: %v", username, project, newSize)
+		common.Logger(ctx).WithFields(logrus.Fields{"user": username, "project": project, "size": newSize}).Info("Grew gluster volume")
 		return nil
 	}
 
 	errMsg, _ := ioutil.ReadAll(resp.Body)
-	log.Println("Error growing gluster volume:", err, resp.StatusCode, string(errMsg))
+	common.Logger(ctx).WithError(err).WithFields(logrus.Fields{"status": resp.StatusCode, "response": string(errMsg)}).Error("Error growing gluster volume")
 
 	return fmt.Errorf("Fehlerhafte Antwort vom Gluster-API: %v", string(errMsg))
 }
 
-func createOpenShiftPV(size string, pvName string, server string, path string, mode string, technology string, username string) error {
-	p := newObjectRequest("PersistentVolume", pvName)
-	p.SetP(size, "spec.capacity.storage")
+func createOpenShiftPV(ctx context.Context, size string, pvName string, server string, path string, mode string, technology string, username string) error {
+	pv := &PersistentVolume{
+		Metadata: ObjectMeta{Name: pvName},
+		Spec: PersistentVolumeSpec{
+			Capacity:                      map[string]string{"storage": size},
+			AccessModes:                   []string{mode},
+			PersistentVolumeReclaimPolicy: "Retain",
+		},
+	}
 
 	if technology == "nfs" {
-		p.SetP(path, "spec.nfs.path")
-		p.SetP(server, "spec.nfs.server")
+		pv.Spec.NFS = &NFSVolumeSource{Server: server, Path: path}
 	} else {
-		p.SetP("glusterfs-cluster", "spec.glusterfs.endpoints")
-		p.SetP(path, "spec.glusterfs.path")
-		p.SetP(false, "spec.glusterfs.readOnly")
+		pv.Spec.Glusterfs = &GlusterVolumeSource{Endpoints: "glusterfs-cluster", Path: path}
 	}
 
-	p.SetP("Retain", "spec.persistentVolumeReclaimPolicy")
-	p.ArrayP("spec.accessModes")
-	p.ArrayAppend(mode, "spec", "accessModes")
-
-	client, req := getOseHTTPClient("POST",
-		"api/v1/persistentvolumes",
-		bytes.NewReader(p.Bytes()))
-
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Println("Error creating Openshift PV", err.Error())
+	if err := ose(ctx).CreatePersistentVolume(ctx, pv); err != nil {
+		common.Logger(ctx).WithError(err).Error("Error creating new PV")
 		return errors.New(genericAPIError)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusCreated {
-		log.Printf("Created the pv %v based on the request of %v", pvName, username)
-		return nil
+	common.Logger(ctx).WithFields(logrus.Fields{"user": username, "pv": pvName}).Info("Created the pv")
+	return nil
+}
+
+func createOpenShiftPVC(ctx context.Context, project string, size string, pvcName string, mode string, username string) error {
+	pvc := &PersistentVolumeClaim{
+		Metadata: ObjectMeta{Name: pvcName, Namespace: project},
+		Spec: PersistentVolumeClaimSpec{
+			AccessModes: []string{mode},
+			Resources:   ResourceRequirements{Requests: map[string]string{"storage": size}},
+		},
 	}
 
-	errMsg, _ := ioutil.ReadAll(resp.Body)
-	log.Println("Error creating new PV:", err, resp.StatusCode, string(errMsg))
+	if err := ose(ctx).CreatePersistentVolumeClaim(ctx, pvc); err != nil {
+		common.Logger(ctx).WithError(err).Error("Error creating new PVC")
+		return errors.New(genericAPIError)
+	}
 
-	return errors.New(genericAPIError)
+	common.Logger(ctx).WithFields(logrus.Fields{"user": username, "pvc": pvcName}).Info("Created the pvc")
+	return nil
 }
 
-func createOpenShiftPVC(project string, size string, pvcName string, mode string, username string) error {
-	p := newObjectRequest("PersistentVolumeClaim", pvcName)
+func recreateGlusterObjects(ctx context.Context, project string, username string) error {
+	if err := createOpenShiftGlusterService(ctx, project, username); err != nil {
+		return err
+	}
+
+	if err := createOpenShiftGlusterEndpoint(ctx, project, username); err != nil {
+		return err
+	}
 
-	p.SetP(size, "spec.resources.requests.storage")
-	p.ArrayP("spec.accessModes")
-	p.ArrayAppend(mode, "spec", "accessModes")
+	return nil
+}
 
-	client, req := getOseHTTPClient("POST",
-		"api/v1/namespaces/"+project+"/persistentvolumeclaims",
-		bytes.NewReader(p.Bytes()))
+func createOpenShiftGlusterService(ctx context.Context, project string, username string) error {
+	service := &Service{
+		Metadata: ObjectMeta{Name: "glusterfs-cluster", Namespace: project},
+		Spec:     ServiceSpec{Ports: []ServicePort{{Port: 1}}},
+	}
 
-	resp, err := client.Do(req)
+	err := ose(ctx).CreateService(ctx, service)
+	if IsConflict(err) {
+		common.Logger(ctx).Info("Gluster service already existed, skipping")
+		return nil
+	}
 	if err != nil {
-		log.Println("Error creating Openshift PVC", err.Error())
+		common.Logger(ctx).WithError(err).Error("Error creating gluster service")
 		return errors.New(genericAPIError)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusCreated {
-		log.Printf("Created the pvc %v based on the request of %v", pvcName, username)
+	common.Logger(ctx).WithField("user", username).Info("Created the gluster service")
+	return nil
+}
+
+func createOpenShiftGlusterEndpoint(ctx context.Context, project string, username string) error {
+	err := ose(ctx).CreateEndpoints(ctx, getGlusterEndpoints(ctx, project))
+	if IsConflict(err) {
+		common.Logger(ctx).Info("Gluster endpoints already existed, skipping")
 		return nil
 	}
+	if err != nil {
+		common.Logger(ctx).WithError(err).Error("Error creating gluster endpoints")
+		return errors.New(genericAPIError)
+	}
 
-	errMsg, _ := ioutil.ReadAll(resp.Body)
-	log.Println("Error creating new PVC:", err, resp.StatusCode, string(errMsg))
+	common.Logger(ctx).WithField("user", username).Info("Created the gluster endpoints")
+	return nil
+}
 
-	return errors.New(genericAPIError)
+func getGlusterEndpoints(ctx context.Context, project string) *Endpoints {
+	// Add gluster endpoints
+	subset := EndpointSubset{
+		Addresses: []EndpointAddress{},
+		Ports:     []EndpointPort{{Port: 1}},
+	}
+	for _, ip := range getCluster(ctx).Gluster.IPs {
+		subset.Addresses = append(subset.Addresses, EndpointAddress{IP: ip})
+	}
+
+	return &Endpoints{
+		Metadata: ObjectMeta{Name: "glusterfs-cluster", Namespace: project},
+		Subsets:  []EndpointSubset{subset},
+	}
 }
 
-func recreateGlusterObjects(project string, username string) error {
-	if err := createOpenShiftGlusterService(project, username); err != nil {
+func deleteVolume(ctx context.Context, project string, pvcName string, username string) error {
+	pv, err := getBoundPv(ctx, project, pvcName)
+	if err != nil {
+		return err
+	}
+	pvName := pv.Metadata.Name
+
+	// Only volumes created by the SSP have a backend we know how to release
+	technology := getPvTechnology(pvName)
+	if len(technology) == 0 {
+		common.Logger(ctx).WithFields(logrus.Fields{"user": username, "pvc": pvcName, "pv": pvName}).Warn("Tried to delete pvc with unmanaged pv")
+		return errors.New("Das Volume wurde nicht über das Self-Service-Portal erstellt und kann nicht gelöscht werden")
+	}
+	if err := checkTechnology(ctx, technology); err != nil {
 		return err
 	}
 
-	if err := createOpenShiftGlusterEndpoint(project, username); err != nil {
+	if err := checkPvcNotMounted(ctx, project, pvcName); err != nil {
 		return err
 	}
 
+	// The pvc is deleted last, a failed deletion can be retried as long as it leads to the pv.
+	// The pv records the deleted backend volume, so a retry doesn't delete it again.
+	if pv.Metadata.Annotations[backendDeletedAnnotation] != "true" {
+		if technology == "gluster" {
+			err = deleteGlusterVolume(ctx, pvName, username)
+		} else {
+			err = deleteNfsVolume(ctx, pvName, username)
+		}
+		if err != nil {
+			return err
+		}
+		if err := ose(ctx).PatchPersistentVolumeAnnotations(ctx, pvName, map[string]string{backendDeletedAnnotation: "true"}); err != nil {
+			common.Logger(ctx).WithError(err).WithField("pv", pvName).Error("Error marking the backend volume of the pv as deleted")
+			return errors.New(genericAPIError)
+		}
+	}
+
+	if err := ose(ctx).DeletePersistentVolume(ctx, pvName); err != nil {
+		common.Logger(ctx).WithError(err).WithField("pv", pvName).Error("Error deleting the pv")
+		return errors.New(genericAPIError)
+	}
+	common.Logger(ctx).WithFields(logrus.Fields{"user": username, "pv": pvName}).Info("Deleted the pv")
+
+	if err := ose(ctx).DeletePersistentVolumeClaim(ctx, project, pvcName); err != nil {
+		common.Logger(ctx).WithError(err).WithField("pvc", pvcName).Error("Error deleting the pvc")
+		return errors.New(genericAPIError)
+	}
+	common.Logger(ctx).WithFields(logrus.Fields{"user": username, "project": project, "pvc": pvcName}).Info("Deleted the pvc")
 	return nil
 }
 
-func createOpenShiftGlusterService(project string, username string) error {
-	p := newObjectRequest("Service", "glusterfs-cluster")
+func getBoundPvName(ctx context.Context, project string, pvcName string) (string, error) {
+	pv, err := getBoundPv(ctx, project, pvcName)
+	if err != nil {
+		return "", err
+	}
+	return pv.Metadata.Name, nil
+}
 
-	port := gabs.New()
-	port.Set(1, "port")
+// getBoundPv returns the pv which is bound to the pvc of the project
+func getBoundPv(ctx context.Context, project string, pvcName string) (*PersistentVolume, error) {
+	pvc, err := ose(ctx).GetPersistentVolumeClaim(ctx, project, pvcName)
+	if IsNotFound(err) {
+		return nil, fmt.Errorf("Das PVC %v existiert nicht", pvcName)
+	}
+	if err != nil {
+		common.Logger(ctx).WithError(err).Error("Error from server while getting pvc")
+		return nil, errors.New(genericAPIError)
+	}
 
-	p.ArrayP("spec.ports")
-	p.ArrayAppendP(port.Data(), "spec.ports")
+	if pvc.Status.Phase != "Bound" || len(pvc.Spec.VolumeName) == 0 {
+		return nil, fmt.Errorf("Das PVC %v ist an kein Volume gebunden", pvcName)
+	}
 
-	client, req := getOseHTTPClient("POST",
-		"api/v1/namespaces/"+project+"/services",
-		bytes.NewReader(p.Bytes()))
+	// The volume name of a pvc can be set by the project admins, only the pv knows its real claim
+	pv, err := ose(ctx).GetPersistentVolume(ctx, pvc.Spec.VolumeName)
+	if IsNotFound(err) {
+		return nil, fmt.Errorf("Das PVC %v ist an kein Volume gebunden", pvcName)
+	}
+	if err != nil {
+		common.Logger(ctx).WithError(err).WithField("pv", pvc.Spec.VolumeName).Error("Error from server while getting pv")
+		return nil, errors.New(genericAPIError)
+	}
+	if !isClaimOfPv(pv, project, pvcName) {
+		common.Logger(ctx).WithFields(logrus.Fields{"project": project, "pvc": pvcName, "pv": pv.Metadata.Name}).Warn("PVC references a pv of another claim")
+		return nil, fmt.Errorf("Das PVC %v ist an kein Volume gebunden", pvcName)
+	}
 
-	resp, err := client.Do(req)
+	return pv, nil
+}
+
+// isClaimOfPv checks that the pv is bound to the pvc of the project
+func isClaimOfPv(pv *PersistentVolume, project string, pvcName string) bool {
+	return pv.Spec.ClaimRef != nil && pv.Spec.ClaimRef.Namespace == project && pv.Spec.ClaimRef.Name == pvcName
+}
+
+func checkPvcNotMounted(ctx context.Context, project string, pvcName string) error {
+	pods, err := ose(ctx).ListPods(ctx, project)
 	if err != nil {
-		log.Println("Error creating Openshift Gluster service", err.Error())
+		common.Logger(ctx).WithError(err).Error("Error from server while getting pod-list")
 		return errors.New(genericAPIError)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusCreated {
-		log.Printf("Created the gluster service based on the request of %v", username)
-		return nil
+	for _, pod := range pods {
+		for _, v := range pod.Spec.Volumes {
+			if v.PersistentVolumeClaim != nil && v.PersistentVolumeClaim.ClaimName == pvcName {
+				return fmt.Errorf("Das PVC %v wird noch vom Pod %v verwendet", pvcName, pod.Metadata.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// getGlusterVolumeName reverts the renaming of the volume for OpenShift.
+// E.g. gl-my-project-pv1 => vol_my-project_pv1
+func getGlusterVolumeName(pvName string) string {
+	name := strings.Replace(pvName, "gl-", "", 1)
+	if i := strings.LastIndex(name, "-pv"); i >= 0 {
+		name = name[:i] + "_pv" + name[i+len("-pv"):]
+	}
+	return "vol_" + name
+}
+
+func deleteGlusterVolume(ctx context.Context, pvName string, username string) error {
+	cmd := models.DeleteVolumeCommand{
+		LvName: getGlusterVolumeName(pvName),
+	}
+
+	b := new(bytes.Buffer)
+	if err := json.NewEncoder(b).Encode(cmd); err != nil {
+		common.Logger(ctx).WithError(err).Error("Error encoding the command")
+		return errors.New(genericAPIError)
+	}
+
+	client, req, err := getGlusterHTTPClient(ctx, "POST", "sec/volume/delete", b)
+	if err != nil {
+		return err
 	}
 
-	if resp.StatusCode == http.StatusConflict {
-		log.Println("Gluster service already existed, skipping")
+	resp, err := client.Do(req)
+	if err != nil {
+		common.Logger(ctx).WithError(err).Error("Error calling gluster-api")
+		return errors.New(genericAPIError)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		common.Logger(ctx).WithFields(logrus.Fields{"user": username, "volume": cmd.LvName}).Info("Deleted gluster volume")
 		return nil
 	}
 
 	errMsg, _ := ioutil.ReadAll(resp.Body)
-	log.Println("Error creating gluster service:", err, resp.StatusCode, string(errMsg))
+	common.Logger(ctx).WithFields(logrus.Fields{"status": resp.StatusCode, "response": string(errMsg)}).Error("Error deleting gluster volume")
 
-	return errors.New(genericAPIError)
+	return fmt.Errorf("Fehlerhafte Antwort vom Gluster-API: %v", string(errMsg))
 }
 
-func createOpenShiftGlusterEndpoint(project string, username string) error {
-	p, err := getGlusterEndpointsContainer()
+func deleteNfsVolume(ctx context.Context, pvName string, username string) error {
+	cmd := common.WorkflowCommand{
+		UserInputValues: []common.WorkflowKeyValue{
+			{
+				Key:   "Projectname",
+				Value: strings.Replace(pvName, "nfs-", "vol_", 1),
+			},
+		},
+	}
+
+	body := new(bytes.Buffer)
+	if err := json.NewEncoder(body).Encode(cmd); err != nil {
+		common.Logger(ctx).WithError(err).Error("Error encoding the command")
+		return errors.New(genericAPIError)
+	}
+
+	client, req, err := getNfsHTTPClient(ctx, "POST", fmt.Sprintf("workflows/%v/jobs", apiDeleteWorkflowUuid), body)
 	if err != nil {
 		return err
 	}
 
-	client, req := getOseHTTPClient("POST",
-		"api/v1/namespaces/"+project+"/endpoints",
-		bytes.NewReader(p.Bytes()))
-
 	resp, err := client.Do(req)
 	if err != nil {
-		log.Println("Error creating Openshift Gluster endpoint", err.Error())
+		common.Logger(ctx).WithError(err).Error("Error calling nfs-api")
 		return errors.New(genericAPIError)
 	}
 	defer resp.Body.Close()
 
+	job := &common.WorkflowJob{}
 	if resp.StatusCode == http.StatusCreated {
-		log.Printf("Created the gluster endpoints based on the request of %v", username)
-		return nil
-	}
+		common.Logger(ctx).WithFields(logrus.Fields{"user": username, "pv": pvName}).Info("Deleting nfs volume")
+		bodyBytes, _ := ioutil.ReadAll(resp.Body)
 
-	if resp.StatusCode == http.StatusConflict {
-		log.Println("Gluster endpoints already existed, skipping")
-		return nil
+		if err := json.Unmarshal(bodyBytes, job); err != nil {
+			common.Logger(ctx).WithError(err).Error("Error unmarshalling workflow job")
+			return errors.New(genericAPIError)
+		}
+
+		_, err = waitForWorkflowJob(ctx, job.JobId)
+		return err
 	}
 
 	errMsg, _ := ioutil.ReadAll(resp.Body)
-	log.Println("Error creating gluster endpoints:", err, resp.StatusCode, string(errMsg))
+	common.Logger(ctx).WithFields(logrus.Fields{"status": resp.StatusCode, "response": string(errMsg)}).Error("Error deleting nfs volume")
 
-	return errors.New(genericAPIError)
+	return fmt.Errorf("Fehlerhafte Antwort vom nfs-api: %v", string(errMsg))
 }
 
-func getGlusterEndpointsContainer() (*gabs.Container, error) {
-	p := newObjectRequest("Endpoints", "glusterfs-cluster")
-	p.Array("subsets")
-
-	// Add gluster endpoints
-	glusterIPs := os.Getenv("GLUSTER_IPS")
-	if len(glusterIPs) == 0 {
-		log.Println("Wrong configuration. Missing env variable 'GLUSTER_IPS'")
+func getProjectVolumes(ctx context.Context, project string) (*common.VolumeListResponse, error) {
+	pvcs, err := ose(ctx).ListPersistentVolumeClaims(ctx, project)
+	if err != nil {
+		common.Logger(ctx).WithError(err).Error("Error from server while getting pvc-list")
 		return nil, errors.New(genericAPIError)
 	}
 
-	addresses := gabs.New()
-	addresses.Array("addresses")
-	addresses.Array("ports")
-	for _, ip := range strings.Split(glusterIPs, ",") {
-		address := gabs.New()
-		address.Set(ip, "ip")
+	result := &common.VolumeListResponse{
+		Volumes: []common.ProjectVolume{},
+	}
+	for _, pvc := range pvcs {
+		volume := common.ProjectVolume{
+			Technology: "other",
+			PvcName:    pvc.Metadata.Name,
+			PvName:     pvc.Spec.VolumeName,
+			Size:       pvc.Status.Capacity["storage"],
+		}
+		if len(pvc.Status.AccessModes) > 0 {
+			volume.Mode = pvc.Status.AccessModes[0]
+		}
+
+		if strings.HasPrefix(volume.PvName, "gl-") || strings.HasPrefix(volume.PvName, "nfs-") {
+			if err := addPvDetails(ctx, project, &volume); err != nil {
+				return nil, err
+			}
+		}
 
-		addresses.ArrayAppend(address.Data(), "addresses")
+		result.Volumes = append(result.Volumes, volume)
 	}
 
-	port := gabs.New()
-	port.Set(1, "port")
-	addresses.ArrayAppend(port.Data(), "ports")
+	return result, nil
+}
 
-	p.ArrayAppend(addresses.Data(), "subsets")
+func addPvDetails(ctx context.Context, project string, volume *common.ProjectVolume) error {
+	pv, err := ose(ctx).GetPersistentVolume(ctx, volume.PvName)
+	if err != nil {
+		common.Logger(ctx).WithError(err).Error("Error from server while getting pv")
+		return errors.New(genericAPIError)
+	}
+
+	// The details of volumes of other projects aren't shown
+	if !isClaimOfPv(pv, project, volume.PvcName) {
+		common.Logger(ctx).WithFields(logrus.Fields{"project": project, "pvc": volume.PvcName, "pv": volume.PvName}).Warn("PVC references a pv of another claim")
+		return nil
+	}
+
+	volume.Size = pv.Spec.Capacity["storage"]
+	if len(pv.Spec.AccessModes) > 0 {
+		volume.Mode = pv.Spec.AccessModes[0]
+	}
+
+	if pv.Spec.NFS != nil {
+		volume.Technology = "nfs"
+		return nil
+	}
+
+	if pv.Spec.Glusterfs != nil {
+		volume.Technology = "gluster"
+
+		// The usage is nice to have, the list is still useful without it
+		usage, err := getGlusterVolumeUsage(ctx, volume.PvName)
+		if err != nil {
+			common.Logger(ctx).WithError(err).WithField("pv", volume.PvName).Warn("Could not get usage of gluster volume")
+			return nil
+		}
+		volume.Usage = usage
+	}
+
+	return nil
+}
+
+func getGlusterVolumeUsage(ctx context.Context, pvName string) (*common.VolumeUsage, error) {
+	client, req, err := getGlusterHTTPClient(ctx, "GET", "volume/"+pvName, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		errMsg, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("gluster-api returned %v: %v", resp.StatusCode, string(errMsg))
+	}
+
+	var volInfo models.VolInfo
+	if err := json.NewDecoder(resp.Body).Decode(&volInfo); err != nil {
+		return nil, err
+	}
 
-	return p, nil
+	return &common.VolumeUsage{
+		TotalKiloBytes: volInfo.TotalKiloBytes,
+		UsedKiloBytes:  volInfo.UsedKiloBytes,
+	}, nil
 }
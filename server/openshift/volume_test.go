@@ -0,0 +1,297 @@
+package openshift
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SchweizerischeBundesbahnen/ssp-backend/glusterapi/models"
+	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
+)
+
+func TestProjectVolumes(t *testing.T) {
+	fake, _ := setupFake("u123456")
+	fake.addProject("project", "u123456")
+
+	ok(t, createOpenShiftPV(context.Background(), "1G", "nfs-project-pv1", "server", "/path", "ReadWriteMany", "nfs", "u123456"))
+	ok(t, createOpenShiftPVC(context.Background(), "project", "1G", "data", "ReadWriteMany", "u123456"))
+	bindPvc(fake, "project", "data", "nfs-project-pv1")
+
+	volumes, err := getProjectVolumes(context.Background(), "project")
+	ok(t, err)
+	equals(t, 1, len(volumes.Volumes))
+	equals(t, "data", volumes.Volumes[0].PvcName)
+	equals(t, "nfs", volumes.Volumes[0].Technology)
+	equals(t, "1G", volumes.Volumes[0].Size)
+	equals(t, "ReadWriteMany", volumes.Volumes[0].Mode)
+
+	assert(t, checkPvcName(context.Background(), "project", "data") != nil, "Existing pvc name should be rejected")
+
+	// The details of a pv bound to another project aren't shown
+	fake.addProject("other", "u123456")
+	ok(t, createOpenShiftPVC(context.Background(), "other", "1G", "stolen", "ReadWriteMany", "u123456"))
+	fake.pvcs["other"]["stolen"].Spec.VolumeName = "nfs-project-pv1"
+	volumes, err = getProjectVolumes(context.Background(), "other")
+	ok(t, err)
+	equals(t, "other", volumes.Volumes[0].Technology)
+	equals(t, "", volumes.Volumes[0].Mode)
+}
+
+// bindPvc binds the pvc to the pv, like OpenShift does
+func bindPvc(fake *fakeClient, project string, pvcName string, pvName string) {
+	pvc := fake.pvcs[project][pvcName]
+	pvc.Spec.VolumeName = pvName
+	pvc.Status.Phase = "Bound"
+	fake.pvs[pvName].Spec.ClaimRef = &ObjectReference{Kind: "PersistentVolumeClaim", Namespace: project, Name: pvcName}
+}
+
+func TestProjectVolumes_GlusterNotConfigured(t *testing.T) {
+	fake, _ := setupFake("u123456")
+	fake.addProject("project", "u123456")
+	clusters[0].glusterClient = nil
+
+	ok(t, createOpenShiftPV(context.Background(), "1G", "gl-project-pv1", "", "vol_project_pv1", "ReadWriteOnce", "gluster", "u123456"))
+	ok(t, createOpenShiftPVC(context.Background(), "project", "1G", "data", "ReadWriteOnce", "u123456"))
+	bindPvc(fake, "project", "data", "gl-project-pv1")
+
+	// The list works without the usage of the volume
+	volumes, err := getProjectVolumes(context.Background(), "project")
+	ok(t, err)
+	equals(t, "gluster", volumes.Volumes[0].Technology)
+	assert(t, volumes.Volumes[0].Usage == nil, "Usage should be empty")
+
+	err = deleteGlusterVolume(context.Background(), "gl-project-pv1", "u123456")
+	equals(t, "Gluster ist auf dem Cluster Default nicht konfiguriert", err.Error())
+}
+
+func TestDeleteVolume_ForeignPv(t *testing.T) {
+	fake, _ := setupFake("u123456")
+	fake.addProject("project", "u123456")
+	fake.addProject("attacker", "u123456")
+	ok(t, createOpenShiftPV(context.Background(), "1G", "nfs-project-pv1", "server", "/path", "ReadWriteMany", "nfs", "u123456"))
+	ok(t, createOpenShiftPVC(context.Background(), "project", "1G", "data", "ReadWriteMany", "u123456"))
+	bindPvc(fake, "project", "data", "nfs-project-pv1")
+
+	// A pvc can name any pv, but only the claim of the pv can delete it
+	ok(t, createOpenShiftPVC(context.Background(), "attacker", "1G", "data", "ReadWriteMany", "u123456"))
+	fake.pvcs["attacker"]["data"].Spec.VolumeName = "nfs-project-pv1"
+	fake.pvcs["attacker"]["data"].Status.Phase = "Bound"
+
+	err := deleteVolume(context.Background(), "attacker", "data", "u123456")
+	equals(t, "Das PVC data ist an kein Volume gebunden", err.Error())
+	assert(t, fake.pvs["nfs-project-pv1"] != nil, "PV of the other project should be kept")
+
+	pvName, err := getBoundPvName(context.Background(), "project", "data")
+	ok(t, err)
+	equals(t, "nfs-project-pv1", pvName)
+}
+
+func TestDeleteVolume_Retry(t *testing.T) {
+	fake, _ := setupFake("u123456")
+	fake.addProject("project", "u123456")
+	var deleted []string
+	server := fakeGlusterAPI(&deleted)
+	defer server.Close()
+	clusters[0].glusterClient = http.DefaultClient
+	ok(t, createOpenShiftPV(context.Background(), "1G", "gl-project-pv1", "", "vol_project_pv1", "ReadWriteOnce", "gluster", "u123456"))
+	ok(t, createOpenShiftPVC(context.Background(), "project", "1G", "data", "ReadWriteOnce", "u123456"))
+	bindPvc(fake, "project", "data", "gl-project-pv1")
+
+	// The pvc still leads to the pv and its backend volume
+	fake.failing["DeletePersistentVolume"] = errors.New("timeout")
+	equals(t, genericAPIError, deleteVolume(context.Background(), "project", "data", "u123456").Error())
+	equals(t, []string{"vol_project_pv1"}, deleted)
+	assert(t, fake.pvcs["project"]["data"] != nil, "PVC should be kept")
+
+	// The backend volume is only deleted once
+	delete(fake.failing, "DeletePersistentVolume")
+	ok(t, deleteVolume(context.Background(), "project", "data", "u123456"))
+	equals(t, []string{"vol_project_pv1"}, deleted)
+	assert(t, fake.pvs["gl-project-pv1"] == nil, "PV should be deleted")
+	assert(t, fake.pvcs["project"]["data"] == nil, "PVC should be deleted")
+}
+
+func TestCheckPvcNotMounted(t *testing.T) {
+	fake, _ := setupFake("u123456")
+	fake.pods["project"] = []Pod{{
+		Metadata: ObjectMeta{Name: "app-1"},
+		Spec: PodSpec{Volumes: []PodVolume{
+			{Name: "tmp"},
+			{Name: "data", PersistentVolumeClaim: &PersistentVolumeClaimRef{ClaimName: "data"}},
+		}},
+	}}
+
+	ok(t, checkPvcNotMounted(context.Background(), "project", "other"))
+	equals(t, "Das PVC data wird noch vom Pod app-1 verwendet", checkPvcNotMounted(context.Background(), "project", "data").Error())
+}
+
+func TestGlusterObjects(t *testing.T) {
+	fake, _ := setupFake("u123456")
+
+	ok(t, recreateGlusterObjects(context.Background(), "project", "u123456"))
+	// Existing objects are skipped
+	ok(t, recreateGlusterObjects(context.Background(), "project", "u123456"))
+
+	endpoints := fake.endpoints["project/glusterfs-cluster"]
+	equals(t, []EndpointAddress{{IP: "10.0.0.1"}}, endpoints.Subsets[0].Addresses)
+	assert(t, fake.services["project/glusterfs-cluster"] != nil, "Gluster service should be created")
+}
+
+// fakeGlusterAPI creates volumes for the default cluster and records the deleted volumes
+func fakeGlusterAPI(deleted *[]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sec/volume":
+			var cmd models.CreateVolumeCommand
+			json.NewDecoder(r.Body).Decode(&cmd)
+			json.NewEncoder(w).Encode(map[string]string{"message": cmd.Project + "_pv1"})
+		case "/sec/volume/delete":
+			var cmd models.DeleteVolumeCommand
+			json.NewDecoder(r.Body).Decode(&cmd)
+			*deleted = append(*deleted, cmd.LvName)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	clusters[0].Gluster.APIURL = server.URL
+	return server
+}
+
+func TestCreateNewVolume(t *testing.T) {
+	fake, _ := setupFake("u123456")
+	var deleted []string
+	server := fakeGlusterAPI(&deleted)
+	defer server.Close()
+
+	volume, err := createNewVolume(context.Background(), "project", "1G", "data", "ReadWriteOnce", "gluster", "u123456")
+	ok(t, err)
+	equals(t, "gl-project-pv1", volume.PvName)
+	equals(t, 5, len(volume.Steps))
+	for _, step := range volume.Steps {
+		equals(t, stepExecuted, step.Status)
+	}
+	assert(t, fake.pvs["gl-project-pv1"] != nil, "PV should be created")
+	assert(t, fake.pvcs["project"]["data"] != nil, "PVC should be created")
+	equals(t, 0, len(deleted))
+}
+
+func TestCreateNewVolumeRollback(t *testing.T) {
+	fake, _ := setupFake("u123456")
+	var deleted []string
+	server := fakeGlusterAPI(&deleted)
+	defer server.Close()
+	fake.failing["CreatePersistentVolumeClaim"] = errors.New("quota exceeded")
+
+	_, err := createNewVolume(context.Background(), "project", "1G", "data", "ReadWriteOnce", "gluster", "u123456")
+	equals(t, genericAPIError+". Rückgängig gemacht: Gluster-Volume erstellen, PV erstellen", err.Error())
+	assert(t, fake.pvs["gl-project-pv1"] == nil, "PV should be deleted")
+	equals(t, []string{"vol_project_pv1"}, deleted)
+	// The gluster objects are shared by the volumes of the project
+	assert(t, fake.services["project/glusterfs-cluster"] != nil, "Gluster service should be kept")
+}
+
+func TestSagaCompensationFailed(t *testing.T) {
+	s := newSaga(context.Background())
+	ok(t, s.run("first", func() error { return nil }, func() error { return errors.New("unreachable") }))
+	ok(t, s.run("second", func() error { return nil }, func() error { return nil }))
+
+	err := s.run("third", func() error { return errors.New("failed") }, nil)
+	equals(t, "failed. Rückgängig gemacht: second. Nicht rückgängig gemacht werden konnte: first. Bitte erstelle ein Ticket", err.Error())
+	equals(t, []common.VolumeStep{{Name: "first", Status: stepCompensationFailed}, {Name: "second", Status: stepCompensated}}, s.steps)
+}
+
+// fakeNfsAPI runs the create workflow of the default cluster, it is completed on the second status call
+// and returns the volume. The delete workflow records the deleted volumes and is completed at once.
+func fakeNfsAPI(volume string, deleted *[]string) *httptest.Server {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case fmt.Sprintf("/workflows/%v/jobs", apiCreateWorkflowUuid):
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(common.WorkflowJob{JobId: 1})
+		case fmt.Sprintf("/workflows/%v/jobs", apiDeleteWorkflowUuid):
+			var cmd common.WorkflowCommand
+			json.NewDecoder(r.Body).Decode(&cmd)
+			*deleted = append(*deleted, cmd.UserInputValues[0].Value)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(common.WorkflowJob{JobId: 2})
+		case "/workflows/jobs/2":
+			job := common.WorkflowJob{JobId: 2}
+			job.JobStatus.JobStatus = "COMPLETED"
+			json.NewEncoder(w).Encode(job)
+		case "/workflows/jobs/1":
+			calls++
+			job := common.WorkflowJob{JobId: 1}
+			job.JobStatus.JobStatus = "EXECUTING"
+			job.JobStatus.WorkflowExecutionProgress = common.WorkflowExecutionProgress{CurrentCommandIndex: 1, CommandsNumber: 2}
+			if calls > 1 {
+				job.JobStatus.JobStatus = "COMPLETED"
+				job.JobStatus.ReturnParameters = []common.WorkflowKeyValue{{Key: "'Server' + $Projectname", Value: volume}}
+			}
+			json.NewEncoder(w).Encode(job)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	clusters[0].Nfs.APIURL = server.URL
+	clusters[0].nfsClient = http.DefaultClient
+	return server
+}
+
+func TestNewNfsVolumeJob(t *testing.T) {
+	fake, router := setupFake("u123456")
+	router.GET("/api/jobs/:id", common.JobHandler)
+	fake.addProject("project", "u123456")
+	var deleted []string
+	server := fakeNfsAPI("nfs1:/vol/project_data", &deleted)
+	defer server.Close()
+	workflowPollInterval = time.Millisecond
+
+	body, _ := json.Marshal(common.NewVolumeCommand{
+		ProjectName: common.ProjectName{Project: "project"},
+		Size:        "10G",
+		PvcName:     "data",
+		Mode:        "ReadWriteMany",
+		Technology:  "nfs",
+	})
+	req := httptest.NewRequest("POST", "/api/ose/volume", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	equals(t, http.StatusAccepted, w.Code)
+	var res common.JobApiResponse
+	ok(t, json.Unmarshal(w.Body.Bytes(), &res))
+
+	var job common.Job
+	for i := 0; i < 100 && job.Status != common.JobDone && job.Status != common.JobFailed; i++ {
+		time.Sleep(10 * time.Millisecond)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/api/jobs/"+res.JobID, nil))
+		ok(t, json.Unmarshal(w.Body.Bytes(), &job))
+	}
+	equals(t, common.JobDone, job.Status)
+	equals(t, "volume-create", job.Type)
+	pv := fake.pvs["nfs-project-data"]
+	assert(t, pv != nil, "PV should be created")
+	equals(t, &NFSVolumeSource{Server: "nfs1", Path: "/vol/project_data"}, pv.Spec.NFS)
+}
+
+func TestCreateNfsVolumeRollback(t *testing.T) {
+	fake, _ := setupFake("u123456")
+	var deleted []string
+	server := fakeNfsAPI("unparsable", &deleted)
+	defer server.Close()
+	workflowPollInterval = time.Millisecond
+
+	// The workflow created the volume, even though its result can't be used
+	_, err := createNewVolume(context.Background(), "project", "10G", "data", "ReadWriteMany", "nfs", "u123456")
+	equals(t, genericAPIError+". Rückgängig gemacht: NFS-Volume erstellen", err.Error())
+	equals(t, []string{"vol_project-data"}, deleted)
+	assert(t, fake.pvs["nfs-project-data"] == nil, "No PV should be created")
+}
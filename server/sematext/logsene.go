@@ -2,15 +2,15 @@ package sematext
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/Jeffail/gabs"
 	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 	"io/ioutil"
-	"log"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
 )
@@ -26,22 +26,22 @@ func getLogseneAppsHandler(c *gin.Context) {
 	mail := common.GetUserMail(c)
 	username := common.GetUserName(c)
 
-	fmt.Sprintf("User %v listed all his sematext logsene apps", username)
+	common.Logger(c).WithField("user", username).Info("Listed the logsene apps of the user")
 
-	if appList, err := getAllLogseneAppsForUser(mail); err != nil {
-		c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
+	if appList, err := getAllLogseneAppsForUser(c, mail); err != nil {
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
 	} else {
 		c.JSON(http.StatusOK, appList)
 	}
 }
 
 func getLogseneDiscountcodeHandler(c *gin.Context) {
-	c.JSON(http.StatusOK, os.Getenv("LOGSENE_DISCOUNTCODE"))
+	c.JSON(http.StatusOK, config.DiscountCode)
 }
 
 func getLogsenePlansHandler(c *gin.Context) {
-	if plans, err := getAllLogsenePlans(); err != nil {
-		c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
+	if plans, err := getAllLogsenePlans(c); err != nil {
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
 	} else {
 		c.JSON(http.StatusOK, plans)
 	}
@@ -53,26 +53,26 @@ func updateLogsenePlanAndLimitHandler(c *gin.Context) {
 	appId, err := strconv.Atoi(c.Param("appId"))
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, common.ApiResponse{Message: wrongAPIUsageError})
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, wrongAPIUsageError))
 		return
 	}
 
 	var data common.EditSematextPlanCommand
 	if c.BindJSON(&data) == nil {
-		if err := validateLogsenePlanAndLimitEdit(mail, appId, data.PlanId, data.Limit); err != nil {
-			c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
+		if err := validateLogsenePlanAndLimitEdit(c, mail, appId, data.PlanId, data.Limit); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
 			return
 		}
 
-		if err := updateLogsenePlanAndLimit(username, data.PlanId, data.Limit, appId); err != nil {
-			c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
+		if err := updateLogsenePlanAndLimit(c, username, data.PlanId, data.Limit, appId); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
 		} else {
 			c.JSON(http.StatusOK, common.ApiResponse{
 				Message: "Der neue Plan & Limite wurden gespeichert.",
 			})
 		}
 	} else {
-		c.JSON(http.StatusBadRequest, common.ApiResponse{Message: wrongAPIUsageError})
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, wrongAPIUsageError))
 	}
 }
 
@@ -82,26 +82,26 @@ func updateLogseneBillingHandler(c *gin.Context) {
 	appId, err := strconv.Atoi(c.Param("appId"))
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, common.ApiResponse{Message: wrongAPIUsageError})
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, wrongAPIUsageError))
 		return
 	}
 
 	var data common.EditBillingDataCommand
 	if c.BindJSON(&data) == nil {
-		if err := validateLogseneBillingEdit(mail, appId, data.Project, data.Billing); err != nil {
-			c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
+		if err := validateLogseneBillingEdit(c, mail, appId, data.Project, data.Billing); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
 			return
 		}
 
-		if err := updateLogseneBilling(username, data.Billing, data.Project, appId); err != nil {
-			c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
+		if err := updateLogseneBilling(c, username, data.Billing, data.Project, appId); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
 		} else {
 			c.JSON(http.StatusOK, common.ApiResponse{
 				Message: fmt.Sprintf("Die Kontierungsdaten (%v / %v) wurden gespeichert.", data.Billing, data.Project),
 			})
 		}
 	} else {
-		c.JSON(http.StatusBadRequest, common.ApiResponse{Message: wrongAPIUsageError})
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, wrongAPIUsageError))
 	}
 }
 
@@ -111,24 +111,24 @@ func createLogseneAppHandler(c *gin.Context) {
 
 	var data common.CreateLogseneAppCommand
 	if c.BindJSON(&data) == nil {
-		if err := validateNewLogseneApp(data.AppName, data.PlanId, data.Limit, data.Project, data.Billing); err != nil {
-			c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
+		if err := validateNewLogseneApp(c, data.AppName, data.PlanId, data.Limit, data.Project, data.Billing); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
 			return
 		}
 
-		if err := createLogseneAppAndInviteUser(username, mail, data); err != nil {
-			c.JSON(http.StatusBadRequest, common.ApiResponse{Message: err.Error()})
+		if err := createLogseneAppAndInviteUser(c, username, mail, data); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorResponse(c, err.Error()))
 		} else {
 			c.JSON(http.StatusOK, common.ApiResponse{
 				Message: fmt.Sprintf("Die Logsene App (%v) wurde erstellt. %v wurde als Administrator eingeladen.", data.AppName, mail),
 			})
 		}
 	} else {
-		c.JSON(http.StatusBadRequest, common.ApiResponse{Message: wrongAPIUsageError})
+		c.JSON(http.StatusBadRequest, common.ErrorResponse(c, wrongAPIUsageError))
 	}
 }
 
-func validateNewLogseneApp(appName string, planId int, limit int, project string, billing string) error {
+func validateNewLogseneApp(ctx context.Context, appName string, planId int, limit int, project string, billing string) error {
 	if len(appName) == 0 {
 		return errors.New("App-Name muss angegeben werden!")
 	}
@@ -149,12 +149,12 @@ func validateNewLogseneApp(appName string, planId int, limit int, project string
 		return errors.New("Kontierungsnummer muss angegeben werden!")
 	}
 
-	return nil
+	return common.ValidateBilling(ctx, billing)
 }
 
-func validateLogseneBillingEdit(mail string, appId int, project string, billing string) error {
+func validateLogseneBillingEdit(ctx context.Context, mail string, appId int, project string, billing string) error {
 	// Check permissions
-	err := validateLogseneAppPermissions(mail, appId)
+	err := validateLogseneAppPermissions(ctx, mail, appId)
 	if err != nil {
 		return err
 	}
@@ -168,12 +168,12 @@ func validateLogseneBillingEdit(mail string, appId int, project string, billing
 		return errors.New("Die Kontierungsnummer muss angegeben werden!")
 	}
 
-	return nil
+	return common.ValidateBilling(ctx, billing)
 }
 
-func validateLogsenePlanAndLimitEdit(mail string, appId int, planId int, limit int) error {
+func validateLogsenePlanAndLimitEdit(ctx context.Context, mail string, appId int, planId int, limit int) error {
 	// Check permissions
-	err := validateLogseneAppPermissions(mail, appId)
+	err := validateLogseneAppPermissions(ctx, mail, appId)
 	if err != nil {
 		return err
 	}
@@ -190,8 +190,8 @@ func validateLogsenePlanAndLimitEdit(mail string, appId int, planId int, limit i
 	return nil
 }
 
-func validateLogseneAppPermissions(mail string, appId int) error {
-	userApps, err := getAllLogseneAppsForUser(mail)
+func validateLogseneAppPermissions(ctx context.Context, mail string, appId int) error {
+	userApps, err := getAllLogseneAppsForUser(ctx, mail)
 
 	if err != nil {
 		return err
@@ -206,8 +206,8 @@ func validateLogseneAppPermissions(mail string, appId int) error {
 	return errors.New(noAccessError)
 }
 
-func getAllLogseneAppsForUser(userMail string) ([]common.SematextAppList, error) {
-	appData, err := getAllLogseneApps()
+func getAllLogseneAppsForUser(ctx context.Context, userMail string) ([]common.SematextAppList, error) {
+	appData, err := getAllLogseneApps(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -215,7 +215,7 @@ func getAllLogseneAppsForUser(userMail string) ([]common.SematextAppList, error)
 	// Filter apps where user has an active role
 	allApps, err := appData.Path("data.apps").Children()
 	if err != nil {
-		log.Println("error getting data inside json", err.Error())
+		common.Logger(ctx).WithError(err).Error("Error getting data inside json")
 		return nil, errors.New(genericAPIError)
 	}
 
@@ -224,7 +224,7 @@ func getAllLogseneAppsForUser(userMail string) ([]common.SematextAppList, error)
 		appName := app.Path("name").Data().(string)
 		userRoles, err := app.Path("userRoles").Children()
 		if err != nil {
-			log.Println("userRoles not found for current app: ", appName)
+			common.Logger(ctx).WithField("app", appName).Info("UserRoles not found for current app")
 			continue
 		}
 
@@ -257,13 +257,13 @@ func getAllLogseneAppsForUser(userMail string) ([]common.SematextAppList, error)
 	return userApps, nil
 }
 
-func getAllLogsenePlans() ([]common.SematextLogsenePlan, error) {
-	client, req := getSematextHTTPClient("GET", "users-web/api/v3/billing/availablePlans?appType=Logsene", nil)
+func getAllLogsenePlans(ctx context.Context) ([]common.SematextLogsenePlan, error) {
+	client, req := getSematextHTTPClient(ctx, "GET", "users-web/api/v3/billing/availablePlans?appType=Logsene", nil)
 
 	resp, err := client.Do(req)
 
 	if err != nil {
-		log.Println("Error from Sematext API: ", err.Error())
+		common.Logger(ctx).WithError(err).Error("Error from Sematext API")
 		return nil, errors.New(genericAPIError)
 	}
 
@@ -271,23 +271,23 @@ func getAllLogsenePlans() ([]common.SematextLogsenePlan, error) {
 
 	json, err := gabs.ParseJSONBuffer(resp.Body)
 	if err != nil {
-		log.Println("error parsing body of response:", err)
+		common.Logger(ctx).WithError(err).Error("Error parsing body of response")
 		return nil, errors.New(genericAPIError)
 	}
 
 	// Map response
 	allPlans, err := json.Path("data.availablePlans").Children()
 	if err != nil {
-		log.Println("error getting data inside json", err.Error())
+		common.Logger(ctx).WithError(err).Error("Error getting data inside json")
 		return nil, errors.New(genericAPIError)
 	}
 
 	plans := []common.SematextLogsenePlan{}
 	for _, plan := range allPlans {
 		plans = append(plans, common.SematextLogsenePlan{
-			PlanId: int(plan.Path("id").Data().(float64)),
-			Name:   plan.Path("name").Data().(string),
-			IsFree: plan.Path("free").Data().(bool),
+			PlanId:                     int(plan.Path("id").Data().(float64)),
+			Name:                       plan.Path("name").Data().(string),
+			IsFree:                     plan.Path("free").Data().(bool),
 			DefaultDailyMaxLimitSizeMb: plan.Path("defaultDailyMaxLimitSizeMb").Data().(float64),
 			PricePerMonth:              round(30*plan.Path("pricePerDay").Data().(float64), 0.05),
 		})
@@ -300,13 +300,13 @@ func round(x, unit float64) float64 {
 	return float64(int64(x/unit+0.5)) * unit
 }
 
-func getAllLogseneApps() (*gabs.Container, error) {
-	client, req := getSematextHTTPClient("GET", "users-web/api/v3/apps/users", nil)
+func getAllLogseneApps(ctx context.Context) (*gabs.Container, error) {
+	client, req := getSematextHTTPClient(ctx, "GET", "users-web/api/v3/apps/users", nil)
 
 	resp, err := client.Do(req)
 
 	if err != nil {
-		log.Println("Error from Sematext API: ", err.Error())
+		common.Logger(ctx).WithError(err).Error("Error from Sematext API")
 		return nil, errors.New(genericAPIError)
 	}
 
@@ -314,37 +314,43 @@ func getAllLogseneApps() (*gabs.Container, error) {
 
 	json, err := gabs.ParseJSONBuffer(resp.Body)
 	if err != nil {
-		log.Println("error parsing body of response:", err)
+		common.Logger(ctx).WithError(err).Error("Error parsing body of response")
 		return nil, errors.New(genericAPIError)
 	}
 
 	return json, nil
 }
 
-func createLogseneAppAndInviteUser(username string, mail string, data common.CreateLogseneAppCommand) error {
-	appId, err := createLogseneApp(username, data)
+func createLogseneAppAndInviteUser(ctx context.Context, username string, mail string, data common.CreateLogseneAppCommand) error {
+	appId, err := createLogseneApp(ctx, username, data)
 	if err != nil {
 		return err
 	}
 
-	if err := updateLogsenePlanAndLimit(username, data.PlanId, data.Limit, appId); err != nil {
+	if err := updateLogsenePlanAndLimit(ctx, username, data.PlanId, data.Limit, appId); err != nil {
 		return err
 	}
 
-	if err := updateLogseneBilling(username, data.Billing, data.Project, appId); err != nil {
+	if err := updateLogseneBilling(ctx, username, data.Billing, data.Project, appId); err != nil {
 		return err
 	}
 
-	if err := inviteUserToApp(mail, appId); err != nil {
+	if err := inviteUserToApp(ctx, mail, appId); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func createLogseneApp(username string, data common.CreateLogseneAppCommand) (int, error) {
-	fmt.Sprintf("User %v creates a new logsene app, name: %v, planId: %v, limit: %v, project: %v, billing: %v",
-		username, data.AppName, data.PlanId, data.Limit, data.Project, data.Billing)
+func createLogseneApp(ctx context.Context, username string, data common.CreateLogseneAppCommand) (int, error) {
+	common.Logger(ctx).WithFields(logrus.Fields{
+		"user":    username,
+		"app":     data.AppName,
+		"plan":    data.PlanId,
+		"limit":   data.Limit,
+		"project": data.Project,
+		"billing": data.Billing,
+	}).Info("Creating a new logsene app")
 
 	j := gabs.New()
 	j.Set(data.AppName, "name")
@@ -352,11 +358,11 @@ func createLogseneApp(username string, data common.CreateLogseneAppCommand) (int
 	j.Set(data.DiscountCode, "discountCode")
 	j.Set("Logsene", "appType")
 
-	client, req := getSematextHTTPClient("POST", "logsene-reports/api/v3/apps", bytes.NewReader(j.Bytes()))
+	client, req := getSematextHTTPClient(ctx, "POST", "logsene-reports/api/v3/apps", bytes.NewReader(j.Bytes()))
 	resp, err := client.Do(req)
 
 	if err != nil {
-		log.Println("Error from Sematext API: ", err.Error())
+		common.Logger(ctx).WithError(err).Error("Error from Sematext API")
 		return -1, errors.New(genericAPIError)
 	}
 
@@ -365,20 +371,20 @@ func createLogseneApp(username string, data common.CreateLogseneAppCommand) (int
 	if resp.StatusCode == http.StatusOK {
 		resJson, err := gabs.ParseJSONBuffer(resp.Body)
 		if err != nil {
-			log.Println("Error parsing app creation response from sematext: ", err.Error())
+			common.Logger(ctx).WithError(err).Error("Error parsing app creation response from sematext")
 			return -1, errors.New(genericAPIError)
 		}
 
 		newApp, err := resJson.Path("data.apps").Children()
 		if err != nil {
-			log.Println("Error getting data inside json", err.Error())
+			common.Logger(ctx).WithError(err).Error("Error getting data inside json")
 			return -1, errors.New(genericAPIError)
 		}
 
 		return int(newApp[0].Path("id").Data().(float64)), nil
 	} else {
 		bodyBytes, _ := ioutil.ReadAll(resp.Body)
-		log.Println("CreateLogseneApp: Sematext response status code was: ", resp.StatusCode, string(bodyBytes))
+		common.Logger(ctx).WithFields(logrus.Fields{"status": resp.StatusCode, "response": string(bodyBytes)}).Info("CreateLogseneApp: Sematext response status code was")
 
 		if strings.Contains(string(bodyBytes), "alreadyExist") {
 			return -1, errors.New("Eine Anwendung mit diesem Namen existiert bereits")
@@ -388,8 +394,8 @@ func createLogseneApp(username string, data common.CreateLogseneAppCommand) (int
 	return -1, errors.New(genericAPIError)
 }
 
-func inviteUserToApp(mail string, appId int) error {
-	fmt.Sprintf("Inviting %v to logsene app %v.", mail, appId)
+func inviteUserToApp(ctx context.Context, mail string, appId int) error {
+	common.Logger(ctx).WithFields(logrus.Fields{"mail": mail, "app": appId}).Info("Inviting user to logsene app")
 
 	j := gabs.New()
 	j.Set(mail, "inviteeEmail")
@@ -400,11 +406,11 @@ func inviteUserToApp(mail string, appId int) error {
 	j.Array("apps")
 	j.ArrayAppend(newAppId.Data(), "apps")
 
-	client, req := getSematextHTTPClient("POST", "users-web/api/v3/apps/guests", bytes.NewReader(j.Bytes()))
+	client, req := getSematextHTTPClient(ctx, "POST", "users-web/api/v3/apps/guests", bytes.NewReader(j.Bytes()))
 	resp, err := client.Do(req)
 
 	if err != nil {
-		log.Println("Error from Sematext API: ", err.Error())
+		common.Logger(ctx).WithError(err).Error("Error from Sematext API")
 		return errors.New(genericAPIError)
 	}
 
@@ -415,22 +421,22 @@ func inviteUserToApp(mail string, appId int) error {
 	}
 
 	bodyBytes, _ := ioutil.ReadAll(resp.Body)
-	log.Println("InviteUserToApp: Sematext response status code was: ", resp.StatusCode, string(bodyBytes))
+	common.Logger(ctx).WithFields(logrus.Fields{"status": resp.StatusCode, "response": string(bodyBytes)}).Info("InviteUserToApp: Sematext response status code was")
 
 	return errors.New(genericAPIError)
 }
 
-func updateLogseneBilling(username string, billing string, project string, appId int) error {
-	fmt.Sprintf("User %v updated logsene app billing to %v / %v.", username, billing, project)
+func updateLogseneBilling(ctx context.Context, username string, billing string, project string, appId int) error {
+	common.Logger(ctx).WithFields(logrus.Fields{"user": username, "billing": billing, "project": project}).Info("Updated logsene app billing")
 
 	j := gabs.New()
 	j.Set(billing+" / "+project, "description")
 
-	client, req := getSematextHTTPClient("PUT", "users-web/api/v3/apps/"+strconv.Itoa(appId), bytes.NewReader(j.Bytes()))
+	client, req := getSematextHTTPClient(ctx, "PUT", "users-web/api/v3/apps/"+strconv.Itoa(appId), bytes.NewReader(j.Bytes()))
 	resp, err := client.Do(req)
 
 	if err != nil {
-		log.Println("Error from Sematext API: ", err.Error())
+		common.Logger(ctx).WithError(err).Error("Error from Sematext API")
 		return errors.New(genericAPIError)
 	}
 
@@ -441,34 +447,34 @@ func updateLogseneBilling(username string, billing string, project string, appId
 	}
 
 	bodyBytes, _ := ioutil.ReadAll(resp.Body)
-	log.Println("UpdateLogseneBilling: Sematext response status code was: ", resp.StatusCode, string(bodyBytes))
+	common.Logger(ctx).WithFields(logrus.Fields{"status": resp.StatusCode, "response": string(bodyBytes)}).Info("UpdateLogseneBilling: Sematext response status code was")
 
 	return errors.New(genericAPIError)
 }
 
-func updateLogsenePlanAndLimit(username string, planId int, limit int, appId int) error {
-	if err := updateLogsenePlan(username, planId, appId); err != nil {
+func updateLogsenePlanAndLimit(ctx context.Context, username string, planId int, limit int, appId int) error {
+	if err := updateLogsenePlan(ctx, username, planId, appId); err != nil {
 		return err
 	}
 
-	if err := updateLogseneLimit(username, limit, appId); err != nil {
+	if err := updateLogseneLimit(ctx, username, limit, appId); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func updateLogseneLimit(username string, limit int, appId int) error {
-	fmt.Sprintf("User %v updated logsene app limit to: %v", username, limit)
+func updateLogseneLimit(ctx context.Context, username string, limit int, appId int) error {
+	common.Logger(ctx).WithFields(logrus.Fields{"user": username, "limit": limit}).Info("Updated logsene app limit")
 
 	j := gabs.New()
 	j.Set(limit, "maxLimitMB")
 
-	client, req := getSematextHTTPClient("PUT", "users-web/api/v3/apps/"+strconv.Itoa(appId), bytes.NewReader(j.Bytes()))
+	client, req := getSematextHTTPClient(ctx, "PUT", "users-web/api/v3/apps/"+strconv.Itoa(appId), bytes.NewReader(j.Bytes()))
 	resp, err := client.Do(req)
 
 	if err != nil {
-		log.Println("Error from Sematext API: ", err.Error())
+		common.Logger(ctx).WithError(err).Error("Error from Sematext API")
 		return errors.New(genericAPIError)
 	}
 
@@ -479,22 +485,22 @@ func updateLogseneLimit(username string, limit int, appId int) error {
 	}
 
 	bodyBytes, _ := ioutil.ReadAll(resp.Body)
-	log.Println("UpdateLogseneLimit: Sematext response status code was: ", resp.StatusCode, string(bodyBytes))
+	common.Logger(ctx).WithFields(logrus.Fields{"status": resp.StatusCode, "response": string(bodyBytes)}).Info("UpdateLogseneLimit: Sematext response status code was")
 
 	return errors.New(genericAPIError)
 }
 
-func updateLogsenePlan(username string, planId int, appId int) error {
-	fmt.Sprintf("User %v updated logsene app plan to planId: %v", username, planId)
+func updateLogsenePlan(ctx context.Context, username string, planId int, appId int) error {
+	common.Logger(ctx).WithFields(logrus.Fields{"user": username, "plan": planId}).Info("Updated logsene app plan")
 
 	j := gabs.New()
 	j.Set(planId, "planId")
 
-	client, req := getSematextHTTPClient("PUT", "users-web/api/v3/billing/info/"+strconv.Itoa(appId), bytes.NewReader(j.Bytes()))
+	client, req := getSematextHTTPClient(ctx, "PUT", "users-web/api/v3/billing/info/"+strconv.Itoa(appId), bytes.NewReader(j.Bytes()))
 	resp, err := client.Do(req)
 
 	if err != nil {
-		log.Println("Error from Sematext API: ", err.Error())
+		common.Logger(ctx).WithError(err).Error("Error from Sematext API")
 		return errors.New(genericAPIError)
 	}
 
@@ -505,7 +511,7 @@ func updateLogsenePlan(username string, planId int, appId int) error {
 	}
 
 	bodyBytes, _ := ioutil.ReadAll(resp.Body)
-	log.Println("UpdateLogsenePlan: Sematext response status code was: ", resp.StatusCode, string(bodyBytes))
+	common.Logger(ctx).WithFields(logrus.Fields{"status": resp.StatusCode, "response": string(bodyBytes)}).Info("UpdateLogsenePlan: Sematext response status code was")
 
 	return errors.New(genericAPIError)
 }
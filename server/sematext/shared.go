@@ -1,10 +1,9 @@
 package sematext
 
 import (
+	"context"
 	"io"
-	"log"
 	"net/http"
-	"os"
 
 	"github.com/SchweizerischeBundesbahnen/ssp-backend/server/common"
 	"github.com/gin-gonic/gin"
@@ -15,35 +14,43 @@ const (
 	wrongAPIUsageError = "Invalid api call - parameters did not match to method definition"
 )
 
-func RegisterRoutes(r *gin.RouterGroup) {
+// config is the Sematext section of the configuration, set by RegisterRoutes
+var config common.SematextConfig
+
+// sematextClient is the http client of the Sematext api, set by RegisterRoutes
+var sematextClient *http.Client
+
+// RegisterRoutes registers the routes for Sematext
+func RegisterRoutes(r *gin.RouterGroup, cfg common.SematextConfig) error {
+	config = cfg
+
+	var err error
+	if sematextClient, err = common.NewHTTPClient("sematext", cfg.HTTPClientConfig); err != nil {
+		return err
+	}
+
 	r.GET("/sematext/plans", getLogsenePlansHandler)
 	r.GET("/sematext/discountcode", getLogseneDiscountcodeHandler)
 	r.GET("/sematext/logsene", getLogseneAppsHandler)
 	r.POST("/sematext/logsene", createLogseneAppHandler)
 	r.POST("/sematext/logsene/:appId", updateLogseneBillingHandler)
 	r.POST("/sematext/logsene/:appId/plan", updateLogsenePlanAndLimitHandler)
+	return nil
 }
 
-func getSematextHTTPClient(method string, urlPart string, body io.Reader) (*http.Client, *http.Request) {
-	token := os.Getenv("SEMATEXT_API_TOKEN")
-	baseUrl := os.Getenv("SEMATEXT_BASE_URL")
-	if len(token) == 0 || len(baseUrl) == 0 {
-		log.Fatal("Env variables 'SEMATEXT_API_TOKEN' and 'SEMATEXT_BASE_URL' must be specified")
-	}
-
+func getSematextHTTPClient(ctx context.Context, method string, urlPart string, body io.Reader) (*http.Client, *http.Request) {
+	baseUrl := config.BaseURL
 	if !strings.HasSuffix(baseUrl, "/") {
 		baseUrl += "/"
 	}
 
-	client := &http.Client{}
 	req, _ := http.NewRequest(method, baseUrl+urlPart, body)
 
-	if common.DebugMode() {
-		log.Println("Calling ", req.URL.String())
-	}
+	common.Logger(ctx).WithField("url", req.URL.String()).Debug("Calling backend")
+	common.SetRequestIDHeader(ctx, req)
 
 	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Authorization", "apiKey "+token)
+	req.Header.Add("Authorization", "apiKey "+config.APIToken)
 
-	return client, req
+	return sematextClient, req
 }